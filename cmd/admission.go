@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/OpusCapita/buhtig-s8k/pkg/admission"
+	"github.com/OpusCapita/buhtig-s8k/pkg/github"
+)
+
+// modes of validating admission webhook
+const (
+	admissionValidationOff  = "off"
+	admissionValidationWarn = "warn"
+	admissionValidationDeny = "deny"
+)
+
+// audit annotation where warning about invalid namespace is put in "warn" mode, API server prefixes it with name of webhook
+const admissionWarningAuditAnnotation = "warning"
+
+// admissionSettings configure listener of admission webhooks
+type admissionSettings struct {
+	// addr of HTTPS listener, empty value disables it
+	addr     string
+	certFile string
+	keyFile  string
+	// validation is one of admissionValidation* modes
+	validation string
+	// sourceURLTemplate and helmReleaseTemplate are Go templates of annotations set by mutating webhook,
+	// it's disabled if both are empty
+	sourceURLTemplate   string
+	helmReleaseTemplate string
+}
+
+var admissionReviewsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "admission_reviews_total",
+	Help:      "Number of namespaces reviewed by admission webhooks, by webhook and result.",
+}, []string{"webhook", "result"})
+
+func init() {
+	prometheus.MustRegister(admissionReviewsCounter)
+}
+
+// admissionMux is a router of admission webhooks listener
+var admissionMux = http.NewServeMux()
+
+// startAdmissionServer starts HTTPS listener of admission webhooks, API server accepts only TLS endpoints
+func startAdmissionServer(settings admissionSettings) {
+	if settings.addr == "" {
+		return
+	}
+	if settings.validation != admissionValidationOff {
+		admissionMux.Handle("/validate/namespaces", admission.Serve(func(req *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+			return validateNamespace(req, settings.validation)
+		}))
+	}
+	if settings.sourceURLTemplate != "" || settings.helmReleaseTemplate != "" {
+		admissionMux.Handle("/mutate/namespaces", admission.Serve(func(req *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+			return annotateNamespace(req, settings)
+		}))
+	}
+
+	go func() {
+		log.Info("Starting admission webhooks listener on " + settings.addr)
+		if err := http.ListenAndServeTLS(settings.addr, settings.certFile, settings.keyFile, admissionMux); err != nil {
+			log.Error("Admission webhooks listener failed")
+			log.Error(err)
+		}
+	}()
+}
+
+// isTracked checks if namespace is labeled for tracking by the app
+func isTracked(k8sNs *corev1.Namespace) bool {
+	selector, err := labels.Parse(labelSelector)
+	return err == nil && selector.Matches(labels.Set(k8sNs.Labels))
+}
+
+// sourceURLProblem describes what's wrong with source URL of namespace, it's empty if URL can be checked
+func sourceURLProblem(ns *namespace) string {
+	sourceURL, ok := ns.ObjectMeta.Annotations[githubURLAnnotationName]
+	if !ok || sourceURL == "" {
+		return fmt.Sprintf("annotation '%s' is missing", githubURLAnnotationName)
+	}
+	if u, err := url.Parse(sourceURL); err != nil || !u.IsAbs() || u.Host == "" {
+		return fmt.Sprintf("annotation '%s' should be absolute URL of branch, got '%s'", githubURLAnnotationName, sourceURL)
+	}
+	provider, err := lookupProvider(ns, sourceURL)
+	if err != nil {
+		return fmt.Sprintf("annotation '%s' doesn't point to known VCS provider: %v", githubURLAnnotationName, err)
+	}
+	if provider.Name() == "github" {
+		if _, _, _, err := github.ParseBranchURL(sourceURL); err != nil {
+			return fmt.Sprintf("annotation '%s' should be like https://github.com/OWNER/REPO/tree/BRANCH, got '%s'", githubURLAnnotationName, sourceURL)
+		}
+	}
+	return ""
+}
+
+// validateNamespace reviews tracked namespace when it's created or when its tracking label or source URL is changed,
+// namespace with missing or malformed source URL is rejected in "deny" mode and admitted with warning in "warn" mode
+func validateNamespace(req *admissionv1beta1.AdmissionRequest, mode string) *admissionv1beta1.AdmissionResponse {
+	if req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update {
+		return admission.Allow()
+	}
+	k8sNs := corev1.Namespace{}
+	if err := json.Unmarshal(req.Object.Raw, &k8sNs); err != nil {
+		log.WithField("namespace", req.Name).WithError(err).Error("Failed to decode namespace under review")
+		return admission.Allow()
+	}
+	if !isTracked(&k8sNs) {
+		return admission.Allow()
+	}
+	if req.Operation == admissionv1beta1.Update {
+		old := corev1.Namespace{}
+		if err := json.Unmarshal(req.OldObject.Raw, &old); err == nil && isTracked(&old) &&
+			old.Annotations[githubURLAnnotationName] == k8sNs.Annotations[githubURLAnnotationName] {
+			return admission.Allow()
+		}
+	}
+
+	ns := newNamespace(k8sNs)
+	problem := sourceURLProblem(ns)
+	if problem == "" {
+		admissionReviewsCounter.WithLabelValues("validate", "valid").Inc()
+		return admission.Allow()
+	}
+	message := fmt.Sprintf("Namespace is labeled '%s' but %s, its branch can't be checked", labelSelector, problem)
+	if mode == admissionValidationDeny {
+		ns.logger().Info("Rejected namespace: " + message)
+		admissionReviewsCounter.WithLabelValues("validate", "denied").Inc()
+		return admission.Deny(message)
+	}
+	ns.logger().Warn("Admitted invalid namespace: " + message)
+	admissionReviewsCounter.WithLabelValues("validate", "warned").Inc()
+	response := admission.Allow()
+	response.AuditAnnotations = map[string]string{admissionWarningAuditAnnotation: message}
+	return response
+}
+
+// derivedAnnotations renders templates of annotations which namespace doesn't have yet; helm release is rendered
+// after source URL, so that its template can refer to .Owner, .Repo and .Branch derived from source URL
+func derivedAnnotations(ns *namespace, settings admissionSettings) (map[string]string, error) {
+	derived := map[string]string{}
+	for _, a := range []struct{ name, template string }{
+		{githubURLAnnotationName, settings.sourceURLTemplate},
+		{helmReleaseAnnotationName, settings.helmReleaseTemplate},
+	} {
+		if _, ok := ns.ObjectMeta.Annotations[a.name]; ok || a.template == "" {
+			continue
+		}
+		value, err := renderTemplate(a.template, newTemplateData(ns))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to render annotation '%s': %v", a.name, err)
+		}
+		// template may opt out of some namespaces by rendering nothing
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		derived[a.name] = value
+		metav1.SetMetaDataAnnotation(&ns.ObjectMeta, a.name, value)
+	}
+	return derived, nil
+}
+
+// annotateNamespace sets annotations derived from name and labels of tracked namespace which is created or updated,
+// annotations which are already set aren't changed
+func annotateNamespace(req *admissionv1beta1.AdmissionRequest, settings admissionSettings) *admissionv1beta1.AdmissionResponse {
+	if req.Operation != admissionv1beta1.Create && req.Operation != admissionv1beta1.Update {
+		return admission.Allow()
+	}
+	k8sNs := corev1.Namespace{}
+	if err := json.Unmarshal(req.Object.Raw, &k8sNs); err != nil {
+		log.WithField("namespace", req.Name).WithError(err).Error("Failed to decode namespace under review")
+		return admission.Allow()
+	}
+	if !isTracked(&k8sNs) {
+		return admission.Allow()
+	}
+	// name isn't set yet if it's generated by API server
+	if k8sNs.Name == "" {
+		k8sNs.Name = req.Name
+	}
+
+	ns := newNamespace(k8sNs)
+	hadAnnotations := ns.ObjectMeta.Annotations != nil
+	derived, err := derivedAnnotations(ns, settings)
+	if err != nil {
+		ns.logger().Error(err)
+		admissionReviewsCounter.WithLabelValues("mutate", "failed").Inc()
+		return admission.Allow()
+	}
+	if len(derived) == 0 {
+		admissionReviewsCounter.WithLabelValues("mutate", "unchanged").Inc()
+		return admission.Allow()
+	}
+
+	ops := []admission.PatchOperation{}
+	if !hadAnnotations {
+		ops = append(ops, admission.PatchOperation{Op: "add", Path: "/metadata/annotations", Value: derived})
+	} else {
+		for name, value := range derived {
+			ops = append(ops, admission.PatchOperation{Op: "add", Path: "/metadata/annotations/" + admission.EscapePathSegment(name), Value: value})
+		}
+	}
+	response, err := admission.Patch(ops)
+	if err != nil {
+		ns.logger().Error(err)
+		admissionReviewsCounter.WithLabelValues("mutate", "failed").Inc()
+		return admission.Allow()
+	}
+	ns.logger().WithField("annotations", derived).Info("Annotated namespace")
+	admissionReviewsCounter.WithLabelValues("mutate", "annotated").Inc()
+	return response
+}
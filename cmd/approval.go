@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// approvalSettings configure manual approval of deletions
+type approvalSettings struct {
+	required bool
+	// expiry is how long candidate waits for approval before it's returned back to normal
+	expiry time.Duration
+	// slack asks for approval in Slack channel, it's nil if Slack isn't configured
+	slack *slackApprovals
+}
+
+// PendingApprovalSince returns time since which namespace waits for approval, it's zero if it doesn't
+func (ns *namespace) PendingApprovalSince() time.Time {
+	since, err := time.Parse(time.RFC3339, ns.ObjectMeta.Annotations[pendingApprovalAnnotationName])
+	if err != nil {
+		return time.Time{}
+	}
+	return since
+}
+
+// ApprovedBy returns who approved deletion of namespace, it's empty if deletion isn't approved
+func (ns *namespace) ApprovedBy() string {
+	approvedBy := strings.TrimSpace(ns.ObjectMeta.Annotations[approvedByAnnotationName])
+	if approvedBy == "false" {
+		return ""
+	}
+	return approvedBy
+}
+
+// RejectedBy returns who rejected deletion of namespace, it's empty if deletion isn't rejected
+func (ns *namespace) RejectedBy() string {
+	return strings.TrimSpace(ns.ObjectMeta.Annotations[rejectedByAnnotationName])
+}
+
+// approvalState lists annotations of approval workflow, they're reset when branch is found again
+var approvalState = []string{pendingApprovalAnnotationName, approvalExpiredAnnotationName, approvedByAnnotationName, rejectedByAnnotationName}
+
+// approveNamespace approves deletion of namespace waiting for approval on behalf of approver
+func approveNamespace(k8sClient kubernetes.Interface, name, approver string) error {
+	k8sNs, err := k8sClient.CoreV1().Namespaces().Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	ns := newNamespace(*k8sNs)
+	if ns.PendingApprovalSince().IsZero() && ns.ObjectMeta.Annotations[approvalExpiredAnnotationName] == "" && ns.RejectedBy() == "" {
+		return fmt.Errorf("Namespace %s doesn't wait for approval", name)
+	}
+	err = ns.patchAnnotations(k8sClient, map[string]*string{approvedByAnnotationName: &approver})
+	auditAction(ns, "approve-deletion", err, map[string]string{"approver": approver})
+	if err == nil {
+		ns.logger().Info("Deletion is approved by " + approver)
+	}
+	return err
+}
+
+// rejectNamespace rejects deletion of namespace waiting for approval on behalf of rejecter, namespace is left alone
+// the same way as if approval expired
+func rejectNamespace(k8sClient kubernetes.Interface, name, rejecter string) error {
+	k8sNs, err := k8sClient.CoreV1().Namespaces().Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	ns := newNamespace(*k8sNs)
+	if ns.PendingApprovalSince().IsZero() {
+		return fmt.Errorf("Namespace %s doesn't wait for approval", name)
+	}
+	err = ns.patchAnnotations(k8sClient, map[string]*string{pendingApprovalAnnotationName: nil, rejectedByAnnotationName: &rejecter})
+	auditAction(ns, "reject-deletion", err, map[string]string{"rejecter": rejecter})
+	if err == nil {
+		ns.logger().Info("Deletion is rejected by " + rejecter)
+	}
+	return err
+}
+
+// registerApprovalHandlers exposes 'POST /approve?namespace=NAME' on admin listener
+func registerApprovalHandlers(k8sClient kubernetes.Interface) {
+	adminMux.HandleFunc("/approve", serveApprove(k8sClient))
+}
+
+// serveApprove approves deletion on behalf of holder of admin token, who is recorded as 'admin-api:NAME' the same
+// way as Slack users are
+func serveApprove(k8sClient kubernetes.Interface) http.HandlerFunc {
+	return requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := r.URL.Query().Get("namespace")
+		if name == "" {
+			http.Error(w, "namespace is required", http.StatusBadRequest)
+			return
+		}
+		caller, _ := adminCaller(r)
+		if err := approveNamespace(k8sClient, name, "admin-api:"+caller); err != nil {
+			status := http.StatusConflict
+			if errors.IsNotFound(err) {
+				status = http.StatusNotFound
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		fmt.Fprintln(w, "approved")
+	})
+}
+
+// isApprovedIfNeeded requires human approval of deletion: candidate is marked as pending approval and it's deleted only
+// once somebody sets 'opuscapita.com/deletion-approved-by' annotation (or calls admin API). Candidate which isn't approved
+// in time expires back to normal, i.e. it's left alone until it's approved or its branch is found again.
+func isApprovedIfNeeded(k8sClient kubernetes.Interface, settings approvalSettings) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if !settings.required || len(ns.CompletedSteps()) > 0 {
+			return true
+		}
+		logger := ns.logger()
+
+		if approvedBy := ns.ApprovedBy(); approvedBy != "" {
+			logger.Info("Deletion is approved by " + approvedBy)
+			return true
+		}
+		if ns.ObjectMeta.Annotations[approvalExpiredAnnotationName] != "" {
+			logger.Debug("Approval of deletion has expired, namespace is left alone")
+			return false
+		}
+		if rejectedBy := ns.RejectedBy(); rejectedBy != "" {
+			logger.Debug("Deletion is rejected by " + rejectedBy + ", namespace is left alone")
+			return false
+		}
+
+		since := ns.PendingApprovalSince()
+		if since.IsZero() {
+			now := time.Now().UTC().Format(time.RFC3339)
+			if err := ns.patchAnnotations(k8sClient, map[string]*string{pendingApprovalAnnotationName: &now}); err != nil {
+				logger.Error(err)
+				return false
+			}
+			logger.Info(fmt.Sprintf("Namespace is waiting for approval of deletion, set annotation '%s' to approve it", approvedByAnnotationName))
+			if settings.slack != nil {
+				if err := settings.slack.requestApproval(ns); err != nil {
+					logger.Error("Failed to ask for approval in Slack")
+					logger.Error(err)
+				}
+			}
+			return false
+		}
+
+		if time.Since(since) > settings.expiry {
+			expired := time.Now().UTC().Format(time.RFC3339)
+			if err := ns.patchAnnotations(k8sClient, map[string]*string{pendingApprovalAnnotationName: nil, approvalExpiredAnnotationName: &expired}); err != nil {
+				logger.Error(err)
+				return false
+			}
+			logger.WithField("expiry", settings.expiry.String()).Info("Deletion wasn't approved in time, namespace is returned back to normal")
+			return false
+		}
+
+		logger.WithField("since", since.Format(time.RFC3339)).Debug("Namespace is waiting for approval of deletion")
+		return false
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	archive "github.com/OpusCapita/buhtig-s8k/pkg/archive"
+	aws "github.com/OpusCapita/buhtig-s8k/pkg/aws"
+)
+
+// archiveTimeFormat is used in names of archives, e.g. 'preview-a/20190702T150405Z.tar.gz'
+const archiveTimeFormat = "20060102T150405Z"
+
+// archiver exports namespaces to object storage
+type archiver struct {
+	exporter *archive.Exporter
+	storage  archive.Storage
+	prefix   string
+}
+
+// newArchiver returns archiver configured by config file or nil if archiving isn't configured; it exits on misconfiguration
+func newArchiver(k8sClient kubernetes.Interface, config *rest.Config, target *archiveTarget) *archiver {
+	if target == nil {
+		return nil
+	}
+
+	var storage archive.Storage
+	switch target.Type {
+	case "s3":
+		region := target.Region
+		if region == "" {
+			region = aws.Region()
+		}
+		if region == "" {
+			log.Fatal(fmt.Sprintf("Region of S3 bucket %s isn't configured", target.Bucket))
+		}
+		sess, err := aws.NewSession()
+		if err != nil {
+			log.Fatal(err)
+		}
+		storage = archive.NewS3(sess, target.Bucket, region)
+	case "gcs":
+		gcs, err := archive.NewGCS(target.Bucket, os.Getenv(target.CredentialsFileEnv))
+		if err != nil {
+			log.Fatal(err)
+		}
+		storage = gcs
+	default:
+		log.Fatal(fmt.Sprintf("Unknown archive storage type '%s'", target.Type))
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exporter := archive.NewExporter(k8sClient.Discovery(), dynamicClient)
+	exporter.IncludeSecrets = target.IncludeSecrets
+	return &archiver{exporter: exporter, storage: storage, prefix: target.Prefix}
+}
+
+// archiveKey returns key of namespace archive in storage
+func archiveKey(prefix, ns string, now time.Time) string {
+	return path.Join(prefix, ns, now.UTC().Format(archiveTimeFormat)+".tar.gz")
+}
+
+// isArchivedIfNeeded exports all namespaced resources as YAML and uploads gzipped tarball of them to object storage
+// before anything is deleted, which is a lightweight audit and restore artifact for clusters without Velero
+func isArchivedIfNeeded(a *archiver) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if a == nil {
+			return true
+		}
+		logger := ns.logger()
+
+		data, err := a.exporter.Export(ns.Name())
+		if err != nil {
+			logger.WithError(err).Error("Failed to export namespace")
+			return false
+		}
+		location, err := a.storage.Upload(archiveKey(a.prefix, ns.Name(), time.Now()), "application/gzip", data)
+		auditAction(ns, "archive-namespace", err, map[string]string{"location": location})
+		if err != nil {
+			logger.Error(err)
+			return false
+		}
+		logger.WithFields(log.Fields{"location": location, "bytes": len(data)}).Info("Namespace is archived")
+		return true
+	}
+}
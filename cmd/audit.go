@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	audit "github.com/OpusCapita/buhtig-s8k/pkg/audit"
+)
+
+// default amount of bytes returned by '/audit/tail' endpoint
+const defaultAuditTailBytes = 64 * 1024
+
+// auditLogger writes audit trail of destructive actions; it's nil if audit is disabled
+var auditLogger *audit.Logger
+
+// setupAudit enables file-based audit sink with rotation and registers '/audit/tail' admin endpoint
+func setupAudit(cfg config) {
+	if cfg.auditFile == "" {
+		return
+	}
+
+	fileWriter := &audit.FileWriter{
+		Path:       cfg.auditFile,
+		MaxSize:    int64(cfg.auditMaxSizeMB) * 1024 * 1024,
+		MaxAge:     cfg.auditMaxAge,
+		MaxBackups: cfg.auditMaxBackups,
+		Compress:   cfg.auditCompress,
+	}
+	auditLogger = audit.NewLogger(fileWriter)
+
+	// GET /audit/tail?bytes=N returns last N bytes of the current audit file
+	adminMux.HandleFunc("/audit/tail", requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		n := int64(defaultAuditTailBytes)
+		if val := r.URL.Query().Get("bytes"); val != "" {
+			parsed, err := strconv.ParseInt(val, 10, 64)
+			if err != nil || parsed <= 0 {
+				http.Error(w, "bytes should be a positive integer", http.StatusBadRequest)
+				return
+			}
+			n = parsed
+		}
+		tail, err := fileWriter.Tail(n)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write(tail)
+	}))
+
+	log.Info("Audit trail is written to " + cfg.auditFile)
+}
+
+// auditAction records destructive action done for namespace if audit is enabled,
+// failures and deletion of namespace are recorded in deletion history as well
+func auditAction(ns *namespace, action string, err error, details map[string]string) {
+	recordHistory(ns, action, err)
+	if auditLogger == nil {
+		return
+	}
+	record := audit.Record{
+		Action:    action,
+		Namespace: ns.Name(),
+		Success:   err == nil,
+		Details:   details,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if logErr := auditLogger.Log(record); logErr != nil {
+		ns.logger().Error("Failed to write audit record")
+		ns.logger().Error(logErr)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// deletionBudget caps number of namespaces deleted in one iteration, so that outage of VCS or revoked token
+// can't wipe dozens of environments in one pass. It's safe for concurrent use.
+type deletionBudget struct {
+	mu sync.Mutex
+	// limit is number of deletions allowed in iteration, <= 0 means unlimited
+	limit int
+	used  int
+	// failed is number of deletions which failed at one of the steps
+	failed int
+}
+
+func newDeletionBudget(limit int) *deletionBudget {
+	return &deletionBudget{limit: limit}
+}
+
+// take reserves one deletion, it returns false if budget is exhausted
+func (b *deletionBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit > 0 && b.used >= b.limit {
+		return false
+	}
+	b.used++
+	return true
+}
+
+// fail records failed deletion
+func (b *deletionBudget) fail() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failed++
+}
+
+// isWithinDeletionBudget lets namespace proceed to teardown while budget of iteration isn't exhausted,
+// remaining candidates are deferred to the next iteration
+func isWithinDeletionBudget(b *deletionBudget) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if b.take() {
+			return true
+		}
+		message := fmt.Sprintf("deletion budget of %d namespaces per iteration is exhausted", b.limit)
+		ns.logger().WithField("budget", b.limit).Warn("Deletion budget of iteration is exhausted, deletion is deferred to the next iteration")
+		skipNamespace(ns, skipReasonBudget, message)
+		return false
+	}
+}
+
+// deletionRampUp limits blast radius of configuration mistakes: after start deletion budget of iteration is small
+// and it's doubled after every iteration which completed all its deletions, up to the maximum. Iteration with failed
+// deletions drops budget back to the initial one, iteration with deletions waiting for their steps (e.g. for Velero
+// Backup) keeps it. It's used by the main loop only.
+type deletionRampUp struct {
+	// initial budget, ramp-up is disabled if it's <= 0
+	initial int
+	// max budget, 0 means unlimited
+	max     int
+	current int
+}
+
+func newDeletionRampUp(initial, max int) *deletionRampUp {
+	return &deletionRampUp{initial: initial, max: max, current: initial}
+}
+
+// budget returns deletion budget of the next iteration
+func (r *deletionRampUp) budget() *deletionBudget {
+	if r.initial <= 0 {
+		return newDeletionBudget(r.max)
+	}
+	return newDeletionBudget(r.current)
+}
+
+// done adjusts budget of the next iteration with results of iteration which used b and completely deleted 'completed' namespaces
+func (r *deletionRampUp) done(b *deletionBudget, completed int) {
+	if r.initial <= 0 || b.used == 0 {
+		return
+	}
+	if b.failed > 0 {
+		if r.current != r.initial {
+			log.WithFields(log.Fields{"started": b.used, "failed": b.failed, "budget": r.initial}).Warn("Some deletions failed, deletion budget is reset")
+		}
+		r.reset()
+		return
+	}
+	if completed < b.used || b.used < b.limit || (r.max > 0 && r.current >= r.max) {
+		return
+	}
+	r.current *= 2
+	if r.max > 0 && r.current > r.max {
+		r.current = r.max
+	}
+	log.WithField("budget", r.current).Info("All deletions of iteration completed, deletion budget is raised")
+}
+
+// reset drops budget back to the initial one
+func (r *deletionRampUp) reset() {
+	r.current = r.initial
+}
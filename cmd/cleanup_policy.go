@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+
+	"github.com/OpusCapita/buhtig-s8k/pkg/crd"
+)
+
+// cleanupPolicyClient lists CleanupPolicies and ClusterCleanupPolicies; it's nil if they're disabled
+var cleanupPolicyClient *crd.PolicyClient
+
+// setupCleanupPolicies enables cleanup policies defined by custom resources, CRDs should be installed
+func setupCleanupPolicies(k8sConfig *rest.Config, enabled bool) {
+	if !enabled {
+		return
+	}
+	dynamicClient, err := dynamic.NewForConfig(k8sConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cleanupPolicyClient = crd.NewPolicyClient(dynamicClient)
+	if _, err := cleanupPolicyClient.ListCluster(); err != nil {
+		log.Fatal(fmt.Sprintf("Failed to list ClusterCleanupPolicies, are CRDs installed? %v", err))
+	}
+	log.Info("Cleanup policies are read from CleanupPolicy and ClusterCleanupPolicy resources")
+}
+
+// cleanupPolicies are policy resources read at the start of iteration, they're applied on top of app configuration
+type cleanupPolicies struct {
+	base policy
+	// namespaced are CleanupPolicies by namespace
+	namespaced map[string][]crd.CleanupPolicy
+	// cluster are ClusterCleanupPolicies, the highest priority first
+	cluster []crd.CleanupPolicy
+}
+
+// loadCleanupPolicies reads policy resources, only base policy is used if they're disabled. Error is returned if they
+// can't be read: namespaces shouldn't be processed then, since e.g. protection or longer grace period set by policy
+// would be silently ignored.
+func loadCleanupPolicies(base policy) (*cleanupPolicies, error) {
+	policies := &cleanupPolicies{base: base, namespaced: map[string][]crd.CleanupPolicy{}}
+	if cleanupPolicyClient == nil {
+		return policies, nil
+	}
+	namespaced, err := cleanupPolicyClient.ListNamespaced()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list CleanupPolicies: %v", err)
+	}
+	cluster, err := cleanupPolicyClient.ListCluster()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list ClusterCleanupPolicies: %v", err)
+	}
+	for _, p := range namespaced {
+		if checkCleanupPolicy(&p) {
+			policies.namespaced[p.Namespace] = append(policies.namespaced[p.Namespace], p)
+		}
+	}
+	for _, p := range cluster {
+		if checkCleanupPolicy(&p) {
+			policies.cluster = append(policies.cluster, p)
+		}
+	}
+	return policies, nil
+}
+
+// validateCleanupPolicy returns error describing the first invalid setting of policy
+func validateCleanupPolicy(p *crd.CleanupPolicy) error {
+	if p.Spec.NamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(p.Spec.NamespaceSelector); err != nil {
+			return fmt.Errorf("namespaceSelector is invalid: %v", err)
+		}
+	}
+	if p.Spec.GracePeriod != "" {
+		if d, err := time.ParseDuration(p.Spec.GracePeriod); err != nil || d < 0 {
+			return fmt.Errorf("gracePeriod should be non-negative duration, got '%s'", p.Spec.GracePeriod)
+		}
+	}
+	if p.Spec.RepoMissingPolicy != "" && p.Spec.RepoMissingPolicy != repoMissingPolicySkip && p.Spec.RepoMissingPolicy != repoMissingPolicyDelete {
+		return fmt.Errorf("repoMissingPolicy should be one of %s, %s, got '%s'", repoMissingPolicySkip, repoMissingPolicyDelete, p.Spec.RepoMissingPolicy)
+	}
+	return nil
+}
+
+// checkCleanupPolicy validates policy and reports result in its Valid condition, invalid policy isn't applied
+func checkCleanupPolicy(p *crd.CleanupPolicy) bool {
+	err := validateCleanupPolicy(p)
+	if err != nil {
+		log.WithFields(log.Fields{"kind": policyKind(p), "policy": policyName(p)}).WithError(err).Warn("Ignoring invalid cleanup policy")
+	}
+	if p.SetValid(err, time.Now()) {
+		if err := cleanupPolicyClient.UpdateStatus(p); err != nil {
+			log.WithFields(log.Fields{"kind": policyKind(p), "policy": policyName(p)}).Error("Failed to update status of cleanup policy")
+			log.Error(err)
+		}
+	}
+	return err == nil
+}
+
+func policyKind(p *crd.CleanupPolicy) string {
+	if p.Namespace == "" {
+		return crd.ClusterCleanupPolicyKind
+	}
+	return crd.CleanupPolicyKind
+}
+
+func policyName(p *crd.CleanupPolicy) string {
+	if p.Namespace == "" {
+		return p.Name
+	}
+	return p.Namespace + "/" + p.Name
+}
+
+// of returns policies which apply to namespace, the most specific first: CleanupPolicies of namespace itself,
+// then selecting ClusterCleanupPolicies by priority
+func (p *cleanupPolicies) of(ns *namespace) []crd.CleanupPolicy {
+	matching := append([]crd.CleanupPolicy{}, p.namespaced[ns.Name()]...)
+	for i := range p.cluster {
+		selects, err := p.cluster[i].Selects(ns.ObjectMeta.Labels)
+		if err != nil {
+			ns.logger().WithField("policy", p.cluster[i].Name).WithError(err).Warn("ClusterCleanupPolicy has invalid namespace selector")
+			continue
+		}
+		if selects {
+			matching = append(matching, p.cluster[i])
+		}
+	}
+	return matching
+}
+
+// defaultAnnotations returns annotations which policy sets for namespaces
+func defaultAnnotations(spec crd.CleanupPolicySpec) map[string]string {
+	annotations := map[string]string{}
+	for name, value := range spec.Annotations {
+		annotations[name] = value
+	}
+	for name, value := range map[string]string{
+		deletionGracePeriodAnnotationName: spec.GracePeriod,
+		vcsProviderAnnotationName:         spec.VCSProvider,
+		approvalChannelAnnotationName:     spec.ApprovalChannel,
+	} {
+		if value != "" {
+			annotations[name] = value
+		}
+	}
+	if spec.Protected != nil {
+		annotations[protectedAnnotationName] = strconv.FormatBool(*spec.Protected)
+	}
+	return annotations
+}
+
+// isCleanupPolicyApplied sets annotations defined by policies in memory unless namespace has its own ones,
+// it never filters namespace out
+func isCleanupPolicyApplied(policies *cleanupPolicies) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		matching := policies.of(ns)
+		if len(matching) == 0 {
+			return true
+		}
+		// annotations are copied, so that namespace object isn't shared with policies
+		annotations := make(map[string]string, len(ns.ObjectMeta.Annotations))
+		for name, value := range ns.ObjectMeta.Annotations {
+			annotations[name] = value
+		}
+		for _, p := range matching {
+			for name, value := range defaultAnnotations(p.Spec) {
+				if _, ok := annotations[name]; !ok {
+					annotations[name] = value
+				}
+			}
+		}
+		ns.ObjectMeta.Annotations = annotations
+		ns.logger().WithField("count", len(matching)).Debug("Applied cleanup policies")
+		return true
+	}
+}
+
+// policyFor returns decision policy of namespace: settings of app configuration are overridden by the most
+// specific policy resource which defines them
+func (p *cleanupPolicies) policyFor(ns *namespace) policy {
+	result := p.base
+	confirmations, repoMissing := false, false
+	for _, cp := range p.of(ns) {
+		if !confirmations && cp.Spec.BranchMissingConfirmations > 0 {
+			result.branchMissingConfirmations = cp.Spec.BranchMissingConfirmations
+			confirmations = true
+		}
+		if !repoMissing && cp.Spec.RepoMissingPolicy != "" {
+			if cp.Spec.RepoMissingPolicy != repoMissingPolicySkip && cp.Spec.RepoMissingPolicy != repoMissingPolicyDelete {
+				ns.logger().WithFields(log.Fields{"policy": cp.Name, "repo_missing_policy": cp.Spec.RepoMissingPolicy}).Warn("Policy has unknown repoMissingPolicy, ignoring it")
+				continue
+			}
+			result.repoMissingPolicy = cp.Spec.RepoMissingPolicy
+			repoMissing = true
+		}
+	}
+	return result
+}
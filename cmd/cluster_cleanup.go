@@ -0,0 +1,78 @@
+package main
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	cleanup "github.com/OpusCapita/buhtig-s8k/pkg/cleanup"
+)
+
+// clusterCleanupSettings configure cleanup of cluster-scoped objects tied to the namespace
+type clusterCleanupSettings struct {
+	enabled bool
+	// kinds are 'Kind.group' strings, e.g. "ClusterRoleBinding.rbac.authorization.k8s.io"
+	kinds []string
+	// label whose value is name of branch namespace
+	label string
+}
+
+// belongsToNamespace checks if cluster-scoped object is tied to namespace: it's labeled with its name, named exactly
+// after it, or refers only to the namespace (PersistentVolume claimed from it, ClusterRoleBinding whose subjects are
+// all in it). Names merely starting with namespace name aren't enough, since they may belong to another namespace
+// sharing the prefix (e.g. 'dev-app-feature-2' of 'dev-app-feature').
+func belongsToNamespace(obj *unstructured.Unstructured, ns, label string) bool {
+	if label != "" && obj.GetLabels()[label] == ns {
+		return true
+	}
+	if obj.GetName() == ns {
+		return true
+	}
+
+	switch obj.GetKind() {
+	case "PersistentVolume":
+		claimNamespace, _, _ := unstructured.NestedString(obj.Object, "spec", "claimRef", "namespace")
+		return claimNamespace == ns
+	case "ClusterRoleBinding":
+		subjects, _, _ := unstructured.NestedSlice(obj.Object, "subjects")
+		if len(subjects) == 0 {
+			return false
+		}
+		for _, subject := range subjects {
+			subject, _ := subject.(map[string]interface{})
+			if subject["namespace"] != ns {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isClusterResourcesDeletedIfNeeded deletes cluster-scoped objects tied to the namespace, which namespace deletion
+// leaves behind; PersistentVolumes still bound to claims of namespace are protected by Kubernetes until claims are gone
+func isClusterResourcesDeletedIfNeeded(deleter *cleanup.Deleter, settings clusterCleanupSettings) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if !settings.enabled {
+			return true
+		}
+		logger := ns.logger()
+
+		failed := false
+		for _, kind := range settings.kinds {
+			gk := schema.ParseGroupKind(kind)
+			gvk := schema.GroupVersionKind{Group: gk.Group, Kind: gk.Kind}
+			deleted, err := deleter.DeleteMatchingFunc(gvk, "", "", func(obj *unstructured.Unstructured) bool {
+				return belongsToNamespace(obj, ns.Name(), settings.label)
+			})
+			for _, obj := range deleted {
+				auditAction(ns, "delete-cluster-resource", nil, map[string]string{"object": obj.String()})
+				logger.WithField("object", obj.String()).Info("Deleted cluster-scoped object")
+			}
+			if err != nil {
+				logger.WithField("kind", gk.Kind).WithError(err).Error("Failed to delete cluster-scoped objects")
+				failed = true
+			}
+		}
+		return !failed
+	}
+}
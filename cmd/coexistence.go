@@ -0,0 +1,47 @@
+package main
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// isClaimedIfNeeded claims namespace for deletion by the app in 'claim' coexistence mode,
+// so that other cleanup controllers honoring the claim annotation leave it alone.
+// Claim is written with optimistic locking: if namespace was changed concurrently (e.g. claimed by someone else)
+// then it's skipped until next iteration.
+func isClaimedIfNeeded(k8sClient kubernetes.Interface, mode string) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if mode != coexistenceClaim {
+			return true
+		}
+
+		logger := ns.logger()
+
+		if ns.ObjectMeta.Annotations[claimedByAnnotationName] == componentName {
+			return true
+		}
+
+		k8sNs, err := k8sClient.CoreV1().Namespaces().Get(ns.Name(), metav1.GetOptions{})
+		if err != nil {
+			logger.Error(err)
+			return false
+		}
+
+		if owner := k8sNs.ObjectMeta.Annotations[claimedByAnnotationName]; owner != "" && owner != componentName {
+			logger.Info("Namespace is claimed by '" + owner + "', skipping")
+			return false
+		}
+
+		// Update (unlike Patch) fails with Conflict if resourceVersion has changed since Get
+		metav1.SetMetaDataAnnotation(&k8sNs.ObjectMeta, claimedByAnnotationName, componentName)
+		if _, err := k8sClient.CoreV1().Namespaces().Update(k8sNs); err != nil {
+			logger.Warn("Failed to claim namespace, will retry on next iteration")
+			logger.Warn(err)
+			return false
+		}
+
+		metav1.SetMetaDataAnnotation(&ns.ObjectMeta, claimedByAnnotationName, componentName)
+		logger.Info("Claimed namespace for deletion")
+		return true
+	}
+}
@@ -0,0 +1,904 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/OpusCapita/buhtig-s8k/pkg/helm"
+	"github.com/OpusCapita/buhtig-s8k/pkg/konnect"
+	"github.com/OpusCapita/buhtig-s8k/pkg/opa"
+	"github.com/OpusCapita/buhtig-s8k/pkg/otlp"
+	"github.com/OpusCapita/buhtig-s8k/pkg/prometheus"
+	"github.com/OpusCapita/buhtig-s8k/pkg/slack"
+	"github.com/OpusCapita/buhtig-s8k/pkg/terraform"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// environment variables for optional configuration
+const (
+	configFileEnv          = "CONFIG_FILE"
+	logFormatEnv           = "LOG_FORMAT"
+	logLevelEnv            = "LOG_LEVEL"
+	logDedupWindowEnv      = "LOG_DEDUP_WINDOW"
+	adminAddrEnv           = "ADMIN_ADDR"
+	debugAddrEnv           = "DEBUG_ADDR"
+	adminTokensEnv         = "ADMIN_TOKENS"
+	updateCheckRepoEnv     = "UPDATE_CHECK_REPO"
+	updateCheckIntervalEnv = "UPDATE_CHECK_INTERVAL"
+	auditFileEnv           = "AUDIT_FILE"
+	auditMaxSizeMBEnv      = "AUDIT_MAX_SIZE_MB"
+	auditMaxAgeEnv         = "AUDIT_MAX_AGE"
+	auditMaxBackupsEnv     = "AUDIT_MAX_BACKUPS"
+	auditCompressEnv       = "AUDIT_COMPRESS"
+
+	branchMissingConfirmationsEnv = "BRANCH_MISSING_CONFIRMATIONS"
+	branchCheckIntervalEnv        = "BRANCH_CHECK_INTERVAL"
+	repoMissingPolicyEnv          = "REPO_MISSING_POLICY"
+	deletionGracePeriodEnv        = "DELETION_GRACE_PERIOD"
+	namespaceAllowEnv             = "NAMESPACE_ALLOW"
+	namespaceDenyEnv              = "NAMESPACE_DENY"
+	maxDeletionsPerRunEnv         = "MAX_DELETIONS_PER_RUN"
+	deletionRampUpInitialEnv      = "DELETION_RAMP_UP_INITIAL"
+	quarantinePeriodEnv           = "QUARANTINE_PERIOD"
+	activeWorkloadWindowEnv       = "ACTIVE_WORKLOAD_WINDOW"
+	recentDeploymentWindowEnv     = "RECENT_DEPLOYMENT_WINDOW"
+	ingressTrafficPrometheusEnv   = "INGRESS_TRAFFIC_PROMETHEUS_URL"
+	ingressTrafficQueryEnv        = "INGRESS_TRAFFIC_QUERY"
+	ingressTrafficWindowEnv       = "INGRESS_TRAFFIC_WINDOW"
+	ingressTrafficThresholdEnv    = "INGRESS_TRAFFIC_THRESHOLD"
+	maintenanceWindowsEnv         = "MAINTENANCE_WINDOWS"
+	maintenanceTimezoneEnv        = "MAINTENANCE_TIMEZONE"
+	approvalRequiredEnv           = "APPROVAL_REQUIRED"
+	approvalExpiryEnv             = "APPROVAL_EXPIRY"
+	slackBotTokenEnv              = "SLACK_BOT_TOKEN"
+	slackSigningSecretEnv         = "SLACK_SIGNING_SECRET"
+	slackApprovalChannelEnv       = "SLACK_APPROVAL_CHANNEL"
+	iterationIntervalEnv          = "ITERATION_INTERVAL"
+	iterationScheduleEnv          = "ITERATION_SCHEDULE"
+	iterationScheduleTimezoneEnv  = "ITERATION_SCHEDULE_TIMEZONE"
+
+	coexistenceModeEnv           = "COEXISTENCE_MODE"
+	foreignCleanupAnnotationsEnv = "FOREIGN_CLEANUP_ANNOTATIONS"
+
+	prCommentEnabledEnv          = "PR_COMMENT_ENABLED"
+	migrateOnStartupEnv          = "MIGRATE_ON_STARTUP"
+	deploymentsPolicyEnv         = "GITHUB_DEPLOYMENTS_POLICY"
+	namespaceDeadlineEnv         = "NAMESPACE_DEADLINE"
+	githubEnvironmentTemplateEnv = "GITHUB_ENVIRONMENT_TEMPLATE"
+	summaryIssueIntervalEnv      = "SUMMARY_ISSUE_INTERVAL"
+	staleAgeEnv                  = "STALE_AGE"
+	stuckTerminatingThresholdEnv = "STUCK_TERMINATING_THRESHOLD"
+	forceFinalizeTimeoutEnv      = "FORCE_FINALIZE_TIMEOUT"
+	forceFinalizeFinalizersEnv   = "FORCE_FINALIZE_FINALIZERS"
+	helmCleanupFinalizerEnv      = "HELM_CLEANUP_FINALIZER"
+	eventsEnabledEnv             = "EVENTS_ENABLED"
+	statusAnnotationsEnv         = "STATUS_ANNOTATIONS"
+	tombstoneRetentionEnv        = "TOMBSTONE_RETENTION"
+	historyMaxAgeEnv             = "HISTORY_MAX_AGE"
+	historyMaxEntriesEnv         = "HISTORY_MAX_ENTRIES"
+	branchEnvironmentsEnv        = "BRANCH_ENVIRONMENTS"
+	cleanupPoliciesEnv           = "CLEANUP_POLICIES"
+	admissionAddrEnv             = "ADMISSION_ADDR"
+	admissionTLSCertEnv          = "ADMISSION_TLS_CERT"
+	admissionTLSKeyEnv           = "ADMISSION_TLS_KEY"
+	admissionValidationEnv       = "ADMISSION_VALIDATION"
+	admissionSourceURLTplEnv     = "ADMISSION_SOURCE_URL_TEMPLATE"
+	admissionHelmReleaseTplEnv   = "ADMISSION_HELM_RELEASE_TEMPLATE"
+	runOnceEnv                   = "RUN_ONCE"
+	pushgatewayURLEnv            = "PUSHGATEWAY_URL"
+	pushgatewayJobEnv            = "PUSHGATEWAY_JOB"
+	otlpEndpointEnv              = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	otlpHeadersEnv               = "OTEL_EXPORTER_OTLP_HEADERS"
+	otlpServiceNameEnv           = "OTEL_SERVICE_NAME"
+	otlpMetricsExporterEnv       = "OTEL_METRICS_EXPORTER"
+	otlpMetricExportIntervalEnv  = "OTEL_METRIC_EXPORT_INTERVAL"
+	statsdAddrEnv                = "STATSD_ADDR"
+	statsdFlavorEnv              = "STATSD_FLAVOR"
+	statsdPrefixEnv              = "STATSD_PREFIX"
+	statsdIntervalEnv            = "STATSD_INTERVAL"
+
+	webhookAddrEnv   = "WEBHOOK_ADDR"
+	webhookSecretEnv = "WEBHOOK_SECRET"
+
+	gcRetentionEnv = "GC_RETENTION"
+	gcIntervalEnv  = "GC_INTERVAL"
+
+	gcOrphanedHelmReleasesEnv = "GC_ORPHANED_HELM_RELEASES"
+
+	credentialsCheckIntervalEnv = "CREDENTIALS_CHECK_INTERVAL"
+	livenessTimeoutEnv          = "LIVENESS_TIMEOUT"
+
+	helmVersionEnv        = "HELM_VERSION"
+	helmMaxConcurrencyEnv = "HELM_MAX_CONCURRENCY"
+	helmNoHooksEnv        = "HELM_NO_HOOKS"
+	helmKeepHistoryEnv    = "HELM_KEEP_HISTORY"
+	helmTimeoutEnv        = "HELM_TIMEOUT"
+
+	helmClusterLeftoversEnv = "HELM_CLUSTER_LEFTOVERS"
+	helmWaitTimeoutEnv      = "HELM_WAIT_TIMEOUT"
+	helmSnapshotEnv         = "HELM_SNAPSHOT"
+
+	fluxCleanupEnv        = "FLUX_CLEANUP"
+	fluxNamespaceEnv      = "FLUX_NAMESPACE"
+	fluxNamespaceLabelEnv = "FLUX_NAMESPACE_LABEL"
+
+	clusterCleanupEnv      = "CLUSTER_CLEANUP"
+	clusterCleanupKindsEnv = "CLUSTER_CLEANUP_KINDS"
+	clusterCleanupLabelEnv = "CLUSTER_CLEANUP_LABEL"
+
+	loadBalancerTimeoutEnv = "LOAD_BALANCER_TIMEOUT"
+
+	preDeleteGateURLEnv     = "PRE_DELETE_GATE_URL"
+	preDeleteGateSecretEnv  = "PRE_DELETE_GATE_SECRET"
+	preDeleteGateTimeoutEnv = "PRE_DELETE_GATE_TIMEOUT"
+
+	opaURLEnv        = "OPA_URL"
+	opaPolicyPathEnv = "OPA_POLICY_PATH"
+	opaTimeoutEnv    = "OPA_TIMEOUT"
+
+	veleroBackupEnv          = "VELERO_BACKUP"
+	veleroNamespaceEnv       = "VELERO_NAMESPACE"
+	veleroBackupTTLEnv       = "VELERO_BACKUP_TTL"
+	veleroStorageLocationEnv = "VELERO_STORAGE_LOCATION"
+	veleroBackupTimeoutEnv   = "VELERO_BACKUP_TIMEOUT"
+
+	preDeleteJobConfigMapEnv = "PRE_DELETE_JOB_CONFIGMAP"
+	preDeleteJobTimeoutEnv   = "PRE_DELETE_JOB_TIMEOUT"
+
+	teardownWorkflowEnv        = "GITHUB_TEARDOWN_WORKFLOW"
+	teardownWorkflowRefEnv     = "GITHUB_TEARDOWN_WORKFLOW_REF"
+	teardownWorkflowTimeoutEnv = "GITHUB_TEARDOWN_WORKFLOW_TIMEOUT"
+
+	databaseDropPostgresImageEnv = "DATABASE_DROP_POSTGRES_IMAGE"
+	databaseDropMySQLImageEnv    = "DATABASE_DROP_MYSQL_IMAGE"
+	databaseDropTimeoutEnv       = "DATABASE_DROP_TIMEOUT"
+	databaseSecretNamespacesEnv  = "DATABASE_SECRET_NAMESPACES"
+
+	tfcURLEnv              = "TFC_URL"
+	tfcTokenEnv            = "TFC_TOKEN"
+	tfcOrganizationEnv     = "TFC_ORGANIZATION"
+	tfcOrganizationsEnv    = "TFC_ORGANIZATIONS"
+	tfcWorkspacePatternEnv = "TFC_WORKSPACE_PATTERN"
+	tfcWorkspaceTagEnv     = "TFC_WORKSPACE_TAG"
+	tfcTimeoutEnv          = "TFC_TIMEOUT"
+
+	externalDNSCleanupEnv        = "EXTERNAL_DNS_CLEANUP"
+	externalDNSNamespaceLabelEnv = "EXTERNAL_DNS_NAMESPACE_LABEL"
+
+	retryMaxAttemptsEnv   = "RETRY_MAX_ATTEMPTS"
+	retryBackoffEnv       = "RETRY_BACKOFF"
+	retryBackoffFactorEnv = "RETRY_BACKOFF_FACTOR"
+	retryMaxBackoffEnv    = "RETRY_MAX_BACKOFF"
+	retryOnEnv            = "RETRY_ON"
+
+	tillerTLSEnableEnv   = "TILLER_TLS_ENABLE"
+	tillerTLSVerifyEnv   = "TILLER_TLS_VERIFY"
+	tillerTLSCertEnv     = "TILLER_TLS_CERT"
+	tillerTLSKeyEnv      = "TILLER_TLS_KEY"
+	tillerTLSCACertEnv   = "TILLER_TLS_CA_CERT"
+	tillerTLSHostnameEnv = "TILLER_TLS_HOSTNAME"
+	tillerlessEnv        = "TILLERLESS"
+	tillerStorageEnv     = "TILLER_STORAGE"
+)
+
+// policies applied when the whole repository referenced by namespace is missing
+const (
+	repoMissingPolicySkip   = "skip"
+	repoMissingPolicyDelete = "delete"
+)
+
+// modes of coexistence with other cleanup controllers (e.g. kube-janitor) acting on the same namespaces
+const (
+	// coexistenceDefer leaves namespaces managed by other controllers to them
+	coexistenceDefer = "defer"
+	// coexistenceClaim claims namespace with annotation before deletion and skips namespaces claimed by others
+	coexistenceClaim = "claim"
+	// coexistenceIgnore acts regardless of other controllers
+	coexistenceIgnore = "ignore"
+)
+
+// fileConfig is structured part of configuration which doesn't fit into env variables,
+// it's read from YAML file referenced by CONFIG_FILE env variable (e.g. mounted ConfigMap).
+// Secrets are never put there directly, instead names of env variables holding them are referenced.
+type fileConfig struct {
+	// Observability lists tools where branch-scoped objects are deleted after environment is removed
+	Observability []observabilityTarget `json:"observability"`
+	// VCSProviders are named VCS instances with their own credentials, namespaces select them with annotation
+	VCSProviders []vcsProviderTarget `json:"vcsProviders"`
+	// ExtraResources are objects of arbitrary kinds deleted during teardown
+	ExtraResources []extraResourceTarget `json:"extraResources"`
+	// DNSProviders are DNS zones where records of branch hostnames are deleted
+	DNSProviders []dnsProviderTarget `json:"dnsProviders"`
+	// ECR lists container registry repositories where images of deleted branches are deleted
+	ECR []ecrTarget `json:"ecr"`
+	// PostDeleteWebhooks receive JSON payload after environment is removed
+	PostDeleteWebhooks []postDeleteWebhookTarget `json:"postDeleteWebhooks"`
+	// JenkinsJobs are triggered before or after environment is removed
+	JenkinsJobs []jenkinsJobTarget `json:"jenkinsJobs"`
+	// Archive configures object storage where manifests of namespace are uploaded before deletion
+	Archive *archiveTarget `json:"archive"`
+	// Predicates are CEL expressions every deletion candidate has to match
+	Predicates []predicateTarget `json:"predicates"`
+}
+
+// extraResourceTarget selects objects to delete during teardown; Namespace, Name and Selector are Go templates
+type extraResourceTarget struct {
+	// Group, Version and Kind of objects, preferred version is used if Version is empty
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	// Namespace of objects, empty value means all namespaces; it's ignored for cluster-scoped kinds
+	Namespace string `json:"namespace"`
+	// Name of object to delete
+	Name string `json:"name"`
+	// Selector is label selector of objects to delete, it's used if Name is empty
+	Selector string `json:"selector"`
+}
+
+// vcsProviderTarget configures named VCS provider
+type vcsProviderTarget struct {
+	// Name is referenced by 'opuscapita.com/vcs-provider' annotation
+	Name string `json:"name"`
+	// Type is name of built-in provider, e.g. "github" or "gitlab"
+	Type string `json:"type"`
+	// URL of API (Github Enterprise) or of instance (Bitbucket Server, Gitea)
+	URL string `json:"url"`
+	// TokenEnv is env variable with access token
+	TokenEnv string `json:"tokenEnv"`
+	// UsernameEnv and PasswordEnv are env variables with Bitbucket Cloud credentials
+	UsernameEnv string `json:"usernameEnv"`
+	PasswordEnv string `json:"passwordEnv"`
+}
+
+// dnsProviderTarget configures DNS zone of a single provider
+type dnsProviderTarget struct {
+	// Type is either "route53" or "clouddns"
+	Type string `json:"type"`
+	// Domain of the zone, only hostnames in it are handled by provider
+	Domain string `json:"domain"`
+	// ZoneID of Route53 hosted zone, AWS credentials are taken from default chain
+	ZoneID string `json:"zoneID"`
+	// Project and Zone (managed zone name) of Cloud DNS
+	Project string `json:"project"`
+	Zone    string `json:"zone"`
+	// CredentialsFileEnv is env variable with path to service account key, GCE metadata server is used if it's empty
+	CredentialsFileEnv string `json:"credentialsFileEnv"`
+	// TXTPrefix is '--txt-prefix' of external-dns managing the zone
+	TXTPrefix string `json:"txtPrefix"`
+}
+
+// ecrTarget configures ECR repositories of a single region
+type ecrTarget struct {
+	// Region of repositories, default is AWS_REGION
+	Region       string   `json:"region"`
+	Repositories []string `json:"repositories"`
+	// TagTemplate is Go template of image tag, default is "{{.Branch}}"; characters not allowed in tags are replaced with '-'
+	TagTemplate string `json:"tagTemplate"`
+	// MatchPrefix deletes also tags starting with the tag followed by '-' or '.' and suffix matching SuffixPattern
+	MatchPrefix bool `json:"matchPrefix"`
+	// SuffixPattern is regular expression of the whole suffix, default matches commit SHAs and build numbers
+	SuffixPattern string `json:"suffixPattern"`
+	// suffixRe is compiled SuffixPattern, it's nil unless MatchPrefix is set
+	suffixRe *regexp.Regexp
+}
+
+// postDeleteWebhookTarget configures single post-delete webhook
+type postDeleteWebhookTarget struct {
+	URL string `json:"url"`
+	// SecretEnv is env variable with secret of HMAC-SHA256 signature of payload
+	SecretEnv string `json:"secretEnv"`
+	// Template is Go template of JSON payload
+	Template string `json:"template"`
+}
+
+// jenkinsJobTarget configures Jenkins job triggered during teardown
+type jenkinsJobTarget struct {
+	// URL of Jenkins
+	URL string `json:"url"`
+	// Job is name of job, job in folders is named like "folder/job"
+	Job string `json:"job"`
+	// CredentialsSecret is Secret with 'username' and 'token' keys as NAMESPACE/NAME or NAME in the app's namespace
+	CredentialsSecret string `json:"credentialsSecret"`
+	// Phase is either "pre" (default) or "post"
+	Phase string `json:"phase"`
+	// Parameters of build are Go templates
+	Parameters map[string]string `json:"parameters"`
+	// Wait for build to succeed
+	Wait bool `json:"wait"`
+	// Timeout of waiting in one iteration, default is "30m"
+	Timeout string `json:"timeout"`
+}
+
+// predicateTarget configures custom pipeline filter
+type predicateTarget struct {
+	// Name is used in logs and audit trail
+	Name string `json:"name"`
+	// Expression is CEL expression over 'ns', 'branch' and 'time' variables which should evaluate to bool
+	Expression string `json:"expression"`
+}
+
+// archiveTarget configures object storage of namespace archives
+type archiveTarget struct {
+	// Type is either "s3" or "gcs"
+	Type   string `json:"type"`
+	Bucket string `json:"bucket"`
+	// Prefix of object keys
+	Prefix string `json:"prefix"`
+	// Region of S3 bucket, default is AWS_REGION
+	Region string `json:"region"`
+	// CredentialsFileEnv is env variable with path to GCP service account key, GCE metadata server is used if it's empty
+	CredentialsFileEnv string `json:"credentialsFileEnv"`
+	// IncludeSecrets archives Secrets as well
+	IncludeSecrets bool `json:"includeSecrets"`
+}
+
+// observabilityTarget configures single observability tool
+type observabilityTarget struct {
+	// Type is one of "grafana", "datadog" or "newrelic"
+	Type string `json:"type"`
+	// URL of Grafana or NerdGraph endpoint of New Relic
+	URL string `json:"url"`
+	// Site of Datadog, e.g. "datadoghq.eu"
+	Site string `json:"site"`
+	// TokenEnv is env variable with Grafana token or New Relic API key
+	TokenEnv string `json:"tokenEnv"`
+	// APIKeyEnv and AppKeyEnv are env variables with Datadog keys
+	APIKeyEnv string `json:"apiKeyEnv"`
+	AppKeyEnv string `json:"appKeyEnv"`
+	// NameTemplate is Go template of object names to delete, default is "{{.Namespace}}"
+	NameTemplate string `json:"nameTemplate"`
+}
+
+// config holds optional settings of the app; every field has a sane default
+type config struct {
+	// file is structured configuration read from CONFIG_FILE
+	file fileConfig
+
+	// adminAddr is the address of HTTP listener serving metrics and admin endpoints
+	adminAddr string
+	// adminTokens maps bearer tokens accepted by protected admin endpoints to names of their holders
+	adminTokens map[string]string
+	// debugAddr is the address of HTTP listener serving pprof and expvar, empty value disables it
+	debugAddr string
+
+	// updateCheckRepo is Github repository (OWNER/REPO) whose releases are checked for new app versions;
+	// the check is opt-in, empty value disables it
+	updateCheckRepo     string
+	updateCheckInterval time.Duration
+
+	// auditFile is a path of file where audit trail of destructive actions is written; empty value disables it
+	auditFile       string
+	auditMaxSizeMB  int
+	auditMaxAge     time.Duration
+	auditMaxBackups int
+	auditCompress   bool
+
+	// branchMissingConfirmations is how many consecutive checks should find branch missing before deletion
+	branchMissingConfirmations int
+	// branchCheckInterval is minimal interval between branch checks of namespace, 0 checks it on every iteration
+	branchCheckInterval time.Duration
+	// repoMissingPolicy is one of repoMissingPolicy* constants
+	repoMissingPolicy string
+	// namespaceNames filters namespaces by name after label selector
+	namespaceNames namespaceNameFilter
+	// maxDeletionsPerRun is how many namespaces can be deleted in one iteration, 0 means unlimited
+	maxDeletionsPerRun int
+	// deletionRampUpInitial is deletion budget of the first iteration which is raised while deletions succeed, 0 disables ramp-up
+	deletionRampUpInitial int
+	// approval configures manual approval of deletions
+	approval approvalSettings
+	// iterationSchedule decides when iterations start
+	iterationSchedule iterationSchedule
+	// runOnce exits after the first iteration, e.g. when the app is run by CronJob
+	runOnce bool
+	// pushgateway is where metrics are pushed before exit in runOnce mode
+	pushgateway pushgatewaySettings
+	// otlp configures export of traces to OpenTelemetry collector
+	otlp otlpSettings
+	// statsd configures emitting of metrics to StatsD or DogStatsD agent
+	statsd statsdSettings
+	// maintenanceWindows restrict destructive actions to time windows
+	maintenanceWindows maintenanceWindows
+	// quarantinePeriod is how long workloads of namespace are scaled to zero before it's deleted, 0 disables quarantine
+	quarantinePeriod time.Duration
+	// activeWorkloadWindow defers deletion of namespace with pods started or restarted within it, 0 disables the guard
+	activeWorkloadWindow time.Duration
+	// recentDeploymentWindow defers deletion of namespace with workloads rolled out within it, 0 disables the guard
+	recentDeploymentWindow time.Duration
+	// ingressTraffic defers deletion of namespace whose Ingresses served traffic recently
+	ingressTraffic ingressTrafficSettings
+	// deletionGracePeriod is how long namespace is marked for deletion before it's deleted, 0 deletes it right away
+	deletionGracePeriod time.Duration
+
+	// coexistenceMode is one of coexistence* constants
+	coexistenceMode string
+	// foreignCleanupAnnotations are annotations which mean namespace is managed by another cleanup controller
+	foreignCleanupAnnotations []string
+
+	// prCommentEnabled enables commenting on pull request after its environment is removed
+	prCommentEnabled bool
+	// commitStatusEnabled enables publishing teardown result as commit status on the last commit of the branch
+	commitStatusEnabled bool
+
+	// namespaceDeadline limits time spent on destructive steps for single namespace in one iteration
+	namespaceDeadline time.Duration
+
+	// deploymentsPolicy is one of deploymentsPolicy* constants
+	deploymentsPolicy string
+
+	// githubEnvironmentTemplate is Go template of Github environment name to delete for the branch
+	githubEnvironmentTemplate string
+
+	// summaryIssueInterval is how often summary issues are published, 0 disables them
+	summaryIssueInterval time.Duration
+	// staleAge is age of namespace after which it's reported as stale
+	staleAge time.Duration
+	// stuckTerminatingThreshold is how long namespace can be in Terminating before it's reported as stuck, 0 disables it
+	stuckTerminatingThreshold time.Duration
+	// forceFinalize configures removal of known-stuck finalizers
+	forceFinalize forceFinalizeSettings
+	// helmCleanupFinalizer puts finalizer on namespaces, so that Helm release is deleted even if namespace is deleted manually
+	helmCleanupFinalizer bool
+	// eventsEnabled turns on recording of Kubernetes Events on namespaces
+	eventsEnabled bool
+	// statusAnnotations turns on writing outcome of evaluation to namespace annotations
+	statusAnnotations bool
+	// tombstoneRetention is how long tombstones of deleted namespaces are kept, 0 disables them
+	tombstoneRetention time.Duration
+	// history configures history of deletions and failures
+	history historySettings
+	// branchEnvironments turns on BranchEnvironment resources representing tracked namespaces
+	branchEnvironments bool
+	// cleanupPolicies turns on reading of CleanupPolicy and ClusterCleanupPolicy resources
+	cleanupPolicies bool
+	// admission configures admission webhooks
+	admission admissionSettings
+
+	// migrateOnStartup is one of migrateMode* constants, legacy annotations are only reported by default
+	migrateOnStartup string
+
+	// webhookAddr is the address of listener receiving Github webhooks; empty value disables it
+	webhookAddr   string
+	webhookSecret string
+
+	// gcRetention is age after which controller-created bookkeeping objects are pruned
+	gcRetention time.Duration
+	gcInterval  time.Duration
+	// gcOrphanedHelmReleases enables purging of Helm 2 releases whose namespaces don't exist anymore
+	gcOrphanedHelmReleases bool
+
+	// credentialsCheckInterval is how often Github token and connection to Kubernetes are checked after startup,
+	// 0 checks them only once
+	credentialsCheckInterval time.Duration
+	// livenessTimeout is how long the main loop can go without progress before liveness fails, 0 disables the check
+	livenessTimeout time.Duration
+
+	// helmVersion is one of helmVersion* constants
+	helmVersion string
+	// helmMaxConcurrency is maximum number of Helm deletions running at the same time, 0 means no limit
+	helmMaxConcurrency int
+	// helmNoHooks, helmKeepHistory and helmTimeout are default uninstall options, namespaces can override them
+	helmNoHooks     bool
+	helmKeepHistory bool
+	helmTimeout     time.Duration
+	// helmClusterLeftovers is one of leftoversPolicy* constants
+	helmClusterLeftovers string
+	// helmWaitTimeout is how long to wait for objects of deleted release to be gone, 0 disables waiting
+	helmWaitTimeout time.Duration
+	// helmSnapshot is one of helmSnapshot* constants
+	helmSnapshot string
+
+	// opa configures policy gate evaluated by Open Policy Agent
+	opa opaSettings
+	// preDeleteGate configures external approval of deletions
+	preDeleteGate preDeleteGateSettings
+
+	// velero configures backup of namespace before deletion
+	velero veleroSettings
+
+	// preDeleteJob configures Job run before environment is deleted
+	preDeleteJob preDeleteJobSettings
+
+	// teardownWorkflow configures Github Actions workflow run before environment is deleted
+	teardownWorkflow teardownWorkflowSettings
+
+	// database configures dropping of per-branch databases
+	database databaseSettings
+
+	// flux configures cleanup of Flux objects reconciling the environment
+	flux fluxSettings
+
+	// clusterCleanup configures cleanup of cluster-scoped objects tied to the namespace
+	clusterCleanup clusterCleanupSettings
+
+	// loadBalancerTimeout is how long to wait for load balancers to be released before namespace deletion, 0 disables it
+	loadBalancerTimeout time.Duration
+
+	// terraform configures destroy runs in Terraform Cloud
+	terraform terraformSettings
+
+	// dns configures cleanup of DNS records of the environment
+	dns dnsSettings
+
+	// retryMaxAttempts, retryBackoff, retryBackoffFactor, retryMaxBackoff and retryOn (list of retryOn* constants)
+	// configure retries of Helm and namespace deletions
+	retryMaxAttempts   int
+	retryBackoff       time.Duration
+	retryBackoffFactor float64
+	retryMaxBackoff    time.Duration
+	retryOn            []string
+
+	// tillerTLS configures TLS connection to Tiller
+	tillerTLS helm.TLSOptions
+	// tillerless enables deletion of Helm 2 releases without Tiller, reading Tiller's storage of tillerStorage kind directly
+	tillerless    bool
+	tillerStorage string
+}
+
+// loadConfig reads config from environment variables
+func loadConfig() config {
+	cfg := config{
+		adminAddr:           envOrDefault(adminAddrEnv, ":8080"),
+		debugAddr:           envOrDefault(debugAddrEnv, ""),
+		adminTokens:         parseAdminTokens(envList(adminTokensEnv, nil)),
+		updateCheckRepo:     envOrDefault(updateCheckRepoEnv, ""),
+		updateCheckInterval: envDuration(updateCheckIntervalEnv, 24*time.Hour),
+		auditFile:           envOrDefault(auditFileEnv, ""),
+		auditMaxSizeMB:      envInt(auditMaxSizeMBEnv, 10),
+		auditMaxAge:         envDuration(auditMaxAgeEnv, 7*24*time.Hour),
+		auditMaxBackups:     envInt(auditMaxBackupsEnv, 5),
+		auditCompress:       envBool(auditCompressEnv, true),
+
+		branchMissingConfirmations: envInt(branchMissingConfirmationsEnv, 3),
+		branchCheckInterval:        envDuration(branchCheckIntervalEnv, 0),
+		deletionGracePeriod:        envDuration(deletionGracePeriodEnv, 0),
+		maxDeletionsPerRun:         envInt(maxDeletionsPerRunEnv, 0),
+		deletionRampUpInitial:      envInt(deletionRampUpInitialEnv, 0),
+		quarantinePeriod:           envDuration(quarantinePeriodEnv, 0),
+		activeWorkloadWindow:       envDuration(activeWorkloadWindowEnv, 0),
+		recentDeploymentWindow:     envDuration(recentDeploymentWindowEnv, 0),
+		approval: approvalSettings{
+			required: envBool(approvalRequiredEnv, false),
+			expiry:   envDuration(approvalExpiryEnv, 72*time.Hour),
+		},
+		iterationSchedule:  newIterationSchedule(envOrDefault(iterationScheduleEnv, ""), envOrDefault(iterationScheduleTimezoneEnv, "UTC")),
+		maintenanceWindows: newMaintenanceWindows(envOrDefault(maintenanceWindowsEnv, ""), envOrDefault(maintenanceTimezoneEnv, "UTC")),
+		namespaceNames:     newNamespaceNameFilter(envList(namespaceAllowEnv, nil), envList(namespaceDenyEnv, []string{"kube-.*", "default"})),
+		repoMissingPolicy:  envOrDefault(repoMissingPolicyEnv, repoMissingPolicySkip),
+		runOnce:            envBool(runOnceEnv, false),
+		pushgateway: pushgatewaySettings{
+			url: envOrDefault(pushgatewayURLEnv, ""),
+			job: envOrDefault(pushgatewayJobEnv, "buhtig-s8k"),
+		},
+		otlp: otlpSettings{
+			endpoint:    envOrDefault(otlpEndpointEnv, ""),
+			serviceName: envOrDefault(otlpServiceNameEnv, "buhtig-s8k"),
+			// interval is in milliseconds as OpenTelemetry SDKs expect
+			metricsExporter: envOrDefault(otlpMetricsExporterEnv, metricsExporterNone),
+			metricsInterval: time.Duration(envInt(otlpMetricExportIntervalEnv, 60000)) * time.Millisecond,
+		},
+		statsd: statsdSettings{
+			addr:     envOrDefault(statsdAddrEnv, ""),
+			flavor:   envOrDefault(statsdFlavorEnv, statsdFlavorDogStatsD),
+			prefix:   envOrDefault(statsdPrefixEnv, ""),
+			interval: envDuration(statsdIntervalEnv, 10*time.Second),
+		},
+
+		coexistenceMode:           envOrDefault(coexistenceModeEnv, coexistenceDefer),
+		foreignCleanupAnnotations: envList(foreignCleanupAnnotationsEnv, []string{"janitor/ttl", "janitor/expires"}),
+
+		prCommentEnabled:          envBool(prCommentEnabledEnv, false),
+		migrateOnStartup:          envOrDefault(migrateOnStartupEnv, migrateModeReport),
+		namespaceDeadline:         envDuration(namespaceDeadlineEnv, 10*time.Minute),
+		deploymentsPolicy:         envOrDefault(deploymentsPolicyEnv, deploymentsPolicyKeep),
+		githubEnvironmentTemplate: envOrDefault(githubEnvironmentTemplateEnv, ""),
+		summaryIssueInterval:      envDuration(summaryIssueIntervalEnv, 0),
+		staleAge:                  envDuration(staleAgeEnv, 30*24*time.Hour),
+		stuckTerminatingThreshold: envDuration(stuckTerminatingThresholdEnv, 30*time.Minute),
+		forceFinalize: forceFinalizeSettings{
+			timeout:    envDuration(forceFinalizeTimeoutEnv, 0),
+			finalizers: envList(forceFinalizeFinalizersEnv, nil),
+		},
+		helmCleanupFinalizer: envBool(helmCleanupFinalizerEnv, false),
+		eventsEnabled:        envBool(eventsEnabledEnv, true),
+		statusAnnotations:    envBool(statusAnnotationsEnv, false),
+		tombstoneRetention:   envDuration(tombstoneRetentionEnv, 0),
+		history: historySettings{
+			maxAge:     envDuration(historyMaxAgeEnv, 0),
+			maxEntries: envInt(historyMaxEntriesEnv, 1000),
+		},
+		branchEnvironments: envBool(branchEnvironmentsEnv, false),
+		cleanupPolicies:    envBool(cleanupPoliciesEnv, false),
+		admission: admissionSettings{
+			addr:                envOrDefault(admissionAddrEnv, ""),
+			certFile:            envOrDefault(admissionTLSCertEnv, ""),
+			keyFile:             envOrDefault(admissionTLSKeyEnv, ""),
+			validation:          envOrDefault(admissionValidationEnv, admissionValidationOff),
+			sourceURLTemplate:   envOrDefault(admissionSourceURLTplEnv, ""),
+			helmReleaseTemplate: envOrDefault(admissionHelmReleaseTplEnv, ""),
+		},
+
+		webhookAddr:   envOrDefault(webhookAddrEnv, ""),
+		webhookSecret: envOrDefault(webhookSecretEnv, ""),
+
+		gcRetention: envDuration(gcRetentionEnv, 7*24*time.Hour),
+		gcInterval:  envDuration(gcIntervalEnv, time.Hour),
+
+		gcOrphanedHelmReleases: envBool(gcOrphanedHelmReleasesEnv, false),
+
+		credentialsCheckInterval: envDuration(credentialsCheckIntervalEnv, time.Hour),
+		livenessTimeout:          envDuration(livenessTimeoutEnv, time.Hour),
+
+		helmVersion:        envOrDefault(helmVersionEnv, helmVersionAuto),
+		helmMaxConcurrency: envInt(helmMaxConcurrencyEnv, 3),
+		helmNoHooks:        envBool(helmNoHooksEnv, false),
+		helmKeepHistory:    envBool(helmKeepHistoryEnv, false),
+		helmTimeout:        envDuration(helmTimeoutEnv, 5*time.Minute),
+
+		helmClusterLeftovers: envOrDefault(helmClusterLeftoversEnv, leftoversPolicyReport),
+		helmWaitTimeout:      envDuration(helmWaitTimeoutEnv, 5*time.Minute),
+		helmSnapshot:         envOrDefault(helmSnapshotEnv, helmSnapshotNone),
+
+		preDeleteGate: preDeleteGateSettings{
+			url:     envOrDefault(preDeleteGateURLEnv, ""),
+			secret:  envOrDefault(preDeleteGateSecretEnv, ""),
+			timeout: envDuration(preDeleteGateTimeoutEnv, 30*time.Second),
+		},
+
+		velero: veleroSettings{
+			enabled:         envBool(veleroBackupEnv, false),
+			namespace:       envOrDefault(veleroNamespaceEnv, "velero"),
+			ttl:             envDuration(veleroBackupTTLEnv, 30*24*time.Hour),
+			storageLocation: envOrDefault(veleroStorageLocationEnv, ""),
+			timeout:         envDuration(veleroBackupTimeoutEnv, 30*time.Minute),
+		},
+
+		preDeleteJob: preDeleteJobSettings{
+			configMap: envOrDefault(preDeleteJobConfigMapEnv, ""),
+			namespace: konnect.CurrentNamespace(),
+			timeout:   envDuration(preDeleteJobTimeoutEnv, 10*time.Minute),
+		},
+
+		teardownWorkflow: teardownWorkflowSettings{
+			workflow: envOrDefault(teardownWorkflowEnv, ""),
+			ref:      envOrDefault(teardownWorkflowRefEnv, ""),
+			timeout:  envDuration(teardownWorkflowTimeoutEnv, 30*time.Minute),
+		},
+
+		database: databaseSettings{
+			images: map[string]string{
+				databaseEnginePostgres: envOrDefault(databaseDropPostgresImageEnv, "postgres:11-alpine"),
+				databaseEngineMySQL:    envOrDefault(databaseDropMySQLImageEnv, "mysql:5.7"),
+			},
+			timeout:          envDuration(databaseDropTimeoutEnv, 5*time.Minute),
+			secretNamespaces: envList(databaseSecretNamespacesEnv, nil),
+		},
+
+		flux: fluxSettings{
+			enabled:   envBool(fluxCleanupEnv, false),
+			namespace: envOrDefault(fluxNamespaceEnv, "flux-system"),
+			label:     envOrDefault(fluxNamespaceLabelEnv, "opuscapita.com/namespace"),
+		},
+
+		clusterCleanup: clusterCleanupSettings{
+			enabled: envBool(clusterCleanupEnv, false),
+			kinds: envList(clusterCleanupKindsEnv, []string{
+				"ClusterRoleBinding.rbac.authorization.k8s.io",
+				"PersistentVolume",
+				"ValidatingWebhookConfiguration.admissionregistration.k8s.io",
+				"MutatingWebhookConfiguration.admissionregistration.k8s.io",
+				"IngressClass.networking.k8s.io",
+			}),
+			label: envOrDefault(clusterCleanupLabelEnv, "opuscapita.com/namespace"),
+		},
+
+		loadBalancerTimeout: envDuration(loadBalancerTimeoutEnv, 5*time.Minute),
+
+		terraform: terraformSettings{
+			organization:  envOrDefault(tfcOrganizationEnv, ""),
+			organizations: envList(tfcOrganizationsEnv, nil),
+			workspaceTag:  envOrDefault(tfcWorkspaceTagEnv, ""),
+			timeout:       envDuration(tfcTimeoutEnv, 30*time.Minute),
+		},
+
+		dns: dnsSettings{
+			enabled: envBool(externalDNSCleanupEnv, false),
+			label:   envOrDefault(externalDNSNamespaceLabelEnv, "opuscapita.com/namespace"),
+		},
+
+		retryMaxAttempts:   envInt(retryMaxAttemptsEnv, 5),
+		retryBackoff:       envDuration(retryBackoffEnv, 10*time.Millisecond),
+		retryBackoffFactor: envFloat(retryBackoffFactorEnv, 1),
+		retryMaxBackoff:    envDuration(retryMaxBackoffEnv, time.Minute),
+		retryOn:            envList(retryOnEnv, []string{retryOnConflict}),
+
+		tillerTLS: helm.TLSOptions{
+			Enable:     envBool(tillerTLSEnableEnv, false),
+			Verify:     envBool(tillerTLSVerifyEnv, false),
+			CertFile:   envOrDefault(tillerTLSCertEnv, "/etc/tiller-tls/tls.crt"),
+			KeyFile:    envOrDefault(tillerTLSKeyEnv, "/etc/tiller-tls/tls.key"),
+			CACertFile: envOrDefault(tillerTLSCACertEnv, "/etc/tiller-tls/ca.crt"),
+			ServerName: envOrDefault(tillerTLSHostnameEnv, ""),
+		},
+		tillerless:    envBool(tillerlessEnv, false),
+		tillerStorage: envOrDefault(tillerStorageEnv, helm.StorageConfigMap),
+	}
+
+	if path := envOrDefault(configFileEnv, ""); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Failed to read config file %s: %v", path, err))
+		}
+		if err := yaml.UnmarshalStrict(data, &cfg.file); err != nil {
+			log.Fatal(fmt.Sprintf("Failed to parse config file %s: %v", path, err))
+		}
+	}
+
+	validateExtraResources(cfg.file.ExtraResources)
+
+	if token := envOrDefault(slackBotTokenEnv, ""); token != "" {
+		channel := envOrDefault(slackApprovalChannelEnv, "")
+		signingSecret := envOrDefault(slackSigningSecretEnv, "")
+		if channel == "" || signingSecret == "" {
+			log.Fatal(fmt.Sprintf("Envs %s and %s are required when %s is set", slackApprovalChannelEnv, slackSigningSecretEnv, slackBotTokenEnv))
+		}
+		if cfg.webhookAddr == "" {
+			log.Fatal(fmt.Sprintf("Env %s is required when %s is set, Slack interactions are received by webhook listener", webhookAddrEnv, slackBotTokenEnv))
+		}
+		cfg.approval.slack = &slackApprovals{client: slack.NewClient(token), signingSecret: signingSecret, channel: channel}
+	}
+
+	if url := envOrDefault(ingressTrafficPrometheusEnv, ""); url != "" {
+		cfg.ingressTraffic = ingressTrafficSettings{
+			client:    prometheus.NewClient(url, 30*time.Second),
+			query:     envOrDefault(ingressTrafficQueryEnv, defaultIngressTrafficQuery),
+			window:    envDuration(ingressTrafficWindowEnv, 24*time.Hour),
+			threshold: envFloat(ingressTrafficThresholdEnv, 0),
+		}
+		if _, err := renderTemplate(cfg.ingressTraffic.query, ingressTrafficQueryData{}); err != nil {
+			log.Fatal(fmt.Sprintf("Env %s should be valid Go template: %v", ingressTrafficQueryEnv, err))
+		}
+	}
+
+	if url := envOrDefault(opaURLEnv, ""); url != "" {
+		cfg.opa = opaSettings{client: opa.NewClient(url, envDuration(opaTimeoutEnv, 10*time.Second)), path: envOrDefault(opaPolicyPathEnv, "buhtig_s8k/deletion")}
+	}
+
+	if token := envOrDefault(tfcTokenEnv, ""); token != "" {
+		cfg.terraform.client = terraform.NewClient(envOrDefault(tfcURLEnv, "https://app.terraform.io"), token)
+		if pattern := envOrDefault(tfcWorkspacePatternEnv, ""); pattern != "" {
+			re, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				log.Fatal(fmt.Sprintf("Env %s should be valid regular expression: %v", tfcWorkspacePatternEnv, err))
+			}
+			cfg.terraform.workspacePattern = re
+		}
+		if cfg.terraform.workspacePattern == nil && cfg.terraform.workspaceTag == "" {
+			log.Fatal(fmt.Sprintf("Env %s or %s is required when %s is set", tfcWorkspacePatternEnv, tfcWorkspaceTagEnv, tfcTokenEnv))
+		}
+	}
+
+	switch cfg.helmSnapshot {
+	case helmSnapshotNone, helmSnapshotConfigMap:
+	case helmSnapshotArchive:
+		if cfg.file.Archive == nil {
+			log.Fatal(fmt.Sprintf("Env %s is '%s', but archive isn't configured in %s", helmSnapshotEnv, helmSnapshotArchive, configFileEnv))
+		}
+	default:
+		log.Fatal(fmt.Sprintf("Env %s should be one of '%s', '%s' or '%s'", helmSnapshotEnv, helmSnapshotNone, helmSnapshotArchive, helmSnapshotConfigMap))
+	}
+
+	if cfg.repoMissingPolicy != repoMissingPolicySkip && cfg.repoMissingPolicy != repoMissingPolicyDelete {
+		log.Fatal(fmt.Sprintf("Env %s should be either '%s' or '%s'", repoMissingPolicyEnv, repoMissingPolicySkip, repoMissingPolicyDelete))
+	}
+
+	switch cfg.deploymentsPolicy {
+	case deploymentsPolicyKeep, deploymentsPolicyDeactivate, deploymentsPolicyDelete:
+	default:
+		log.Fatal(fmt.Sprintf("Env %s should be one of '%s', '%s' or '%s'", deploymentsPolicyEnv, deploymentsPolicyKeep, deploymentsPolicyDeactivate, deploymentsPolicyDelete))
+	}
+
+	switch cfg.coexistenceMode {
+	case coexistenceDefer, coexistenceClaim, coexistenceIgnore:
+	default:
+		log.Fatal(fmt.Sprintf("Env %s should be one of '%s', '%s' or '%s'", coexistenceModeEnv, coexistenceDefer, coexistenceClaim, coexistenceIgnore))
+	}
+
+	switch cfg.admission.validation {
+	case admissionValidationOff, admissionValidationWarn, admissionValidationDeny:
+	default:
+		log.Fatal(fmt.Sprintf("Env %s should be one of '%s', '%s' or '%s'", admissionValidationEnv, admissionValidationOff, admissionValidationWarn, admissionValidationDeny))
+	}
+	if cfg.admission.addr != "" && (cfg.admission.certFile == "" || cfg.admission.keyFile == "") {
+		log.Fatal(fmt.Sprintf("Envs %s and %s are required when %s is set, API server calls webhooks only over TLS", admissionTLSCertEnv, admissionTLSKeyEnv, admissionAddrEnv))
+	}
+	for env, text := range map[string]string{admissionSourceURLTplEnv: cfg.admission.sourceURLTemplate, admissionHelmReleaseTplEnv: cfg.admission.helmReleaseTemplate} {
+		if _, err := renderTemplate(text, templateData{}); err != nil {
+			log.Fatal(fmt.Sprintf("Env %s should be valid Go template: %v", env, err))
+		}
+	}
+
+	headers, err := otlp.ParseHeaders(envOrDefault(otlpHeadersEnv, ""))
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Env %s is invalid: %v", otlpHeadersEnv, err))
+	}
+	cfg.otlp.headers = headers
+	switch cfg.otlp.metricsExporter {
+	case metricsExporterNone:
+	case metricsExporterOTLP:
+		if cfg.otlp.endpoint == "" {
+			log.Fatal(fmt.Sprintf("Env %s is required when %s is '%s'", otlpEndpointEnv, otlpMetricsExporterEnv, metricsExporterOTLP))
+		}
+		if cfg.otlp.metricsInterval <= 0 {
+			log.Fatal(fmt.Sprintf("Env %s should be positive number of milliseconds", otlpMetricExportIntervalEnv))
+		}
+	default:
+		log.Fatal(fmt.Sprintf("Env %s should be '%s' or '%s'", otlpMetricsExporterEnv, metricsExporterOTLP, metricsExporterNone))
+	}
+
+	switch cfg.statsd.flavor {
+	case statsdFlavorDogStatsD, statsdFlavorStatsD:
+	default:
+		log.Fatal(fmt.Sprintf("Env %s should be '%s' or '%s'", statsdFlavorEnv, statsdFlavorDogStatsD, statsdFlavorStatsD))
+	}
+	if cfg.statsd.addr != "" && cfg.statsd.interval <= 0 {
+		log.Fatal(fmt.Sprintf("Env %s should be positive", statsdIntervalEnv))
+	}
+
+	if cfg.pushgateway.url != "" && !cfg.runOnce {
+		log.Warn(fmt.Sprintf("Env %s is ignored unless %s is set, metrics of long-running app are scraped", pushgatewayURLEnv, runOnceEnv))
+	}
+
+	switch cfg.migrateOnStartup {
+	case migrateModeOff, migrateModeReport, migrateModeApply:
+	default:
+		log.Fatal(fmt.Sprintf("Env %s should be one of '%s', '%s' or '%s'", migrateOnStartupEnv, migrateModeOff, migrateModeReport, migrateModeApply))
+	}
+
+	switch cfg.helmVersion {
+	case helmVersion2, helmVersion3, helmVersionAuto:
+	default:
+		log.Fatal(fmt.Sprintf("Env %s should be one of '%s', '%s' or '%s'", helmVersionEnv, helmVersion2, helmVersion3, helmVersionAuto))
+	}
+
+	switch cfg.helmClusterLeftovers {
+	case leftoversPolicyIgnore, leftoversPolicyReport, leftoversPolicyDelete:
+	default:
+		log.Fatal(fmt.Sprintf("Env %s should be one of '%s', '%s' or '%s'", helmClusterLeftoversEnv, leftoversPolicyIgnore, leftoversPolicyReport, leftoversPolicyDelete))
+	}
+
+	if cfg.retryMaxAttempts < 1 {
+		log.Fatal(fmt.Sprintf("Env %s should be positive", retryMaxAttemptsEnv))
+	}
+	if cfg.retryBackoffFactor < 1 {
+		log.Fatal(fmt.Sprintf("Env %s should be at least 1", retryBackoffFactorEnv))
+	}
+	for _, class := range cfg.retryOn {
+		known := false
+		for _, c := range retryClasses {
+			known = known || c == class
+		}
+		if !known {
+			log.Fatal(fmt.Sprintf("Env %s should list some of '%s'", retryOnEnv, strings.Join(retryClasses, "', '")))
+		}
+	}
+
+	if cfg.forceFinalize.timeout > 0 {
+		if len(cfg.forceFinalize.finalizers) == 0 {
+			log.Fatal(fmt.Sprintf("Env %s is required when %s is set", forceFinalizeFinalizersEnv, forceFinalizeTimeoutEnv))
+		}
+		if cfg.stuckTerminatingThreshold <= 0 {
+			log.Fatal(fmt.Sprintf("Env %s requires detection of stuck namespaces, %s shouldn't be 0", forceFinalizeTimeoutEnv, stuckTerminatingThresholdEnv))
+		}
+	}
+
+	if cfg.tillerStorage != helm.StorageConfigMap && cfg.tillerStorage != helm.StorageSecret {
+		log.Fatal(fmt.Sprintf("Env %s should be either '%s' or '%s'", tillerStorageEnv, helm.StorageConfigMap, helm.StorageSecret))
+	}
+
+	return cfg
+}
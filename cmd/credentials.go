@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+
+	github "github.com/OpusCapita/buhtig-s8k/pkg/github"
+	"github.com/OpusCapita/buhtig-s8k/pkg/helm"
+)
+
+// names of readiness checks
+const (
+	githubTokenCheck = "github-token"
+	kubernetesCheck  = "kubernetes"
+	tillerCheck      = "tiller"
+)
+
+// runCredentialsValidator validates Github token on startup and then periodically;
+// invalid token fails readiness, otherwise it would just look like endless non-404 responses of branch checks
+func runCredentialsValidator(ghClient *github.Client, interval time.Duration) {
+	runReadinessCheck(githubTokenCheck, interval, func() error {
+		return validateGithubToken(ghClient)
+	})
+}
+
+// runKubernetesCheck checks connection to Kubernetes API on startup and then periodically
+func runKubernetesCheck(k8sClient kubernetes.Interface, interval time.Duration) {
+	runReadinessCheck(kubernetesCheck, interval, func() error {
+		if _, err := k8sClient.Discovery().ServerVersion(); err != nil {
+			return fmt.Errorf("Kubernetes API isn't reachable: %v", err)
+		}
+		return nil
+	})
+}
+
+// runTillerCheck checks that Helm 2 releases can be read through Tiller or from its storage, newReleases is called
+// for every check and its result is closed afterwards, so that tunnel to Tiller isn't kept open between checks
+func runTillerCheck(newReleases func() helm.Releases, interval time.Duration) {
+	runReadinessCheck(tillerCheck, interval, func() error {
+		releases := newReleases()
+		defer releases.Close()
+		return releases.Ping()
+	})
+}
+
+// validateGithubToken checks that token is accepted by Github and has access to repositories
+func validateGithubToken(ghClient *github.Client) error {
+	info, err := ghClient.TokenInfo()
+	if err != nil {
+		return err
+	}
+	if !info.HasScope("repo", "public_repo") {
+		return fmt.Errorf("token of '%s' has scopes %v, but 'repo' (or 'public_repo' for public repositories only) is required", info.Login, info.Scopes)
+	}
+
+	log.WithFields(log.Fields{"login": info.Login, "rate_limit_remaining": info.RateLimitRemaining, "rate_limit_reset": info.RateLimitReset.Format(time.RFC3339)}).Debug("Github token is valid")
+	if info.RateLimitRemaining == 0 {
+		log.WithField("rate_limit_reset", info.RateLimitReset.Format(time.RFC3339)).Warn("Github rate limit is exhausted")
+	}
+	return nil
+}
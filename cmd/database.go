@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// database engines whose databases can be dropped
+const (
+	databaseEnginePostgres = "postgres"
+	databaseEngineMySQL    = "mysql"
+)
+
+// databaseNameRe restricts database names, so that they can be safely put into SQL
+var databaseNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,63}$`)
+
+// drop commands read connection settings from standard env variables of clients, which are taken from Secret
+var databaseDropCommands = map[string]string{
+	databaseEnginePostgres: `psql -v ON_ERROR_STOP=1 -d "${PGDATABASE:-postgres}" -c "DROP DATABASE IF EXISTS \"$DATABASE_NAME\""`,
+	databaseEngineMySQL:    `mysql -u "$MYSQL_USER" -e "DROP DATABASE IF EXISTS ` + "\\`$DATABASE_NAME\\`" + `"`,
+}
+
+// databaseSettings configure dropping of per-branch databases
+type databaseSettings struct {
+	// images of database clients by engine
+	images  map[string]string
+	timeout time.Duration
+	// secretNamespaces are namespaces other than the namespace itself whose Secrets can be referenced
+	secretNamespaces []string
+}
+
+// databaseDropJob returns Job which drops database declared by namespace annotations or nil if there's none.
+// Job runs in the namespace of Secret with connection settings (the namespace itself if Secret is referenced by name).
+// Secrets of other namespaces can be referenced only if they're allowed by settings, otherwise anyone who can
+// annotate namespace could run SQL with credentials of other teams.
+func databaseDropJob(ns *namespace, settings databaseSettings) (*batchv1.Job, error) {
+	annotations := ns.ObjectMeta.Annotations
+	name := strings.TrimSpace(annotations[databaseAnnotationName])
+	if name == "" {
+		return nil, nil
+	}
+	if !databaseNameRe.MatchString(name) {
+		return nil, fmt.Errorf("Database name '%s' should match %s", name, databaseNameRe)
+	}
+
+	secretNamespace, secretName := ns.Name(), strings.TrimSpace(annotations[databaseSecretAnnotationName])
+	if parts := strings.SplitN(secretName, "/", 2); len(parts) == 2 {
+		secretNamespace, secretName = parts[0], parts[1]
+	}
+	if secretName == "" {
+		return nil, fmt.Errorf("Annotation %s is required when %s is set", databaseSecretAnnotationName, databaseAnnotationName)
+	}
+	allowed := secretNamespace == ns.Name()
+	for _, n := range settings.secretNamespaces {
+		allowed = allowed || n == secretNamespace
+	}
+	if !allowed {
+		return nil, fmt.Errorf("Secret %s/%s can't be used, namespace %s isn't in %s", secretNamespace, secretName, secretNamespace, databaseSecretNamespacesEnv)
+	}
+
+	engine := annotations[databaseEngineAnnotationName]
+	if engine == "" {
+		engine = databaseEnginePostgres
+	}
+	command, ok := databaseDropCommands[engine]
+	if !ok {
+		return nil, fmt.Errorf("Unknown database engine '%s', should be either '%s' or '%s'", engine, databaseEnginePostgres, databaseEngineMySQL)
+	}
+
+	backoffLimit := int32(2)
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			// namespace UID keeps Jobs of different namespaces apart when they run in shared namespace,
+			// including namespaces recreated with the same name
+			Name:      fmt.Sprintf("%s-drop-db-%s", componentName, ns.UID),
+			Namespace: secretNamespace,
+			Labels:    map[string]string{managedByLabel: componentName},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{{
+						Name:    "drop-database",
+						Image:   settings.images[engine],
+						Command: []string{"sh", "-c", command},
+						Env:     []corev1.EnvVar{{Name: "DATABASE_NAME", Value: name}},
+						EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}}}},
+					}},
+				},
+			},
+		},
+	}, nil
+}
+
+// isDatabaseDroppedIfNeeded drops per-branch database declared by 'opuscapita.com/database' annotation with a Job
+// running database client, since preview environments with external databases otherwise leak them forever.
+// It runs before Helm release is deleted, which may delete Secret with connection settings.
+func isDatabaseDroppedIfNeeded(k8sClient kubernetes.Interface, settings databaseSettings) func(*namespace) stepResult {
+	return func(ns *namespace) stepResult {
+		job, err := databaseDropJob(ns, settings)
+		if err != nil {
+			ns.logger().Error(err)
+			return stepFailed
+		}
+		if job == nil {
+			return stepDone
+		}
+		return runJob(k8sClient, ns, job, settings.timeout, "database drop Job", "database "+ns.ObjectMeta.Annotations[databaseAnnotationName])
+	}
+}
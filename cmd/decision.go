@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// actions which decision engine can come up with
+const (
+	// actionDelete means namespace should be terminated
+	actionDelete = "delete"
+	// actionWait means namespace is a deletion candidate, but deletion isn't confirmed yet
+	actionWait = "wait"
+	// actionSkip means namespace should be left alone
+	actionSkip = "skip"
+)
+
+// policy is a set of rules decision engine applies
+type policy struct {
+	branchMissingConfirmations int
+	repoMissingPolicy          string
+	coexistenceMode            string
+	foreignCleanupAnnotations  []string
+	gracePeriod                time.Duration
+}
+
+// newPolicy builds policy from app config
+func newPolicy(cfg config) policy {
+	return policy{
+		branchMissingConfirmations: cfg.branchMissingConfirmations,
+		repoMissingPolicy:          cfg.repoMissingPolicy,
+		coexistenceMode:            cfg.coexistenceMode,
+		foreignCleanupAnnotations:  cfg.foreignCleanupAnnotations,
+		gracePeriod:                cfg.deletionGracePeriod,
+	}
+}
+
+// evaluation is everything known about namespace at the moment of decision
+type evaluation struct {
+	ns *namespace
+	// branchStatus is HTTP status of branch check
+	branchStatus int
+	// repoStatus is HTTP status of repository check, it's only performed if branch check returned 404
+	repoStatus int
+	// now is the moment of decision, grace period is counted from it
+	now time.Time
+}
+
+// short reasons of skipping namespace which are used as metric labels
+const (
+	skipReasonProtected   = "protected"
+	skipReasonNameFilter  = "name-filter"
+	skipReasonBudget      = "deletion-budget"
+	skipReasonMaintenance = "maintenance-window"
+	skipReasonPaused      = "paused"
+	skipReasonPolicy      = "policy"
+	skipReasonPredicate   = "predicate"
+)
+
+// decision is result of evaluation with trace explaining how it was made
+type decision struct {
+	action string
+	reason string
+	// skipReason is one of skipReason* constants for skips which are counted in metrics, it's empty otherwise
+	skipReason string
+	// branchMissingCount is the value of consecutive 404 counter which should be persisted, 0 resets it
+	branchMissingCount int
+	// deleteAfter is deletion mark of namespace which should be persisted, zero value removes it
+	deleteAfter time.Time
+	trace       []string
+}
+
+func (d *decision) tracef(format string, args ...interface{}) {
+	d.trace = append(d.trace, fmt.Sprintf(format, args...))
+}
+
+// evaluate is the decision engine: it doesn't do any I/O and thus can be run offline (see 'eval' command)
+func evaluate(p policy, e evaluation) decision {
+	d := decision{deleteAfter: e.ns.DeleteAfter()}
+
+	if e.ns.IsProtected() {
+		d.action = actionSkip
+		d.skipReason = skipReasonProtected
+		d.reason = fmt.Sprintf("namespace is protected by annotation '%s'", protectedAnnotationName)
+		d.tracef("%s, it's never deleted automatically", d.reason)
+		d.branchMissingCount = e.ns.BranchMissingCount()
+		if !d.deleteAfter.IsZero() {
+			d.tracef("deletion mark is removed")
+			d.deleteAfter = time.Time{}
+		}
+		return d
+	}
+
+	if reason := otherControllerReason(p, e.ns); reason != "" {
+		d.action = actionSkip
+		d.reason = reason
+		d.tracef("coexistence mode is '%s', %s", p.coexistenceMode, reason)
+		d.branchMissingCount = e.ns.BranchMissingCount()
+		return d
+	}
+
+	d.tracef("branch check returned status %d", e.branchStatus)
+	if e.branchStatus != 404 {
+		d.action = actionSkip
+		d.reason = fmt.Sprintf("branch check returned status %d", e.branchStatus)
+		d.tracef("branch is not missing, counter of consecutive 404s is reset")
+		if !d.deleteAfter.IsZero() {
+			d.tracef("deletion mark is removed")
+			d.deleteAfter = time.Time{}
+		}
+		return d
+	}
+
+	d.tracef("repository check returned status %d", e.repoStatus)
+	switch e.repoStatus {
+	case 200:
+		d.tracef("repository is accessible, branch is missing")
+	case 404:
+		if p.repoMissingPolicy != repoMissingPolicyDelete {
+			d.action = actionSkip
+			d.reason = "repository is missing or not accessible"
+			d.tracef("repository missing policy is '%s', leaving namespace alone", p.repoMissingPolicy)
+			d.branchMissingCount = e.ns.BranchMissingCount()
+			return d
+		}
+		d.tracef("repository missing policy is '%s', treating branch as deleted", p.repoMissingPolicy)
+	default:
+		d.action = actionSkip
+		d.reason = fmt.Sprintf("repository check returned status %d", e.repoStatus)
+		d.tracef("can't confirm branch deletion")
+		d.branchMissingCount = e.ns.BranchMissingCount()
+		return d
+	}
+
+	d.branchMissingCount = e.ns.BranchMissingCount() + 1
+	d.tracef("branch is missing on %d of %d required consecutive checks", d.branchMissingCount, p.branchMissingConfirmations)
+	if d.branchMissingCount < p.branchMissingConfirmations {
+		d.action = actionWait
+		d.reason = "waiting for branch deletion to be confirmed"
+		return d
+	}
+
+	if gracePeriod := gracePeriod(p, e.ns, &d); gracePeriod > 0 {
+		if d.deleteAfter.IsZero() {
+			d.deleteAfter = e.now.Add(gracePeriod).Truncate(time.Second)
+			d.tracef("grace period is %s, namespace is marked for deletion after %s", gracePeriod, d.deleteAfter.UTC().Format(time.RFC3339))
+		}
+		if e.now.Before(d.deleteAfter) {
+			d.action = actionWait
+			d.reason = fmt.Sprintf("namespace is marked for deletion after %s", d.deleteAfter.UTC().Format(time.RFC3339))
+			return d
+		}
+		d.tracef("deletion mark %s has passed", d.deleteAfter.UTC().Format(time.RFC3339))
+	}
+
+	d.action = actionDelete
+	d.reason = "branch is deleted"
+	return d
+}
+
+// IsProtected checks if namespace is exempted from automatic deletion
+func (ns *namespace) IsProtected() bool {
+	protected, _ := strconv.ParseBool(ns.ObjectMeta.Annotations[protectedAnnotationName])
+	return protected
+}
+
+// gracePeriod returns grace period of namespace: global one is overridden by namespace annotation
+func gracePeriod(p policy, ns *namespace, d *decision) time.Duration {
+	val, ok := ns.ObjectMeta.Annotations[deletionGracePeriodAnnotationName]
+	if !ok {
+		return p.gracePeriod
+	}
+	gracePeriod, err := time.ParseDuration(val)
+	if err != nil || gracePeriod < 0 {
+		d.tracef("annotation '%s' should be non-negative duration, got '%s', using global grace period", deletionGracePeriodAnnotationName, val)
+		return p.gracePeriod
+	}
+	d.tracef("grace period is overridden by annotation '%s'", deletionGracePeriodAnnotationName)
+	return gracePeriod
+}
+
+// otherControllerReason returns non-empty reason if namespace should be left to another cleanup controller
+func otherControllerReason(p policy, ns *namespace) string {
+	switch p.coexistenceMode {
+	case coexistenceDefer:
+		for _, name := range p.foreignCleanupAnnotations {
+			if _, ok := ns.ObjectMeta.Annotations[name]; ok {
+				return fmt.Sprintf("namespace is managed by another cleanup controller (annotation '%s')", name)
+			}
+		}
+	case coexistenceClaim:
+		if owner := ns.ObjectMeta.Annotations[claimedByAnnotationName]; owner != "" && owner != componentName {
+			return fmt.Sprintf("namespace is claimed by '%s'", owner)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestEvaluate(t *testing.T) {
+	p := policy{branchMissingConfirmations: 3, repoMissingPolicy: repoMissingPolicySkip}
+
+	tests := []struct {
+		name         string
+		missingCount string
+		branchStatus int
+		repoStatus   int
+		policy       policy
+		action       string
+		count        int
+	}{
+		{"branch exists", "2", 200, 0, p, actionSkip, 0},
+		{"first 404", "", 404, 200, p, actionWait, 1},
+		{"second 404", "1", 404, 200, p, actionWait, 2},
+		{"confirmed 404", "2", 404, 200, p, actionDelete, 3},
+		{"repo missing is skipped", "2", 404, 404, p, actionSkip, 2},
+		{"repo missing is deleted", "2", 404, 404, policy{branchMissingConfirmations: 3, repoMissingPolicy: repoMissingPolicyDelete}, actionDelete, 3},
+		{"repo check failed", "1", 404, 500, p, actionSkip, 1},
+	}
+
+	for _, test := range tests {
+		k8sNs := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "One"}}
+		if test.missingCount != "" {
+			metav1.SetMetaDataAnnotation(&k8sNs.ObjectMeta, branchMissingCountAnnotationName, test.missingCount)
+		}
+
+		d := evaluate(test.policy, evaluation{ns: newNamespace(k8sNs), branchStatus: test.branchStatus, repoStatus: test.repoStatus})
+
+		if d.action != test.action {
+			t.Errorf("%s: expected action %s, but got %s (%v)", test.name, test.action, d.action, d.trace)
+		}
+		if d.branchMissingCount != test.count {
+			t.Errorf("%s: expected count %d, but got %d", test.name, test.count, d.branchMissingCount)
+		}
+	}
+}
+
+func TestEvaluate_GracePeriod(t *testing.T) {
+	p := policy{branchMissingConfirmations: 1, gracePeriod: 24 * time.Hour}
+	now := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		gracePeriod  string
+		deleteAfter  string
+		branchStatus int
+		action       string
+		mark         time.Time
+	}{
+		{"first confirmed 404 marks namespace", "", "", 404, actionWait, now.Add(24 * time.Hour)},
+		{"marked namespace waits", "", "2019-07-02T09:00:00Z", 404, actionWait, time.Date(2019, 7, 2, 9, 0, 0, 0, time.UTC)},
+		{"deadline passed", "", "2019-07-01T09:00:00Z", 404, actionDelete, time.Date(2019, 7, 1, 9, 0, 0, 0, time.UTC)},
+		{"restored branch removes mark", "", "2019-07-01T09:00:00Z", 200, actionSkip, time.Time{}},
+		{"annotation overrides grace period", "48h", "", 404, actionWait, now.Add(48 * time.Hour)},
+		{"annotation disables grace period", "0", "", 404, actionDelete, time.Time{}},
+		{"invalid annotation is ignored", "soon", "", 404, actionWait, now.Add(24 * time.Hour)},
+	}
+
+	for _, test := range tests {
+		k8sNs := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "One"}}
+		if test.gracePeriod != "" {
+			metav1.SetMetaDataAnnotation(&k8sNs.ObjectMeta, deletionGracePeriodAnnotationName, test.gracePeriod)
+		}
+		if test.deleteAfter != "" {
+			metav1.SetMetaDataAnnotation(&k8sNs.ObjectMeta, deleteAfterAnnotationName, test.deleteAfter)
+		}
+
+		d := evaluate(p, evaluation{ns: newNamespace(k8sNs), branchStatus: test.branchStatus, repoStatus: 200, now: now})
+
+		if d.action != test.action {
+			t.Errorf("%s: expected action %s, but got %s (%v)", test.name, test.action, d.action, d.trace)
+		}
+		if !d.deleteAfter.Equal(test.mark) {
+			t.Errorf("%s: expected mark %v, but got %v", test.name, test.mark, d.deleteAfter)
+		}
+	}
+}
+
+func TestEvaluate_Protected(t *testing.T) {
+	p := policy{branchMissingConfirmations: 1, repoMissingPolicy: repoMissingPolicyDelete}
+	for value, action := range map[string]string{"true": actionSkip, "false": actionDelete, "yes": actionDelete} {
+		k8sNs := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "One"}}
+		metav1.SetMetaDataAnnotation(&k8sNs.ObjectMeta, protectedAnnotationName, value)
+
+		d := evaluate(p, evaluation{ns: newNamespace(k8sNs), branchStatus: 404, repoStatus: 404})
+
+		if d.action != action {
+			t.Errorf("Expected action %s for '%s', but got %s (%v)", action, value, d.action, d.trace)
+		}
+		if (d.skipReason == skipReasonProtected) != (action == actionSkip) {
+			t.Errorf("Unexpected skip reason '%s' for '%s'", d.skipReason, value)
+		}
+	}
+}
+
+func TestEvaluate_Coexistence(t *testing.T) {
+	tests := []struct {
+		mode        string
+		annotations map[string]string
+		action      string
+	}{
+		{coexistenceDefer, map[string]string{"janitor/ttl": "24h"}, actionSkip},
+		{coexistenceDefer, map[string]string{claimedByAnnotationName: "kube-janitor"}, actionDelete},
+		{coexistenceClaim, map[string]string{"janitor/ttl": "24h"}, actionDelete},
+		{coexistenceClaim, map[string]string{claimedByAnnotationName: "kube-janitor"}, actionSkip},
+		{coexistenceClaim, map[string]string{claimedByAnnotationName: componentName}, actionDelete},
+		{coexistenceIgnore, map[string]string{"janitor/ttl": "24h"}, actionDelete},
+	}
+
+	for _, test := range tests {
+		p := policy{
+			branchMissingConfirmations: 1,
+			coexistenceMode:            test.mode,
+			foreignCleanupAnnotations:  []string{"janitor/ttl"},
+		}
+		k8sNs := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "One", Annotations: test.annotations}}
+
+		d := evaluate(p, evaluation{ns: newNamespace(k8sNs), branchStatus: 404, repoStatus: 200})
+
+		if d.action != test.action {
+			t.Errorf("%s %v: expected action %s, but got %s", test.mode, test.annotations, test.action, d.action)
+		}
+	}
+}
+
+func TestRecordDecisionEvents(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	eventRecorder = recorder
+	defer func() { eventRecorder = nil }()
+
+	now := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	p := policy{branchMissingConfirmations: 1, repoMissingPolicy: repoMissingPolicySkip, gracePeriod: time.Hour}
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "One"}})
+
+	e := evaluation{ns: ns, branchStatus: 404, repoStatus: 200, now: now}
+	recordDecisionEvents(ns, e, evaluate(p, e))
+	for _, expected := range []string{
+		"Normal BranchDeleted Source branch is missing (status 404)",
+		"Normal MarkedForDeletion Namespace is marked for deletion after 2019-07-01T11:00:00Z",
+	} {
+		if event := <-recorder.Events; event != expected {
+			t.Errorf("Expected event '%s', got '%s'", expected, event)
+		}
+	}
+
+	metav1.SetMetaDataAnnotation(&ns.ObjectMeta, branchMissingCountAnnotationName, "1")
+	metav1.SetMetaDataAnnotation(&ns.ObjectMeta, deleteAfterAnnotationName, "2019-07-01T11:00:00Z")
+	recordDecisionEvents(ns, e, evaluate(p, e))
+	if len(recorder.Events) != 0 {
+		t.Errorf("Expected no events while namespace waits, got '%s'", <-recorder.Events)
+	}
+
+	e.branchStatus = 200
+	recordDecisionEvents(ns, e, evaluate(p, e))
+	if event := <-recorder.Events; event != "Normal DeletionCancelled Deletion is cancelled: branch check returned status 200" {
+		t.Errorf("Unexpected event '%s'", event)
+	}
+}
+
+func TestEvaluateOffline(t *testing.T) {
+	// 2019-07-01 is Monday
+	now := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	cfg := config{
+		branchMissingConfirmations: 1,
+		repoMissingPolicy:          repoMissingPolicySkip,
+		namespaceNames:             newNamespaceNameFilter(nil, []string{"kube-.*"}),
+		maintenanceWindows:         newMaintenanceWindows("Mon-Fri 08:00-18:00", "UTC"),
+	}
+	approval := approvalSettings{required: true, expiry: time.Hour}
+
+	tests := []struct {
+		name        string
+		nsName      string
+		annotations map[string]string
+		approval    approvalSettings
+		now         time.Time
+		action      string
+	}{
+		{"deleted", "preview", nil, approvalSettings{}, now, actionDelete},
+		{"denied by name", "kube-preview", nil, approvalSettings{}, now, actionSkip},
+		{"outside of maintenance window", "preview", nil, approvalSettings{}, now.Add(10 * time.Hour), actionWait},
+		{"waiting for approval", "preview", nil, approval, now, actionWait},
+		{"approved", "preview", map[string]string{approvedByAnnotationName: "jdoe"}, approval, now, actionDelete},
+		{"rejected", "preview", map[string]string{rejectedByAnnotationName: "jdoe"}, approval, now, actionSkip},
+		{"approval expired", "preview", map[string]string{approvalExpiredAnnotationName: "2019-07-01T09:00:00Z"}, approval, now, actionSkip},
+	}
+
+	for _, test := range tests {
+		cfg.approval = test.approval
+		k8sNs := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: test.nsName, Annotations: test.annotations}}
+
+		d := evaluateOffline(cfg, evaluation{ns: newNamespace(k8sNs), branchStatus: 404, repoStatus: 200, now: test.now})
+
+		if d.action != test.action {
+			t.Errorf("%s: expected action %s, but got %s (%v)", test.name, test.action, d.action, d.trace)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/OpusCapita/buhtig-s8k/pkg/aws"
+	cleanup "github.com/OpusCapita/buhtig-s8k/pkg/cleanup"
+	"github.com/OpusCapita/buhtig-s8k/pkg/dns"
+)
+
+// dnsEndpointKind is custom resource of external-dns CRD source
+var dnsEndpointKind = schema.GroupVersionKind{Group: "externaldns.k8s.io", Kind: "DNSEndpoint"}
+
+// externalDNSHostnameAnnotation is set on Services and Ingresses to make external-dns create records
+const externalDNSHostnameAnnotation = "external-dns.alpha.kubernetes.io/hostname"
+
+// dnsSettings configure cleanup of DNS records of the environment
+type dnsSettings struct {
+	enabled bool
+	// label whose value is name of branch namespace, DNSEndpoints labeled so are deleted in any namespace
+	label string
+}
+
+// dnsProvider is configured provider with the domain it manages
+type dnsProvider struct {
+	dns.Provider
+	domain string
+	// txtPrefix is prefix of names of external-dns ownership records
+	txtPrefix string
+}
+
+// manages checks if hostname belongs to domain of provider
+func (p dnsProvider) manages(hostname string) bool {
+	domain := strings.TrimSuffix(strings.ToLower(p.domain), ".")
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+	return hostname == domain || strings.HasSuffix(hostname, "."+domain)
+}
+
+// newDNSProviders builds providers from config; it exits on misconfiguration
+func newDNSProviders(targets []dnsProviderTarget) []dnsProvider {
+	providers := []dnsProvider{}
+	var awsSession *session.Session
+	for _, target := range targets {
+		// provider without domain would handle hostnames of every zone it can see
+		if strings.Trim(target.Domain, ".") == "" {
+			log.Fatal(fmt.Sprintf("Domain of DNS provider '%s' should be set", target.Type))
+		}
+		var provider dns.Provider
+		switch target.Type {
+		case "route53":
+			if awsSession == nil {
+				sess, err := aws.NewSession()
+				if err != nil {
+					log.Fatal(err)
+				}
+				awsSession = sess
+			}
+			provider = dns.NewRoute53(awsSession, target.ZoneID)
+		case "clouddns":
+			p, err := dns.NewCloudDNS(target.Project, target.Zone, os.Getenv(target.CredentialsFileEnv))
+			if err != nil {
+				log.Fatal(err)
+			}
+			provider = p
+		default:
+			log.Fatal(fmt.Sprintf("Unknown DNS provider type '%s'", target.Type))
+		}
+		providers = append(providers, dnsProvider{Provider: provider, domain: target.Domain, txtPrefix: target.TXTPrefix})
+	}
+	return providers
+}
+
+// splitHostnames splits comma-separated list of hostnames, as external-dns annotations have it
+func splitHostnames(val string) []string {
+	hostnames := []string{}
+	for _, h := range strings.Split(val, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hostnames = append(hostnames, h)
+		}
+	}
+	return hostnames
+}
+
+// objectHostnames returns hostnames external-dns creates records for from Service, Ingress or DNSEndpoint
+func objectHostnames(obj *unstructured.Unstructured) []string {
+	hostnames := splitHostnames(obj.GetAnnotations()[externalDNSHostnameAnnotation])
+
+	switch obj.GetKind() {
+	case "Ingress":
+		rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+		for _, rule := range rules {
+			if r, ok := rule.(map[string]interface{}); ok {
+				if host, _ := r["host"].(string); host != "" {
+					hostnames = append(hostnames, host)
+				}
+			}
+		}
+		tls, _, _ := unstructured.NestedSlice(obj.Object, "spec", "tls")
+		for _, t := range tls {
+			if m, ok := t.(map[string]interface{}); ok {
+				hosts, _, _ := unstructured.NestedStringSlice(m, "hosts")
+				hostnames = append(hostnames, hosts...)
+			}
+		}
+	case "DNSEndpoint":
+		endpoints, _, _ := unstructured.NestedSlice(obj.Object, "spec", "endpoints")
+		for _, endpoint := range endpoints {
+			if e, ok := endpoint.(map[string]interface{}); ok {
+				if name, _ := e["dnsName"].(string); name != "" {
+					hostnames = append(hostnames, name)
+				}
+			}
+		}
+	}
+	return hostnames
+}
+
+// externalDNSResource returns reference of DNS source as external-dns keeps it in ownership TXT record,
+// e.g. 'ingress/NAMESPACE/NAME'
+func externalDNSResource(obj *unstructured.Unstructured) string {
+	kind := strings.ToLower(obj.GetKind())
+	if obj.GetKind() == dnsEndpointKind.Kind {
+		kind = "crd"
+	}
+	return kind + "/" + obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// dnsSources collects hostnames and external-dns references of DNS sources
+type dnsSources struct {
+	hostnames map[string]bool
+	resources map[string]bool
+}
+
+func newDNSSources() dnsSources {
+	return dnsSources{hostnames: map[string]bool{}, resources: map[string]bool{}}
+}
+
+func (s dnsSources) addHostname(h string) {
+	// wildcard records can't be attributed to a single environment
+	if !strings.HasPrefix(h, "*") {
+		s.hostnames[strings.TrimSuffix(strings.ToLower(h), ".")] = true
+	}
+}
+
+// collect lists objects of kind matching selector except excluded ones (by external-dns reference), adds them
+// to sources and returns them
+func (s dnsSources) collect(deleter *cleanup.Deleter, gvk schema.GroupVersionKind, namespace, selector string, excluded map[string]bool) ([]cleanup.Object, error) {
+	return deleter.ListFunc(gvk, namespace, selector, func(obj *unstructured.Unstructured) bool {
+		resource := externalDNSResource(obj)
+		if excluded[resource] {
+			return false
+		}
+		s.resources[resource] = true
+		for _, h := range objectHostnames(obj) {
+			s.addHostname(h)
+		}
+		return true
+	})
+}
+
+// isDNSCleanedIfNeeded deletes external-dns DNSEndpoints of the environment and, if DNS providers are configured,
+// records of its hostnames directly in providers. Hostnames are collected from Ingresses, annotated Services,
+// DNSEndpoints and 'opuscapita.com/hostnames' namespace annotation, so it runs before they're deleted.
+// external-dns doesn't delete records with 'upsert-only' policy and misses deletions when it's down,
+// which leaves preview URLs resolving to released load balancers (possibly reused by other tenants).
+// Records are deleted only if external-dns ownership record names one of sources of the environment, and hostnames
+// still served by sources in other namespaces (e.g. path-based Ingresses on shared host) are left alone.
+func isDNSCleanedIfNeeded(deleter *cleanup.Deleter, settings dnsSettings, providers []dnsProvider) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if !settings.enabled {
+			return true
+		}
+		logger := ns.logger()
+
+		own := newDNSSources()
+		for _, h := range splitHostnames(ns.ObjectMeta.Annotations[hostnamesAnnotationName]) {
+			own.addHostname(h)
+		}
+		kinds := append([]schema.GroupVersionKind{serviceKind}, ingressKinds...)
+		for _, kind := range kinds {
+			if _, err := own.collect(deleter, kind, ns.Name(), "", nil); err != nil {
+				logger.WithField("kind", kind.Kind).WithError(err).Error("Failed to list DNS sources")
+				return false
+			}
+		}
+
+		endpoints, err := own.collect(deleter, dnsEndpointKind, ns.Name(), "", nil)
+		if err != nil {
+			logger.WithError(err).Error("Failed to list DNSEndpoints")
+			return false
+		}
+		if settings.label != "" {
+			labeled, err := own.collect(deleter, dnsEndpointKind, "", fmt.Sprintf("%s=%s", settings.label, ns.Name()), nil)
+			if err != nil {
+				logger.WithError(err).Error("Failed to list DNSEndpoints")
+				return false
+			}
+			endpoints = append(endpoints, labeled...)
+		}
+
+		// hostnames of sources outside of the environment are checked before anything is deleted
+		foreign := newDNSSources()
+		if len(providers) > 0 {
+			for _, kind := range append(kinds, dnsEndpointKind) {
+				if _, err := foreign.collect(deleter, kind, "", "", own.resources); err != nil {
+					logger.WithField("kind", kind.Kind).WithError(err).Error("Failed to list DNS sources of other namespaces")
+					return false
+				}
+			}
+		}
+
+		failed := false
+		for _, obj := range endpoints {
+			_, err := deleter.Delete(obj)
+			auditAction(ns, "delete-dns-endpoint", err, map[string]string{"object": obj.String()})
+			if err != nil {
+				logger.WithField("object", obj.String()).WithError(err).Error("Failed to delete DNS source")
+				failed = true
+				continue
+			}
+			logger.WithField("object", obj.String()).Info("Deleted DNS source")
+		}
+
+		sorted := []string{}
+		for h := range own.hostnames {
+			sorted = append(sorted, h)
+		}
+		sort.Strings(sorted)
+
+		for _, hostname := range sorted {
+			if foreign.hostnames[hostname] {
+				logger.WithField("hostname", hostname).Info("Hostname is served by other namespaces too, its DNS records are kept")
+				continue
+			}
+			for _, provider := range providers {
+				if !provider.manages(hostname) {
+					continue
+				}
+				deleted, err := provider.DeleteRecords(hostname, dns.Ownership{TXTPrefix: provider.txtPrefix, Resources: own.resources})
+				if deleted > 0 || err != nil {
+					auditAction(ns, "delete-dns-records", err, map[string]string{"hostname": hostname, "provider": provider.Name()})
+				}
+				if err != nil {
+					logger.WithFields(log.Fields{"hostname": hostname, "provider": provider.Name()}).WithError(err).Error("Failed to delete DNS records")
+					failed = true
+					continue
+				}
+				if deleted > 0 {
+					logger.WithFields(log.Fields{"hostname": hostname, "provider": provider.Name(), "deleted": deleted}).Info("Deleted DNS record sets")
+				}
+			}
+		}
+		return !failed
+	}
+}
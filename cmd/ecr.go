@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	aws "github.com/OpusCapita/buhtig-s8k/pkg/aws"
+	ecr "github.com/OpusCapita/buhtig-s8k/pkg/ecr"
+)
+
+// invalidTagCharsRe matches characters which aren't allowed in image tags
+var invalidTagCharsRe = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// imageTag converts rendered template (usually branch name) to image tag the way CI pipelines commonly do it,
+// e.g. 'feature/JIRA-1' becomes 'feature-JIRA-1'
+func imageTag(val string) string {
+	tag := invalidTagCharsRe.ReplaceAllString(strings.TrimSpace(val), "-")
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	return tag
+}
+
+// defaultTagSuffixPattern matches commit SHAs and build numbers CI pipelines commonly append to branch tag
+const defaultTagSuffixPattern = `[0-9a-f]{7,40}|\d+`
+
+// matchingTags returns tags equal to tag or, if suffix is set, consisting of tag, '-' or '.' and suffix
+// matching it (e.g. 'feature-x-3f2a1b' or 'feature-x.42'). Suffix is restricted, since tags of other branches
+// may start with the tag too, e.g. 'feature-x-fix' of branch 'feature/x-fix'.
+func matchingTags(tags []string, tag string, suffix *regexp.Regexp) []string {
+	matching := []string{}
+	for _, t := range tags {
+		if t == tag {
+			matching = append(matching, t)
+			continue
+		}
+		if suffix == nil || len(t) <= len(tag)+1 || !strings.HasPrefix(t, tag) || (t[len(tag)] != '-' && t[len(tag)] != '.') {
+			continue
+		}
+		if suffix.MatchString(t[len(tag)+1:]) {
+			matching = append(matching, t)
+		}
+	}
+	return matching
+}
+
+// ecrCleaner deletes branch images from configured ECR repositories
+type ecrCleaner struct {
+	client  *ecr.Client
+	targets []ecrTarget
+}
+
+// newECRCleaner returns cleaner of configured repositories or nil if there are none; it exits on misconfiguration
+func newECRCleaner(targets []ecrTarget) *ecrCleaner {
+	if len(targets) == 0 {
+		return nil
+	}
+	for i := range targets {
+		if targets[i].Region == "" {
+			targets[i].Region = aws.Region()
+		}
+		if targets[i].Region == "" {
+			log.Fatal(fmt.Sprintf("Region of ECR repositories %s isn't configured", strings.Join(targets[i].Repositories, ", ")))
+		}
+		if targets[i].TagTemplate == "" {
+			targets[i].TagTemplate = "{{.Branch}}"
+		}
+		if targets[i].MatchPrefix {
+			pattern := targets[i].SuffixPattern
+			if pattern == "" {
+				pattern = defaultTagSuffixPattern
+			}
+			re, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				log.Fatal(fmt.Sprintf("Suffix pattern of ECR repositories %s should be valid regular expression: %v", strings.Join(targets[i].Repositories, ", "), err))
+			}
+			targets[i].suffixRe = re
+		}
+	}
+	sess, err := aws.NewSession()
+	if err != nil {
+		log.WithError(err).Fatal("AWS session can't be created for ECR cleanup")
+	}
+	return &ecrCleaner{client: ecr.NewClient(sess), targets: targets}
+}
+
+// isECRCleanedIfNeeded deletes image tags of removed branch from ECR repositories, so that per-branch images
+// don't pile up in registry; failures are logged but don't stop the pipeline
+func isECRCleanedIfNeeded(cleaner *ecrCleaner) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if cleaner == nil {
+			return true
+		}
+		logger := ns.logger()
+		data := newTemplateData(ns)
+
+		for _, target := range cleaner.targets {
+			rendered, err := renderTemplate(target.TagTemplate, data)
+			if err != nil {
+				logger.Error(err)
+				continue
+			}
+			tag := imageTag(rendered)
+			if tag == "" {
+				logger.Debug("Image tag is empty, skipping ECR cleanup")
+				continue
+			}
+
+			for _, repo := range target.Repositories {
+				tags := []string{tag}
+				if target.MatchPrefix {
+					all, err := cleaner.client.ListTags(target.Region, repo)
+					if err != nil {
+						logger.WithField("repository", repo).WithError(err).Error("Failed to list tags of ECR repository")
+						continue
+					}
+					tags = matchingTags(all, tag, target.suffixRe)
+				}
+				if len(tags) == 0 {
+					continue
+				}
+
+				deleted, err := cleaner.client.DeleteTags(target.Region, repo, tags)
+				if deleted > 0 || err != nil {
+					auditAction(ns, "delete-ecr-images", err, map[string]string{"repository": repo, "tag": tag, "deleted": fmt.Sprintf("%d", deleted)})
+				}
+				if err != nil {
+					logger.WithField("repository", repo).WithError(err).Error("Failed to delete tags from ECR repository")
+				}
+				if deleted > 0 {
+					logger.WithFields(log.Fields{"repository": repo, "tag": tag, "deleted": deleted}).Info("Deleted image tags from ECR repository")
+				}
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/OpusCapita/buhtig-s8k/pkg/crd"
+	"github.com/OpusCapita/buhtig-s8k/pkg/konnect"
+)
+
+// branchEnvironments reads and writes BranchEnvironment resources; it's nil if they're disabled
+var branchEnvironments *crd.EnvironmentClient
+
+// setupBranchEnvironments enables BranchEnvironment resources in the app's namespace, CRD should be installed
+func setupBranchEnvironments(k8sConfig *rest.Config, enabled bool) {
+	if !enabled {
+		return
+	}
+	dynamicClient, err := dynamic.NewForConfig(k8sConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	branchEnvironments = crd.NewEnvironmentClient(dynamicClient, konnect.CurrentNamespace())
+	if _, err := branchEnvironments.List(); err != nil {
+		log.Fatal(fmt.Sprintf("Failed to list BranchEnvironments, is CRD installed? %v", err))
+	}
+	log.Info(fmt.Sprintf("Tracked namespaces are represented by BranchEnvironments in namespace %s", konnect.CurrentNamespace()))
+}
+
+// loadBranchEnvironments returns BranchEnvironments by namespace name at the start of iteration, it's nil if they're
+// disabled. Error is returned if they can't be listed: namespaces shouldn't be processed then, since overrides
+// (e.g. longer grace period or protection) would be silently ignored.
+func loadBranchEnvironments() (map[string]*crd.BranchEnvironment, error) {
+	if branchEnvironments == nil {
+		return nil, nil
+	}
+	list, err := branchEnvironments.List()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list BranchEnvironments: %v", err)
+	}
+	envs := make(map[string]*crd.BranchEnvironment, len(list))
+	for i := range list {
+		envs[list[i].Name] = &list[i]
+	}
+	return envs, nil
+}
+
+// isBranchEnvironmentApplied applies overrides of namespace's BranchEnvironment to its annotations in memory,
+// it never filters namespace out
+func isBranchEnvironmentApplied(envs map[string]*crd.BranchEnvironment) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		env, ok := envs[ns.Name()]
+		if !ok || len(env.Spec.Overrides) == 0 {
+			return true
+		}
+		// annotations are copied, so that namespace object isn't shared with overrides
+		annotations := make(map[string]string, len(ns.ObjectMeta.Annotations)+len(env.Spec.Overrides))
+		for name, value := range ns.ObjectMeta.Annotations {
+			annotations[name] = value
+		}
+		for name, value := range env.Spec.Overrides {
+			annotations[name] = value
+		}
+		ns.ObjectMeta.Annotations = annotations
+		ns.logger().WithField("count", len(env.Spec.Overrides)).Debug("Applied overrides of BranchEnvironment")
+		return true
+	}
+}
+
+// environmentSpec returns spec of namespace's BranchEnvironment, overrides are owned by users and kept as is
+func environmentSpec(ns *namespace, overrides map[string]string) crd.BranchEnvironmentSpec {
+	spec := crd.BranchEnvironmentSpec{Namespace: ns.Name(), Overrides: overrides}
+	spec.SourceURL, _ = ns.GithubSourceURL()
+	if owner, repo, branch, err := ns.GithubBranch(); err == nil {
+		spec.Repository = owner + "/" + repo
+		spec.Branch = branch
+	}
+	if release, err := ns.HelmRelease(); err == nil {
+		spec.Releases = []string{release}
+	}
+	return spec
+}
+
+// environmentPhase returns phase of environment according to evaluation of namespace in iteration
+func environmentPhase(s *namespaceStatus) string {
+	switch {
+	case !s.deletedAt.IsZero():
+		return crd.PhaseDeleted
+	case s.action == actionDelete:
+		return crd.PhaseDeleting
+	case s.action == actionWait || !s.deleteAfter.IsZero():
+		return crd.PhaseMarkedForDeletion
+	}
+	return crd.PhaseActive
+}
+
+// environmentStatus returns status of environment updated with evaluation of namespace in iteration
+func environmentStatus(s *namespaceStatus, status crd.BranchEnvironmentStatus) crd.BranchEnvironmentStatus {
+	status.SetBranchStatus(s.branchStatus, s.checkedAt)
+	status.SetPhase(environmentPhase(s), s.action, s.reason, s.checkedAt)
+	status.CompletedSteps = s.ns.CompletedSteps()
+	checkedAt := metav1.NewTime(s.checkedAt.UTC().Truncate(time.Second))
+	status.LastChecked = &checkedAt
+	status.DeleteAfter = nil
+	if !s.deleteAfter.IsZero() {
+		deleteAfter := metav1.NewTime(s.deleteAfter.UTC())
+		status.DeleteAfter = &deleteAfter
+	}
+	// namespace with the same name may be created again after deletion
+	status.DeletedAt = nil
+	if !s.deletedAt.IsZero() {
+		deletedAt := metav1.NewTime(s.deletedAt.UTC().Truncate(time.Second))
+		status.DeletedAt = &deletedAt
+	}
+	return status
+}
+
+// writeBranchEnvironment creates or updates BranchEnvironment of namespace evaluated in iteration
+func writeBranchEnvironment(s *namespaceStatus, env *crd.BranchEnvironment) error {
+	var err error
+	if env == nil {
+		env = &crd.BranchEnvironment{
+			ObjectMeta: metav1.ObjectMeta{Name: s.ns.Name(), Labels: map[string]string{managedByLabel: componentName}},
+			Spec:       environmentSpec(s.ns, nil),
+		}
+		if env, err = branchEnvironments.Create(env); err != nil {
+			return err
+		}
+	} else if spec := environmentSpec(s.ns, env.Spec.Overrides); !reflect.DeepEqual(spec, env.Spec) {
+		env.Spec = spec
+		if env, err = branchEnvironments.Update(env); err != nil {
+			return err
+		}
+	}
+	env.Status = environmentStatus(s, env.Status)
+	_, err = branchEnvironments.UpdateStatus(env)
+	return err
+}
+
+// writeBranchEnvironments writes BranchEnvironments of namespaces evaluated in iteration; environments of namespaces
+// which are gone (e.g. deleted manually) are marked deleted and removed once they're deleted for longer than retention.
+// It should be called before statuses are forgotten by writeNamespaceStatuses.
+func writeBranchEnvironments(k8sClient kubernetes.Interface, envs map[string]*crd.BranchEnvironment, retention time.Duration) {
+	if envs == nil {
+		return
+	}
+	evaluated := map[string]bool{}
+	namespaceStatuses.Range(func(key, val interface{}) bool {
+		status := val.(*namespaceStatus)
+		evaluated[status.ns.Name()] = true
+		if err := writeBranchEnvironment(status, envs[status.ns.Name()]); err != nil {
+			status.ns.logger().Error("Failed to write BranchEnvironment: " + err.Error())
+		}
+		return true
+	})
+
+	nsList, err := k8sClient.CoreV1().Namespaces().List(metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		log.Error("Failed to list namespaces of BranchEnvironments")
+		log.Error(err)
+		return
+	}
+	existing := map[string]bool{}
+	for _, ns := range nsList.Items {
+		existing[ns.Name] = true
+	}
+	now := time.Now()
+	for name, env := range envs {
+		switch {
+		case evaluated[name] || existing[name]:
+		case env.Status.Phase != crd.PhaseDeleted:
+			deletedAt := metav1.NewTime(now.UTC().Truncate(time.Second))
+			env.Status.SetPhase(crd.PhaseDeleted, "", "namespace is deleted outside of the app", now)
+			env.Status.DeletedAt = &deletedAt
+			if _, err := branchEnvironments.UpdateStatus(env); err != nil {
+				log.WithField("environment", name).WithError(err).Error("Failed to mark BranchEnvironment deleted")
+			}
+		case retention > 0 && env.Status.DeletedAt != nil && now.Sub(env.Status.DeletedAt.Time) > retention:
+			if err := branchEnvironments.Delete(name); err != nil {
+				log.WithField("environment", name).WithError(err).Error("Failed to delete BranchEnvironment")
+			}
+		}
+	}
+}
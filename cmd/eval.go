@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// runEval implements 'eval' command which runs decision engine offline for namespace manifest
+// and prints decision trace; policy is configured by the same env variables as the app itself.
+// Exit code is 0 on success, 1 if decision doesn't match '--expect' and 2 on usage errors.
+func runEval(args []string) int {
+	flags := flag.NewFlagSet("eval", flag.ContinueOnError)
+	nsFile := flags.String("namespace-file", "", "path to YAML or JSON manifest of namespace")
+	branchStatus := flags.Int("branch-status", 404, "HTTP status returned by branch check")
+	repoStatus := flags.Int("repo-status", 200, "HTTP status returned by repository check")
+	output := flags.String("output", "text", "output format: text or json")
+	expect := flags.String("expect", "", "expected action (delete, wait or skip); exit with code 1 if decision differs")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *nsFile == "" {
+		fmt.Fprintln(os.Stderr, "--namespace-file is required")
+		flags.Usage()
+		return 2
+	}
+
+	data, err := ioutil.ReadFile(*nsFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	k8sNs := corev1.Namespace{}
+	if err := yaml.Unmarshal(data, &k8sNs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	d := evaluateOffline(loadConfig(), evaluation{
+		ns:           newNamespace(k8sNs),
+		branchStatus: *branchStatus,
+		repoStatus:   *repoStatus,
+		now:          time.Now(),
+	})
+
+	if *output == "json" {
+		out, _ := json.MarshalIndent(map[string]interface{}{
+			"namespace":    k8sNs.Name,
+			"action":       d.action,
+			"reason":       d.reason,
+			"trace":        d.trace,
+			"notEvaluated": offlineSkippedGates,
+		}, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		fmt.Printf("namespace: %s\n", k8sNs.Name)
+		for i, line := range d.trace {
+			fmt.Printf("  %d. %s\n", i+1, line)
+		}
+		fmt.Printf("action: %s (%s)\n", d.action, d.reason)
+		fmt.Printf("not evaluated: %s\n", strings.Join(offlineSkippedGates, ", "))
+	}
+
+	if *expect != "" && *expect != d.action {
+		fmt.Fprintf(os.Stderr, "expected action '%s', but got '%s'\n", *expect, d.action)
+		return 1
+	}
+	return 0
+}
+
+// offlineSkippedGates are gates and settings of the app which need cluster, external services or runtime state, so 'eval'
+// command can't evaluate them and namespace it decides to delete may still be left alone by them (or decided differently,
+// e.g. cleanup policy or BranchEnvironment override may change grace period or protect namespace)
+var offlineSkippedGates = []string{
+	"CleanupPolicy/ClusterCleanupPolicy settings", "BranchEnvironment overrides", "coexistence claim", "OPA policy",
+	"CEL predicates", "approval channel of policies", "pause", "pre-delete gate", "guards", "deletion budget",
+}
+
+// evaluateOffline runs decision engine together with gates which depend only on config and namespace manifest:
+// name allow/deny patterns, manual approval and maintenance windows
+func evaluateOffline(cfg config, e evaluation) decision {
+	if reason := cfg.namespaceNames.reject(e.ns.Name()); reason != "" {
+		d := decision{action: actionSkip, reason: reason, skipReason: skipReasonNameFilter}
+		d.tracef("%s, namespace is left alone", reason)
+		return d
+	}
+
+	d := evaluate(newPolicy(cfg), e)
+	if d.action != actionDelete {
+		return d
+	}
+
+	if cfg.approval.required && len(e.ns.CompletedSteps()) == 0 {
+		switch {
+		case e.ns.ApprovedBy() != "":
+			d.tracef("deletion is approved by %s", e.ns.ApprovedBy())
+		case e.ns.ObjectMeta.Annotations[approvalExpiredAnnotationName] != "":
+			d.action, d.reason = actionSkip, "approval of deletion has expired"
+			d.tracef("%s, namespace is left alone", d.reason)
+			return d
+		case e.ns.RejectedBy() != "":
+			d.action, d.reason = actionSkip, "deletion is rejected by "+e.ns.RejectedBy()
+			d.tracef("%s, namespace is left alone", d.reason)
+			return d
+		default:
+			d.action, d.reason = actionWait, "waiting for approval of deletion"
+			d.tracef("approval is required, but nobody has approved deletion yet")
+			return d
+		}
+	}
+
+	if !cfg.maintenanceWindows.contains(e.now) {
+		d.action, d.reason, d.skipReason = actionWait, "deletion is deferred till maintenance window", skipReasonMaintenance
+		d.tracef("%s", d.reason)
+	}
+	return d
+}
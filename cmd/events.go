@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// reasons of Events recorded on namespaces
+const (
+	eventBranchDeleted      = "BranchDeleted"
+	eventMarkedForDeletion  = "MarkedForDeletion"
+	eventDeletionCancelled  = "DeletionCancelled"
+	eventDeletionDeferred   = "DeletionDeferred"
+	eventHelmReleaseDeleted = "HelmReleaseDeleted"
+	eventNamespaceDeleted   = "NamespaceDeleted"
+	eventDeletionFailed     = "DeletionFailed"
+	eventStuckTerminating   = "StuckTerminating"
+)
+
+// annotations of Events which tie them to logs of iteration and namespace's evaluation
+const (
+	iterationIDAnnotationName   = "opuscapita.com/iteration-id"
+	correlationIDAnnotationName = "opuscapita.com/correlation-id"
+)
+
+// eventRecorder records Events on namespaces; it's nil if Events are disabled
+var eventRecorder record.EventRecorder
+
+// setupEvents enables recording of Events. Namespace is cluster-scoped, so its Events are created in 'default'
+// namespace (that's where 'kubectl describe namespace' and other tools look for them) and outlive namespace itself.
+func setupEvents(k8sClient kubernetes.Interface, enabled bool) {
+	if !enabled {
+		return
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: k8sClient.CoreV1().Events("")})
+	eventRecorder = broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: componentName})
+}
+
+// recordEvent records Event of type (corev1.EventTypeNormal or corev1.EventTypeWarning) on namespace if Events are enabled
+func recordEvent(ns *namespace, eventType, reason, message string) {
+	if eventRecorder == nil {
+		return
+	}
+	k8sNs := corev1.Namespace(*ns)
+	annotations := map[string]string{}
+	iteration, correlation := correlationIDs(ns)
+	if iteration != "" {
+		annotations[iterationIDAnnotationName] = iteration
+	}
+	if correlation != "" {
+		annotations[correlationIDAnnotationName] = correlation
+	}
+	if len(annotations) == 0 {
+		eventRecorder.Event(&k8sNs, eventType, reason, message)
+		return
+	}
+	eventRecorder.AnnotatedEventf(&k8sNs, annotations, eventType, reason, "%s", message)
+}
+
+// recordDecisionEvents records Events about changes decision brings to namespace, it should be called
+// before decision is persisted
+func recordDecisionEvents(ns *namespace, e evaluation, d decision) {
+	if d.branchMissingCount > 0 && ns.BranchMissingCount() == 0 {
+		recordEvent(ns, corev1.EventTypeNormal, eventBranchDeleted, fmt.Sprintf("Source branch is missing (status %d)", e.branchStatus))
+	}
+	if !d.deleteAfter.IsZero() && ns.DeleteAfter().IsZero() {
+		recordEvent(ns, corev1.EventTypeNormal, eventMarkedForDeletion, "Namespace is marked for deletion after "+d.deleteAfter.UTC().Format(time.RFC3339))
+	}
+	if d.deleteAfter.IsZero() && !ns.DeleteAfter().IsZero() || e.branchStatus != 404 && ns.BranchMissingCount() > 0 {
+		recordEvent(ns, corev1.EventTypeNormal, eventDeletionCancelled, "Deletion is cancelled: "+d.reason)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// helmCleanupFinalizer keeps namespace deleted manually (e.g. with kubectl) until its Helm release is deleted,
+// since release may own cluster-scoped objects which outlive namespace
+const helmCleanupFinalizer = "opuscapita.com/helm-cleanup"
+
+// hasFinalizer checks if namespace metadata has finalizer
+func (ns *namespace) hasFinalizer(finalizer string) bool {
+	for _, f := range ns.ObjectMeta.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// patchFinalizers replaces metadata finalizers of namespace in Kubernetes and mirrors the change in local copy;
+// resource version makes patch fail if namespace was changed meanwhile, so that others' finalizers aren't lost
+func (ns *namespace) patchFinalizers(k8sClient kubernetes.Interface, finalizers []string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"finalizers": finalizers, "resourceVersion": ns.ObjectMeta.ResourceVersion},
+	})
+	if err != nil {
+		return err
+	}
+
+	updated, err := k8sClient.CoreV1().Namespaces().Patch(ns.Name(), types.MergePatchType, patch)
+	if err != nil {
+		return err
+	}
+	ns.ObjectMeta.Finalizers = finalizers
+	ns.ObjectMeta.ResourceVersion = updated.ResourceVersion
+	return nil
+}
+
+// withoutFinalizer returns metadata finalizers of namespace except the given one
+func (ns *namespace) withoutFinalizer(finalizer string) []string {
+	finalizers := []string{}
+	for _, f := range ns.ObjectMeta.Finalizers {
+		if f != finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	return finalizers
+}
+
+// isHelmCleanupFinalizerSynced puts finalizer on namespace with Helm release if it's enabled and removes it otherwise,
+// so that disabling the feature doesn't leave namespaces which can't be deleted. It never filters namespace out.
+func isHelmCleanupFinalizerSynced(k8sClient kubernetes.Interface, enabled bool) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		_, err := ns.HelmRelease()
+		needed := enabled && err == nil
+		if needed == ns.hasFinalizer(helmCleanupFinalizer) {
+			return true
+		}
+
+		finalizers := ns.withoutFinalizer(helmCleanupFinalizer)
+		if needed {
+			finalizers = append(finalizers, helmCleanupFinalizer)
+		}
+		if err := ns.patchFinalizers(k8sClient, finalizers); err != nil {
+			ns.logger().WithField("finalizer", helmCleanupFinalizer).WithError(err).Error("Failed to update finalizer")
+		}
+		return true
+	}
+}
+
+// finalizeTerminatingNamespaces deletes Helm releases of terminating namespaces which have Helm cleanup finalizer
+// and then removes the finalizer; release isn't deleted again if the app itself deleted it before namespace.
+// Finalizer is kept if release deletion fails, so that it's retried on next iteration.
+func finalizeTerminatingNamespaces(k8sClient kubernetes.Interface, deleteRelease func(*namespace) bool) {
+	nsList, err := k8sClient.CoreV1().Namespaces().List(metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		log.Error("Failed to get namespaces to finalize")
+		log.Error(err)
+		return
+	}
+
+	for _, k8sNs := range nsList.Items {
+		ns := newNamespace(k8sNs)
+		if ns.Status.Phase != corev1.NamespaceTerminating || !ns.hasFinalizer(helmCleanupFinalizer) {
+			continue
+		}
+		logger := ns.logger()
+
+		if !ns.isStepCompleted(stepHelmRelease) {
+			logger.Info("Namespace is deleted, deleting its Helm release before it's gone")
+			if !deleteRelease(ns) {
+				continue
+			}
+		}
+
+		err := ns.patchFinalizers(k8sClient, ns.withoutFinalizer(helmCleanupFinalizer))
+		auditAction(ns, "remove-finalizer", err, map[string]string{"finalizer": helmCleanupFinalizer})
+		if err != nil {
+			logger.WithField("finalizer", helmCleanupFinalizer).WithError(err).Error("Failed to remove finalizer")
+		}
+	}
+}
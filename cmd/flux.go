@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	log "github.com/sirupsen/logrus"
+
+	cleanup "github.com/OpusCapita/buhtig-s8k/pkg/cleanup"
+)
+
+// Flux v2 kinds which reconcile environments; versions are resolved by the cluster
+var (
+	fluxHelmReleaseKind   = schema.GroupVersionKind{Group: "helm.toolkit.fluxcd.io", Kind: "HelmRelease"}
+	fluxKustomizationKind = schema.GroupVersionKind{Group: "kustomize.toolkit.fluxcd.io", Kind: "Kustomization"}
+)
+
+// fluxSettings configure cleanup of Flux objects
+type fluxSettings struct {
+	enabled bool
+	// namespace of Flux objects referenced by name only
+	namespace string
+	// label whose value is name of branch namespace, Flux objects labeled so are deleted in any namespace
+	label string
+}
+
+// fluxObjects returns Flux objects referenced by namespace annotations as comma-separated NAMESPACE/NAME or NAME
+func fluxObjects(ns *namespace, defaultNamespace string) []cleanup.Object {
+	objects := []cleanup.Object{}
+	for annotation, kind := range map[string]schema.GroupVersionKind{
+		fluxHelmReleasesAnnotationName:   fluxHelmReleaseKind,
+		fluxKustomizationsAnnotationName: fluxKustomizationKind,
+	} {
+		for _, ref := range strings.Split(ns.ObjectMeta.Annotations[annotation], ",") {
+			ref = strings.TrimSpace(ref)
+			if ref == "" {
+				continue
+			}
+			obj := cleanup.Object{GroupVersionKind: kind, Namespace: defaultNamespace, Name: ref}
+			if parts := strings.SplitN(ref, "/", 2); len(parts) == 2 {
+				obj.Namespace, obj.Name = parts[0], parts[1]
+			}
+			objects = append(objects, obj)
+		}
+	}
+	return objects
+}
+
+// isFluxCleanedIfNeeded deletes Flux HelmReleases and Kustomizations of the environment, so that GitOps controllers
+// stop reconciling it; it runs before Helm release is deleted, otherwise Flux would install it again
+func isFluxCleanedIfNeeded(deleter *cleanup.Deleter, settings fluxSettings) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if !settings.enabled {
+			return true
+		}
+		logger := ns.logger()
+
+		failed := false
+		for _, obj := range fluxObjects(ns, settings.namespace) {
+			ok, err := deleter.Delete(obj)
+			auditAction(ns, "delete-flux-object", err, map[string]string{"object": obj.String()})
+			if err != nil {
+				logger.WithField("object", obj.String()).WithError(err).Error("Failed to delete Flux object")
+				failed = true
+				continue
+			}
+			if ok {
+				logger.WithField("object", obj.String()).Info("Deleted Flux object")
+			}
+		}
+
+		if settings.label != "" {
+			selector := fmt.Sprintf("%s=%s", settings.label, ns.Name())
+			for _, kind := range []schema.GroupVersionKind{fluxHelmReleaseKind, fluxKustomizationKind} {
+				deleted, err := deleter.DeleteMatching(kind, "", selector)
+				for _, obj := range deleted {
+					auditAction(ns, "delete-flux-object", nil, map[string]string{"object": obj.String()})
+					logger.WithField("object", obj.String()).Info("Deleted Flux object")
+				}
+				if err != nil {
+					logger.WithFields(log.Fields{"kind": kind.Kind, "selector": selector}).WithError(err).Error("Failed to delete Flux objects")
+					failed = true
+				}
+			}
+		}
+		return !failed
+	}
+}
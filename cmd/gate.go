@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	webhook "github.com/OpusCapita/buhtig-s8k/pkg/webhook"
+)
+
+// eventHeader tells receivers of webhooks sent by the app what happened
+const eventHeader = "X-Buhtig-S8k-Event"
+
+// namespacePayload is namespace metadata sent to external systems
+type namespacePayload struct {
+	Namespace   string            `json:"namespace"`
+	Owner       string            `json:"owner,omitempty"`
+	Repo        string            `json:"repo,omitempty"`
+	Branch      string            `json:"branch,omitempty"`
+	HelmRelease string            `json:"helmRelease,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+}
+
+func newNamespacePayload(ns *namespace) namespacePayload {
+	data := newTemplateData(ns)
+	return namespacePayload{
+		Namespace:   data.Namespace,
+		Owner:       data.Owner,
+		Repo:        data.Repo,
+		Branch:      data.Branch,
+		HelmRelease: data.HelmRelease,
+		Labels:      data.Labels,
+		Annotations: data.Annotations,
+		CreatedAt:   ns.ObjectMeta.CreationTimestamp.Time,
+	}
+}
+
+// postWebhook POSTs body to url signing it with secret (if it's not empty) and returns status code and response body
+func postWebhook(httpClient *http.Client, url, event string, secret, body []byte) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(eventHeader, event)
+	if len(secret) > 0 {
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign(secret, body))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	// response is only used for logging
+	respBody, _ := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: 1024})
+	return resp.StatusCode, string(respBody), nil
+}
+
+// preDeleteGateSettings configure external approval of deletions
+type preDeleteGateSettings struct {
+	// url receives namespace metadata, empty value disables the gate
+	url     string
+	secret  string
+	timeout time.Duration
+}
+
+// isApprovedByGateIfNeeded POSTs namespace metadata to pre-delete gate and lets namespace proceed to deletion only
+// if gate responds with 2xx, so that external systems (billing, QA sign-off, change management) can veto or delay it.
+// Any other response or failed request leaves namespace alone until the next iteration. Gate isn't asked again once
+// teardown has started, since half-deleted environment is of no use anyway.
+func isApprovedByGateIfNeeded(settings preDeleteGateSettings) func(*namespace) bool {
+	httpClient := &http.Client{Timeout: settings.timeout}
+	return func(ns *namespace) bool {
+		if settings.url == "" || len(ns.CompletedSteps()) > 0 {
+			return true
+		}
+		logger := ns.logger()
+
+		body, err := json.Marshal(newNamespacePayload(ns))
+		if err != nil {
+			logger.Error(err)
+			return false
+		}
+
+		status, reason, err := postWebhook(httpClient, settings.url, "pre-delete", []byte(settings.secret), body)
+		if err != nil {
+			logger.WithError(err).Error("Pre-delete gate failed, deletion is postponed")
+			return false
+		}
+		if status < 200 || status > 299 {
+			logger.WithFields(log.Fields{"status": status, "reason": reason}).Info("Pre-delete gate postponed deletion")
+			auditAction(ns, "pre-delete-gate", nil, map[string]string{"decision": "postponed", "status": fmt.Sprintf("%d", status), "reason": reason})
+			return false
+		}
+		logger.WithField("status", status).Debug("Pre-delete gate allowed deletion")
+		auditAction(ns, "pre-delete-gate", nil, map[string]string{"decision": "approved", "status": fmt.Sprintf("%d", status)})
+		return true
+	}
+}
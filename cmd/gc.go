@@ -0,0 +1,140 @@
+package main
+
+import (
+	"time"
+
+	"github.com/OpusCapita/buhtig-s8k/pkg/helm"
+	"github.com/prometheus/client_golang/prometheus"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var prunedObjectsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "gc_pruned_objects_total",
+	Help:      "Number of controller-created objects pruned by garbage collection.",
+}, []string{"kind"})
+
+func init() {
+	prometheus.MustRegister(prunedObjectsCounter)
+}
+
+// runGarbageCollector periodically prunes objects the app creates for its own bookkeeping
+// (Events and managed ConfigMaps) which are older than retention, tombstones of deleted namespaces are kept
+// for tombstoneRetention if it's set; orphaned Helm 2 releases are purged as well if orphanedReleasesStorage isn't empty
+func runGarbageCollector(k8sClient kubernetes.Interface, controllerNamespace string, retention, interval time.Duration, orphanedReleasesStorage string, tombstoneRetention time.Duration) {
+	if retention <= 0 || interval <= 0 {
+		log.Info("Garbage collection is disabled")
+		return
+	}
+
+	go func() {
+		for {
+			deadline := time.Now().Add(-retention)
+			tombstoneDeadline := deadline
+			if tombstoneRetention > 0 {
+				tombstoneDeadline = time.Now().Add(-tombstoneRetention)
+			}
+			pruneEvents(k8sClient, deadline)
+			pruneManagedConfigMaps(k8sClient, controllerNamespace, deadline, tombstoneDeadline)
+			if orphanedReleasesStorage != "" {
+				pruneOrphanedReleases(k8sClient, orphanedReleasesStorage)
+			}
+			<-time.After(interval)
+		}
+	}()
+}
+
+// pruneEvents deletes Events reported by the app in tracked namespaces (and Events of namespaces themselves,
+// which live in 'default' namespace) which were last seen before deadline
+func pruneEvents(k8sClient kubernetes.Interface, deadline time.Time) {
+	logger := log.WithFields(log.Fields{"func": "pruneEvents"})
+
+	nsList, err := k8sClient.CoreV1().Namespaces().List(metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	names := []string{metav1.NamespaceDefault}
+	for _, ns := range nsList.Items {
+		names = append(names, ns.Name)
+	}
+
+	for _, name := range names {
+		events, err := k8sClient.CoreV1().Events(name).List(metav1.ListOptions{})
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		for _, event := range events.Items {
+			if event.Source.Component != componentName && event.ReportingController != componentName {
+				continue
+			}
+			lastSeen := event.LastTimestamp.Time
+			if lastSeen.IsZero() {
+				lastSeen = event.CreationTimestamp.Time
+			}
+			if lastSeen.After(deadline) {
+				continue
+			}
+			if err := k8sClient.CoreV1().Events(name).Delete(event.Name, &metav1.DeleteOptions{}); err != nil {
+				logger.Error(err)
+				continue
+			}
+			prunedObjectsCounter.WithLabelValues("Event").Inc()
+		}
+	}
+}
+
+// pruneManagedConfigMaps deletes ConfigMaps created by the app in its own namespace before deadline,
+// tombstones are deleted if namespace was deleted before tombstoneDeadline
+func pruneManagedConfigMaps(k8sClient kubernetes.Interface, controllerNamespace string, deadline, tombstoneDeadline time.Time) {
+	logger := log.WithFields(log.Fields{"func": "pruneManagedConfigMaps"})
+
+	cmList, err := k8sClient.CoreV1().ConfigMaps(controllerNamespace).List(metav1.ListOptions{LabelSelector: managedBySelector})
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	for _, cm := range cmList.Items {
+		// deletion history is pruned according to its own settings
+		if cm.Labels[historyLabel] == "true" {
+			continue
+		}
+		createdAt, cmDeadline := cm.CreationTimestamp.Time, deadline
+		if cm.Labels[tombstoneLabel] == "true" {
+			// tombstone is replaced if namespace with the same name is deleted again
+			if deletedAt, err := time.Parse(time.RFC3339, cm.Data["deletedAt"]); err == nil {
+				createdAt = deletedAt
+			}
+			cmDeadline = tombstoneDeadline
+		}
+		if createdAt.After(cmDeadline) {
+			continue
+		}
+		if err := k8sClient.CoreV1().ConfigMaps(controllerNamespace).Delete(cm.Name, &metav1.DeleteOptions{}); err != nil {
+			logger.Error(err)
+			continue
+		}
+		logger.WithField("configmap", controllerNamespace+"/"+cm.Name).Debug("Pruned ConfigMap")
+		prunedObjectsCounter.WithLabelValues("ConfigMap").Inc()
+	}
+}
+
+// pruneOrphanedReleases purges Helm 2 releases left in Tiller's storage after their namespaces were deleted manually
+func pruneOrphanedReleases(k8sClient kubernetes.Interface, storage string) {
+	logger := log.WithFields(log.Fields{"func": "pruneOrphanedReleases"})
+
+	purged, err := helm.PurgeOrphanedReleases(k8sClient, storage)
+	for _, name := range purged {
+		logger.WithField("release", name).Info("Purged Helm release whose namespace doesn't exist")
+		prunedObjectsCounter.WithLabelValues("HelmRelease").Inc()
+	}
+	if err != nil {
+		logger.Error(err)
+	}
+}
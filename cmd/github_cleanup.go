@@ -0,0 +1,93 @@
+package main
+
+import log "github.com/sirupsen/logrus"
+
+// policies of handling Github Deployments of the branch after its environment is removed
+const (
+	deploymentsPolicyKeep       = "keep"
+	deploymentsPolicyDeactivate = "deactivate"
+	deploymentsPolicyDelete     = "delete"
+)
+
+// isGithubDeploymentsCleanedIfNeeded marks Github Deployments of namespace's branch as inactive (or deletes them),
+// so repository's "Environments" tab doesn't show active deployments pointing to removed namespace;
+// failures are logged but don't stop the pipeline because the namespace is already gone
+func isGithubDeploymentsCleanedIfNeeded(policy string) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if policy == deploymentsPolicyKeep || !ns.IsGithubSource() {
+			return true
+		}
+
+		logger := ns.logger()
+
+		owner, repo, branch, err := ns.GithubBranch()
+		if err != nil {
+			logger.Error(err)
+			return true
+		}
+
+		deployments, err := ghClient.ListDeployments(owner, repo, branch)
+		if err != nil {
+			logger.Error(err)
+			return true
+		}
+
+		for _, deployment := range deployments {
+			// deployment must be inactive before it can be deleted
+			if err := ghClient.DeactivateDeployment(owner, repo, deployment.ID); err != nil {
+				logger.Error(err)
+				continue
+			}
+			if policy == deploymentsPolicyDelete {
+				if err := ghClient.DeleteDeployment(owner, repo, deployment.ID); err != nil {
+					logger.Error(err)
+					continue
+				}
+			}
+			logger.WithFields(log.Fields{"deployment": deployment.ID, "environment": deployment.Environment, "policy": policy}).Info("Github deployment is cleaned up")
+		}
+		return true
+	}
+}
+
+// isGithubEnvironmentDeletedIfNeeded deletes Github Actions environment created for namespace's branch;
+// environment name is taken from annotation or rendered from template (e.g. "preview-{{.Branch}}"),
+// nothing is done if neither is set
+func isGithubEnvironmentDeletedIfNeeded(nameTemplate string) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if !ns.IsGithubSource() {
+			return true
+		}
+
+		logger := ns.logger()
+
+		name, ok := ns.ObjectMeta.Annotations[githubEnvironmentAnnotationName]
+		if !ok {
+			if nameTemplate == "" {
+				return true
+			}
+			var err error
+			name, err = renderTemplate(nameTemplate, newTemplateData(ns))
+			if err != nil {
+				logger.Error(err)
+				return true
+			}
+		}
+		if name == "" {
+			return true
+		}
+
+		owner, repo, _, err := ns.GithubBranch()
+		if err != nil {
+			logger.Error(err)
+			return true
+		}
+
+		if err := ghClient.DeleteEnvironment(owner, repo, name); err != nil {
+			logger.Error(err)
+			return true
+		}
+		logger.WithField("environment", name).Info("Github environment is deleted")
+		return true
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	cleanup "github.com/OpusCapita/buhtig-s8k/pkg/cleanup"
+	"github.com/OpusCapita/buhtig-s8k/pkg/prometheus"
+)
+
+// guard checks signs of environment being still in use, non-empty reason defers deletion
+type guard struct {
+	// name is used as skip reason in metrics
+	name  string
+	check func(*namespace) (reason string, err error)
+}
+
+// newGuards returns enabled guards
+func newGuards(k8sClient kubernetes.Interface, deleter *cleanup.Deleter, cfg config) []guard {
+	guards := []guard{}
+	if cfg.activeWorkloadWindow > 0 {
+		guards = append(guards, guard{name: "active-workload", check: activeWorkloadGuard(k8sClient, cfg.activeWorkloadWindow)})
+	}
+	if cfg.recentDeploymentWindow > 0 {
+		guards = append(guards, guard{name: "recent-deployment", check: recentDeploymentGuard(k8sClient, cfg.recentDeploymentWindow)})
+	}
+	if cfg.ingressTraffic.client != nil {
+		guards = append(guards, guard{name: "ingress-traffic", check: ingressTrafficGuard(deleter, cfg.ingressTraffic)})
+	}
+	return guards
+}
+
+// activeWorkloadGuard defers deletion of namespace with pods which started or restarted within window
+func activeWorkloadGuard(k8sClient kubernetes.Interface, window time.Duration) func(*namespace) (string, error) {
+	return func(ns *namespace) (string, error) {
+		pods, err := k8sClient.CoreV1().Pods(ns.Name()).List(metav1.ListOptions{})
+		if err != nil {
+			return "", err
+		}
+		since := time.Now().Add(-window)
+		for _, pod := range pods.Items {
+			if pod.Status.StartTime != nil && pod.Status.StartTime.Time.After(since) {
+				return fmt.Sprintf("pod %s started at %s", pod.Name, pod.Status.StartTime.UTC().Format(time.RFC3339)), nil
+			}
+			for _, status := range pod.Status.ContainerStatuses {
+				if status.RestartCount == 0 {
+					continue
+				}
+				if running := status.State.Running; running != nil && running.StartedAt.Time.After(since) {
+					return fmt.Sprintf("container %s of pod %s restarted at %s", status.Name, pod.Name, running.StartedAt.UTC().Format(time.RFC3339)), nil
+				}
+				if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.FinishedAt.Time.After(since) {
+					return fmt.Sprintf("container %s of pod %s restarted at %s", status.Name, pod.Name, terminated.FinishedAt.UTC().Format(time.RFC3339)), nil
+				}
+			}
+		}
+		return "", nil
+	}
+}
+
+// restartedAtAnnotationName is set on pod template by 'kubectl rollout restart'
+const restartedAtAnnotationName = "kubectl.kubernetes.io/restartedAt"
+
+// rolloutTimes returns times of the latest rollouts of Deployments and StatefulSets in namespace by workload name:
+// Deployment rollout is the last update of its 'Progressing' condition, StatefulSet rollout is creation of its
+// update revision; restart with 'kubectl rollout restart' counts too
+func rolloutTimes(k8sClient kubernetes.Interface, ns *namespace) (map[string]time.Time, error) {
+	times := map[string]time.Time{}
+	latest := func(workload string, t time.Time) {
+		if t.After(times[workload]) {
+			times[workload] = t
+		}
+	}
+	restartedAt := func(workload string, annotations map[string]string) {
+		if t, err := time.Parse(time.RFC3339, annotations[restartedAtAnnotationName]); err == nil {
+			latest(workload, t)
+		}
+	}
+
+	deployments, err := k8sClient.AppsV1().Deployments(ns.Name()).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deployments.Items {
+		workload := "Deployment " + d.Name
+		for _, c := range d.Status.Conditions {
+			if c.Type == appsv1.DeploymentProgressing {
+				latest(workload, c.LastUpdateTime.Time)
+			}
+		}
+		restartedAt(workload, d.Spec.Template.ObjectMeta.Annotations)
+	}
+
+	statefulSets, err := k8sClient.AppsV1().StatefulSets(ns.Name()).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range statefulSets.Items {
+		workload := "StatefulSet " + s.Name
+		if s.Status.UpdateRevision != "" {
+			revision, err := k8sClient.AppsV1().ControllerRevisions(ns.Name()).Get(s.Status.UpdateRevision, metav1.GetOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				return nil, err
+			}
+			if err == nil {
+				latest(workload, revision.CreationTimestamp.Time)
+			}
+		}
+		restartedAt(workload, s.Spec.Template.ObjectMeta.Annotations)
+	}
+	return times, nil
+}
+
+// recentDeploymentGuard defers deletion of namespace whose Deployments or StatefulSets were rolled out within window,
+// e.g. CI re-deployed environment just as its branch was deleted and recreated
+func recentDeploymentGuard(k8sClient kubernetes.Interface, window time.Duration) func(*namespace) (string, error) {
+	return func(ns *namespace) (string, error) {
+		times, err := rolloutTimes(k8sClient, ns)
+		if err != nil {
+			return "", err
+		}
+		since := time.Now().Add(-window)
+		workloads := make([]string, 0, len(times))
+		for workload := range times {
+			workloads = append(workloads, workload)
+		}
+		// the same reason is reported every time, so that annotation isn't rewritten
+		sort.Strings(workloads)
+		for _, workload := range workloads {
+			if times[workload].After(since) {
+				return fmt.Sprintf("%s was rolled out at %s", workload, times[workload].UTC().Format(time.RFC3339)), nil
+			}
+		}
+		return "", nil
+	}
+}
+
+// ingressTrafficSettings configure guard querying Prometheus for requests served by Ingresses of namespace
+type ingressTrafficSettings struct {
+	// client is nil if guard is disabled
+	client *prometheus.Client
+	// query is Go template of PromQL query, see ingressTrafficQueryData
+	query     string
+	window    time.Duration
+	threshold float64
+}
+
+// defaultIngressTrafficQuery counts requests to hosts served by ingress-nginx
+const defaultIngressTrafficQuery = `sum(increase(nginx_ingress_controller_requests{host=~"{{.HostsRegex}}"}[{{.Window}}]))`
+
+// ingressTrafficQueryData is data of query template
+type ingressTrafficQueryData struct {
+	templateData
+	Hosts []string
+	// HostsRegex matches any of hosts, it's escaped to be put into double-quoted PromQL string
+	HostsRegex string
+	// Window is PromQL duration, e.g. "86400s"
+	Window string
+}
+
+// ingressHosts returns hostnames of Ingresses of namespace together with ones from 'opuscapita.com/hostnames' annotation
+func ingressHosts(deleter *cleanup.Deleter, ns *namespace) ([]string, error) {
+	sources := newDNSSources()
+	for _, h := range splitHostnames(ns.ObjectMeta.Annotations[hostnamesAnnotationName]) {
+		sources.addHostname(h)
+	}
+	for _, kind := range ingressKinds {
+		if _, err := sources.collect(deleter, kind, ns.Name(), "", nil); err != nil {
+			return nil, err
+		}
+	}
+	hosts := []string{}
+	for h := range sources.hostnames {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// ingressTrafficQuery renders query template for hosts
+func ingressTrafficQuery(settings ingressTrafficSettings, ns *namespace, hosts []string) (string, error) {
+	quoted := make([]string, len(hosts))
+	for i, h := range hosts {
+		quoted[i] = regexp.QuoteMeta(h)
+	}
+	return renderTemplate(settings.query, ingressTrafficQueryData{
+		templateData: newTemplateData(ns),
+		Hosts:        hosts,
+		HostsRegex:   strings.Replace(strings.Join(quoted, "|"), `\`, `\\`, -1),
+		Window:       fmt.Sprintf("%ds", int64(settings.window/time.Second)),
+	})
+}
+
+// ingressTrafficReason queries Prometheus for requests served to hosts and returns reason to defer deletion
+// if there were more of them than threshold
+func ingressTrafficReason(settings ingressTrafficSettings, ns *namespace, hosts []string) (string, error) {
+	query, err := ingressTrafficQuery(settings, ns, hosts)
+	if err != nil {
+		return "", err
+	}
+	samples, err := settings.client.Query(query)
+	if err != nil {
+		return "", err
+	}
+	total := 0.0
+	for _, sample := range samples {
+		total += sample.Value
+	}
+	if total > settings.threshold {
+		return fmt.Sprintf("Ingresses served %.0f requests within %s", total, settings.window), nil
+	}
+	return "", nil
+}
+
+// ingressTrafficGuard defers deletion of namespace whose Ingresses served more requests than threshold within window
+// according to Prometheus, e.g. environment demoed to customers; namespace without hostnames passes
+func ingressTrafficGuard(deleter *cleanup.Deleter, settings ingressTrafficSettings) func(*namespace) (string, error) {
+	return func(ns *namespace) (string, error) {
+		hosts, err := ingressHosts(deleter, ns)
+		if err != nil || len(hosts) == 0 {
+			return "", err
+		}
+		return ingressTrafficReason(settings, ns, hosts)
+	}
+}
+
+// isNotGuarded defers deletion of namespace which any of guards considers to be in use; reason is kept
+// in 'opuscapita.com/deletion-deferred' annotation and removed once all guards pass. Guards aren't checked
+// once teardown has started.
+func isNotGuarded(k8sClient kubernetes.Interface, guards []guard) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if len(guards) == 0 || len(ns.CompletedSteps()) > 0 {
+			return true
+		}
+		logger := ns.logger()
+
+		for _, g := range guards {
+			reason, err := g.check(ns)
+			if err != nil {
+				logger.WithField("guard", g.name).WithError(err).Error("Guard failed, deletion is deferred")
+				return false
+			}
+			if reason == "" {
+				continue
+			}
+			logger.Info("Deletion is deferred: " + reason)
+			skipNamespace(ns, g.name, "deletion is deferred: "+reason)
+			if ns.ObjectMeta.Annotations[deletionDeferredAnnotationName] != reason {
+				err := ns.patchAnnotations(k8sClient, map[string]*string{deletionDeferredAnnotationName: &reason})
+				recordEvent(ns, corev1.EventTypeNormal, eventDeletionDeferred, "Deletion is deferred: "+reason)
+				auditAction(ns, "defer-deletion", err, map[string]string{"guard": g.name, "reason": reason})
+				if err != nil {
+					logger.Error(err)
+				}
+			}
+			return false
+		}
+
+		if _, ok := ns.ObjectMeta.Annotations[deletionDeferredAnnotationName]; ok {
+			if err := ns.patchAnnotations(k8sClient, map[string]*string{deletionDeferredAnnotationName: nil}); err != nil {
+				logger.Error(err)
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	helm "github.com/OpusCapita/buhtig-s8k/pkg/helm"
+	helm3 "github.com/OpusCapita/buhtig-s8k/pkg/helm3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Helm versions releases can be deleted with
+const (
+	// helmVersion2 deletes releases via Tiller
+	helmVersion2 = "2"
+	// helmVersion3 uninstalls releases stored in secrets of release namespace
+	helmVersion3 = "3"
+	// helmVersionAuto uses Helm 3 if release secrets are found in namespace and Tiller otherwise,
+	// which suits migration period when both kinds of releases exist
+	helmVersionAuto = "auto"
+)
+
+var helm3Client *helm3.Client
+
+// helmSlots limits number of concurrent Helm operations, nil channel means no limit
+var helmSlots chan struct{}
+
+// setHelmConcurrency sets maximum number of concurrent Helm operations, 0 removes the limit
+func setHelmConcurrency(n int) {
+	helmSlots = nil
+	if n > 0 {
+		helmSlots = make(chan struct{}, n)
+	}
+}
+
+// parseReleaseRef parses value of release annotation which is either 'RELEASE' (release installed into the namespace itself)
+// or 'NAMESPACE/RELEASE' (release installed into another namespace, e.g. per-branch ingress or monitoring release);
+// explicit is true for the latter
+func parseReleaseRef(ns *namespace, ref string) (releaseNamespace, release string, explicit bool) {
+	if parts := strings.SplitN(ref, "/", 2); len(parts) == 2 {
+		return parts[0], parts[1], true
+	}
+	return ns.Name(), ref, false
+}
+
+// detectHelmVersion returns Helm version release should be deleted with: namespace annotation overrides configured version,
+// and 'auto' is resolved by looking for Helm 3 release secrets in release namespace
+func detectHelmVersion(helmVersion string, ns *namespace, releaseNamespace, release string) (string, error) {
+	if v := ns.ObjectMeta.Annotations[helmVersionAnnotationName]; v != "" {
+		helmVersion = v
+	}
+
+	switch helmVersion {
+	case helmVersion2, helmVersion3:
+		return helmVersion, nil
+	case helmVersionAuto:
+		exists, err := helm3Client.ReleaseExists(releaseNamespace, release)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return helmVersion3, nil
+		}
+		return helmVersion2, nil
+	}
+	return "", fmt.Errorf("Unknown Helm version '%s'", helmVersion)
+}
+
+var (
+	clusterLeftoversCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "helm_cluster_leftovers_total",
+		Help:      "Number of cluster-scoped objects found after Helm release deletion.",
+	}, []string{"kind"})
+
+	releaseDeletionsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "helm_release_deletions_total",
+		Help:      "Number of Helm release deletion attempts, by Helm version and status.",
+	}, []string{"helm_version", "status"})
+
+	releaseDeletionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "helm_release_deletion_duration_seconds",
+		Help:      "Duration of Helm release deletion attempts including waiting for objects of release, by Helm version.",
+		Buckets:   []float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"helm_version"})
+
+	tillerTunnelFailuresCounter = prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "helm_tiller_tunnel_failures_total",
+		Help:      "Number of failed attempts to open port-forward tunnel to Tiller.",
+	}, func() float64 { return float64(helm.TunnelFailures()) })
+)
+
+func init() {
+	prometheus.MustRegister(clusterLeftoversCounter)
+	prometheus.MustRegister(releaseDeletionsCounter)
+	prometheus.MustRegister(releaseDeletionDuration)
+	prometheus.MustRegister(tillerTunnelFailuresCounter)
+}
+
+// statuses of release deletion attempts in helm_release_deletions_total metric
+const (
+	releaseDeletionDeleted     = "deleted"
+	releaseDeletionTimeout     = "timeout"
+	releaseDeletionUnavailable = "unavailable"
+	releaseDeletionFailed      = "failed"
+)
+
+// releaseDeletionStatus classifies result of release deletion, so that unreachable Tiller or hanging hooks
+// can be told apart from other failures
+func releaseDeletionStatus(err error) string {
+	switch {
+	case err == nil:
+		return releaseDeletionDeleted
+	case errorHasClass(err, retryOnTimeout):
+		return releaseDeletionTimeout
+	case errorHasClass(err, retryOnUnavailable):
+		return releaseDeletionUnavailable
+	}
+	return releaseDeletionFailed
+}
+
+// policies applied to cluster-scoped objects of release which are left after its deletion
+const (
+	leftoversPolicyIgnore = "ignore"
+	leftoversPolicyReport = "report"
+	leftoversPolicyDelete = "delete"
+)
+
+// helmDeleteOptions are defaults of release deletion which namespace can override with annotations
+type helmDeleteOptions struct {
+	noHooks     bool
+	keepHistory bool
+	timeout     time.Duration
+	// leftoversPolicy is one of leftoversPolicy* constants, it can't be overridden by namespace
+	leftoversPolicy string
+	// waitTimeout is how long to wait for objects of release to be gone after its deletion, 0 disables waiting
+	waitTimeout time.Duration
+}
+
+func newHelmDeleteOptions(cfg config) helmDeleteOptions {
+	return helmDeleteOptions{noHooks: cfg.helmNoHooks, keepHistory: cfg.helmKeepHistory, timeout: cfg.helmTimeout, leftoversPolicy: cfg.helmClusterLeftovers, waitTimeout: cfg.helmWaitTimeout}
+}
+
+// forNamespace applies overrides from annotations of namespace; invalid values are logged and ignored
+func (o helmDeleteOptions) forNamespace(ns *namespace) helmDeleteOptions {
+	annotations := ns.ObjectMeta.Annotations
+	if v, ok := annotations[helmNoHooksAnnotationName]; ok {
+		if b, err := strconv.ParseBool(v); err == nil {
+			o.noHooks = b
+		} else {
+			ns.logger().WithFields(log.Fields{"annotation": helmNoHooksAnnotationName, "value": v}).Warn("Invalid value of annotation")
+		}
+	}
+	if v, ok := annotations[helmKeepHistoryAnnotationName]; ok {
+		if b, err := strconv.ParseBool(v); err == nil {
+			o.keepHistory = b
+		} else {
+			ns.logger().WithFields(log.Fields{"annotation": helmKeepHistoryAnnotationName, "value": v}).Warn("Invalid value of annotation")
+		}
+	}
+	if v, ok := annotations[helmTimeoutAnnotationName]; ok {
+		if d, err := time.ParseDuration(v); err == nil {
+			o.timeout = d
+		} else {
+			ns.logger().WithFields(log.Fields{"annotation": helmTimeoutAnnotationName, "value": v}).Warn("Invalid value of annotation")
+		}
+	}
+	return o
+}
+
+// deleteHelmRelease deletes release referenced by namespace with Helm version detected by detectHelmVersion
+func deleteHelmRelease(helmVersion string, defaults helmDeleteOptions, ns *namespace, ref string, tiller helm.Releases) (err error) {
+	releaseNamespace, release, explicit := parseReleaseRef(ns, ref)
+	version, err := detectHelmVersion(helmVersion, ns, releaseNamespace, release)
+	if err != nil {
+		return err
+	}
+
+	if helmSlots != nil {
+		ns.logger().Debug("Waiting for free Helm slot")
+		helmSlots <- struct{}{}
+		defer func() { <-helmSlots }()
+	}
+	ns.logger().WithField("helm_version", version).Debug("Deleting release")
+
+	start := time.Now()
+	defer func() {
+		releaseDeletionDuration.WithLabelValues(version).Observe(time.Since(start).Seconds())
+		releaseDeletionsCounter.WithLabelValues(version, releaseDeletionStatus(err)).Inc()
+	}()
+
+	if err := snapshotHelmRelease(ns, version, releaseNamespace, release, tiller); err != nil {
+		return err
+	}
+
+	opts := defaults.forNamespace(ns)
+	checkLeftovers := opts.leftoversPolicy == leftoversPolicyReport || opts.leftoversPolicy == leftoversPolicyDelete
+
+	// manifest is read beforehand, since it's gone once release is purged
+	manifest := ""
+	if checkLeftovers || opts.waitTimeout > 0 {
+		if version == helmVersion3 {
+			manifest, err = helm3Client.ReleaseManifest(releaseNamespace, release)
+		} else {
+			manifest, err = tiller.ReleaseManifest(release)
+		}
+		if err != nil {
+			ns.logger().WithField("release", release).WithError(err).Warn("Failed to read manifest of release, its deletion won't be verified")
+		}
+	}
+
+	if version == helmVersion3 {
+		err = helm3Client.Uninstall(releaseNamespace, release, helm3.UninstallOptions{DisableHooks: opts.noHooks, KeepHistory: opts.keepHistory, Timeout: opts.timeout})
+	} else {
+		tillerOpts := helm.DeleteOptions{DisableHooks: opts.noHooks, KeepHistory: opts.keepHistory, Timeout: opts.timeout}
+		// Helm 2 release names are global, but explicitly referenced namespace is verified to not delete unrelated release
+		if explicit {
+			err = tiller.DeleteRelease(release, releaseNamespace, tillerOpts)
+		} else {
+			err = tiller.DeleteRelease(release, "", tillerOpts)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Tiller and Helm 3 client only issue deletion, while objects with finalizers (or chart's own cleanup) may take a while
+	if opts.waitTimeout > 0 && manifest != "" {
+		ns.logger().Debug("Waiting for objects of release to be deleted")
+		if err := helm3Client.WaitForDeletion(manifest, releaseNamespace, opts.waitTimeout); err != nil {
+			return err
+		}
+	}
+
+	if checkLeftovers && manifest != "" {
+		handleClusterLeftovers(ns, manifest, opts.leftoversPolicy)
+	}
+	return nil
+}
+
+// handleClusterLeftovers reports cluster-scoped objects of release manifest which survived release deletion
+// and deletes them if policy says so; failures are only logged since release itself is deleted
+func handleClusterLeftovers(ns *namespace, manifest, policy string) {
+	logger := ns.logger()
+
+	leftovers, err := helm3Client.Leftovers(manifest)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to check cluster-scoped leftovers of release")
+		return
+	}
+
+	for _, obj := range leftovers {
+		ref := fmt.Sprintf("%s %s", obj.GetKind(), obj.GetName())
+		clusterLeftoversCounter.WithLabelValues(obj.GetKind()).Inc()
+		if policy != leftoversPolicyDelete {
+			logger.WithField("object", ref).Warn("Cluster-scoped object is left after release deletion")
+			continue
+		}
+		err := helm3Client.DeleteLeftover(obj)
+		auditAction(ns, "delete-cluster-leftover", err, map[string]string{"object": ref})
+		if err != nil {
+			logger.WithField("object", ref).WithError(err).Error("Failed to delete cluster-scoped object left after release deletion")
+			continue
+		}
+		logger.WithField("object", ref).Info("Deleted cluster-scoped object left after release deletion")
+	}
+}
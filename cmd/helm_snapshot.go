@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+
+	log "github.com/sirupsen/logrus"
+
+	helm "github.com/OpusCapita/buhtig-s8k/pkg/helm"
+	helm3 "github.com/OpusCapita/buhtig-s8k/pkg/helm3"
+)
+
+// where snapshots of Helm releases are saved before deletion
+const (
+	helmSnapshotNone      = "none"
+	helmSnapshotArchive   = "archive"
+	helmSnapshotConfigMap = "configmap"
+)
+
+// releaseSnapshots saves snapshots of Helm releases before they're deleted, it's nil if snapshots are disabled
+var releaseSnapshots *releaseSnapshotter
+
+// releaseSnapshotter saves snapshots either to archive storage or to ConfigMaps in the app's namespace
+type releaseSnapshotter struct {
+	k8sClient kubernetes.Interface
+	// namespace of ConfigMaps
+	namespace string
+	// archive is set if snapshots are uploaded to archive storage
+	archive *archiver
+}
+
+// snapshotConfigMapName returns name of ConfigMap with snapshot of release of namespace
+func snapshotConfigMapName(ns, release string) string {
+	return fmt.Sprintf("%s-snapshot-%s-%s", componentName, ns, release)
+}
+
+// save saves snapshot of release of namespace and returns its location
+func (s *releaseSnapshotter) save(ns *namespace, snapshot *helm3.Snapshot) (string, error) {
+	if s.archive != nil {
+		data, err := yaml.Marshal(snapshot)
+		if err != nil {
+			return "", err
+		}
+		key := path.Join(s.archive.prefix, ns.Name(), fmt.Sprintf("%s-release-%s.yaml", time.Now().UTC().Format(archiveTimeFormat), snapshot.Name))
+		return s.archive.storage.Upload(key, "application/yaml", data)
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      snapshotConfigMapName(ns.Name(), snapshot.Name),
+			Namespace: s.namespace,
+			Labels:    map[string]string{managedByLabel: componentName, "opuscapita.com/namespace": ns.Name()},
+			Annotations: map[string]string{
+				"opuscapita.com/helm-release":           snapshot.Name,
+				"opuscapita.com/helm-release-namespace": snapshot.Namespace,
+				"opuscapita.com/helm-release-revision":  strconv.Itoa(snapshot.Revision),
+				"opuscapita.com/helm-chart":             snapshot.Chart,
+				"opuscapita.com/helm-chart-version":     snapshot.ChartVersion,
+			},
+		},
+		Data: map[string]string{"values.yaml": snapshot.Values, "manifest.yaml": snapshot.Manifest},
+	}
+	configMaps := s.k8sClient.CoreV1().ConfigMaps(s.namespace)
+	_, err := configMaps.Create(cm)
+	if errors.IsAlreadyExists(err) {
+		_, err = configMaps.Update(cm)
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("configmap %s/%s", cm.Namespace, cm.Name), nil
+}
+
+// snapshotHelmRelease saves snapshot of release before it's deleted, so that environment can be recreated exactly
+// as it was; missing release isn't an error
+func snapshotHelmRelease(ns *namespace, version, releaseNamespace, release string, tiller helm.Releases) error {
+	if releaseSnapshots == nil {
+		return nil
+	}
+
+	var snapshot *helm3.Snapshot
+	var err error
+	if version == helmVersion3 {
+		snapshot, err = helm3Client.ReleaseSnapshot(releaseNamespace, release)
+	} else {
+		snapshot, err = tiller.ReleaseSnapshot(release)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to snapshot release %s: %v", release, err)
+	}
+	if snapshot == nil {
+		return nil
+	}
+
+	location, err := releaseSnapshots.save(ns, snapshot)
+	auditAction(ns, "snapshot-helm-release", err, map[string]string{"release": release, "location": location})
+	if err != nil {
+		return fmt.Errorf("Failed to save snapshot of release %s: %v", release, err)
+	}
+	ns.logger().WithFields(log.Fields{"release": release, "revision": snapshot.Revision, "location": location}).Info("Snapshot of release is saved")
+	return nil
+}
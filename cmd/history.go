@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+
+	history "github.com/OpusCapita/buhtig-s8k/pkg/history"
+	"github.com/OpusCapita/buhtig-s8k/pkg/konnect"
+)
+
+// historyLabel marks ConfigMaps holding deletion history, they're pruned according to HISTORY_* settings
+const historyLabel = "opuscapita.com/history"
+
+// deletionHistory keeps history of deletions and failures; it's nil if history is disabled
+var deletionHistory *history.Store
+
+// historySettings configure deletion history
+type historySettings struct {
+	// maxAge is how long entries are kept, 0 disables history
+	maxAge time.Duration
+	// maxEntries limits number of kept entries, 0 means no limit
+	maxEntries int
+}
+
+// newHistoryStore returns store of history in ConfigMaps of namespace
+func newHistoryStore(k8sClient kubernetes.Interface, namespace string) *history.Store {
+	return history.NewStore(k8sClient, namespace, componentName+"-history", map[string]string{managedByLabel: componentName, historyLabel: "true"})
+}
+
+// setupHistory enables deletion history and registers '/history' admin endpoint
+func setupHistory(k8sClient kubernetes.Interface, settings historySettings) {
+	if settings.maxAge <= 0 {
+		return
+	}
+	deletionHistory = newHistoryStore(k8sClient, konnect.CurrentNamespace())
+
+	// GET /history?namespace=NS&outcome=deleted|failed&since=24h&limit=N returns entries as JSON, the latest first;
+	// entries expose names of branches and errors, so admin token is required like for audit trail
+	adminMux.HandleFunc("/history", requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		params := r.URL.Query()
+		q, err := newHistoryQuery(params.Get("namespace"), params.Get("outcome"), params.Get("since"), params.Get("limit"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entries, err := deletionHistory.List(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}))
+
+	log.Info(fmt.Sprintf("Deletion history is kept for %s", settings.maxAge))
+}
+
+// newHistoryQuery parses query parameters, since is duration back from now
+func newHistoryQuery(namespace, outcome, since, limit string) (history.Query, error) {
+	q := history.Query{Namespace: namespace, Outcome: outcome}
+	if outcome != "" && outcome != history.OutcomeDeleted && outcome != history.OutcomeFailed {
+		return q, fmt.Errorf("outcome should be %s or %s", history.OutcomeDeleted, history.OutcomeFailed)
+	}
+	if since != "" {
+		d, err := time.ParseDuration(since)
+		if err != nil || d <= 0 {
+			return q, fmt.Errorf("since should be positive duration, e.g. 24h")
+		}
+		q.Since = time.Now().Add(-d)
+	}
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return q, fmt.Errorf("limit should be a positive integer")
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
+
+// recordHistory adds failed action or deletion of namespace to history if it's enabled
+func recordHistory(ns *namespace, action string, err error) {
+	if deletionHistory == nil || err == nil && action != "delete-namespace" {
+		return
+	}
+	entry := history.Entry{Namespace: ns.Name(), Outcome: history.OutcomeDeleted}
+	if err != nil {
+		entry.Outcome = history.OutcomeFailed
+		entry.Action = action
+		entry.Error = err.Error()
+	}
+	if owner, repo, branch, err := ns.GithubBranch(); err == nil {
+		entry.Repository = owner + "/" + repo
+		entry.Branch = branch
+	}
+	if err := deletionHistory.Append(entry); err != nil {
+		ns.logger().WithError(err).Error("Failed to record history")
+	}
+}
+
+// pruneHistory removes entries which are too old or too many
+func pruneHistory(settings historySettings) {
+	if deletionHistory == nil {
+		return
+	}
+	removed, err := deletionHistory.Prune(settings.maxAge, settings.maxEntries, time.Now())
+	if err != nil {
+		log.Error("Failed to prune deletion history")
+		log.Error(err)
+	}
+	if removed > 0 {
+		log.WithField("count", removed).Debug("Pruned entries of deletion history")
+	}
+}
+
+// runHistory implements 'history' command which prints deletion history kept in the cluster
+func runHistory(args []string) int {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	appNamespace := flags.String("app-namespace", konnect.CurrentNamespace(), "namespace where the app keeps history")
+	namespace := flags.String("namespace", "", "show only entries of this namespace")
+	outcome := flags.String("outcome", "", "show only entries with this outcome: deleted or failed")
+	since := flags.String("since", "", "show only entries newer than this duration, e.g. 24h")
+	limit := flags.String("limit", "", "show at most this number of the latest entries")
+	output := flags.String("output", "text", "output format: text or json")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	q, err := newHistoryQuery(*namespace, *outcome, *since, *limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	k8sConfig, err := konnect.NewConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	k8sClient, err := konnect.NewClient(k8sConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	entries, err := newHistoryStore(k8sClient, *appNamespace).List(q)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *output == "json" {
+		out, _ := json.MarshalIndent(entries, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	}
+	printHistory(os.Stdout, entries)
+	return 0
+}
+
+// printHistory prints entries as table
+func printHistory(w io.Writer, entries []history.Entry) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tNAMESPACE\tOUTCOME\tREPOSITORY\tBRANCH\tFAILED ACTION\tERROR")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Format(time.RFC3339), e.Namespace, e.Outcome, e.Repository, e.Branch, e.Action, e.Error)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OpusCapita/buhtig-s8k/pkg/jenkins"
+	"github.com/OpusCapita/buhtig-s8k/pkg/konnect"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// phases of teardown when Jenkins job is triggered
+const (
+	jenkinsPhasePre  = "pre"
+	jenkinsPhasePost = "post"
+)
+
+// jenkinsPollDelay is how often state of Jenkins build is checked
+var jenkinsPollDelay = 10 * time.Second
+
+// jenkinsHook is configured Jenkins job
+type jenkinsHook struct {
+	url string
+	job string
+	// secretNamespace and secretName reference Secret with 'username' and 'token' (or 'password') keys
+	secretNamespace string
+	secretName      string
+	phase           string
+	// parameters are Go templates of build parameters
+	parameters map[string]string
+	wait       bool
+	timeout    time.Duration
+}
+
+// newJenkinsHooks builds Jenkins hooks from config; it exits on misconfiguration
+func newJenkinsHooks(targets []jenkinsJobTarget) []jenkinsHook {
+	hooks := []jenkinsHook{}
+	for _, target := range targets {
+		if target.URL == "" || target.Job == "" {
+			log.Fatal("URL and job of Jenkins hook are required")
+		}
+		hook := jenkinsHook{url: target.URL, job: target.Job, phase: target.Phase, parameters: target.Parameters, wait: target.Wait}
+		switch hook.phase {
+		case "":
+			hook.phase = jenkinsPhasePre
+		case jenkinsPhasePre, jenkinsPhasePost:
+		default:
+			log.Fatal(fmt.Sprintf("Phase of Jenkins job %s should be either '%s' or '%s'", target.Job, jenkinsPhasePre, jenkinsPhasePost))
+		}
+		hook.timeout = 30 * time.Minute
+		if target.Timeout != "" {
+			timeout, err := time.ParseDuration(target.Timeout)
+			if err != nil {
+				log.Fatal(fmt.Sprintf("Timeout of Jenkins job %s should be duration, got '%s'", target.Job, target.Timeout))
+			}
+			hook.timeout = timeout
+		}
+		hook.secretNamespace, hook.secretName = konnect.CurrentNamespace(), target.CredentialsSecret
+		if parts := strings.SplitN(target.CredentialsSecret, "/", 2); len(parts) == 2 {
+			hook.secretNamespace, hook.secretName = parts[0], parts[1]
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks
+}
+
+// client returns Jenkins client authenticated with credentials from Secret, anonymous if Secret isn't configured
+func (h jenkinsHook) client(k8sClient kubernetes.Interface) (*jenkins.Client, error) {
+	if h.secretName == "" {
+		return jenkins.NewClient(h.url, "", ""), nil
+	}
+	secret, err := k8sClient.CoreV1().Secrets(h.secretNamespace).Get(h.secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read credentials of Jenkins job %s: %v", h.job, err)
+	}
+	token := secret.Data["token"]
+	if len(token) == 0 {
+		token = secret.Data["password"]
+	}
+	return jenkins.NewClient(h.url, string(secret.Data["username"]), string(token)), nil
+}
+
+// trigger queues build of job with rendered parameters and returns URL of queue item
+func (h jenkinsHook) trigger(client *jenkins.Client, ns *namespace) (string, error) {
+	data := newTemplateData(ns)
+	parameters := map[string]string{}
+	for name, text := range h.parameters {
+		value, err := renderTemplate(text, data)
+		if err != nil {
+			return "", fmt.Errorf("Failed to render parameter %s of Jenkins job %s: %v", name, h.job, err)
+		}
+		parameters[name] = value
+	}
+	queueURL, err := client.TriggerBuild(h.job, parameters)
+	auditAction(ns, "trigger-jenkins-job", err, map[string]string{"job": h.url + " " + h.job, "phase": h.phase})
+	return queueURL, err
+}
+
+// awaitJenkinsBuild polls queue item or build at itemURL until build finishes or timeout expires, onBuild is called
+// with URL of build once it's started; it returns true if build succeeded and false if it's still running,
+// failed build is returned as error
+func awaitJenkinsBuild(client *jenkins.Client, itemURL string, timeout time.Duration, onBuild func(string) error) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	buildURL := ""
+	if !strings.Contains(itemURL, "/queue/item/") {
+		buildURL = itemURL
+	}
+	for {
+		if buildURL == "" {
+			build, err := client.QueuedBuild(itemURL)
+			if err != nil {
+				return false, err
+			}
+			if build != nil {
+				buildURL = build.URL
+				if err := onBuild(buildURL); err != nil {
+					return false, err
+				}
+			}
+		}
+		if buildURL != "" {
+			build, err := client.GetBuild(buildURL)
+			if err != nil {
+				return false, err
+			}
+			if build.IsFinished() {
+				if build.IsSucceeded() {
+					return true, nil
+				}
+				return false, fmt.Errorf("Jenkins build %s finished with result %s", buildURL, build.Result)
+			}
+		}
+		if time.Now().After(deadline) {
+			return false, nil
+		}
+		time.Sleep(jenkinsPollDelay)
+	}
+}
+
+// jenkinsBuilds returns URLs of queue items or builds of Jenkins jobs triggered for namespace, keyed by job
+func jenkinsBuilds(ns *namespace) map[string]string {
+	builds := map[string]string{}
+	if val := ns.ObjectMeta.Annotations[jenkinsBuildsAnnotationName]; val != "" {
+		if err := json.Unmarshal([]byte(val), &builds); err != nil {
+			ns.logger().WithField("annotation", jenkinsBuildsAnnotationName).WithError(err).Warn("Ignoring invalid annotation")
+		}
+	}
+	return builds
+}
+
+// isPreDeleteJenkinsJobCompletedIfNeeded triggers Jenkins jobs of 'pre' phase and waits for builds of jobs configured to be waited for;
+// queue items and builds are kept in namespace annotation, so that build is waited for on the next iteration if it takes
+// longer than timeout; failed build is forgotten and job is triggered again on the next iteration
+func isPreDeleteJenkinsJobCompletedIfNeeded(k8sClient kubernetes.Interface, hooks []jenkinsHook) func(*namespace) stepResult {
+	return func(ns *namespace) stepResult {
+		logger := ns.logger()
+		builds := jenkinsBuilds(ns)
+		save := func() error {
+			val, err := json.Marshal(builds)
+			if err != nil {
+				return err
+			}
+			s := string(val)
+			return ns.patchAnnotations(k8sClient, map[string]*string{jenkinsBuildsAnnotationName: &s})
+		}
+
+		for _, hook := range hooks {
+			if hook.phase != jenkinsPhasePre {
+				continue
+			}
+			itemURL, triggered := builds[hook.job]
+			if triggered && !hook.wait {
+				continue
+			}
+
+			client, err := hook.client(k8sClient)
+			if err != nil {
+				logger.Error(err)
+				return stepFailed
+			}
+
+			if !triggered {
+				if itemURL, err = hook.trigger(client, ns); err != nil {
+					logger.Error(err)
+					return stepFailed
+				}
+				builds[hook.job] = itemURL
+				if err := save(); err != nil {
+					logger.Error(err)
+					return stepFailed
+				}
+				logger.WithField("job", hook.job).Info("Triggered Jenkins job")
+				if !hook.wait {
+					continue
+				}
+			}
+
+			succeeded, err := awaitJenkinsBuild(client, itemURL, hook.timeout, func(buildURL string) error {
+				builds[hook.job] = buildURL
+				logger.WithField("url", buildURL).Info("Waiting for Jenkins build")
+				return save()
+			})
+			if err != nil {
+				logger.Error(err)
+				// job is triggered again on the next iteration
+				delete(builds, hook.job)
+				if err := save(); err != nil {
+					logger.Error(err)
+				}
+				return stepFailed
+			}
+			if !succeeded {
+				logger.WithFields(log.Fields{"job": hook.job, "timeout": hook.timeout.String()}).Warn("Jenkins job didn't finish in time, will wait on next iteration")
+				return stepWaiting
+			}
+		}
+		return stepDone
+	}
+}
+
+// isPostDeleteJenkinsJobTriggeredIfNeeded triggers Jenkins jobs of 'post' phase after environment is removed and waits
+// for builds if configured; failures are logged but don't stop the pipeline because the namespace is already gone
+func isPostDeleteJenkinsJobTriggeredIfNeeded(k8sClient kubernetes.Interface, hooks []jenkinsHook) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		logger := ns.logger()
+		for _, hook := range hooks {
+			if hook.phase != jenkinsPhasePost {
+				continue
+			}
+			client, err := hook.client(k8sClient)
+			if err != nil {
+				logger.Error(err)
+				continue
+			}
+			queueURL, err := hook.trigger(client, ns)
+			if err != nil {
+				logger.Error(err)
+				continue
+			}
+			logger.WithField("job", hook.job).Info("Triggered Jenkins job")
+			if !hook.wait {
+				continue
+			}
+			succeeded, err := awaitJenkinsBuild(client, queueURL, hook.timeout, func(string) error { return nil })
+			if err != nil {
+				logger.Error(err)
+			} else if !succeeded {
+				logger.WithFields(log.Fields{"job": hook.job, "timeout": hook.timeout.String()}).Warn("Jenkins job didn't finish in time")
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	log "github.com/sirupsen/logrus"
+
+	cleanup "github.com/OpusCapita/buhtig-s8k/pkg/cleanup"
+)
+
+// kinds which own cloud load balancers and DNS records; Ingress is looked up in both groups it's served from
+var (
+	serviceKind           = schema.GroupVersionKind{Version: "v1", Kind: "Service"}
+	ingressKinds          = []schema.GroupVersionKind{{Group: "networking.k8s.io", Kind: "Ingress"}, {Group: "extensions", Kind: "Ingress"}}
+	loadBalancerPollDelay = 5 * time.Second
+)
+
+// isLoadBalancerService checks if Service is backed by cloud load balancer
+func isLoadBalancerService(obj *unstructured.Unstructured) bool {
+	serviceType, _, _ := unstructured.NestedString(obj.Object, "spec", "type")
+	return serviceType == "LoadBalancer"
+}
+
+// loadBalancerObjects returns LoadBalancer Services and Ingresses of namespace
+func loadBalancerObjects(deleter *cleanup.Deleter, ns string) ([]cleanup.Object, error) {
+	objects, err := deleter.ListFunc(serviceKind, ns, "", isLoadBalancerService)
+	if err != nil {
+		return nil, err
+	}
+	ingresses, err := ingressObjects(deleter, ns)
+	if err != nil {
+		return nil, err
+	}
+	return append(objects, ingresses...), nil
+}
+
+// ingressObjects returns Ingresses of namespace
+func ingressObjects(deleter *cleanup.Deleter, ns string) ([]cleanup.Object, error) {
+	for _, kind := range ingressKinds {
+		ingresses, err := deleter.List(kind, ns, "")
+		if err != nil {
+			return nil, err
+		}
+		// the same Ingress is served from both groups, the first one found is enough
+		if len(ingresses) > 0 {
+			return ingresses, nil
+		}
+	}
+	return nil, nil
+}
+
+// isLoadBalancersDeletedIfNeeded deletes LoadBalancer Services and Ingresses before namespace and waits until they're
+// gone, i.e. cloud controllers released load balancers and DNS records (they hold objects with finalizers until then).
+// Namespace finalization deletes them too, but cloud resources are sometimes orphaned under its time pressure.
+// If objects aren't gone in time, warning is logged and teardown continues.
+func isLoadBalancersDeletedIfNeeded(deleter *cleanup.Deleter, timeout time.Duration) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if timeout <= 0 {
+			return true
+		}
+		logger := ns.logger()
+
+		objects, err := loadBalancerObjects(deleter, ns.Name())
+		if err != nil {
+			logger.WithError(err).Error("Failed to list load balancers")
+			return false
+		}
+		if len(objects) == 0 {
+			return true
+		}
+
+		for _, obj := range objects {
+			_, err := deleter.Delete(obj)
+			auditAction(ns, "delete-load-balancer", err, map[string]string{"object": obj.String()})
+			if err != nil {
+				logger.WithField("object", obj.String()).WithError(err).Error("Failed to delete load balancer")
+				return false
+			}
+			logger.WithField("object", obj.String()).Info("Deleted load balancer, waiting for cloud resources to be released")
+		}
+
+		deadline := time.Now().Add(timeout)
+		for {
+			remaining := []string{}
+			for _, obj := range objects {
+				exists, err := deleter.Exists(obj)
+				if err != nil {
+					logger.Error(err)
+					return false
+				}
+				if exists {
+					remaining = append(remaining, obj.String())
+				}
+			}
+			if len(remaining) == 0 {
+				logger.Info("Load balancers are released")
+				return true
+			}
+			if time.Now().After(deadline) {
+				logger.WithFields(log.Fields{"timeout": timeout.String(), "remaining": strings.Join(remaining, ", ")}).Warn("Load balancers aren't released in time, proceeding anyway")
+				return true
+			}
+			time.Sleep(loadBalancerPollDelay)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// repeatedField marks summary of suppressed messages, such entries are never suppressed themselves
+const repeatedField = "repeated"
+
+// dedupFormatter suppresses warnings and errors which repeat within window, e.g. the same malformed annotation
+// reported every iteration: the first occurrence is logged as is, repeats are counted and summarized once per window.
+// Message is identified by level, text and namespace, so that the same error of different namespaces isn't merged.
+type dedupFormatter struct {
+	next   log.Formatter
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[dedupKey]*dedupState
+}
+
+type dedupKey struct {
+	level     log.Level
+	message   string
+	namespace interface{}
+}
+
+type dedupState struct {
+	lastSeen   time.Time
+	suppressed int
+}
+
+// setupLogDedup wraps current formatter of logs with dedupFormatter if window is positive
+func setupLogDedup(window time.Duration) {
+	if window <= 0 {
+		return
+	}
+	f := &dedupFormatter{next: log.StandardLogger().Formatter, window: window, seen: map[dedupKey]*dedupState{}}
+	log.SetFormatter(f)
+
+	go func() {
+		for now := range time.Tick(window) {
+			f.summarize(now)
+		}
+	}()
+}
+
+// Format implements log.Formatter; suppressed entry is formatted as nothing, so that nothing is written
+func (f *dedupFormatter) Format(entry *log.Entry) ([]byte, error) {
+	if entry.Level > log.WarnLevel {
+		return f.next.Format(entry)
+	}
+	if _, ok := entry.Data[repeatedField]; ok {
+		return f.next.Format(entry)
+	}
+
+	key := dedupKey{level: entry.Level, message: entry.Message, namespace: entry.Data["namespace"]}
+	f.mu.Lock()
+	state, ok := f.seen[key]
+	if !ok {
+		state = &dedupState{}
+		f.seen[key] = state
+	}
+	state.lastSeen = entry.Time
+	if ok {
+		state.suppressed++
+	}
+	f.mu.Unlock()
+
+	if ok {
+		return nil, nil
+	}
+	return f.next.Format(entry)
+}
+
+// summarize logs how many times every suppressed message repeated since the previous summary; messages which
+// didn't repeat for the whole window are forgotten, so that they're logged in full when they come back
+func (f *dedupFormatter) summarize(now time.Time) {
+	type summary struct {
+		key   dedupKey
+		count int
+	}
+	var summaries []summary
+
+	f.mu.Lock()
+	for key, state := range f.seen {
+		if state.suppressed > 0 {
+			summaries = append(summaries, summary{key: key, count: state.suppressed})
+			state.suppressed = 0
+		} else if now.Sub(state.lastSeen) >= f.window {
+			delete(f.seen, key)
+		}
+	}
+	f.mu.Unlock()
+
+	// logged outside of the lock, since logger calls Format
+	for _, s := range summaries {
+		fields := log.Fields{repeatedField: s.count}
+		if s.key.namespace != nil {
+			fields["namespace"] = s.key.namespace
+		}
+		log.WithFields(fields).Log(s.key.level, fmt.Sprintf("Repeated %d more times in the last %v: %s", s.count, f.window, s.key.message))
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+
+	github "github.com/OpusCapita/buhtig-s8k/pkg/github"
+)
+
+// log formats
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// setupLogFormat switches between human-readable text and JSON logs which Loki or Elasticsearch can query by field
+func setupLogFormat(format string) error {
+	switch format {
+	case logFormatText:
+		log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
+	case logFormatJSON:
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return fmt.Errorf("log format should be '%s' or '%s', got '%s'", logFormatText, logFormatJSON, format)
+	}
+	return nil
+}
+
+// registerLogLevelHandlers lets log level be changed without restart, which would lose in-memory state like
+// backoff of retries: PUT /loglevel with level name (e.g. "debug") in body and admin token sets level, GET /loglevel
+// returns it;
+// SIGHUP toggles between debug and configured level
+func registerLogLevelHandlers(configured log.Level) {
+	adminMux.HandleFunc("/loglevel", serveLogLevel)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			toggleDebugLevel(configured)
+		}
+	}()
+}
+
+// toggleDebugLevel switches to debug level or back to configured one
+func toggleDebugLevel(configured log.Level) {
+	level := log.DebugLevel
+	if log.GetLevel() == log.DebugLevel && configured != log.DebugLevel {
+		level = configured
+	}
+	log.SetLevel(level)
+	log.WithFields(log.Fields{"level": level.String(), "signal": syscall.SIGHUP.String()}).Warn("Log level is set by signal")
+}
+
+// serveLogLevel returns current log level to anybody, while only holder of admin token can change it
+func serveLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		fmt.Fprintln(w, log.GetLevel())
+	case http.MethodPut:
+		setLogLevel(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// setLogLevel sets level named in request body
+var setLogLevel = requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 64))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	level, err := log.ParseLevel(strings.TrimSpace(string(body)))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	caller, _ := adminCaller(r)
+	log.SetLevel(level)
+	log.WithFields(log.Fields{"level": level.String(), "path": r.URL.Path, "caller": caller}).Warn("Log level is set by admin endpoint")
+	fmt.Fprintln(w, log.GetLevel())
+})
+
+// iterationNumber counts iterations since start of the app, it's logged as 'iteration' field
+var iterationNumber int64
+
+// iterationID is unique ID of current iteration, it's logged as 'iteration_id' field
+var iterationID atomic.Value
+
+// namespaceCorrelationIDs hold unique IDs of namespaces' evaluations in current iteration by namespace name,
+// they're logged as 'correlation_id' field
+var namespaceCorrelationIDs sync.Map
+
+// startIterationLogging advances iteration number, assigns new iteration ID and returns logger of new iteration.
+// ID is trace ID of iteration if it's traced, so that logs can be joined with traces.
+func startIterationLogging(traceID string) *log.Entry {
+	if traceID == "" {
+		traceID = randomID()
+	}
+	iterationID.Store(traceID)
+	namespaceCorrelationIDs.Range(func(name, _ interface{}) bool {
+		namespaceCorrelationIDs.Delete(name)
+		return true
+	})
+	return log.WithFields(log.Fields{"iteration": atomic.AddInt64(&iterationNumber, 1), "iteration_id": traceID})
+}
+
+// startCorrelation assigns new correlation ID to namespace entering the pipeline
+func startCorrelation(ns *namespace) {
+	namespaceCorrelationIDs.Store(ns.Name(), randomID())
+}
+
+// correlationIDs returns IDs of current iteration and namespace's evaluation, they're empty if unknown
+func correlationIDs(ns *namespace) (iteration, correlation string) {
+	iteration, _ = iterationID.Load().(string)
+	if id, ok := namespaceCorrelationIDs.Load(ns.Name()); ok {
+		correlation = id.(string)
+	}
+	return iteration, correlation
+}
+
+// randomID returns random 16-byte hex ID
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// namespaceStages holds step which namespace is passing by namespace name, it's logged as 'stage' field
+var namespaceStages sync.Map
+
+// setStage sets step which is logged with every message about namespace, empty step clears it
+func setStage(ns *namespace, stage string) {
+	if stage == "" {
+		namespaceStages.Delete(ns.Name())
+		return
+	}
+	namespaceStages.Store(ns.Name(), stage)
+}
+
+// logFields returns fields logged with every message about namespace: namespace, iteration and its ID, correlation ID
+// of namespace's evaluation, repo and branch (if namespace references Github branch) and stage (if namespace is
+// passing one of the steps)
+func (ns *namespace) logFields() log.Fields {
+	fields := log.Fields{
+		"namespace": ns.Name(),
+		"iteration": atomic.LoadInt64(&iterationNumber),
+	}
+	if owner, repo, branch, err := github.ParseBranchURL(ns.ObjectMeta.Annotations[githubURLAnnotationName]); err == nil {
+		fields["repo"] = owner + "/" + repo
+		fields["branch"] = branch
+	}
+	iteration, correlation := correlationIDs(ns)
+	if iteration != "" {
+		fields["iteration_id"] = iteration
+	}
+	if correlation != "" {
+		fields["correlation_id"] = correlation
+	}
+	if stage, ok := namespaceStages.Load(ns.Name()); ok {
+		fields["stage"] = stage
+	}
+	return fields
+}
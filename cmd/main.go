@@ -1,48 +1,131 @@
 package main
 
 import (
-	"context"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"os"
-	"regexp"
+	"strconv"
 	"sync"
 	"time"
 
-	"golang.org/x/oauth2"
-
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/util/retry"
 
 	log "github.com/sirupsen/logrus"
 
+	cleanup "github.com/OpusCapita/buhtig-s8k/pkg/cleanup"
+	github "github.com/OpusCapita/buhtig-s8k/pkg/github"
 	helm "github.com/OpusCapita/buhtig-s8k/pkg/helm"
+	helm3 "github.com/OpusCapita/buhtig-s8k/pkg/helm3"
 	konnect "github.com/OpusCapita/buhtig-s8k/pkg/konnect"
 )
 
 const (
+	// componentName identifies the app as author of objects it creates (Events, ConfigMaps, etc.)
+	componentName = "buhtig-s8k"
+
 	labelSelector = "opuscapita.com/buhtig-s8k=true"
 
+	// managedByLabel marks objects created by the app for its own bookkeeping
+	managedByLabel    = "app.kubernetes.io/managed-by"
+	managedBySelector = managedByLabel + "=" + componentName
+
 	githubURLAnnotationName   = "opuscapita.com/github-source-url"
 	helmReleaseAnnotationName = "opuscapita.com/helm-release"
 
+	// optional annotations
+	githubEnvironmentAnnotationName = "opuscapita.com/github-environment"
+	vcsProviderAnnotationName       = "opuscapita.com/vcs-provider"
+	helmVersionAnnotationName       = "opuscapita.com/helm-version"
+	helmNoHooksAnnotationName       = "opuscapita.com/helm-no-hooks"
+	helmKeepHistoryAnnotationName   = "opuscapita.com/helm-keep-history"
+	helmTimeoutAnnotationName       = "opuscapita.com/helm-timeout"
+
+	fluxHelmReleasesAnnotationName   = "opuscapita.com/flux-helmreleases"
+	fluxKustomizationsAnnotationName = "opuscapita.com/flux-kustomizations"
+	// preDeleteJobAnnotationName references ConfigMap with template of Job run before deletion
+	preDeleteJobAnnotationName = "opuscapita.com/pre-delete-job"
+	// teardownWorkflowAnnotationName names Github Actions workflow run before deletion
+	teardownWorkflowAnnotationName = "opuscapita.com/teardown-workflow"
+	// databaseAnnotationName declares per-branch database dropped before deletion, Secret with connection settings
+	// and engine are declared by the other two
+	databaseAnnotationName       = "opuscapita.com/database"
+	databaseSecretAnnotationName = "opuscapita.com/database-secret"
+	databaseEngineAnnotationName = "opuscapita.com/database-engine"
+	// terraformWorkspaceAnnotationName references Terraform Cloud workspace destroyed with namespace
+	terraformWorkspaceAnnotationName = "opuscapita.com/terraform-workspace"
+	// protectedAnnotationName exempts namespace from automatic deletion when set to "true"
+	protectedAnnotationName = "opuscapita.com/protected"
+	// approvedByAnnotationName is set by human who approves deletion of namespace pending approval
+	approvedByAnnotationName = "opuscapita.com/deletion-approved-by"
+	// deletionGracePeriodAnnotationName overrides DELETION_GRACE_PERIOD for namespace
+	deletionGracePeriodAnnotationName = "opuscapita.com/deletion-grace-period"
+	// hostnamesAnnotationName lists hostnames of environment whose DNS records are deleted
+	hostnamesAnnotationName = "opuscapita.com/hostnames"
+
+	// state annotations written by the app itself
+	branchMissingCountAnnotationName = "opuscapita.com/branch-missing-count"
+	deleteAfterAnnotationName        = "opuscapita.com/delete-after"
+	quarantinedUntilAnnotationName   = "opuscapita.com/quarantined-until"
+	pendingApprovalAnnotationName    = "opuscapita.com/pending-approval"
+	approvalExpiredAnnotationName    = "opuscapita.com/approval-expired"
+	deletionDeferredAnnotationName   = "opuscapita.com/deletion-deferred"
+	rejectedByAnnotationName         = "opuscapita.com/deletion-rejected-by"
+	// quarantineReplicasAnnotationName is set on workloads scaled to zero during quarantine
+	quarantineReplicasAnnotationName         = "opuscapita.com/quarantine-replicas"
+	claimedByAnnotationName                  = "opuscapita.com/cleanup-claimed-by"
+	completedStepsAnnotationName             = "opuscapita.com/cleanup-completed-steps"
+	veleroBackupAnnotationName               = "opuscapita.com/velero-backup"
+	terraformRunAnnotationName               = "opuscapita.com/terraform-destroy-run"
+	teardownWorkflowDispatchedAnnotationName = "opuscapita.com/teardown-workflow-dispatched"
+	teardownWorkflowRunAnnotationName        = "opuscapita.com/teardown-workflow-run"
+	jenkinsBuildsAnnotationName              = "opuscapita.com/jenkins-builds"
+
 	ghTokenEnv = "GH_TOKEN"
 )
 
 var k8sConfig *rest.Config
 var k8sClient *kubernetes.Clientset
+var ghClient *github.Client
 
 func main() {
 	log.SetLevel(log.DebugLevel)
 	log.SetFormatter(&log.TextFormatter{FullTimestamp: true})
 
+	// commands which don't need Github access
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "eval":
+			os.Exit(runEval(os.Args[2:]))
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
+		case "history":
+			os.Exit(runHistory(os.Args[2:]))
+		}
+	}
+
+	// flags are registered on the global flag set, where konnect registers '-kubeconfig' too
+	logFormat := flag.String("log-format", envOrDefault(logFormatEnv, logFormatText), "log format: text or json")
+	flag.Parse()
+	if err := setupLogFormat(*logFormat); err != nil {
+		log.Fatal(err)
+	}
+	logLevel, err := log.ParseLevel(envOrDefault(logLevelEnv, "debug"))
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Env %s is invalid: %v", logLevelEnv, err))
+	}
+	log.SetLevel(logLevel)
+	setupLogDedup(envDuration(logDedupWindowEnv, 0))
+
 	// assert if required env variables are defined
 	assertEnv(ghTokenEnv)
 
-	var err error
+	cfg := loadConfig()
 
 	// get k8s connection config
 	k8sConfig, err = konnect.NewConfig()
@@ -56,6 +139,108 @@ func main() {
 		panic(err)
 	}
 
+	adminTokens = cfg.adminTokens
+	setupAudit(cfg)
+	setupEvents(k8sClient, cfg.eventsEnabled)
+	setupHistory(k8sClient, cfg.history)
+	setupBranchEnvironments(k8sConfig, cfg.branchEnvironments)
+	setupCleanupPolicies(k8sConfig, cfg.cleanupPolicies)
+	registerPauseHandlers()
+	registerLogLevelHandlers(logLevel)
+	registerApprovalHandlers(k8sClient)
+	registerSlackHandlers(k8sClient, cfg.approval.slack)
+	watchdog.timeout = cfg.livenessTimeout
+	startAdminServer(cfg.adminAddr)
+	startDebugServer(cfg.debugAddr)
+	setupTracing(cfg.otlp)
+	startMetricsExport(cfg.otlp)
+	startStatsdEmitter(cfg.statsd)
+
+	migrateOnStartup(k8sClient, cfg.migrateOnStartup)
+
+	ghClient = github.NewClient(os.Getenv(ghTokenEnv))
+	registerVCSProviders(cfg.file.VCSProviders)
+
+	helm3Client, err = helm3.NewClient(k8sClient, k8sConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	setHelmConcurrency(cfg.helmMaxConcurrency)
+
+	tillerTLS, err := helm.TLSConfig(cfg.tillerTLS)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Failed to configure TLS connection to Tiller: %v", err))
+	}
+
+	objectDeleter, err := cleanup.NewDeleter(k8sClient, k8sConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	retries := newRetryPolicy(cfg)
+	log.Info(fmt.Sprintf("Deletions are retried %s", retries))
+
+	// Helm 2 releases are deleted without Tiller if it's removed from cluster
+	var tillerless helm.Releases
+	if cfg.tillerless {
+		tillerless, err = helm.NewTillerless(k8sClient, helm3Client, cfg.tillerStorage)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	runCredentialsValidator(ghClient, cfg.credentialsCheckInterval)
+	runKubernetesCheck(k8sClient, cfg.credentialsCheckInterval)
+	// Tiller can be missing legitimately if Helm version is detected automatically
+	if cfg.tillerless || cfg.helmVersion == helmVersion2 {
+		runTillerCheck(func() helm.Releases {
+			if tillerless != nil {
+				return tillerless
+			}
+			return helm.NewTiller(k8sClient, k8sConfig, tillerTLS)
+		}, cfg.credentialsCheckInterval)
+	}
+
+	runUpdateChecker(ghClient, cfg.updateCheckRepo, cfg.updateCheckInterval)
+
+	startWebhookServer(cfg.webhookAddr, cfg.webhookSecret)
+
+	startAdmissionServer(cfg.admission)
+
+	runSummaryReporter(k8sClient, cfg.summaryIssueInterval, cfg.staleAge)
+
+	runStuckNamespaceDetector(k8sClient, objectDeleter, cfg.stuckTerminatingThreshold, cfg.forceFinalize)
+
+	observabilityCleaners := newObservabilityCleaners(cfg.file.Observability)
+
+	dnsProviders := newDNSProviders(cfg.file.DNSProviders)
+
+	ecrCleaner := newECRCleaner(cfg.file.ECR)
+
+	postDeleteHooks := newPostDeleteHooks(cfg.file.PostDeleteWebhooks)
+
+	jenkinsHooks := newJenkinsHooks(cfg.file.JenkinsJobs)
+
+	predicates := newPredicates(cfg.file.Predicates)
+
+	guards := newGuards(k8sClient, objectDeleter, cfg)
+
+	namespaceArchiver := newArchiver(k8sClient, k8sConfig, cfg.file.Archive)
+
+	switch cfg.helmSnapshot {
+	case helmSnapshotArchive:
+		releaseSnapshots = &releaseSnapshotter{archive: namespaceArchiver}
+	case helmSnapshotConfigMap:
+		releaseSnapshots = &releaseSnapshotter{k8sClient: k8sClient, namespace: konnect.CurrentNamespace()}
+	}
+
+	orphanedReleasesStorage := ""
+	if cfg.gcOrphanedHelmReleases {
+		orphanedReleasesStorage = cfg.tillerStorage
+	}
+	runGarbageCollector(k8sClient, konnect.CurrentNamespace(), cfg.gcRetention, cfg.gcInterval, orphanedReleasesStorage, cfg.tombstoneRetention)
+
+	tombstones := tombstoneSettings{retention: cfg.tombstoneRetention, namespace: konnect.CurrentNamespace()}
+
 	// set buffer of 1 to enable non-blocking send before any consumers are ready
 	start := make(chan struct{}, 1)
 	errReport := make(chan error, 1)
@@ -63,6 +248,8 @@ func main() {
 	// trigger first iteration
 	start <- struct{}{}
 
+	rampUp := newDeletionRampUp(cfg.deletionRampUpInitial, cfg.maxDeletionsPerRun)
+
 	for {
 		// main goroutine designed to run infinitely
 		// it can return only in case of panic inside it; outer loop will then start new iteration over again
@@ -88,7 +275,10 @@ func main() {
 				select {
 				// this blocks until 'start' channel receives a value
 				case <-start:
-					log.Info("Starting new iteration")
+					iterationSpan = tracer.Start(nil, "iteration")
+					startIterationLogging(iterationSpan.TraceID()).Info("Starting new iteration")
+					watchdog.iterationStarted(time.Now())
+					startIterationSummary(time.Now())
 
 					// main logic happens here
 					// make a channel of namespaces and filter it sequentially
@@ -97,20 +287,113 @@ func main() {
 					// therefore all namespaces are processed concurrently
 					// items in the resulting channel are those namespaces which completed all consequent steps in workflow
 					// (e.g. returned 'true' for all predicates one after another)
-					terminated := getNamespaces(k8sClient).
-						filter(isBranchDeleted).
-						filter(isHelmReleaseDeletedIfNeeded(k8sClient, k8sConfig)).
-						filter(isNamespaceDeleted(k8sClient))
+					// all Helm 2 deletions of iteration share the same tunnel to Tiller
+					var tiller helm.Releases = tillerless
+					if tiller == nil {
+						tiller = helm.NewTiller(k8sClient, k8sConfig, tillerTLS)
+					}
+
+					deleteRelease := isHelmReleaseDeletedIfNeeded(tiller, cfg.helmVersion, newHelmDeleteOptions(cfg), retries)
+					finalizeTerminatingNamespaces(k8sClient, deleteRelease)
+
+					budget := rampUp.budget()
+					branches := newBranchCache()
+					environments, err := loadBranchEnvironments()
+					policies, policiesErr := loadCleanupPolicies(newPolicy(cfg))
+					if err == nil {
+						err = policiesErr
+					}
+					namespaces := noNamespaces()
+					if err != nil {
+						log.WithError(err).Error("Namespaces aren't processed in this iteration, since their settings can't be read")
+					} else {
+						namespaces = getNamespaces(k8sClient)
+					}
+					terminated := namespaces.
+						filter(isBranchEnvironmentApplied(environments)).
+						filter(isCleanupPolicyApplied(policies)).
+						filter(isNamespaceNameAllowed(cfg.namespaceNames)).
+						filter(isHelmCleanupFinalizerSynced(k8sClient, cfg.helmCleanupFinalizer)).
+						filter(isBranchDeleted(k8sClient, policies, branches, cfg.branchCheckInterval)).
+						filter(isClaimedIfNeeded(k8sClient, cfg.coexistenceMode)).
+						filter(isAllowedByPolicyIfNeeded(cfg.opa, branches)).
+						filter(isMatchingPredicates(predicates, branches)).
+						filter(isApprovedIfNeeded(k8sClient, cfg.approval)).
+						filter(isInMaintenanceWindow(cfg.maintenanceWindows)).
+						filter(isNotPaused(destructionPause)).
+						filter(isApprovedByGateIfNeeded(cfg.preDeleteGate)).
+						filter(isNotGuarded(k8sClient, guards)).
+						filter(isWithinDeletionBudget(budget)).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepQuarantine,
+							withDeadline(k8sClient, stepQuarantine, cfg.namespaceDeadline, true, isQuarantinedIfNeeded(k8sClient, objectDeleter, cfg.quarantinePeriod)))).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepBackup,
+							withDeadline(k8sClient, stepBackup, cfg.namespaceDeadline, true, isBackedUpIfNeeded(k8sClient, objectDeleter, cfg.velero)))).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepArchive,
+							withDeadline(k8sClient, stepArchive, cfg.namespaceDeadline, true, stepResultOf(isArchivedIfNeeded(namespaceArchiver))))).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepPreDeleteJob,
+							withDeadline(k8sClient, stepPreDeleteJob, cfg.namespaceDeadline, true, isPreDeleteJobCompletedIfNeeded(k8sClient, cfg.preDeleteJob)))).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepWorkflow,
+							withDeadline(k8sClient, stepWorkflow, cfg.namespaceDeadline, true, isTeardownWorkflowCompletedIfNeeded(k8sClient, cfg.teardownWorkflow)))).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepJenkins,
+							withDeadline(k8sClient, stepJenkins, cfg.namespaceDeadline, true, isPreDeleteJenkinsJobCompletedIfNeeded(k8sClient, jenkinsHooks)))).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepDatabase,
+							withDeadline(k8sClient, stepDatabase, cfg.namespaceDeadline, true, isDatabaseDroppedIfNeeded(k8sClient, cfg.database)))).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepFlux,
+							withDeadline(k8sClient, stepFlux, cfg.namespaceDeadline, true, stepResultOf(isFluxCleanedIfNeeded(objectDeleter, cfg.flux))))).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepHelmRelease,
+							withDeadline(k8sClient, stepHelmRelease, cfg.namespaceDeadline, true, stepResultOf(deleteRelease)))).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepExtraResources,
+							withDeadline(k8sClient, stepExtraResources, cfg.namespaceDeadline, true, stepResultOf(isExtraResourcesDeletedIfNeeded(objectDeleter, cfg.file.ExtraResources))))).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepClusterResources,
+							withDeadline(k8sClient, stepClusterResources, cfg.namespaceDeadline, true, stepResultOf(isClusterResourcesDeletedIfNeeded(objectDeleter, cfg.clusterCleanup))))).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepDNS,
+							withDeadline(k8sClient, stepDNS, cfg.namespaceDeadline, true, stepResultOf(isDNSCleanedIfNeeded(objectDeleter, cfg.dns, dnsProviders))))).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepLoadBalancers,
+							withDeadline(k8sClient, stepLoadBalancers, cfg.namespaceDeadline, true, stepResultOf(isLoadBalancersDeletedIfNeeded(objectDeleter, cfg.loadBalancerTimeout))))).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepTerraform,
+							withDeadline(k8sClient, stepTerraform, cfg.namespaceDeadline, true, isTerraformDestroyedIfNeeded(k8sClient, cfg.terraform)))).
+						filter(withFailureCommitStatus(cfg.commitStatusEnabled, budget, stepNamespace,
+							withDeadline(k8sClient, stepNamespace, cfg.namespaceDeadline, false, stepResultOf(isNamespaceDeleted(k8sClient, retries))))).
+						filter(isTombstoneWrittenIfNeeded(k8sClient, tombstones)).
+						filter(isCommitStatusPublishedIfNeeded(cfg.commitStatusEnabled)).
+						filter(isPullRequestNotifiedIfNeeded(cfg.prCommentEnabled)).
+						filter(isGithubDeploymentsCleanedIfNeeded(cfg.deploymentsPolicy)).
+						filter(isGithubEnvironmentDeletedIfNeeded(cfg.githubEnvironmentTemplate)).
+						filter(isObservabilityCleanedIfNeeded(observabilityCleaners)).
+						filter(isECRCleanedIfNeeded(ecrCleaner)).
+						filter(isPostDeleteWebhookSentIfNeeded(postDeleteHooks)).
+						filter(isPostDeleteJenkinsJobTriggeredIfNeeded(k8sClient, jenkinsHooks))
 
 					// this loop blocks until 'terminated' channel is closed
+					completed := 0
 					for ns := range terminated {
 						ns.logger().Debug("Completely terminated")
+						completed++
+						endNamespaceSpan(ns.Name(), true)
+					}
+					endIterationSpan(completed)
+					finishIterationSummary(time.Now())
+					tiller.Close()
+					writeBranchEnvironments(k8sClient, environments, cfg.gcRetention)
+					writeNamespaceStatuses(k8sClient, cfg.statusAnnotations)
+					pruneHistory(cfg.history)
+					rampUp.done(budget, completed)
+					iterationCompletedGauge.SetToCurrentTime()
+
+					if cfg.runOnce {
+						exitAfterRun(cfg.pushgateway, nil)
 					}
 
 					log.Debug("All namespaces processed, time to reschedule")
+					next := cfg.iterationSchedule.next(time.Now())
+					watchdog.iterationCompleted(next)
 					go func() {
-						log.Debug("Sleep")
-						<-time.After(time.Minute)
+						log.WithField("until", next.Format(time.RFC3339)).Debug("Sleep")
+						select {
+						case <-time.After(time.Until(next)):
+						case <-iterationTrigger:
+							log.Debug("Iteration is triggered")
+						}
 						log.Debug("Reschedule")
 						start <- struct{}{}
 					}()
@@ -120,6 +403,11 @@ func main() {
 
 		err := <-errReport
 		log.Error(err)
+		if cfg.runOnce {
+			exitAfterRun(cfg.pushgateway, err)
+		}
+		// iteration has crashed, deletions are ramped up from scratch
+		rampUp.reset()
 	}
 }
 
@@ -140,7 +428,7 @@ func (ns *namespace) Name() string {
 }
 
 func (ns *namespace) logger() *log.Entry {
-	return log.WithFields(log.Fields{"namespace": ns.Name()})
+	return log.WithFields(ns.logFields())
 }
 
 func (ns *namespace) GithubSourceURL() (string, error) {
@@ -148,10 +436,25 @@ func (ns *namespace) GithubSourceURL() (string, error) {
 	if !ok {
 		return "", fmt.Errorf("Annotation '%s' not set", githubURLAnnotationName)
 	}
-	ns.logger().Debug(fmt.Sprintf("%s = %s", githubURLAnnotationName, githubURL))
+	ns.logger().WithField("url", githubURL).Debug("Branch URL of namespace")
 	return githubURL, nil
 }
 
+// IsGithubSource checks if namespace's source URL points to Github (and not to other VCS)
+func (ns *namespace) IsGithubSource() bool {
+	_, _, _, err := ns.GithubBranch()
+	return err == nil
+}
+
+// GithubBranch returns owner, repository and branch referenced by namespace's Github source URL
+func (ns *namespace) GithubBranch() (owner, repo, branch string, err error) {
+	githubURL, err := ns.GithubSourceURL()
+	if err != nil {
+		return "", "", "", err
+	}
+	return github.ParseBranchURL(githubURL)
+}
+
 func (ns *namespace) HelmRelease() (string, error) {
 	helmRelease, ok := ns.ObjectMeta.Annotations[helmReleaseAnnotationName]
 	if !ok {
@@ -160,6 +463,49 @@ func (ns *namespace) HelmRelease() (string, error) {
 	return helmRelease, nil
 }
 
+// BranchMissingCount returns number of consecutive checks which found branch missing
+func (ns *namespace) BranchMissingCount() int {
+	count, err := strconv.Atoi(ns.ObjectMeta.Annotations[branchMissingCountAnnotationName])
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// DeleteAfter returns time after which namespace marked for deletion is deleted, it's zero if namespace isn't marked
+func (ns *namespace) DeleteAfter() time.Time {
+	deleteAfter, err := time.Parse(time.RFC3339, ns.ObjectMeta.Annotations[deleteAfterAnnotationName])
+	if err != nil {
+		return time.Time{}
+	}
+	return deleteAfter
+}
+
+// patchAnnotations sets (or removes if value is nil) namespace annotations in Kubernetes
+// and mirrors the change in local copy of namespace
+func (ns *namespace) patchAnnotations(k8sClient kubernetes.Interface, annotations map[string]*string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = k8sClient.CoreV1().Namespaces().Patch(ns.Name(), types.MergePatchType, patch)
+	if err != nil {
+		return err
+	}
+
+	for key, val := range annotations {
+		if val == nil {
+			delete(ns.ObjectMeta.Annotations, key)
+		} else {
+			metav1.SetMetaDataAnnotation(&ns.ObjectMeta, key, *val)
+		}
+	}
+	return nil
+}
+
 // implement Stringer type to enable usage of namespace type in string context (print to stdout, concat string, etc.)
 func (ns *namespace) String() string {
 	return ns.Name()
@@ -195,6 +541,9 @@ func (in nsChan) filter(predicate func(*namespace) bool) nsChan {
 				// if predicate returns true then push to output channel
 				if predicate(ns) {
 					out <- ns
+				} else {
+					// namespace leaves the pipeline, its trace is complete
+					endNamespaceSpan(ns.Name(), false)
 				}
 			}(ns)
 		}
@@ -209,6 +558,13 @@ func (in nsChan) filter(predicate func(*namespace) bool) nsChan {
 	return out
 }
 
+// noNamespaces returns closed channel, e.g. to skip processing in iteration
+func noNamespaces() nsChan {
+	namespaces := make(nsChan)
+	close(namespaces)
+	return namespaces
+}
+
 // getNamespaces returns a channel which is populated by namespaces from Kubernetes API
 // which match our labelSelector. It incapsulates logic required for creating a list of
 // relevant namespaces.
@@ -243,12 +599,17 @@ func getNamespaces(k8sClient kubernetes.Interface) nsChan {
 
 		num := len(nsList.Items)
 
-		log.Info(fmt.Sprintf("Found %d relevant namespaces", num))
+		log.WithField("count", num).Info("Found relevant namespaces")
 
 		for _, ns := range nsList.Items {
 			// get only those namespaces which are not in Terminating state currently
 			if ns.Status.Phase != corev1.NamespaceTerminating {
-				namespaces <- newNamespace(ns)
+				processingStartedAt.Store(ns.Name, time.Now())
+				coercedNs := newNamespace(ns)
+				startCorrelation(coercedNs)
+				countFound()
+				startNamespaceSpan(coercedNs)
+				namespaces <- coercedNs
 			}
 		}
 	}()
@@ -257,40 +618,138 @@ func getNamespaces(k8sClient kubernetes.Interface) nsChan {
 	return namespaces
 }
 
-func isBranchDeleted(ns *namespace) bool {
-	logger := ns.logger()
+// isBranchDeleted checks if branch referenced by namespace is deleted from Github (or other VCS)
+// and lets decision engine (see 'evaluate') decide whether namespace should be deleted;
+// counter of consecutive 404s is persisted in namespace annotation to survive restarts; branch of namespace
+// isn't checked more often than checkInterval (see 'isCheckThrottled')
+func isBranchDeleted(k8sClient kubernetes.Interface, policies *cleanupPolicies, cache *branchCache, checkInterval time.Duration) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		setStage(ns, "branch-check")
+		defer setStage(ns, "")
+		logger := ns.logger()
 
-	logger.Debug("Checking branch")
+		logger.Debug("Checking branch")
 
-	githubURL, err := ns.GithubSourceURL()
-	if err != nil {
-		logger.Error(err)
-		return false
-	}
+		githubURL, err := ns.GithubSourceURL()
+		if err != nil {
+			logger.Error(err)
+			return false
+		}
 
-	// check Github Url
-	status, err := getBranchURLStatus(githubURL)
-	if err != nil {
-		logger.Error(err)
-		return false
-	}
-	if status != 404 {
-		logger.Info(fmt.Sprintf("Received status %d for URL %s, do nothing", status, githubURL))
+		provider, err := lookupProvider(ns, githubURL)
+		if err != nil {
+			logger.Error(err)
+			return false
+		}
+
+		// while API budget is exhausted branch can't be checked, but cleanup which was already decided
+		// in previous iterations (and partially done) can go on
+		if reset := rateLimitedUntil(provider); !reset.IsZero() {
+			if len(ns.CompletedSteps()) > 0 && !ns.IsProtected() {
+				logger.WithField("provider", provider.Name()).Info("Rate limit is exhausted, continuing cleanup started earlier")
+				return true
+			}
+			logger.WithFields(log.Fields{"provider": provider.Name(), "rate_limit_reset": reset.Format(time.RFC3339)}).Debug("Rate limit is exhausted, branch check is delayed")
+			return false
+		}
+
+		if isCheckThrottled(ns, checkInterval, time.Now()) {
+			logger.WithField("last_checked", ns.LastChecked().Format(time.RFC3339)).Debug("Branch was checked recently, check is throttled")
+			return false
+		}
+
+		// check source branch (and repository if branch is missing)
+		e := evaluation{ns: ns, now: time.Now()}
+		// the same branch may be referenced by several namespaces, it's checked once per iteration
+		span := startClientSpan(ns, "vcs.check-branch")
+		span.SetAttribute("vcs.provider", provider.Name())
+		e.branchStatus, e.repoStatus, err = cache.check(branchCacheKey(ns, githubURL), provider, githubURL)
+		span.SetAttribute("http.status_code", e.branchStatus)
+		endSpan(ns, span, err)
+		if err != nil {
+			logger.Error(err)
+			countErrored(ns)
+			return false
+		}
+		countEvaluated()
+
+		d := evaluate(policies.policyFor(ns), e)
+		for _, line := range d.trace {
+			logger.Debug(line)
+		}
+		recordDecisionEvents(ns, e, d)
+		setNamespaceStatus(e, d)
+
+		patch := map[string]*string{}
+		// time of check is needed to throttle next checks
+		if ns.BranchCheckInterval(checkInterval) > 0 {
+			lastChecked := e.now.UTC().Format(time.RFC3339)
+			patch[lastCheckedAnnotationName] = &lastChecked
+		}
+		if d.branchMissingCount != ns.BranchMissingCount() {
+			var count *string
+			if d.branchMissingCount > 0 {
+				countStr := strconv.Itoa(d.branchMissingCount)
+				count = &countStr
+			}
+			patch[branchMissingCountAnnotationName] = count
+		}
+		if !d.deleteAfter.Equal(ns.DeleteAfter()) {
+			var deleteAfter *string
+			if !d.deleteAfter.IsZero() {
+				deleteAfterStr := d.deleteAfter.UTC().Format(time.RFC3339)
+				deleteAfter = &deleteAfterStr
+			}
+			patch[deleteAfterAnnotationName] = deleteAfter
+		}
+		// branch is back (e.g. recreated), progress of previous cleanup attempt is obsolete
+		if e.branchStatus != 404 && len(ns.CompletedSteps()) > 0 {
+			patch[completedStepsAnnotationName] = nil
+		}
+		// namespace isn't a deletion candidate anymore, approval and deferral of deletion are reset too
+		if e.branchStatus != 404 {
+			for _, name := range append(approvalState, deletionDeferredAnnotationName) {
+				if _, ok := ns.ObjectMeta.Annotations[name]; ok {
+					patch[name] = nil
+				}
+			}
+		}
+		// quarantine is lifted, but workloads are left scaled down until somebody scales them back up
+		if (e.branchStatus != 404 || ns.IsProtected()) && !ns.QuarantinedUntil().IsZero() {
+			logger.Warn(fmt.Sprintf("Namespace isn't going to be deleted, quarantine is lifted; scale workloads back up to replicas in '%s' annotation and restore Ingresses from ConfigMap %s", quarantineReplicasAnnotationName, quarantineConfigMapName))
+			patch[quarantinedUntilAnnotationName] = nil
+		}
+		if len(patch) > 0 {
+			if err := ns.patchAnnotations(k8sClient, patch); err != nil {
+				logger.Error(err)
+			}
+		}
+
+		logger = logger.WithFields(log.Fields{"status": e.branchStatus, "action": d.action})
+		switch d.action {
+		case actionDelete:
+			logger.WithField("url", githubURL).Info("Branch is deleted, call the Terminator!")
+			return true
+		case actionWait:
+			logger.WithFields(log.Fields{"url": githubURL, "reason": d.reason}).Info("Waiting before deletion")
+		default:
+			logger.WithFields(log.Fields{"url": githubURL, "reason": d.reason}).Info("Do nothing")
+			if d.skipReason != "" {
+				namespacesSkippedCounter.WithLabelValues(d.skipReason).Inc()
+				countSkipped(d.skipReason)
+			}
+		}
 		return false
 	}
-
-	// it was 404, proceed
-	logger.Info(fmt.Sprintf("Received status %d for URL %s, call the Terminator!", status, githubURL))
-	return true
 }
 
-func isHelmReleaseDeletedIfNeeded(k8sClient kubernetes.Interface, k8sConfig *rest.Config) func(*namespace) bool {
+func isHelmReleaseDeletedIfNeeded(tiller helm.Releases, helmVersion string, deleteOptions helmDeleteOptions, retries retryPolicy) func(*namespace) bool {
 	return func(ns *namespace) bool {
 		logger := ns.logger()
 
 		logger.Debug("Deleting Helm release")
 
-		retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		retryErr := retries.do(func() error {
 			helmRelease, err := ns.HelmRelease()
 			if err != nil {
 				logger.Error(err)
@@ -298,17 +757,23 @@ func isHelmReleaseDeletedIfNeeded(k8sClient kubernetes.Interface, k8sConfig *res
 			}
 
 			logger.Info("Trying to delete Helm release")
-			err = helm.DeleteRelease(helmRelease, k8sClient, k8sConfig)
+			span := startClientSpan(ns, "helm.delete-release")
+			span.SetAttribute("helm.release", helmRelease)
+			err = deleteHelmRelease(helmVersion, deleteOptions, ns, helmRelease, tiller)
+			endSpan(ns, span, err)
+			auditAction(ns, "delete-helm-release", err, map[string]string{"helmRelease": helmRelease})
 			if err != nil {
 				logger.Error(err)
 				return err
 			}
 			logger.Info("Successfully deleted helm release")
+			recordEvent(ns, corev1.EventTypeNormal, eventHelmReleaseDeleted, fmt.Sprintf("Helm release %s is deleted", helmRelease))
 			return nil
 		})
 
 		if retryErr != nil {
 			logger.Error(retryErr)
+			recordEvent(ns, corev1.EventTypeWarning, eventDeletionFailed, fmt.Sprintf("Failed to delete Helm release: %v", retryErr))
 			return false
 		}
 
@@ -318,14 +783,14 @@ func isHelmReleaseDeletedIfNeeded(k8sClient kubernetes.Interface, k8sConfig *res
 
 // isNamespaceDeleted deletes namespace from Kubernetes if it exists
 // returns false if namespace deletion fails, true otherwise
-func isNamespaceDeleted(k8sClient kubernetes.Interface) func(*namespace) bool {
+func isNamespaceDeleted(k8sClient kubernetes.Interface, retries retryPolicy) func(*namespace) bool {
 	return func(ns *namespace) bool {
 		logger := ns.logger()
 
 		logger.Debug("Deleting namespace")
 
-		// use "k8s.io/client-go/util/retry" package to retry on conflicts
-		retryErr := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		// errors are retried according to RETRY_* settings, by default only conflicts are
+		retryErr := retries.do(func() error {
 			logger.Debug("Getting namespace")
 			k8sNs, err := k8sClient.CoreV1().Namespaces().Get(ns.Name(), metav1.GetOptions{})
 
@@ -340,47 +805,26 @@ func isNamespaceDeleted(k8sClient kubernetes.Interface) func(*namespace) bool {
 			}
 
 			logger.Debug("Trying to delete namespace")
+			span := startClientSpan(ns, "kubernetes.delete-namespace")
 			err = k8sClient.CoreV1().Namespaces().Delete(ns.Name(), &metav1.DeleteOptions{})
+			endSpan(ns, span, err)
+			auditAction(ns, "delete-namespace", err, nil)
 			if err != nil {
 				logger.Error(err)
 				return err
 			}
 			logger.Info("Successfully deleted namespace")
+			recordEvent(ns, corev1.EventTypeNormal, eventNamespaceDeleted, "Namespace is deleted")
 			return nil
 		})
 
 		if retryErr != nil {
 			logger.Error(retryErr)
+			recordEvent(ns, corev1.EventTypeWarning, eventDeletionFailed, fmt.Sprintf("Failed to delete namespace: %v", retryErr))
 			return false
 		}
 
+		setNamespaceDeleted(ns)
 		return true
 	}
 }
-
-// getBranchURLStatus expects URL like https://github.com/USER/REPO/tree/BRANCH
-// it queries Github API and returns status code of HTTP response
-func getBranchURLStatus(branchURL string) (status int, err error) {
-	ghBranchURLRe := regexp.MustCompile("https://github.com/([^/]+)/([^/]+)/tree/(.+)")
-	parts := ghBranchURLRe.FindStringSubmatch(branchURL)
-	if parts == nil || len(parts) < 4 {
-		return 0, fmt.Errorf("branchURL doesn't match regexp: %v", parts)
-	}
-
-	// get Github auth token from env variable and inject it into http client
-	tokenSource := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: os.Getenv(ghTokenEnv)},
-	)
-	httpClient := oauth2.NewClient(context.Background(), tokenSource)
-
-	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/branches/%s", parts[1], parts[2], parts[3])
-
-	resp, err := httpClient.Get(apiURL)
-	defer resp.Body.Close()
-
-	if err != nil {
-		return 0, err
-	}
-
-	return resp.StatusCode, nil
-}
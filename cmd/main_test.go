@@ -1,14 +1,59 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/Masterminds/semver"
+	promclient "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	log "github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/yaml"
+
+	cleanup "github.com/OpusCapita/buhtig-s8k/pkg/cleanup"
+	"github.com/OpusCapita/buhtig-s8k/pkg/crd"
+	"github.com/OpusCapita/buhtig-s8k/pkg/dns"
+	"github.com/OpusCapita/buhtig-s8k/pkg/github"
+	helm3 "github.com/OpusCapita/buhtig-s8k/pkg/helm3"
+	"github.com/OpusCapita/buhtig-s8k/pkg/opa"
+	"github.com/OpusCapita/buhtig-s8k/pkg/prometheus"
+	"github.com/OpusCapita/buhtig-s8k/pkg/slack"
+	vcs "github.com/OpusCapita/buhtig-s8k/pkg/vcs"
+	webhook "github.com/OpusCapita/buhtig-s8k/pkg/webhook"
 )
 
 func TestNamespace_Name(t *testing.T) {
@@ -178,7 +223,7 @@ func TestIsNamespaceDeleted(t *testing.T) {
 	k8sNs, err := k8sClient.CoreV1().Namespaces().Get(names[1], metav1.GetOptions{})
 
 	// should delete namespace and return true
-	ok := isNamespaceDeleted(k8sClient)(newNamespace(*k8sNs))
+	ok := isNamespaceDeleted(k8sClient, retryPolicy{backoff: retry.DefaultRetry, on: []string{retryOnConflict}})(newNamespace(*k8sNs))
 
 	nsList, err := k8sClient.CoreV1().Namespaces().List(metav1.ListOptions{})
 	if err != nil {
@@ -197,9 +242,2545 @@ func TestIsNamespaceDeleted(t *testing.T) {
 	nonExNs := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "IDontExist"}}
 
 	// should return true because this namespace doesn't exist
-	ok = isNamespaceDeleted(k8sClient)(newNamespace(nonExNs))
+	ok = isNamespaceDeleted(k8sClient, retryPolicy{backoff: retry.DefaultRetry, on: []string{retryOnConflict}})(newNamespace(nonExNs))
 
 	if !ok {
 		t.Errorf("Expected %v for not existing namespace, but got %v", true, ok)
 	}
 }
+
+func TestNamespace_patchAnnotations(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+
+	err := addK8sNs(k8sClient, []string{"One"}, false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	k8sNs, err := k8sClient.CoreV1().Namespaces().Get("One", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := newNamespace(*k8sNs)
+
+	if ns.BranchMissingCount() != 0 {
+		t.Errorf("Expected 0 for namespace without annotation, but got %d", ns.BranchMissingCount())
+	}
+
+	count := "2"
+	if err := ns.patchAnnotations(k8sClient, map[string]*string{branchMissingCountAnnotationName: &count}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ns.BranchMissingCount() != 2 {
+		t.Errorf("Expected local copy to have count 2, but got %d", ns.BranchMissingCount())
+	}
+
+	k8sNs, err = k8sClient.CoreV1().Namespaces().Get("One", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newNamespace(*k8sNs).BranchMissingCount() != 2 {
+		t.Errorf("Expected patched namespace to have count 2, but got %v", k8sNs.ObjectMeta.Annotations)
+	}
+
+	if err := ns.patchAnnotations(k8sClient, map[string]*string{branchMissingCountAnnotationName: nil}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ns.ObjectMeta.Annotations[branchMissingCountAnnotationName]; ok {
+		t.Errorf("Expected annotation to be removed")
+	}
+}
+
+func TestWithDeadline(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+
+	err := addK8sNs(k8sClient, []string{"One"}, false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	k8sNs, err := k8sClient.CoreV1().Namespaces().Get("One", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := newNamespace(*k8sNs)
+
+	calls := 0
+	step := withDeadline(k8sClient, stepHelmRelease, time.Minute, true, func(*namespace) stepResult {
+		calls++
+		return stepDone
+	})
+
+	processingStartedAt.Store(ns.Name(), time.Now())
+	if step(ns) != stepDone || calls != 1 {
+		t.Errorf("Expected step to be run once, but it was run %d times", calls)
+	}
+	if !ns.isStepCompleted(stepHelmRelease) {
+		t.Errorf("Expected step to be persisted as completed, got %v", ns.ObjectMeta.Annotations)
+	}
+
+	// completed step is skipped on next attempt
+	if step(ns) != stepDone || calls != 1 {
+		t.Errorf("Expected completed step to be skipped, but it was run %d times", calls)
+	}
+
+	// step isn't started after deadline
+	processingStartedAt.Store(ns.Name(), time.Now().Add(-time.Hour))
+	expired := withDeadline(k8sClient, stepNamespace, time.Minute, false, func(*namespace) stepResult {
+		t.Errorf("Step shouldn't be run after deadline")
+		return stepDone
+	})
+	if expired(ns) != stepWaiting {
+		t.Errorf("Expected expired deadline to wait for the next iteration")
+	}
+}
+
+func TestWithDeadline_abandonedStep(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+	if err := addK8sNs(k8sClient, []string{"One"}, false); err != nil {
+		t.Fatal(err)
+	}
+	get := func() *namespace {
+		k8sNs, err := k8sClient.CoreV1().Namespaces().Get("One", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newNamespace(*k8sNs)
+	}
+
+	release, finished := make(chan struct{}), make(chan struct{})
+	var calls int32
+	step := withDeadline(k8sClient, stepBackup, time.Minute, true, func(*namespace) stepResult {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		defer close(finished)
+		return stepDone
+	})
+
+	ns := get()
+	processingStartedAt.Store(ns.Name(), time.Now().Add(-time.Minute+50*time.Millisecond))
+	if step(ns) != stepWaiting {
+		t.Errorf("Expected step exceeding deadline to wait for the next iteration")
+	}
+
+	// abandoned step isn't started again while it's running
+	processingStartedAt.Store(ns.Name(), time.Now())
+	if step(get()) != stepWaiting || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("Expected step to be left alone while it's running, it was started %d times", atomic.LoadInt32(&calls))
+	}
+
+	close(release)
+	<-finished
+	// wait for the step to record its result
+	for i := 0; i < 100; i++ {
+		val, _ := stepsInFlight.Load("One")
+		run := val.(*stepRun)
+		run.mu.Lock()
+		done := run.finished
+		run.mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if get().isStepCompleted(stepBackup) {
+		t.Errorf("Expected abandoned namespace copy not to be patched")
+	}
+
+	fresh := get()
+	if step(fresh) != stepDone || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("Expected finished step to be resumed without running it again, it was started %d times", atomic.LoadInt32(&calls))
+	}
+	if !get().isStepCompleted(stepBackup) {
+		t.Errorf("Expected step completion to be persisted on the next attempt")
+	}
+}
+
+// countingProvider reports every branch as missing and counts branch checks
+type countingProvider struct {
+	mu     sync.Mutex
+	checks int
+}
+
+func (p *countingProvider) Name() string                  { return "counting" }
+func (p *countingProvider) Match(*url.URL) bool           { return true }
+func (p *countingProvider) CheckRepo(string) (int, error) { return 200, nil }
+func (p *countingProvider) CheckPR(string) (*vcs.PullRequest, error) {
+	return nil, vcs.ErrNotSupported
+}
+func (p *countingProvider) CheckBranch(string) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checks++
+	time.Sleep(10 * time.Millisecond)
+	return 404, nil
+}
+
+func TestBranchCache(t *testing.T) {
+	provider := &countingProvider{}
+	cache := newBranchCache()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if branchStatus, repoStatus, err := cache.check("repo/branch", provider, "https://example.com/repo/branch"); branchStatus != 404 || repoStatus != 200 || err != nil {
+				t.Errorf("Unexpected result %d, %d, %v", branchStatus, repoStatus, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if provider.checks != 1 {
+		t.Errorf("Expected branch to be checked once, but it was checked %d times", provider.checks)
+	}
+
+	cache.check("repo/other", provider, "https://example.com/repo/other")
+	if provider.checks != 2 {
+		t.Errorf("Expected another branch to be checked separately, but there were %d checks", provider.checks)
+	}
+}
+
+func TestDetectHelmVersion(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+	helm3Release := &release.Release{Name: "helm3-release", Namespace: "ns", Version: 1, Info: &release.Info{Status: release.StatusDeployed}}
+	if err := driver.NewSecrets(k8sClient.CoreV1().Secrets("ns")).Create("sh.helm.release.v1.helm3-release.v1", helm3Release); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	helm3Client, err = helm3.NewClient(k8sClient, &rest.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ns := &namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns", Annotations: map[string]string{}}}
+	for _, tc := range []struct {
+		configured, annotation, release, expected string
+	}{
+		{helmVersionAuto, "", "helm3-release", helmVersion3},
+		{helmVersionAuto, "", "tiller-release", helmVersion2},
+		{helmVersion2, "", "helm3-release", helmVersion2},
+		{helmVersion2, helmVersionAuto, "helm3-release", helmVersion3},
+		{helmVersionAuto, helmVersion2, "helm3-release", helmVersion2},
+	} {
+		ns.ObjectMeta.Annotations[helmVersionAnnotationName] = tc.annotation
+		if version, err := detectHelmVersion(tc.configured, ns, "ns", tc.release); err != nil || version != tc.expected {
+			t.Errorf("Expected version %s for %+v, but got %s (%v)", tc.expected, tc, version, err)
+		}
+	}
+}
+
+func TestDeleteHelmRelease_Concurrency(t *testing.T) {
+	var err error
+	helm3Client, err = helm3.NewClient(fake.NewSimpleClientset(), &rest.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setHelmConcurrency(1)
+	defer setHelmConcurrency(0)
+
+	// the only slot is taken, so deletion has to wait
+	helmSlots <- struct{}{}
+	done := make(chan error)
+	go func() {
+		ns := &namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns"}}
+		done <- deleteHelmRelease(helmVersion3, helmDeleteOptions{}, ns, "release", nil)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Expected deletion to wait for free slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-helmSlots
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestParseReleaseRef(t *testing.T) {
+	ns := &namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev-branch"}}
+
+	if releaseNamespace, release, explicit := parseReleaseRef(ns, "dev-branch-app"); releaseNamespace != "dev-branch" || release != "dev-branch-app" || explicit {
+		t.Errorf("Unexpected result for plain release: %s, %s, %v", releaseNamespace, release, explicit)
+	}
+	if releaseNamespace, release, explicit := parseReleaseRef(ns, "ingress/dev-branch-ingress"); releaseNamespace != "ingress" || release != "dev-branch-ingress" || !explicit {
+		t.Errorf("Unexpected result for cross-namespace release: %s, %s, %v", releaseNamespace, release, explicit)
+	}
+}
+
+func TestHelmDeleteOptions_forNamespace(t *testing.T) {
+	defaults := helmDeleteOptions{timeout: 5 * time.Minute}
+	ns := &namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns", Annotations: map[string]string{
+		helmNoHooksAnnotationName:     "true",
+		helmKeepHistoryAnnotationName: "not-a-bool",
+		helmTimeoutAnnotationName:     "90s",
+	}}}
+
+	opts := defaults.forNamespace(ns)
+	if !opts.noHooks || opts.keepHistory || opts.timeout != 90*time.Second {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+	if defaults.noHooks {
+		t.Errorf("Defaults shouldn't be modified")
+	}
+}
+
+func TestFluxObjects(t *testing.T) {
+	ns := &namespace{ObjectMeta: metav1.ObjectMeta{Name: "ns", Annotations: map[string]string{
+		fluxHelmReleasesAnnotationName:   "app, shared/ingress",
+		fluxKustomizationsAnnotationName: "",
+	}}}
+
+	objects := fluxObjects(ns, "flux-system")
+	if len(objects) != 2 || objects[0].String() != "HelmRelease flux-system/app" || objects[1].String() != "HelmRelease shared/ingress" {
+		t.Errorf("Unexpected Flux objects %v", objects)
+	}
+}
+
+func TestBelongsToNamespace(t *testing.T) {
+	newObject := func(kind, name string, labels map[string]string, fields map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: fields}
+		if obj.Object == nil {
+			obj.Object = map[string]interface{}{}
+		}
+		obj.SetKind(kind)
+		obj.SetName(name)
+		obj.SetLabels(labels)
+		return obj
+	}
+
+	for _, tc := range []struct {
+		obj      *unstructured.Unstructured
+		expected bool
+	}{
+		{newObject("IngressClass", "preview-a", nil, nil), true},
+		{newObject("IngressClass", "preview-a-nginx", nil, nil), false},
+		{newObject("ClusterRoleBinding", "preview-a-2", nil, nil), false},
+		{newObject("IngressClass", "preview-ab", nil, nil), false},
+		{newObject("ValidatingWebhookConfiguration", "webhook", map[string]string{"env": "preview-a"}, nil), true},
+		{newObject("PersistentVolume", "pvc-123", nil, map[string]interface{}{"spec": map[string]interface{}{"claimRef": map[string]interface{}{"namespace": "preview-a"}}}), true},
+		{newObject("PersistentVolume", "pvc-456", nil, map[string]interface{}{"spec": map[string]interface{}{"claimRef": map[string]interface{}{"namespace": "other"}}}), false},
+		{newObject("ClusterRoleBinding", "reader", nil, map[string]interface{}{"subjects": []interface{}{
+			map[string]interface{}{"kind": "ServiceAccount", "name": "default", "namespace": "preview-a"},
+		}}), true},
+		{newObject("ClusterRoleBinding", "shared", nil, map[string]interface{}{"subjects": []interface{}{
+			map[string]interface{}{"kind": "ServiceAccount", "name": "default", "namespace": "preview-a"},
+			map[string]interface{}{"kind": "Group", "name": "developers"},
+		}}), false},
+	} {
+		if actual := belongsToNamespace(tc.obj, "preview-a", "env"); actual != tc.expected {
+			t.Errorf("Expected %v for %s %s, but got %v", tc.expected, tc.obj.GetKind(), tc.obj.GetName(), actual)
+		}
+	}
+}
+
+func TestObjectHostnames(t *testing.T) {
+	ingress := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"rules": []interface{}{map[string]interface{}{"host": "a.example.com"}},
+			"tls":   []interface{}{map[string]interface{}{"hosts": []interface{}{"b.example.com"}}},
+		},
+	}}
+	ingress.SetKind("Ingress")
+	ingress.SetAnnotations(map[string]string{externalDNSHostnameAnnotation: "c.example.com, d.example.com"})
+
+	endpoint := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"endpoints": []interface{}{map[string]interface{}{"dnsName": "e.example.com"}}},
+	}}
+	endpoint.SetKind("DNSEndpoint")
+
+	for _, tc := range []struct {
+		obj      *unstructured.Unstructured
+		expected []string
+	}{
+		{ingress, []string{"c.example.com", "d.example.com", "a.example.com", "b.example.com"}},
+		{endpoint, []string{"e.example.com"}},
+	} {
+		if actual := objectHostnames(tc.obj); !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("Expected %v for %s, but got %v", tc.expected, tc.obj.GetKind(), actual)
+		}
+	}
+}
+
+func TestDNSProvider_manages(t *testing.T) {
+	p := dnsProvider{domain: "preview.example.com."}
+	for hostname, expected := range map[string]bool{
+		"a.preview.example.com":  true,
+		"A.Preview.Example.com.": true,
+		"preview.example.com":    true,
+		"apreview.example.com":   false,
+		"a.example.com":          false,
+	} {
+		if actual := p.manages(hostname); actual != expected {
+			t.Errorf("Expected %v for %s, but got %v", expected, hostname, actual)
+		}
+	}
+}
+
+// fakeDNSProvider records hostnames it's asked to delete together with resources of environment
+type fakeDNSProvider struct {
+	deleted map[string][]string
+}
+
+func (p *fakeDNSProvider) Name() string { return "fake" }
+
+func (p *fakeDNSProvider) DeleteRecords(hostname string, owner dns.Ownership) (int, error) {
+	resources := []string{}
+	for r := range owner.Resources {
+		resources = append(resources, r)
+	}
+	sort.Strings(resources)
+	p.deleted[hostname] = resources
+	return 1, nil
+}
+
+func TestIsDNSCleanedIfNeeded_SkipsSharedHosts(t *testing.T) {
+	ingressKind := schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1beta1", Kind: "Ingress"}
+	endpointKind := schema.GroupVersionKind{Group: "externaldns.k8s.io", Version: "v1alpha1", Kind: "DNSEndpoint"}
+	newIngress := func(namespace, name, host string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"rules": []interface{}{map[string]interface{}{"host": host}}},
+		}}
+		obj.SetGroupVersionKind(ingressKind)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		return obj
+	}
+	endpoint := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"endpoints": []interface{}{map[string]interface{}{"dnsName": "db.preview.example.com"}}},
+	}}
+	endpoint.SetGroupVersionKind(endpointKind)
+	endpoint.SetNamespace("preview")
+	endpoint.SetName("db")
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newIngress("preview", "web", "web.preview.example.com"),
+		newIngress("preview", "api", "shared.example.com"),
+		newIngress("other", "api", "shared.example.com"),
+		endpoint,
+	)
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{ingressKind.GroupVersion(), endpointKind.GroupVersion()})
+	mapper.Add(ingressKind, meta.RESTScopeNamespace)
+	mapper.Add(endpointKind, meta.RESTScopeNamespace)
+	deleter := cleanup.NewDeleterForClients(dynamicClient, mapper, nil)
+	provider := &fakeDNSProvider{deleted: map[string][]string{}}
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview"}})
+
+	if !isDNSCleanedIfNeeded(deleter, dnsSettings{enabled: true}, []dnsProvider{{Provider: provider, domain: "example.com"}})(ns) {
+		t.Fatal("Expected DNS to be cleaned")
+	}
+	resources := []string{"crd/preview/db", "ingress/preview/api", "ingress/preview/web"}
+	expected := map[string][]string{"web.preview.example.com": resources, "db.preview.example.com": resources}
+	if !reflect.DeepEqual(provider.deleted, expected) {
+		t.Errorf("Expected records of %v to be deleted, but got %v", expected, provider.deleted)
+	}
+	if exists, _ := deleter.Exists(cleanup.Object{GroupVersionKind: endpointKind, Namespace: "preview", Name: "db"}); exists {
+		t.Error("Expected DNSEndpoint of namespace to be deleted")
+	}
+}
+
+func TestImageTag(t *testing.T) {
+	for val, expected := range map[string]string{
+		"feature/JIRA-1": "feature-JIRA-1",
+		"fix_1.2":        "fix_1.2",
+		"a b+c":          "a-b-c",
+	} {
+		if actual := imageTag(val); actual != expected {
+			t.Errorf("Expected %s for %s, but got %s", expected, val, actual)
+		}
+	}
+
+	tags := []string{"feature-x", "feature-x-3f2a1b7", "feature-x.42", "feature-xy", "feature-x-2-3f2a1b7", "feature-x-y", "feature-x-", "master"}
+	suffix := regexp.MustCompile("^(?:" + defaultTagSuffixPattern + ")$")
+	if actual := matchingTags(tags, "feature-x", suffix); !reflect.DeepEqual(actual, []string{"feature-x", "feature-x-3f2a1b7", "feature-x.42"}) {
+		t.Errorf("Unexpected matching tags %v", actual)
+	}
+	if actual := matchingTags(tags, "feature-x", nil); !reflect.DeepEqual(actual, []string{"feature-x"}) {
+		t.Errorf("Unexpected matching tags %v", actual)
+	}
+}
+
+func TestIsPreDeleteJobCompletedIfNeeded(t *testing.T) {
+	k8sNs := corev1.Namespace{}
+	k8sNs.ObjectMeta.Name = "preview-a"
+	k8sNs.ObjectMeta.Annotations = map[string]string{preDeleteJobAnnotationName: "templates/dump-db"}
+	ns := namespace(k8sNs)
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "dump-db", Namespace: "templates"},
+		Data: map[string]string{preDeleteJobKey: `
+metadata:
+  name: dump-{{.Namespace}}
+spec:
+  template:
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: dump
+        image: postgres
+`},
+	}
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "dump-preview-a", Namespace: "preview-a"},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"},
+		}},
+	}
+	k8sClient := fake.NewSimpleClientset(cm, job)
+	settings := preDeleteJobSettings{namespace: "default", timeout: time.Second}
+
+	// failed Job is deleted, so that it's run again
+	if isPreDeleteJobCompletedIfNeeded(k8sClient, settings)(&ns) != stepFailed {
+		t.Errorf("Failed Job shouldn't let deletion proceed")
+	}
+	if _, err := k8sClient.BatchV1().Jobs("preview-a").Get("dump-preview-a", metav1.GetOptions{}); err == nil {
+		t.Errorf("Failed Job should be deleted")
+	}
+
+	// new Job is created and waited for
+	jobPollDelay = 10 * time.Millisecond
+	if isPreDeleteJobCompletedIfNeeded(k8sClient, settings)(&ns) != stepWaiting {
+		t.Errorf("Running Job should be waited for")
+	}
+	created, err := k8sClient.BatchV1().Jobs("preview-a").Get("dump-preview-a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Labels[managedByLabel] != componentName || created.Spec.Template.Spec.Containers[0].Image != "postgres" {
+		t.Errorf("Unexpected Job %+v", created)
+	}
+
+	created.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+	k8sClient.BatchV1().Jobs("preview-a").Update(created)
+	if isPreDeleteJobCompletedIfNeeded(k8sClient, settings)(&ns) != stepDone {
+		t.Errorf("Completed Job should let deletion proceed")
+	}
+	if _, err := k8sClient.BatchV1().Jobs("preview-a").Get("dump-preview-a", metav1.GetOptions{}); err == nil {
+		t.Errorf("Completed Job should be deleted")
+	}
+
+	// there's no Job without annotation and default ConfigMap
+	k8sNs.ObjectMeta.Annotations = nil
+	ns = namespace(k8sNs)
+	if isPreDeleteJobCompletedIfNeeded(fake.NewSimpleClientset(), settings)(&ns) != stepDone {
+		t.Errorf("Namespace without Job should proceed")
+	}
+}
+
+func TestIsApprovedByGateIfNeeded(t *testing.T) {
+	status := http.StatusOK
+	var payload namespacePayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := webhook.VerifySignature([]byte("secret"), body, r.Header.Get(webhook.SignatureHeader)); err != nil {
+			t.Error(err)
+		}
+		json.Unmarshal(body, &payload)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	k8sNs := corev1.Namespace{}
+	k8sNs.ObjectMeta.Name = "preview-a"
+	k8sNs.ObjectMeta.Annotations = map[string]string{githubURLAnnotationName: "https://github.com/org/app/tree/feature/x"}
+	ns := namespace(k8sNs)
+	gate := isApprovedByGateIfNeeded(preDeleteGateSettings{url: server.URL, secret: "secret", timeout: time.Second})
+
+	if !gate(&ns) {
+		t.Errorf("Expected deletion to be approved")
+	}
+	if payload.Namespace != "preview-a" || payload.Repo != "app" || payload.Branch != "feature/x" {
+		t.Errorf("Unexpected payload %+v", payload)
+	}
+
+	status = http.StatusConflict
+	if gate(&ns) {
+		t.Errorf("Expected deletion to be postponed")
+	}
+
+	// teardown has already started
+	k8sNs.ObjectMeta.Annotations[completedStepsAnnotationName] = stepFlux
+	ns = namespace(k8sNs)
+	if !gate(&ns) {
+		t.Errorf("Expected gate to be skipped")
+	}
+}
+
+func TestIsPostDeleteWebhookSentIfNeeded(t *testing.T) {
+	payloads := []map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(eventHeader) != "deleted" {
+			t.Errorf("Unexpected event %s", r.Header.Get(eventHeader))
+		}
+		payload := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads = append(payloads, payload)
+	}))
+	defer server.Close()
+
+	k8sNs := corev1.Namespace{}
+	k8sNs.ObjectMeta.Name = "preview-a"
+	k8sNs.ObjectMeta.Annotations = map[string]string{githubURLAnnotationName: "https://github.com/org/app/tree/feature/\"x\""}
+	ns := namespace(k8sNs)
+
+	hooks := newPostDeleteHooks([]postDeleteWebhookTarget{
+		{URL: server.URL},
+		{URL: server.URL, Template: `{"text": {{json .Branch}}}`},
+		{URL: server.URL, Template: `{"text": {{.Branch}}}`},
+	})
+	isPostDeleteWebhookSentIfNeeded(hooks)(&ns)
+
+	if len(payloads) != 2 {
+		t.Fatalf("Expected 2 payloads (third one is invalid JSON), got %v", payloads)
+	}
+	if payloads[0]["namespace"] != "preview-a" || payloads[0]["branch"] != "feature/\"x\"" || payloads[0]["durationSeconds"] == nil {
+		t.Errorf("Unexpected default payload %v", payloads[0])
+	}
+	if payloads[1]["text"] != "feature/\"x\"" {
+		t.Errorf("Unexpected custom payload %v", payloads[1])
+	}
+}
+
+func TestDatabaseDropJob(t *testing.T) {
+	settings := databaseSettings{
+		images:           map[string]string{databaseEnginePostgres: "postgres", databaseEngineMySQL: "mysql"},
+		secretNamespaces: []string{"shared"},
+	}
+	newNs := func(annotations map[string]string) *namespace {
+		k8sNs := corev1.Namespace{}
+		k8sNs.ObjectMeta.Name = "preview-a"
+		k8sNs.ObjectMeta.UID = types.UID("0b5a3c1e-7d4f-4c1a-9f0e-2a6b8c9d1e2f")
+		k8sNs.ObjectMeta.Annotations = annotations
+		ns := namespace(k8sNs)
+		return &ns
+	}
+
+	if job, err := databaseDropJob(newNs(nil), settings); job != nil || err != nil {
+		t.Errorf("Expected no Job without annotations, got %v (%v)", job, err)
+	}
+
+	job, err := databaseDropJob(newNs(map[string]string{
+		databaseAnnotationName:       "app_feature_x",
+		databaseSecretAnnotationName: "shared/db-admin",
+		databaseEngineAnnotationName: "mysql",
+	}), settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := job.Spec.Template.Spec.Containers[0]
+	if job.Namespace != "shared" || job.Name != "buhtig-s8k-drop-db-0b5a3c1e-7d4f-4c1a-9f0e-2a6b8c9d1e2f" || container.Image != "mysql" ||
+		container.EnvFrom[0].SecretRef.Name != "db-admin" || container.Env[0].Value != "app_feature_x" {
+		t.Errorf("Unexpected Job %+v", job)
+	}
+
+	for _, annotations := range []map[string]string{
+		{databaseAnnotationName: "x; DROP TABLE users", databaseSecretAnnotationName: "db"},
+		{databaseAnnotationName: "app"},
+		{databaseAnnotationName: "app", databaseSecretAnnotationName: "db", databaseEngineAnnotationName: "oracle"},
+		// Secrets of namespaces which aren't allowed can't be used
+		{databaseAnnotationName: "app", databaseSecretAnnotationName: "other-team/db-admin"},
+	} {
+		if _, err := databaseDropJob(newNs(annotations), settings); err == nil {
+			t.Errorf("Expected error for %v", annotations)
+		}
+	}
+}
+
+func TestNewVeleroBackup(t *testing.T) {
+	k8sNs := corev1.Namespace{}
+	k8sNs.ObjectMeta.Name = strings.Repeat("a", 60)
+	ns := namespace(k8sNs)
+
+	backup := newVeleroBackup(&ns, veleroSettings{namespace: "velero", ttl: time.Hour, storageLocation: "s3"})
+	if len(backup.GetName()) > 63 || !strings.HasPrefix(backup.GetName(), "aaa") || backup.GetNamespace() != "velero" {
+		t.Errorf("Unexpected name %s/%s", backup.GetNamespace(), backup.GetName())
+	}
+	namespaces, _, _ := unstructured.NestedStringSlice(backup.Object, "spec", "includedNamespaces")
+	location, _, _ := unstructured.NestedString(backup.Object, "spec", "storageLocation")
+	if !reflect.DeepEqual(namespaces, []string{ns.Name()}) || location != "s3" {
+		t.Errorf("Unexpected spec %v", backup.Object["spec"])
+	}
+}
+
+func TestArchiveKey(t *testing.T) {
+	now := time.Date(2019, 7, 2, 15, 4, 5, 0, time.UTC)
+	if key := archiveKey("envs/", "preview-a", now); key != "envs/preview-a/20190702T150405Z.tar.gz" {
+		t.Errorf("Unexpected key %s", key)
+	}
+	if key := archiveKey("", "preview-a", now); key != "preview-a/20190702T150405Z.tar.gz" {
+		t.Errorf("Unexpected key %s", key)
+	}
+}
+
+func TestReleaseSnapshotter_save(t *testing.T) {
+	k8sNs := corev1.Namespace{}
+	k8sNs.ObjectMeta.Name = "preview-a"
+	ns := namespace(k8sNs)
+	k8sClient := fake.NewSimpleClientset()
+	s := &releaseSnapshotter{k8sClient: k8sClient, namespace: "buhtig"}
+
+	snapshot := &helm3.Snapshot{Name: "app", Namespace: "preview-a", Revision: 3, Chart: "app", ChartVersion: "1.0.0", Values: "a: b\n", Manifest: "kind: ConfigMap"}
+	for i := 0; i < 2; i++ {
+		if _, err := s.save(&ns, snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cm, err := k8sClient.CoreV1().ConfigMaps("buhtig").Get(snapshotConfigMapName("preview-a", "app"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data["values.yaml"] != "a: b\n" || cm.Labels[managedByLabel] != componentName || cm.Annotations["opuscapita.com/helm-release-revision"] != "3" {
+		t.Errorf("Unexpected ConfigMap %+v", cm)
+	}
+}
+
+func TestTerraformWorkspace(t *testing.T) {
+	settings := terraformSettings{
+		organization:     "default-org",
+		organizations:    []string{"org"},
+		workspacePattern: regexp.MustCompile(`^(?:preview-.+)$`),
+	}
+	for ref, expected := range map[string][2]string{
+		"":                      {"", ""},
+		"preview-a":             {"default-org", "preview-a"},
+		"org/preview-a":         {"org", "preview-a"},
+		"default-org/preview-a": {"default-org", "preview-a"},
+	} {
+		k8sNs := corev1.Namespace{}
+		k8sNs.ObjectMeta.Annotations = map[string]string{terraformWorkspaceAnnotationName: ref}
+		ns := namespace(k8sNs)
+		if org, workspace, err := terraformWorkspace(&ns, settings); org != expected[0] || workspace != expected[1] || err != nil {
+			t.Errorf("Expected %v for '%s', but got %s/%s (%v)", expected, ref, org, workspace, err)
+		}
+	}
+
+	for _, ref := range []string{"other-org/preview-a", "production", "org/production"} {
+		k8sNs := corev1.Namespace{}
+		k8sNs.ObjectMeta.Annotations = map[string]string{terraformWorkspaceAnnotationName: ref}
+		ns := namespace(k8sNs)
+		if _, _, err := terraformWorkspace(&ns, settings); err == nil {
+			t.Errorf("Expected workspace '%s' not to be allowed", ref)
+		}
+	}
+
+	// workspace referenced by name only requires organization
+	k8sNs := corev1.Namespace{}
+	k8sNs.ObjectMeta.Annotations = map[string]string{terraformWorkspaceAnnotationName: "preview-a"}
+	ns := namespace(k8sNs)
+	if _, _, err := terraformWorkspace(&ns, terraformSettings{}); err == nil {
+		t.Error("Expected error without organization")
+	}
+}
+
+func TestTeardownWorkflow(t *testing.T) {
+	settings := teardownWorkflowSettings{workflow: "teardown.yml"}
+	for _, tc := range []struct {
+		annotations map[string]string
+		expected    string
+	}{
+		{map[string]string{}, "teardown.yml"},
+		{map[string]string{teardownWorkflowAnnotationName: "cleanup.yml"}, "cleanup.yml"},
+		{map[string]string{teardownWorkflowAnnotationName: ""}, ""},
+	} {
+		k8sNs := corev1.Namespace{}
+		k8sNs.ObjectMeta.Annotations = tc.annotations
+		ns := namespace(k8sNs)
+		if workflow := teardownWorkflow(&ns, settings); workflow != tc.expected {
+			t.Errorf("Expected workflow '%s' for %v, but got '%s'", tc.expected, tc.annotations, workflow)
+		}
+	}
+}
+
+func TestJenkinsPreDeleteJob(t *testing.T) {
+	jenkinsPollDelay = time.Millisecond
+	var server *httptest.Server
+	triggered := 0
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/job/teardown/buildWithParameters":
+			triggered++
+			if r.URL.Query().Get("NAMESPACE") != "feature-a" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Location", server.URL+"/queue/item/1/")
+			w.WriteHeader(http.StatusCreated)
+		case "/queue/item/1/api/json":
+			fmt.Fprintf(w, `{"executable": {"number": 5, "url": "%s/job/teardown/5/"}}`, server.URL)
+		case "/job/teardown/5/api/json":
+			fmt.Fprint(w, `{"number": 5, "building": false, "result": "SUCCESS"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	k8sClient := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "feature-a"}})
+	hooks := newJenkinsHooks([]jenkinsJobTarget{
+		{URL: server.URL, Job: "teardown", Parameters: map[string]string{"NAMESPACE": "{{.Namespace}}"}, Wait: true, Timeout: "1s"},
+		{URL: server.URL, Job: "missing", Phase: jenkinsPhasePost},
+	})
+
+	ns := namespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "feature-a"}})
+	if isPreDeleteJenkinsJobCompletedIfNeeded(k8sClient, hooks)(&ns) != stepDone {
+		t.Fatal("Expected pre-delete Jenkins job to complete")
+	}
+	if triggered != 1 {
+		t.Errorf("Expected job to be triggered once, but it's triggered %d times", triggered)
+	}
+
+	k8sNs, _ := k8sClient.CoreV1().Namespaces().Get("feature-a", metav1.GetOptions{})
+	ns = namespace(*k8sNs)
+	if builds := jenkinsBuilds(&ns); builds["teardown"] != server.URL+"/job/teardown/5/" {
+		t.Errorf("Expected build to be kept in annotation, but got %v", builds)
+	}
+}
+
+func TestNamespaceNameFilter(t *testing.T) {
+	f := newNamespaceNameFilter([]string{"preview-.*", "pr-[0-9]+"}, []string{"kube-.*", "default", "preview-prod"})
+	for name, allowed := range map[string]bool{
+		"preview-feature": true,
+		"pr-42":           true,
+		"pr-42-db":        false,
+		"preview-prod":    false,
+		"kube-system":     false,
+		"default":         false,
+		"my-default":      false,
+	} {
+		if reason := f.reject(name); (reason == "") != allowed {
+			t.Errorf("Expected namespace %s to be allowed: %v, but got reason '%s'", name, allowed, reason)
+		}
+	}
+
+	if reason := newNamespaceNameFilter(nil, []string{"default"}).reject("my-default"); reason != "" {
+		t.Errorf("Expected namespace to be allowed without allow patterns, but got reason '%s'", reason)
+	}
+}
+
+func TestDeletionBudget(t *testing.T) {
+	budget := newDeletionBudget(2)
+	check := isWithinDeletionBudget(budget)
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview"}})
+	for i, expected := range []bool{true, true, false, false} {
+		if allowed := check(ns); allowed != expected {
+			t.Errorf("Expected deletion %d to be allowed: %v, but got %v", i+1, expected, allowed)
+		}
+	}
+
+	unlimited := newDeletionBudget(0)
+	for i := 0; i < 100; i++ {
+		if !unlimited.take() {
+			t.Fatal("Expected unlimited budget")
+		}
+	}
+}
+
+func TestDeletionRampUp(t *testing.T) {
+	r := newDeletionRampUp(1, 5)
+	for i, step := range []struct {
+		used, completed, failed, limit int
+	}{
+		{1, 1, 0, 1},
+		{2, 2, 0, 2},
+		// deletion waiting for its steps keeps budget
+		{4, 3, 0, 4},
+		{4, 4, 0, 4},
+		{5, 5, 0, 5},
+		// failed deletion resets budget
+		{5, 4, 1, 5},
+		{1, 1, 0, 1},
+		{1, 1, 0, 2},
+		{0, 0, 0, 2},
+	} {
+		b := r.budget()
+		if b.limit != step.limit {
+			t.Errorf("Expected budget %d of iteration %d, but got %d", step.limit, i+1, b.limit)
+		}
+		for j := 0; j < step.used; j++ {
+			b.take()
+		}
+		for j := 0; j < step.failed; j++ {
+			b.fail()
+		}
+		r.done(b, step.completed)
+	}
+
+	if b := newDeletionRampUp(0, 3).budget(); b.limit != 3 {
+		t.Errorf("Expected budget 3 without ramp-up, but got %d", b.limit)
+	}
+}
+
+func TestWithFailureCommitStatus(t *testing.T) {
+	defer func() { lastSummary = nil }()
+
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview"}})
+	budget := newDeletionBudget(0)
+	startIterationSummary(time.Now())
+	for _, tc := range []struct {
+		result   stepResult
+		expected bool
+	}{
+		{stepDone, true},
+		{stepWaiting, false},
+	} {
+		step := withFailureCommitStatus(false, budget, stepBackup, func(*namespace) stepResult { return tc.result })
+		if step(ns) != tc.expected {
+			t.Errorf("Expected %v for result %d", tc.expected, tc.result)
+		}
+	}
+	if budget.failed != 0 {
+		t.Errorf("Expected waiting step not to be counted as failure")
+	}
+
+	step := withFailureCommitStatus(false, budget, stepBackup, func(*namespace) stepResult { return stepFailed })
+	if step(ns) || budget.failed != 1 {
+		t.Errorf("Expected failed step to stop namespace and to be counted, got %d failures", budget.failed)
+	}
+	finishIterationSummary(time.Now())
+	if s := lastIterationSummary(); s.Errored != 1 {
+		t.Errorf("Expected failed step to be counted as errored, got %d", s.Errored)
+	}
+}
+
+func TestIsCommitStatusPublishedIfNeeded_ForgetsDeletedNamespace(t *testing.T) {
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview"}})
+	publishedCommitStatuses.Store("preview", "failure")
+	publishedCommitStatuses.Store("other", "failure")
+	defer publishedCommitStatuses.Delete("other")
+
+	if !isCommitStatusPublishedIfNeeded(false)(ns) {
+		t.Error("Expected namespace to proceed")
+	}
+	if _, ok := publishedCommitStatuses.Load("preview"); ok {
+		t.Error("Expected published status of deleted namespace to be forgotten")
+	}
+	if _, ok := publishedCommitStatuses.Load("other"); !ok {
+		t.Error("Expected published status of other namespace to be kept")
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	replicas := int32(3)
+	k8sClient := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "preview"}, Spec: appsv1.DeploymentSpec{Replicas: &replicas}},
+	)
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview"}})
+
+	if err := scaleToZero(k8sClient, ns, "Deployment", "web", &replicas); err != nil {
+		t.Fatal(err)
+	}
+	deployment, _ := k8sClient.AppsV1().Deployments("preview").Get("web", metav1.GetOptions{})
+	if *deployment.Spec.Replicas != 0 || deployment.Annotations[quarantineReplicasAnnotationName] != "3" {
+		t.Errorf("Expected deployment scaled to zero with replicas kept in annotation, but got %d replicas and annotations %v", *deployment.Spec.Replicas, deployment.Annotations)
+	}
+
+	if !ns.QuarantinedUntil().IsZero() {
+		t.Error("Expected namespace not to be quarantined")
+	}
+	ns.ObjectMeta.Annotations = map[string]string{quarantinedUntilAnnotationName: time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)}
+	if isQuarantinedIfNeeded(k8sClient, nil, time.Hour)(ns) != stepDone {
+		t.Error("Expected namespace to proceed once quarantine is over")
+	}
+	ns.ObjectMeta.Annotations = map[string]string{quarantinedUntilAnnotationName: time.Now().Add(time.Hour).UTC().Format(time.RFC3339)}
+	if isQuarantinedIfNeeded(k8sClient, nil, time.Hour)(ns) != stepWaiting {
+		t.Error("Expected namespace to wait while quarantined")
+	}
+}
+
+func TestQuarantine_ScalesDownAndRemovesIngresses(t *testing.T) {
+	replicas, none := int32(3), int32(0)
+	k8sClient := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "preview"}, Spec: appsv1.DeploymentSpec{Replicas: &replicas}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "idle", Namespace: "preview"}, Spec: appsv1.DeploymentSpec{Replicas: &none}},
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "preview"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "other"}, Spec: appsv1.DeploymentSpec{Replicas: &replicas}},
+	)
+	ingressKind := schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1beta1", Kind: "Ingress"}
+	newIngress := func(namespace, name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec":   map[string]interface{}{"rules": []interface{}{map[string]interface{}{"host": name + ".example.com"}}},
+			"status": map[string]interface{}{"loadBalancer": map[string]interface{}{}},
+		}}
+		obj.SetGroupVersionKind(ingressKind)
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		obj.SetUID(types.UID("uid-" + name))
+		obj.SetResourceVersion("42")
+		return obj
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), newIngress("preview", "web"), newIngress("other", "web"))
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{ingressKind.GroupVersion()})
+	mapper.Add(ingressKind, meta.RESTScopeNamespace)
+	deleter := cleanup.NewDeleterForClients(dynamicClient, mapper, nil)
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview"}})
+
+	if result := isQuarantinedIfNeeded(k8sClient, deleter, time.Hour)(ns); result != stepWaiting {
+		t.Fatalf("Expected namespace to wait in quarantine, got %v", result)
+	}
+	k8sNs, _ := k8sClient.CoreV1().Namespaces().Get("preview", metav1.GetOptions{})
+	if newNamespace(*k8sNs).QuarantinedUntil().IsZero() {
+		t.Error("Expected end of quarantine to be kept in annotation")
+	}
+
+	for _, tc := range []struct {
+		namespace, name  string
+		replicas         int32
+		keptInAnnotation string
+	}{
+		{"preview", "web", 0, "3"},
+		{"preview", "idle", 0, ""},
+		{"other", "web", 3, ""},
+	} {
+		d, _ := k8sClient.AppsV1().Deployments(tc.namespace).Get(tc.name, metav1.GetOptions{})
+		if *d.Spec.Replicas != tc.replicas || d.Annotations[quarantineReplicasAnnotationName] != tc.keptInAnnotation {
+			t.Errorf("Unexpected Deployment %s/%s with %d replicas and annotations %v", tc.namespace, tc.name, *d.Spec.Replicas, d.Annotations)
+		}
+	}
+	// StatefulSet without replicas runs one pod
+	s, _ := k8sClient.AppsV1().StatefulSets("preview").Get("db", metav1.GetOptions{})
+	if s.Spec.Replicas == nil || *s.Spec.Replicas != 0 || s.Annotations[quarantineReplicasAnnotationName] != "1" {
+		t.Errorf("Unexpected StatefulSet with replicas %v and annotations %v", s.Spec.Replicas, s.Annotations)
+	}
+
+	configMap, err := k8sClient.CoreV1().ConfigMaps("preview").Get(quarantineConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := configMap.Data["web.yaml"]
+	if configMap.Labels[managedByLabel] != componentName || !strings.Contains(manifest, "host: web.example.com") ||
+		strings.Contains(manifest, "status") || strings.Contains(manifest, "uid") || strings.Contains(manifest, "resourceVersion") {
+		t.Errorf("Expected restorable manifest of Ingress, got labels %v and manifest:\n%s", configMap.Labels, manifest)
+	}
+	restored := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal([]byte(manifest), &restored.Object); err != nil || restored.GetName() != "web" || restored.GetNamespace() != "preview" {
+		t.Errorf("Expected manifest to be valid Ingress, got %v (%v)", restored.Object, err)
+	}
+
+	if exists, _ := deleter.Exists(cleanup.Object{GroupVersionKind: ingressKind, Namespace: "preview", Name: "web"}); exists {
+		t.Error("Expected Ingress of quarantined namespace to be removed")
+	}
+	if exists, _ := deleter.Exists(cleanup.Object{GroupVersionKind: ingressKind, Namespace: "other", Name: "web"}); !exists {
+		t.Error("Expected Ingress of other namespace to be kept")
+	}
+
+	// namespace without Ingresses gets no ConfigMap
+	empty := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "empty"}})
+	if err := removeIngresses(k8sClient, deleter, empty); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k8sClient.CoreV1().ConfigMaps("empty").Get(quarantineConfigMapName, metav1.GetOptions{}); err == nil {
+		t.Error("Expected no ConfigMap in namespace without Ingresses")
+	}
+}
+
+func TestMaintenanceWindows(t *testing.T) {
+	mw := newMaintenanceWindows("Mon-Fri 08:00-18:00; Sat 22:00-02:00", "Europe/Helsinki")
+	helsinki, _ := time.LoadLocation("Europe/Helsinki")
+	for _, tc := range []struct {
+		time     time.Time
+		expected bool
+	}{
+		// 2019-07-01 is Monday
+		{time.Date(2019, 7, 1, 8, 0, 0, 0, helsinki), true},
+		{time.Date(2019, 7, 1, 7, 59, 0, 0, helsinki), false},
+		{time.Date(2019, 7, 5, 17, 59, 0, 0, helsinki), true},
+		{time.Date(2019, 7, 5, 18, 0, 0, 0, helsinki), false},
+		{time.Date(2019, 7, 1, 5, 0, 0, 0, time.UTC), true},
+		{time.Date(2019, 7, 6, 12, 0, 0, 0, helsinki), false},
+		{time.Date(2019, 7, 6, 23, 0, 0, 0, helsinki), true},
+		{time.Date(2019, 7, 7, 1, 0, 0, 0, helsinki), true},
+		{time.Date(2019, 7, 7, 23, 0, 0, 0, helsinki), false},
+	} {
+		if actual := mw.contains(tc.time); actual != tc.expected {
+			t.Errorf("Expected %v to be in windows: %v, but got %v", tc.time, tc.expected, actual)
+		}
+	}
+
+	if !newMaintenanceWindows("", "UTC").contains(time.Now()) {
+		t.Error("Expected any time to be allowed without windows")
+	}
+	for _, invalid := range []string{"Mon", "Funday 08:00-18:00", "Mon 08:00", "Mon 25:00-26:00"} {
+		if _, err := parseMaintenanceWindow(invalid); err == nil {
+			t.Errorf("Expected error for '%s'", invalid)
+		}
+	}
+}
+
+func TestIterationSchedule(t *testing.T) {
+	now := time.Date(2019, 7, 1, 10, 20, 30, 0, time.UTC)
+
+	s := newIterationSchedule("", "UTC")
+	if next := s.next(now); !next.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected iteration in a minute by default, but got %v", next)
+	}
+
+	s = newIterationSchedule("0 8-18 * * *; 0 2 * * *", "Europe/Helsinki")
+	if next := s.next(now); !next.Equal(time.Date(2019, 7, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected iteration at 14:00 in Helsinki, but got %v", next)
+	}
+	if next := s.next(time.Date(2019, 7, 1, 16, 0, 0, 0, time.UTC)); !next.Equal(time.Date(2019, 7, 1, 23, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected nightly iteration at 02:00 in Helsinki, but got %v", next)
+	}
+
+	s.interval = 5 * time.Minute
+	if next := s.next(now); !next.Equal(now.Add(5 * time.Minute)) {
+		t.Errorf("Expected interval to come first, but got %v", next)
+	}
+}
+
+func TestPause(t *testing.T) {
+	p := &pauseState{}
+	check := isNotPaused(p)
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview"}})
+
+	if !check(ns) {
+		t.Error("Expected namespace to proceed while not paused")
+	}
+	p.set(true, "test")
+	if check(ns) {
+		t.Error("Expected namespace to be stopped while paused")
+	}
+	p.set(false, "test")
+	if !check(ns) {
+		t.Error("Expected namespace to proceed after resume")
+	}
+
+	recorder := httptest.NewRecorder()
+	serveStatus(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+	status := map[string]interface{}{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil || status["paused"] != false {
+		t.Errorf("Expected status not paused, but got %s (%v)", recorder.Body.String(), err)
+	}
+
+	defer func(tokens map[string]string) { adminTokens = tokens }(adminTokens)
+	defer destructionPause.set(false, "test")
+	adminTokens = parseAdminTokens([]string{"jdoe:s3cret"})
+	recorder = httptest.NewRecorder()
+	servePause(true)(recorder, httptest.NewRequest(http.MethodPost, "/pause", nil))
+	if paused, _ := destructionPause.get(); recorder.Code != http.StatusUnauthorized || paused {
+		t.Errorf("Expected pause without token to be refused, got %d", recorder.Code)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/pause", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	recorder = httptest.NewRecorder()
+	servePause(true)(recorder, r)
+	if paused, _ := destructionPause.get(); recorder.Code != http.StatusOK || !paused {
+		t.Errorf("Expected pause with token to succeed, got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestApproval(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview"}})
+	check := isApprovedIfNeeded(k8sClient, approvalSettings{required: true, expiry: time.Hour})
+	get := func() *namespace {
+		k8sNs, _ := k8sClient.CoreV1().Namespaces().Get("preview", metav1.GetOptions{})
+		return newNamespace(*k8sNs)
+	}
+
+	if err := approveNamespace(k8sClient, "preview", "jdoe"); err == nil {
+		t.Error("Expected namespace which doesn't wait for approval not to be approved")
+	}
+
+	if check(get()) {
+		t.Fatal("Expected candidate to wait for approval")
+	}
+	if get().PendingApprovalSince().IsZero() {
+		t.Fatal("Expected candidate to be marked as pending approval")
+	}
+	if check(get()) {
+		t.Fatal("Expected candidate to keep waiting for approval")
+	}
+
+	if err := approveNamespace(k8sClient, "preview", "jdoe"); err != nil {
+		t.Fatal(err)
+	}
+	if !check(get()) {
+		t.Error("Expected approved candidate to proceed")
+	}
+
+	defer func(tokens map[string]string) { adminTokens = tokens }(adminTokens)
+	adminTokens = parseAdminTokens([]string{"jdoe:s3cret"})
+	approve := func(query, token string) int {
+		r := httptest.NewRequest(http.MethodPost, "/approve?"+query, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		serveApprove(k8sClient)(recorder, r)
+		return recorder.Code
+	}
+	if code := approve("namespace=preview&approver=jdoe", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected approval without token to be refused, got %d", code)
+	}
+	if code := approve("namespace=missing", "s3cret"); code != http.StatusNotFound {
+		t.Errorf("Expected approval of missing namespace to fail, got %d", code)
+	}
+	if code := approve("namespace=preview&approver=someone-else", "s3cret"); code != http.StatusOK || get().ApprovedBy() != "admin-api:jdoe" {
+		t.Errorf("Expected holder of token to be recorded as approver, got %d %s", code, get().ApprovedBy())
+	}
+
+	expired := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview", Annotations: map[string]string{
+		pendingApprovalAnnotationName: time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339),
+	}}})
+	if check(expired) || expired.ObjectMeta.Annotations[approvalExpiredAnnotationName] == "" {
+		t.Errorf("Expected approval to expire, but got annotations %v", expired.ObjectMeta.Annotations)
+	}
+}
+
+func TestSlackApprovals(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview", Annotations: map[string]string{
+		pendingApprovalAnnotationName: time.Now().UTC().Format(time.RFC3339),
+	}}})
+	check := isApprovedIfNeeded(k8sClient, approvalSettings{required: true, expiry: time.Hour})
+	get := func() *namespace {
+		k8sNs, _ := k8sClient.CoreV1().Namespaces().Get("preview", metav1.GetOptions{})
+		return newNamespace(*k8sNs)
+	}
+	click := func(actionID, name string) string {
+		interaction := &slack.Interaction{Actions: []slack.Action{{ActionID: actionID, Value: name}}}
+		interaction.User.ID = "U1"
+		interaction.User.Username = "jdoe"
+		return (&slackApprovals{}).handleInteraction(k8sClient, interaction)
+	}
+
+	if text := click(slackActionKeep, "preview"); !strings.Contains(text, "kept") {
+		t.Errorf("Expected namespace to be kept, got '%s'", text)
+	}
+	if get().RejectedBy() != "slack:jdoe" || check(get()) {
+		t.Fatalf("Expected rejected namespace to be left alone, got annotations %v", get().ObjectMeta.Annotations)
+	}
+
+	if text := click(slackActionApprove, "preview"); !strings.Contains(text, "approved") {
+		t.Errorf("Expected deletion to be approved, got '%s'", text)
+	}
+	if get().ApprovedBy() != "slack:jdoe" || !check(get()) {
+		t.Errorf("Expected approved namespace to proceed, got annotations %v", get().ObjectMeta.Annotations)
+	}
+
+	if text := click(slackActionApprove, "missing"); !strings.HasPrefix(text, "Failed") {
+		t.Errorf("Expected missing namespace not to be approved, got '%s'", text)
+	}
+	if text := click("unknown", "preview"); text != "" {
+		t.Errorf("Expected unknown action to be ignored, got '%s'", text)
+	}
+}
+
+func TestPolicyGate(t *testing.T) {
+	var inputs []policyInput
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			Input policyInput `json:"input"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&request)
+		inputs = append(inputs, request.Input)
+		if request.Input.Namespace.ObjectMeta.Labels["team"] == "payments" {
+			fmt.Fprint(w, `{"result": {"allow": false, "reason": "payments environments are deleted manually"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"result": {"allow": true}}`)
+	}))
+	defer server.Close()
+
+	cache := newBranchCache()
+	cache.check("repo/branch", &countingProvider{}, "https://example.com/repo/branch")
+	check := isAllowedByPolicyIfNeeded(opaSettings{client: opa.NewClient(server.URL, time.Second), path: "buhtig_s8k/deletion"}, cache)
+	newNs := func(team string) *namespace {
+		return newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:        "feature-a",
+			Labels:      map[string]string{"team": team},
+			Annotations: map[string]string{githubURLAnnotationName: "https://github.com/org/repo/tree/feature-a", branchMissingCountAnnotationName: "3"},
+		}})
+	}
+
+	if check(newNs("payments")) {
+		t.Error("Expected deletion to be denied by policy")
+	}
+	if !check(newNs("frontend")) {
+		t.Error("Expected deletion to be allowed by policy")
+	}
+	if len(inputs) != 2 || inputs[1].Branch.Name != "feature-a" || inputs[1].Branch.MissingCount != 3 || inputs[1].Time.Now.IsZero() {
+		t.Errorf("Unexpected policy inputs %+v", inputs)
+	}
+
+	status, _, ok := cache.cached(branchCacheKey(newNs("frontend"), "https://github.com/org/repo/tree/feature-a/"))
+	if ok || status != 0 {
+		t.Error("Expected unchecked branch not to be cached")
+	}
+	if status, repoStatus, ok := cache.cached("repo/branch"); !ok || status != 404 || repoStatus != 200 {
+		t.Errorf("Expected cached result of checked branch, got %d, %d", status, repoStatus)
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	cache := newBranchCache()
+	cache.check(branchCacheKey(&namespace{}, "https://github.com/org/repo/tree/feature-a"), &countingProvider{}, "https://github.com/org/repo/tree/feature-a")
+	check := isMatchingPredicates(newPredicates([]predicateTarget{
+		{Name: "not-payments", Expression: `ns.metadata.labels['team'] != 'payments' && branch.status == 404`},
+		{Expression: `time.ageSeconds >= 3600`},
+	}), cache)
+	newNs := func(team string, age time.Duration) *namespace {
+		return newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:              "feature-a",
+			Labels:            map[string]string{"team": team},
+			Annotations:       map[string]string{githubURLAnnotationName: "https://github.com/org/repo/tree/feature-a"},
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+		}})
+	}
+
+	if !check(newNs("frontend", 2*time.Hour)) {
+		t.Error("Expected namespace matching all predicates to proceed")
+	}
+	if check(newNs("payments", 2*time.Hour)) {
+		t.Error("Expected namespace not matching the first predicate to be skipped")
+	}
+	if check(newNs("frontend", time.Minute)) {
+		t.Error("Expected namespace not matching the second predicate to be skipped")
+	}
+
+	failing := isMatchingPredicates(newPredicates([]predicateTarget{{Expression: `ns.metadata.annotations.missing == "x"`}}), cache)
+	if failing(newNs("frontend", time.Hour)) {
+		t.Error("Expected failed evaluation to leave namespace alone")
+	}
+
+	env, err := predicateEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars, err := predicateVars(newPolicyInput(newNs("frontend", time.Hour), cache, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		expression string
+		matched    bool
+		failed     bool
+	}{
+		// logical operators absorb errors of the other operand whichever side it's on
+		{`ns.metadata.annotations.missing == "x" && false`, false, false},
+		{`false && ns.metadata.annotations.missing == "x"`, false, false},
+		{`ns.metadata.annotations.missing == "x" || true`, true, false},
+		{`ns.metadata.annotations.missing == "x" && true`, false, true},
+		{`branch.status * 9223372036854775807 > 0`, false, true},
+		{`ns.metadata.name.startsWith("feature-") && time.ageSeconds > 60`, true, false},
+	} {
+		program, err := compilePredicate(env, tc.expression)
+		if err != nil {
+			t.Errorf("Failed to compile %s: %v", tc.expression, err)
+			continue
+		}
+		matched, err := predicate{program: program}.eval(vars)
+		if matched != tc.matched || (err != nil) != tc.failed {
+			t.Errorf("Expected %s to be %v (failed: %v), got %v (%v)", tc.expression, tc.matched, tc.failed, matched, err)
+		}
+	}
+	for _, expression := range []string{`branch.status +`, `unknown == 1`, `"404" == 404`, `1 + 2`} {
+		if _, err := compilePredicate(env, expression); err == nil {
+			t.Errorf("Expected %s not to compile", expression)
+		}
+	}
+}
+
+func TestActiveWorkloadGuard(t *testing.T) {
+	recent := metav1.NewTime(time.Now().Add(-time.Hour))
+	old := metav1.NewTime(time.Now().Add(-48 * time.Hour))
+	k8sClient := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "started"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "started"}, Status: corev1.PodStatus{StartTime: &recent}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "restarted"}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "restarted"}, Status: corev1.PodStatus{
+			StartTime: &old,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:         "app",
+				RestartCount: 2,
+				State:        corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: recent}},
+			}},
+		}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "idle", Annotations: map[string]string{deletionDeferredAnnotationName: "pod api started"}}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "idle"}, Status: corev1.PodStatus{StartTime: &old}},
+	)
+	check := isNotGuarded(k8sClient, newGuards(k8sClient, nil, config{activeWorkloadWindow: 6 * time.Hour}))
+	get := func(name string) *namespace {
+		k8sNs, _ := k8sClient.CoreV1().Namespaces().Get(name, metav1.GetOptions{})
+		return newNamespace(*k8sNs)
+	}
+
+	if check(get("started")) || !strings.HasPrefix(get("started").ObjectMeta.Annotations[deletionDeferredAnnotationName], "pod api started") {
+		t.Errorf("Expected deletion of namespace with recently started pod to be deferred, got annotations %v", get("started").ObjectMeta.Annotations)
+	}
+	if check(get("restarted")) || !strings.HasPrefix(get("restarted").ObjectMeta.Annotations[deletionDeferredAnnotationName], "container app of pod api restarted") {
+		t.Errorf("Expected deletion of namespace with recently restarted container to be deferred, got annotations %v", get("restarted").ObjectMeta.Annotations)
+	}
+	idle := get("idle")
+	if !check(idle) {
+		t.Error("Expected idle namespace to proceed")
+	}
+	if _, ok := idle.ObjectMeta.Annotations[deletionDeferredAnnotationName]; ok {
+		t.Error("Expected deferral reason to be removed")
+	}
+}
+
+func TestRecentDeploymentGuard(t *testing.T) {
+	recent := metav1.NewTime(time.Now().Add(-time.Hour))
+	old := metav1.NewTime(time.Now().Add(-48 * time.Hour))
+	k8sClient := fake.NewSimpleClientset(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "deployed"}, Status: appsv1.DeploymentStatus{
+			Conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, LastUpdateTime: recent}},
+		}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "restarted"}, Spec: appsv1.DeploymentSpec{
+			Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{restartedAtAnnotationName: recent.UTC().Format(time.RFC3339)}}},
+		}, Status: appsv1.DeploymentStatus{
+			Conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, LastUpdateTime: old}},
+		}},
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "stateful"}, Status: appsv1.StatefulSetStatus{UpdateRevision: "db-1"}},
+		&appsv1.ControllerRevision{ObjectMeta: metav1.ObjectMeta{Name: "db-1", Namespace: "stateful", CreationTimestamp: recent}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "idle"}, Status: appsv1.DeploymentStatus{
+			Conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, LastUpdateTime: old}},
+		}},
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "idle"}, Status: appsv1.StatefulSetStatus{UpdateRevision: "missing"}},
+	)
+	check := recentDeploymentGuard(k8sClient, 6*time.Hour)
+
+	for name, expected := range map[string]string{
+		"deployed":  "Deployment api was rolled out at ",
+		"restarted": "Deployment api was rolled out at ",
+		"stateful":  "StatefulSet db was rolled out at ",
+		"idle":      "",
+	} {
+		reason, err := check(newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(reason, expected) || (expected == "") != (reason == "") {
+			t.Errorf("Expected reason '%s...' for namespace %s, got '%s'", expected, name, reason)
+		}
+	}
+}
+
+func TestIngressTrafficGuard(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.FormValue("query"))
+		value := "0"
+		if strings.Contains(r.FormValue("query"), "demo") {
+			value = "1234"
+		}
+		fmt.Fprintf(w, `{"status": "success", "data": {"resultType": "vector", "result": [{"metric": {}, "value": [1562079845, "%s"]}]}}`, value)
+	}))
+	defer server.Close()
+
+	settings := ingressTrafficSettings{client: prometheus.NewClient(server.URL, time.Second), query: defaultIngressTrafficQuery, window: 24 * time.Hour, threshold: 10}
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "feature-a"}})
+
+	reason, err := ingressTrafficReason(settings, ns, []string{"demo.example.com", "api.example.com"})
+	if err != nil || reason != "Ingresses served 1234 requests within 24h0m0s" {
+		t.Errorf("Expected deletion to be deferred, got '%s', %v", reason, err)
+	}
+	expected := `sum(increase(nginx_ingress_controller_requests{host=~"demo\\.example\\.com|api\\.example\\.com"}[86400s]))`
+	if len(queries) != 1 || queries[0] != expected {
+		t.Errorf("Expected query %s, got %v", expected, queries)
+	}
+
+	if reason, err := ingressTrafficReason(settings, ns, []string{"idle.example.com"}); err != nil || reason != "" {
+		t.Errorf("Expected idle environment to pass, got '%s', %v", reason, err)
+	}
+}
+
+func TestStuckNamespaces(t *testing.T) {
+	now := time.Now()
+	terminating := func(name string, since time.Duration) corev1.Namespace {
+		deletedAt := metav1.NewTime(now.Add(-since))
+		return corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: name, DeletionTimestamp: &deletedAt, Finalizers: []string{"example.com/operator"}},
+			Spec:       corev1.NamespaceSpec{Finalizers: []corev1.FinalizerName{corev1.FinalizerKubernetes}},
+			Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating},
+		}
+	}
+	s := &stuckNamespaces{reported: map[string]bool{}}
+
+	stuck := s.check([]corev1.Namespace{
+		terminating("stuck", 2*time.Hour),
+		terminating("recent", time.Minute),
+		{ObjectMeta: metav1.ObjectMeta{Name: "active"}},
+	}, 30*time.Minute, now)
+	if len(stuck) != 1 || stuck[0].Name() != "stuck" || !s.reported["stuck"] {
+		t.Fatalf("Expected only namespace terminating for 2h to be stuck, got %v", stuck)
+	}
+	if finalizers := stuck[0].Finalizers(); !reflect.DeepEqual(finalizers, []string{"kubernetes", "example.com/operator"}) {
+		t.Errorf("Unexpected finalizers %v", finalizers)
+	}
+
+	s.check(nil, 30*time.Minute, now)
+	if len(s.reported) != 0 {
+		t.Errorf("Expected removed namespace to be forgotten, got %v", s.reported)
+	}
+}
+
+func TestForceFinalize(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "stuck", Finalizers: []string{"example.com/defunct", "example.com/alive"}},
+		Spec:       corev1.NamespaceSpec{Finalizers: []corev1.FinalizerName{corev1.FinalizerKubernetes}},
+		Status:     corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating},
+	})
+
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "stuck"}})
+	if err := forceFinalize(k8sClient, ns, []string{"example.com/defunct", "kubernetes"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var finalized, updated *corev1.Namespace
+	for _, action := range k8sClient.Actions() {
+		if action.GetVerb() == "create" && action.GetSubresource() == "finalize" {
+			finalized = action.(k8stesting.CreateAction).GetObject().(*corev1.Namespace)
+		}
+		if action.GetVerb() == "update" {
+			updated = action.(k8stesting.UpdateAction).GetObject().(*corev1.Namespace)
+		}
+	}
+	if finalized == nil || len(finalized.Spec.Finalizers) != 0 {
+		t.Errorf("Expected 'kubernetes' finalizer to be removed through finalize subresource, got %v", finalized)
+	}
+	if updated == nil || !reflect.DeepEqual(updated.ObjectMeta.Finalizers, []string{"example.com/alive"}) {
+		t.Errorf("Expected only allowed finalizer to be removed from metadata, got %v", updated)
+	}
+}
+
+func TestHelmCleanupFinalizer(t *testing.T) {
+	labels := map[string]string{strings.Split(labelSelector, "=")[0]: strings.Split(labelSelector, "=")[1]}
+	k8sNs := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "app",
+		Labels:      labels,
+		Annotations: map[string]string{helmReleaseAnnotationName: "app"},
+		Finalizers:  []string{"example.com/other"},
+	}}
+	k8sClient := fake.NewSimpleClientset(&k8sNs)
+
+	ns := newNamespace(k8sNs)
+	isHelmCleanupFinalizerSynced(k8sClient, true)(ns)
+	updated, _ := k8sClient.CoreV1().Namespaces().Get("app", metav1.GetOptions{})
+	if !reflect.DeepEqual(updated.Finalizers, []string{"example.com/other", helmCleanupFinalizer}) {
+		t.Errorf("Expected finalizer to be added, got %v", updated.Finalizers)
+	}
+
+	// namespace is deleted manually
+	updated.Status.Phase = corev1.NamespaceTerminating
+	k8sClient.CoreV1().Namespaces().Update(updated)
+	deleted := []string{}
+	deleteRelease := func(ns *namespace) bool {
+		deleted = append(deleted, ns.Name())
+		return len(deleted) > 1
+	}
+
+	finalizeTerminatingNamespaces(k8sClient, deleteRelease)
+	updated, _ = k8sClient.CoreV1().Namespaces().Get("app", metav1.GetOptions{})
+	if len(deleted) != 1 || !reflect.DeepEqual(updated.Finalizers, []string{"example.com/other", helmCleanupFinalizer}) {
+		t.Errorf("Expected finalizer to be kept when release deletion fails, got %v", updated.Finalizers)
+	}
+
+	finalizeTerminatingNamespaces(k8sClient, deleteRelease)
+	updated, _ = k8sClient.CoreV1().Namespaces().Get("app", metav1.GetOptions{})
+	if len(deleted) != 2 || !reflect.DeepEqual(updated.Finalizers, []string{"example.com/other"}) {
+		t.Errorf("Expected finalizer to be removed once release is deleted, got %v", updated.Finalizers)
+	}
+}
+
+func TestHelmCleanupFinalizer_Disabled(t *testing.T) {
+	k8sNs := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "app",
+		Annotations: map[string]string{helmReleaseAnnotationName: "app"},
+		Finalizers:  []string{helmCleanupFinalizer},
+	}}
+	k8sClient := fake.NewSimpleClientset(&k8sNs)
+
+	isHelmCleanupFinalizerSynced(k8sClient, false)(newNamespace(k8sNs))
+	updated, _ := k8sClient.CoreV1().Namespaces().Get("app", metav1.GetOptions{})
+	if len(updated.Finalizers) != 0 {
+		t.Errorf("Expected finalizer to be removed when feature is disabled, got %v", updated.Finalizers)
+	}
+}
+
+func TestNamespaceStatus(t *testing.T) {
+	k8sNs := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app"}}
+	k8sClient := fake.NewSimpleClientset(&k8sNs)
+	ns := newNamespace(k8sNs)
+	now := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+
+	setNamespaceStatus(evaluation{ns: ns, branchStatus: 404, now: now}, decision{action: actionDelete, reason: "branch is deleted"})
+	skipNamespace(ns, skipReasonPaused, "destructive actions are paused")
+	writeNamespaceStatuses(k8sClient, true)
+
+	updated, _ := k8sClient.CoreV1().Namespaces().Get("app", metav1.GetOptions{})
+	expected := map[string]string{
+		lastCheckedAnnotationName:      "2019-07-01T10:00:00Z",
+		lastBranchStatusAnnotationName: "404",
+		nextActionAnnotationName:       actionSkip,
+		skipReasonAnnotationName:       "destructive actions are paused",
+	}
+	if !reflect.DeepEqual(updated.Annotations, expected) {
+		t.Errorf("Expected status annotations %v, got %v", expected, updated.Annotations)
+	}
+
+	setNamespaceStatus(evaluation{ns: ns, branchStatus: 404, now: now}, decision{action: actionDelete, reason: "branch is deleted"})
+	writeNamespaceStatuses(k8sClient, true)
+	if ns.ObjectMeta.Annotations[nextActionAnnotationName] != actionDelete || ns.ObjectMeta.Annotations[skipReasonAnnotationName] != "" {
+		t.Errorf("Expected namespace to be going to be deleted without skip reason, got %v", ns.ObjectMeta.Annotations)
+	}
+
+	if _, ok := namespaceStatuses.Load("app"); ok {
+		t.Error("Expected statuses to be forgotten after they're written")
+	}
+}
+
+func TestIsCheckThrottled(t *testing.T) {
+	now := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	newNs := func(annotations map[string]string) *namespace {
+		annotations[githubURLAnnotationName] = "https://github.com/org/app/tree/feature-a"
+		return newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app", Annotations: annotations}})
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		throttled   bool
+	}{
+		{"never checked", map[string]string{}, false},
+		{"checked recently", map[string]string{lastCheckedAnnotationName: "2019-07-01T09:30:00Z"}, true},
+		{"checked long ago", map[string]string{lastCheckedAnnotationName: "2019-07-01T08:30:00Z"}, false},
+		{"annotation overrides interval", map[string]string{lastCheckedAnnotationName: "2019-07-01T08:30:00Z", branchCheckIntervalAnnotationName: "2h"}, true},
+		{"annotation disables throttling", map[string]string{lastCheckedAnnotationName: "2019-07-01T09:30:00Z", branchCheckIntervalAnnotationName: "0"}, false},
+		{"branch is missing", map[string]string{lastCheckedAnnotationName: "2019-07-01T09:30:00Z", branchMissingCountAnnotationName: "1"}, false},
+	}
+	for _, test := range tests {
+		if throttled := isCheckThrottled(newNs(test.annotations), time.Hour, now); throttled != test.throttled {
+			t.Errorf("%s: expected throttled to be %v", test.name, test.throttled)
+		}
+	}
+
+	// webhook reported deletion after the latest check
+	hintBranchDeleted("Org/App", "feature-a")
+	if isCheckThrottled(newNs(map[string]string{lastCheckedAnnotationName: time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)}), time.Hour, time.Now()) {
+		t.Error("Expected branch reported deleted by webhook not to be throttled")
+	}
+	deletedBranchHints.Delete("org/app/feature-a")
+}
+
+func TestTombstone(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name: "app-feature-a",
+		Annotations: map[string]string{
+			githubURLAnnotationName:          "https://github.com/org/app/tree/feature-a",
+			helmReleaseAnnotationName:        "app-feature-a",
+			branchMissingCountAnnotationName: "3",
+			completedStepsAnnotationName:     "helm-release",
+		},
+	}})
+	setNamespaceStatus(evaluation{ns: ns, branchStatus: 404}, decision{action: actionDelete})
+	defer namespaceStatuses.Delete(ns.Name())
+
+	isTombstoneWrittenIfNeeded(k8sClient, tombstoneSettings{retention: time.Hour, namespace: "buhtig"})(ns)
+
+	cm, err := k8sClient.CoreV1().ConfigMaps("buhtig").Get(tombstoneName("app-feature-a"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]string{
+		"repository":   "org/app",
+		"branch":       "feature-a",
+		"helmReleases": "app-feature-a",
+		"reason":       "branch check returned status 404 on 3 consecutive checks",
+	} {
+		if cm.Data[key] != expected {
+			t.Errorf("Expected tombstone %s to be '%s', got '%s'", key, expected, cm.Data[key])
+		}
+	}
+
+	deletedAt, _ := time.Parse(time.RFC3339, cm.Data["deletedAt"])
+	pruneManagedConfigMaps(k8sClient, "buhtig", deletedAt.Add(time.Minute), deletedAt.Add(-time.Minute))
+	if _, err := k8sClient.CoreV1().ConfigMaps("buhtig").Get(cm.Name, metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected tombstone to be kept for its retention, got %v", err)
+	}
+	pruneManagedConfigMaps(k8sClient, "buhtig", deletedAt.Add(-time.Minute), deletedAt.Add(time.Minute))
+	if _, err := k8sClient.CoreV1().ConfigMaps("buhtig").Get(cm.Name, metav1.GetOptions{}); err == nil {
+		t.Error("Expected tombstone to be pruned after its retention")
+	}
+}
+
+func TestPruneEvents(t *testing.T) {
+	now := time.Now()
+	newEvent := func(namespace, name, component string, lastSeen, createdAt time.Time) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:    metav1.ObjectMeta{Name: name, Namespace: namespace, CreationTimestamp: metav1.NewTime(createdAt)},
+			Source:        corev1.EventSource{Component: component},
+			LastTimestamp: metav1.NewTime(lastSeen),
+		}
+	}
+	old, recent := now.Add(-48*time.Hour), now.Add(-time.Hour)
+	k8sClient := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tracked", Labels: map[string]string{"opuscapita.com/buhtig-s8k": "true"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "untracked"}},
+		newEvent("tracked", "old", componentName, old, old),
+		newEvent("tracked", "recent", componentName, recent, old),
+		newEvent("tracked", "old-without-last-seen", componentName, time.Time{}, old),
+		newEvent("tracked", "recent-without-last-seen", componentName, time.Time{}, recent),
+		newEvent("tracked", "old-of-other-component", "kubelet", old, old),
+		newEvent("untracked", "old", componentName, old, old),
+		newEvent(metav1.NamespaceDefault, "old-of-namespace", componentName, old, old),
+	)
+	exists := func(namespace, name string) bool {
+		_, err := k8sClient.CoreV1().Events(namespace).Get(name, metav1.GetOptions{})
+		return err == nil
+	}
+
+	pruneEvents(k8sClient, now.Add(-24*time.Hour))
+
+	for _, tc := range []struct {
+		namespace, name string
+		kept            bool
+	}{
+		{"tracked", "old", false},
+		{"tracked", "recent", true},
+		{"tracked", "old-without-last-seen", false},
+		{"tracked", "recent-without-last-seen", true},
+		{"tracked", "old-of-other-component", true},
+		{"untracked", "old", true},
+		{metav1.NamespaceDefault, "old-of-namespace", false},
+	} {
+		if exists(tc.namespace, tc.name) != tc.kept {
+			t.Errorf("Expected Event %s/%s to be kept: %v", tc.namespace, tc.name, tc.kept)
+		}
+	}
+}
+
+func TestRunGarbageCollector(t *testing.T) {
+	old := metav1.NewTime(time.Now().Add(-48 * time.Hour))
+	newClient := func() *fake.Clientset {
+		return fake.NewSimpleClientset(
+			&corev1.Event{ObjectMeta: metav1.ObjectMeta{Name: "old", Namespace: metav1.NamespaceDefault}, Source: corev1.EventSource{Component: componentName}, LastTimestamp: old},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "old", Namespace: "buhtig", CreationTimestamp: old, Labels: map[string]string{managedByLabel: componentName}}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "unmanaged", Namespace: "buhtig", CreationTimestamp: old}},
+		)
+	}
+
+	disabled := newClient()
+	runGarbageCollector(disabled, "buhtig", 0, time.Hour, "", 0)
+	runGarbageCollector(disabled, "buhtig", 24*time.Hour, 0, "", 0)
+	time.Sleep(100 * time.Millisecond)
+	if actions := disabled.Actions(); len(actions) != 0 {
+		t.Errorf("Expected disabled garbage collection to do nothing, got %v", actions)
+	}
+
+	k8sClient := newClient()
+	runGarbageCollector(k8sClient, "buhtig", 24*time.Hour, time.Hour, "", 0)
+	pruned := func() bool {
+		_, eventErr := k8sClient.CoreV1().Events(metav1.NamespaceDefault).Get("old", metav1.GetOptions{})
+		_, cmErr := k8sClient.CoreV1().ConfigMaps("buhtig").Get("old", metav1.GetOptions{})
+		return eventErr != nil && cmErr != nil
+	}
+	for i := 0; !pruned(); i++ {
+		if i == 50 {
+			t.Fatal("Expected old Event and managed ConfigMap to be pruned right away")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := k8sClient.CoreV1().ConfigMaps("buhtig").Get("unmanaged", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected ConfigMap which isn't managed by the app to be kept, got %v", err)
+	}
+}
+
+func TestDeletionHistory(t *testing.T) {
+	deletionHistory = newHistoryStore(fake.NewSimpleClientset(), "buhtig")
+	defer func() { deletionHistory = nil }()
+
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "app-feature-a",
+		Annotations: map[string]string{githubURLAnnotationName: "https://github.com/org/app/tree/feature-a"},
+	}})
+	auditAction(ns, "delete-helm-release", errors.New("timed out"), nil)
+	auditAction(ns, "snapshot-helm-release", nil, nil)
+	auditAction(ns, "delete-namespace", nil, nil)
+
+	q, err := newHistoryQuery("app-feature-a", "", "1h", "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := deletionHistory.List(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].Outcome != "failed" || entries[1].Action != "delete-helm-release" || entries[0].Outcome != "deleted" || entries[0].Branch != "feature-a" {
+		t.Errorf("Expected failure and deletion to be recorded, got %v", entries)
+	}
+
+	var out bytes.Buffer
+	printHistory(&out, entries)
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 3 || !strings.Contains(lines[2], "timed out") {
+		t.Errorf("Unexpected table:\n%s", out.String())
+	}
+
+	for _, params := range [][]string{{"", "gone", "", ""}, {"", "", "yesterday", ""}, {"", "", "", "-1"}} {
+		if _, err := newHistoryQuery(params[0], params[1], params[2], params[3]); err == nil {
+			t.Errorf("Expected query %v to be invalid", params)
+		}
+	}
+}
+
+func TestBranchEnvironments(t *testing.T) {
+	branchEnvironments = crd.NewEnvironmentClient(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), "buhtig")
+	defer func() { branchEnvironments = nil }()
+	labels := map[string]string{"opuscapita.com/buhtig-s8k": "true"}
+	k8sClient := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app-active", Labels: labels}})
+
+	now := time.Now()
+	gone, err := branchEnvironments.Create(&crd.BranchEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-gone"},
+		Spec:       crd.BranchEnvironmentSpec{Namespace: "app-gone"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := branchEnvironments.Create(&crd.BranchEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-active"},
+		Spec:       crd.BranchEnvironmentSpec{Namespace: "app-active", Overrides: map[string]string{deletionGracePeriodAnnotationName: "72h"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	envs, err := loadBranchEnvironments()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	active := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "app-active",
+		Annotations: map[string]string{githubURLAnnotationName: "https://github.com/org/app/tree/active", helmReleaseAnnotationName: "app-active"},
+	}})
+	deleted := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app-deleted"}})
+	isBranchEnvironmentApplied(envs)(active)
+	if active.ObjectMeta.Annotations[deletionGracePeriodAnnotationName] != "72h" {
+		t.Errorf("Expected override to be applied, got %v", active.ObjectMeta.Annotations)
+	}
+
+	setNamespaceStatus(evaluation{ns: active, now: now, branchStatus: 200}, decision{action: actionSkip, reason: "branch check returned status 200"})
+	setNamespaceStatus(evaluation{ns: deleted, now: now, branchStatus: 404}, decision{action: actionDelete})
+	setNamespaceDeleted(deleted)
+	writeBranchEnvironments(k8sClient, envs, time.Hour)
+	writeNamespaceStatuses(k8sClient, false)
+
+	env, err := branchEnvironments.Get("app-active")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Spec.SourceURL != "https://github.com/org/app/tree/active" || len(env.Spec.Releases) != 1 || env.Spec.Overrides[deletionGracePeriodAnnotationName] != "72h" {
+		t.Errorf("Expected spec to be taken from annotations and overrides to be kept, got %+v", env.Spec)
+	}
+	if env.Status.Phase != crd.PhaseActive || env.Status.BranchState != crd.BranchPresent || env.Status.LastChecked == nil {
+		t.Errorf("Expected active environment, got %+v", env.Status)
+	}
+	if env, _ := branchEnvironments.Get("app-deleted"); env == nil || env.Status.Phase != crd.PhaseDeleted || env.Status.DeletedAt == nil {
+		t.Errorf("Expected environment of deleted namespace to be created in Deleted phase, got %+v", env)
+	}
+	if env, _ := branchEnvironments.Get("app-gone"); env == nil || env.Status.Phase != crd.PhaseDeleted {
+		t.Errorf("Expected environment of missing namespace to be marked deleted, got %+v", env)
+	}
+
+	// environments deleted for longer than retention are removed
+	deletedAt := metav1.NewTime(now.Add(-2 * time.Hour))
+	gone.Status.Phase = crd.PhaseDeleted
+	gone.Status.DeletedAt = &deletedAt
+	writeBranchEnvironments(k8sClient, map[string]*crd.BranchEnvironment{"app-gone": gone}, time.Hour)
+	if env, _ := branchEnvironments.Get("app-gone"); env != nil {
+		t.Errorf("Expected environment to be removed after retention, got %+v", env)
+	}
+}
+
+func TestLoadBranchEnvironments_ListFails(t *testing.T) {
+	failing := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	failing.PrependReactor("list", "*", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+	branchEnvironments = crd.NewEnvironmentClient(failing, "buhtig")
+	defer func() { branchEnvironments = nil }()
+
+	if envs, err := loadBranchEnvironments(); envs != nil || err == nil {
+		t.Errorf("Expected error when BranchEnvironments can't be listed, got %v", envs)
+	}
+}
+
+func TestCleanupPolicies(t *testing.T) {
+	protected := true
+	policies := &cleanupPolicies{
+		base: policy{branchMissingConfirmations: 1, repoMissingPolicy: repoMissingPolicySkip},
+		namespaced: map[string][]crd.CleanupPolicy{
+			"app-feature": {{ObjectMeta: metav1.ObjectMeta{Name: "own", Namespace: "app-feature"}, Spec: crd.CleanupPolicySpec{GracePeriod: "1h"}}},
+		},
+		cluster: []crd.CleanupPolicy{
+			{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}, Spec: crd.CleanupPolicySpec{
+				NamespaceSelector:          &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+				GracePeriod:                "72h",
+				BranchMissingConfirmations: 3,
+				ApprovalChannel:            "#team-a",
+				Annotations:                map[string]string{helmTimeoutAnnotationName: "10m"},
+			}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "default"}, Spec: crd.CleanupPolicySpec{RepoMissingPolicy: repoMissingPolicyDelete, Protected: &protected}},
+		},
+	}
+
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "app-feature",
+		Labels:      map[string]string{"team": "a"},
+		Annotations: map[string]string{protectedAnnotationName: "false"},
+	}})
+	isCleanupPolicyApplied(policies)(ns)
+	expected := map[string]string{
+		protectedAnnotationName:           "false",
+		deletionGracePeriodAnnotationName: "1h",
+		approvalChannelAnnotationName:     "#team-a",
+		helmTimeoutAnnotationName:         "10m",
+	}
+	if !reflect.DeepEqual(ns.ObjectMeta.Annotations, expected) {
+		t.Errorf("Expected annotations of namespace and the most specific policies, got %v", ns.ObjectMeta.Annotations)
+	}
+	if p := policies.policyFor(ns); p.branchMissingConfirmations != 3 || p.repoMissingPolicy != repoMissingPolicyDelete {
+		t.Errorf("Expected decision policy to be overridden, got %+v", p)
+	}
+
+	other := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app-other", Labels: map[string]string{"team": "b"}}})
+	isCleanupPolicyApplied(policies)(other)
+	if !other.IsProtected() || other.ObjectMeta.Annotations[deletionGracePeriodAnnotationName] != "" {
+		t.Errorf("Expected only default policy to apply, got %v", other.ObjectMeta.Annotations)
+	}
+	if p := policies.policyFor(other); p.branchMissingConfirmations != 1 {
+		t.Errorf("Expected base confirmations, got %+v", p)
+	}
+}
+
+func TestValidateNamespace(t *testing.T) {
+	saved := vcsProviders
+	defer func() { vcsProviders = saved }()
+	vcsProviders = vcs.NewRegistry()
+	vcsProviders.Register(github.NewClient(""))
+
+	review := func(op admissionv1beta1.Operation, obj, old *corev1.Namespace, mode string) *admissionv1beta1.AdmissionResponse {
+		req := &admissionv1beta1.AdmissionRequest{Operation: op}
+		req.Object.Raw, _ = json.Marshal(obj)
+		if old != nil {
+			req.OldObject.Raw, _ = json.Marshal(old)
+		}
+		return validateNamespace(req, mode)
+	}
+	tracked := func(sourceURL string) *corev1.Namespace {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app-feature", Labels: map[string]string{"opuscapita.com/buhtig-s8k": "true"}}}
+		if sourceURL != "" {
+			ns.Annotations = map[string]string{githubURLAnnotationName: sourceURL}
+		}
+		return ns
+	}
+
+	if r := review(admissionv1beta1.Create, tracked("https://github.com/org/app/tree/feature"), nil, admissionValidationDeny); !r.Allowed {
+		t.Errorf("Expected valid namespace to be admitted, got %+v", r.Result)
+	}
+	if r := review(admissionv1beta1.Create, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}}, nil, admissionValidationDeny); !r.Allowed {
+		t.Error("Expected untracked namespace to be admitted")
+	}
+	for _, sourceURL := range []string{"", "github.com/org/app", "https://github.com/org/app"} {
+		r := review(admissionv1beta1.Create, tracked(sourceURL), nil, admissionValidationDeny)
+		if r.Allowed || !strings.Contains(r.Result.Message, githubURLAnnotationName) {
+			t.Errorf("Expected namespace with source URL '%s' to be rejected, got %+v", sourceURL, r)
+		}
+	}
+	if r := review(admissionv1beta1.Create, tracked(""), nil, admissionValidationWarn); !r.Allowed || r.AuditAnnotations[admissionWarningAuditAnnotation] == "" {
+		t.Errorf("Expected invalid namespace to be admitted with warning, got %+v", r)
+	}
+
+	// unrelated updates of existing namespaces aren't blocked
+	if r := review(admissionv1beta1.Update, tracked(""), tracked(""), admissionValidationDeny); !r.Allowed {
+		t.Error("Expected update which doesn't change source URL to be admitted")
+	}
+	if r := review(admissionv1beta1.Update, tracked("bogus"), tracked(""), admissionValidationDeny); r.Allowed {
+		t.Error("Expected update which breaks source URL to be rejected")
+	}
+}
+
+func TestAnnotateNamespace(t *testing.T) {
+	settings := admissionSettings{
+		sourceURLTemplate:   `https://github.com/org/{{ index .Labels "app" }}/tree/{{ trimPrefix (print (index .Labels "app") "-") .Namespace }}`,
+		helmReleaseTemplate: `{{ if .Branch }}{{ .Repo }}-{{ replace "/" "-" .Branch }}{{ end }}`,
+	}
+	review := func(ns *corev1.Namespace) *admissionv1beta1.AdmissionResponse {
+		req := &admissionv1beta1.AdmissionRequest{Operation: admissionv1beta1.Create, Name: ns.Name}
+		req.Object.Raw, _ = json.Marshal(ns)
+		return annotateNamespace(req, settings)
+	}
+	patchOf := func(r *admissionv1beta1.AdmissionResponse) []map[string]interface{} {
+		ops := []map[string]interface{}{}
+		if r.Patch != nil {
+			json.Unmarshal(r.Patch, &ops)
+		}
+		return ops
+	}
+	labels := map[string]string{"opuscapita.com/buhtig-s8k": "true", "app": "shop"}
+
+	ops := patchOf(review(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop-feature", Labels: labels}}))
+	expected := map[string]interface{}{
+		githubURLAnnotationName:   "https://github.com/org/shop/tree/feature",
+		helmReleaseAnnotationName: "shop-feature",
+	}
+	if len(ops) != 1 || ops[0]["path"] != "/metadata/annotations" || !reflect.DeepEqual(ops[0]["value"], expected) {
+		t.Errorf("Expected annotations to be added, got %v", ops)
+	}
+
+	// annotations set by CI are kept
+	ops = patchOf(review(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:        "shop-feature",
+		Labels:      labels,
+		Annotations: map[string]string{githubURLAnnotationName: "https://github.com/org/shop/tree/feature/x"},
+	}}))
+	if len(ops) != 1 || ops[0]["path"] != "/metadata/annotations/opuscapita.com~1helm-release" || ops[0]["value"] != "shop-feature-x" {
+		t.Errorf("Expected only helm release to be added, got %v", ops)
+	}
+
+	if r := review(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "shop-feature"}}); r.Patch != nil || !r.Allowed {
+		t.Errorf("Expected untracked namespace to be admitted as is, got %+v", r)
+	}
+}
+
+func TestLoadCleanupPolicies(t *testing.T) {
+	clusterPolicy := func(name string, spec map[string]interface{}) runtime.Object {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{"metadata": map[string]interface{}{"name": name}, "spec": spec}}
+		u.SetAPIVersion(crd.Group + "/" + crd.Version)
+		u.SetKind(crd.ClusterCleanupPolicyKind)
+		return u
+	}
+	cleanupPolicyClient = crd.NewPolicyClient(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		clusterPolicy("valid", map[string]interface{}{"gracePeriod": "1h"}),
+		clusterPolicy("invalid", map[string]interface{}{"gracePeriod": "soon"})))
+	defer func() { cleanupPolicyClient = nil }()
+
+	policies, err := loadCleanupPolicies(policy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies.cluster) != 1 || policies.cluster[0].Name != "valid" {
+		t.Errorf("Expected only valid policy to be applied, got %v", policies.cluster)
+	}
+	listed, _ := cleanupPolicyClient.ListCluster()
+	for _, p := range listed {
+		c := p.Status.Conditions
+		if len(c) != 1 || c[0].Type != crd.ConditionValid || (c[0].Status == corev1.ConditionTrue) != (p.Name == "valid") {
+			t.Errorf("Expected Valid condition of %s to be written, got %+v", p.Name, c)
+		}
+	}
+
+	// policies which can't be read aren't replaced with base policy
+	failing := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	failing.PrependReactor("list", "*", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+	cleanupPolicyClient = crd.NewPolicyClient(failing)
+	if policies, err := loadCleanupPolicies(policy{}); policies != nil || err == nil {
+		t.Errorf("Expected error when policies can't be listed, got %v", policies)
+	}
+}
+
+func TestGithubRateLimitCollector(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "4321")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	collector := &githubRateLimitCollector{remaining: githubRateLimits.remaining, reset: githubRateLimits.reset}
+	client := github.NewEnterpriseClient(server.URL, "")
+	collector.add("ghe", "GHE_TOKEN", client)
+	registry := promclient.NewRegistry()
+	registry.MustRegister(collector)
+
+	if families, _ := registry.Gather(); len(families) != 0 {
+		t.Errorf("Expected no metrics before any response, got %v", families)
+	}
+	if _, err := client.BranchStatus("org", "app", "master"); err != nil {
+		t.Fatal(err)
+	}
+	families, err := registry.Gather()
+	if err != nil || len(families) != 2 {
+		t.Fatalf("Expected 2 metrics, got %v (%v)", families, err)
+	}
+	for _, f := range families {
+		m := f.GetMetric()[0]
+		value := m.GetGauge().GetValue()
+		switch f.GetName() {
+		case "buhtig_s8k_github_rate_limit_remaining":
+			if value != 4321 {
+				t.Errorf("Expected remaining requests, got %v", value)
+			}
+		case "buhtig_s8k_github_rate_limit_reset_seconds":
+			if value <= 3500 || value > 3600 {
+				t.Errorf("Expected about an hour until reset, got %v", value)
+			}
+		}
+		if m.GetLabel()[0].GetValue() != "ghe" || m.GetLabel()[1].GetValue() != "GHE_TOKEN" {
+			t.Errorf("Expected provider and token labels, got %v", m.GetLabel())
+		}
+	}
+}
+
+func TestPushMetrics(t *testing.T) {
+	var method, path string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	registry := promclient.NewRegistry()
+	gauge := promclient.NewGauge(promclient.GaugeOpts{Name: "buhtig_s8k_test", Help: "Test."})
+	gauge.Set(42)
+	registry.MustRegister(gauge)
+
+	if err := pushMetrics(pushgatewaySettings{job: "buhtig-s8k"}, registry); err != nil || method != "" {
+		t.Errorf("Expected nothing to be pushed without URL, got %s (%v)", method, err)
+	}
+	if err := pushMetrics(pushgatewaySettings{url: server.URL, job: "buhtig-s8k"}, registry); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPut || path != "/metrics/job/buhtig-s8k" || len(body) == 0 {
+		t.Errorf("Expected metrics to replace group of job, got %s %s (%d bytes)", method, path, len(body))
+	}
+}
+
+func TestLoopWatchdog(t *testing.T) {
+	now := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	w := &loopWatchdog{timeout: time.Hour}
+	if err := w.check(now); err != nil {
+		t.Errorf("Expected watchdog to pass before the first iteration, got %v", err)
+	}
+
+	w.iterationStarted(now)
+	if err := w.check(now.Add(59 * time.Minute)); err != nil {
+		t.Errorf("Expected running iteration to be within timeout, got %v", err)
+	}
+	if err := w.check(now.Add(61 * time.Minute)); err == nil || !strings.Contains(err.Error(), "to complete") {
+		t.Errorf("Expected wedged iteration to fail liveness, got %v", err)
+	}
+
+	w.iterationCompleted(now.Add(24 * time.Hour))
+	if err := w.check(now.Add(24*time.Hour + 30*time.Minute)); err != nil {
+		t.Errorf("Expected idle loop to pass until next iteration is due, got %v", err)
+	}
+	if err := w.check(now.Add(26 * time.Hour)); err == nil || !strings.Contains(err.Error(), "to start") {
+		t.Errorf("Expected loop which didn't start next iteration to fail liveness, got %v", err)
+	}
+
+	w.timeout = 0
+	if err := w.check(now.Add(26 * time.Hour)); err != nil {
+		t.Errorf("Expected disabled watchdog to pass, got %v", err)
+	}
+}
+
+func TestReadinessChecks(t *testing.T) {
+	defer readinessFailures.Delete(kubernetesCheck)
+	runKubernetesCheck(fake.NewSimpleClientset(), 0)
+
+	recorder := httptest.NewRecorder()
+	serveReadiness(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected app to be ready, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	runReadinessCheck(kubernetesCheck, 0, func() error { return errors.New("connection refused") })
+	recorder = httptest.NewRecorder()
+	serveReadiness(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable || !strings.Contains(recorder.Body.String(), "kubernetes: connection refused") {
+		t.Errorf("Expected failed check to be reported, got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestDebugMux(t *testing.T) {
+	mux := newDebugMux()
+	for path, expected := range map[string]string{
+		"/debug/vars":                    `"goroutines":`,
+		"/debug/pprof/goroutine?debug=1": "goroutine profile",
+	} {
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), expected) {
+			t.Errorf("Expected %s to contain %s, got %d", path, expected, recorder.Code)
+		}
+	}
+}
+
+func TestNamespaceSpans(t *testing.T) {
+	var received struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					Name         string `json:"name"`
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+	setupTracing(otlpSettings{endpoint: server.URL, serviceName: "buhtig-s8k"})
+	defer func() { tracer, iterationSpan = nil, nil }()
+
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview"}})
+	iterationSpan = tracer.Start(nil, "iteration")
+	startNamespaceSpan(ns)
+	step := startSpan(ns, "step helm-release")
+	call := startClientSpan(ns, "helm.delete-release")
+	endSpan(ns, call, nil)
+	endSpan(ns, step, nil)
+	// deadline has expired during step, its span is ended with namespace
+	startSpan(ns, "step namespace")
+	endIterationSpan(0)
+
+	parents := map[string]string{}
+	names := map[string]string{"": ""}
+	for _, span := range received.ResourceSpans[0].ScopeSpans[0].Spans {
+		names[span.SpanID] = span.Name
+		parents[span.Name] = span.ParentSpanID
+	}
+	for name, parent := range map[string]string{
+		"helm.delete-release": "step helm-release",
+		"step helm-release":   "namespace",
+		"step namespace":      "namespace",
+		"namespace":           "iteration",
+		"iteration":           "",
+	} {
+		if id, ok := parents[name]; !ok || names[id] != parent {
+			t.Errorf("Expected span '%s' to be a child of '%s', got %v", name, parent, parents)
+		}
+	}
+	if _, ok := namespaceTraces.Load(ns.Name()); ok {
+		t.Error("Expected trace of namespace to be forgotten after iteration")
+	}
+}
+
+func TestNamespaceLogFields(t *testing.T) {
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview", Annotations: map[string]string{
+		githubURLAnnotationName: "https://github.com/OpusCapita/buhtig-s8k/tree/feature/logs",
+	}}})
+	setStage(ns, stepHelmRelease)
+	fields := ns.logFields()
+	if fields["namespace"] != "preview" || fields["repo"] != "OpusCapita/buhtig-s8k" || fields["branch"] != "feature/logs" || fields["stage"] != stepHelmRelease {
+		t.Errorf("Unexpected fields %v", fields)
+	}
+	setStage(ns, "")
+	if _, ok := ns.logFields()["stage"]; ok {
+		t.Error("Expected stage to be cleared")
+	}
+
+	if err := setupLogFormat("xml"); err == nil {
+		t.Error("Expected unknown format to be rejected")
+	}
+}
+
+func TestGithubWebhook_Replays(t *testing.T) {
+	defer deletedBranchHints.Delete("org/repo/feature")
+	handler := githubWebhookHandler("s3cret")
+	deliver := func(delivery, body string) int {
+		r := httptest.NewRequest(http.MethodPost, "/webhook/github", strings.NewReader(body))
+		r.Header.Set("X-GitHub-Event", "delete")
+		r.Header.Set(webhook.DeliveryHeader, delivery)
+		r.Header.Set(webhook.SignatureHeader, webhook.Sign([]byte("s3cret"), []byte(body)))
+		recorder := httptest.NewRecorder()
+		handler(recorder, r)
+		return recorder.Code
+	}
+	body := `{"ref":"feature","ref_type":"branch","repository":{"full_name":"org/repo"}}`
+
+	if code := deliver("1", body); code != http.StatusAccepted {
+		t.Fatalf("Expected delivery to be accepted, got %d", code)
+	}
+	select {
+	case <-iterationTrigger:
+	default:
+		t.Error("Expected deleted branch to trigger iteration")
+	}
+	if code := deliver("1", `{"ref":"other","ref_type":"branch"}`); code != http.StatusConflict {
+		t.Errorf("Expected replayed delivery ID to be rejected, got %d", code)
+	}
+	// delivery ID isn't signed, so it's easy to change
+	if code := deliver("2", body); code != http.StatusConflict {
+		t.Errorf("Expected replayed payload with new delivery ID to be rejected, got %d", code)
+	}
+	if code := deliver("3", strings.Replace(body, "feature", "bugfix", 1)); code != http.StatusAccepted {
+		t.Errorf("Expected new payload to be accepted, got %d", code)
+	}
+	<-iterationTrigger
+	deletedBranchHints.Delete("org/repo/bugfix")
+}
+
+func TestCheckForUpdate(t *testing.T) {
+	tag := "v1.1.0"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/OpusCapita/buhtig-s8k/releases/latest" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(github.Release{TagName: tag, HTMLURL: "https://github.com/OpusCapita/buhtig-s8k/releases/" + tag})
+	}))
+	defer server.Close()
+	ghClient := github.NewEnterpriseClient(server.URL, "")
+	defer func(v string) { version = v }(version)
+	version = "1.0.0"
+	current := semver.MustParse(version)
+
+	latest, err := checkForUpdate(ghClient, "OpusCapita", "buhtig-s8k", current)
+	if err != nil || latest == nil || latest.TagName != "v1.1.0" {
+		t.Fatalf("Expected newer release, got %v (%v)", latest, err)
+	}
+	if available := testutil.ToFloat64(updateAvailableGauge.WithLabelValues("1.0.0", tag, latest.HTMLURL)); available != 1 {
+		t.Errorf("Expected update to be reported available, got %v", available)
+	}
+
+	tag = "v1.0.0"
+	if latest, err := checkForUpdate(ghClient, "OpusCapita", "buhtig-s8k", current); err != nil || latest != nil {
+		t.Errorf("Expected no update for the same version, got %v (%v)", latest, err)
+	}
+	if available := testutil.ToFloat64(updateAvailableGauge.WithLabelValues("1.0.0", tag, "https://github.com/OpusCapita/buhtig-s8k/releases/"+tag)); available != 0 {
+		t.Errorf("Expected update not to be available, got %v", available)
+	}
+
+	tag = "latest"
+	if _, err := checkForUpdate(ghClient, "OpusCapita", "buhtig-s8k", current); err == nil {
+		t.Error("Expected error for tag which isn't semantic version")
+	}
+	if _, err := checkForUpdate(ghClient, "OpusCapita", "missing", current); err == nil {
+		t.Error("Expected error for missing repository")
+	}
+}
+
+func TestRunUpdateChecker(t *testing.T) {
+	requests := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.URL.Path
+		json.NewEncoder(w).Encode(github.Release{TagName: "v2.0.0"})
+	}))
+	defer server.Close()
+	ghClient := github.NewEnterpriseClient(server.URL, "")
+	defer func(v string) { version = v }(version)
+
+	// disabled by default, for development builds and for malformed repository
+	version = "1.0.0"
+	runUpdateChecker(ghClient, "", time.Hour)
+	runUpdateChecker(ghClient, "buhtig-s8k", time.Hour)
+	version = "dev"
+	runUpdateChecker(ghClient, "OpusCapita/buhtig-s8k", time.Hour)
+	select {
+	case path := <-requests:
+		t.Fatalf("Expected disabled check not to call Github, got request %s", path)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	version = "1.0.0"
+	runUpdateChecker(ghClient, "OpusCapita/buhtig-s8k", time.Hour)
+	select {
+	case path := <-requests:
+		if path != "/repos/OpusCapita/buhtig-s8k/releases/latest" {
+			t.Errorf("Unexpected request %s", path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected enabled check to call Github right away")
+	}
+	// wait for the check to complete before version is restored
+	for i := 0; testutil.ToFloat64(updateAvailableGauge.WithLabelValues("1.0.0", "v2.0.0", "")) != 1; i++ {
+		if i == 50 {
+			t.Fatal("Expected newer version to be reported")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRequireAdminToken(t *testing.T) {
+	defer func(tokens map[string]string) { adminTokens = tokens }(adminTokens)
+	handler := requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+		caller, _ := adminCaller(r)
+		fmt.Fprint(w, caller)
+	})
+	request := func(header string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/pause", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, r)
+		return recorder
+	}
+
+	adminTokens = parseAdminTokens(nil)
+	if recorder := request("Bearer "); recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected endpoint to be disabled without tokens, got %d", recorder.Code)
+	}
+
+	adminTokens = parseAdminTokens([]string{"jdoe:s3cret", "shared", "nobody:"})
+	if len(adminTokens) != 2 {
+		t.Errorf("Expected token without value to be dropped, got %v", adminTokens)
+	}
+	for _, header := range []string{"", "s3cret", "Bearer wrong", "Bearer "} {
+		if recorder := request(header); recorder.Code != http.StatusUnauthorized {
+			t.Errorf("Expected %q to be unauthorized, got %d", header, recorder.Code)
+		}
+	}
+	if recorder := request("Bearer s3cret"); recorder.Code != http.StatusOK || recorder.Body.String() != "jdoe" {
+		t.Errorf("Expected caller jdoe, got %d %s", recorder.Code, recorder.Body)
+	}
+	if recorder := request("Bearer shared"); recorder.Code != http.StatusOK || recorder.Body.String() != "admin" {
+		t.Errorf("Expected caller admin, got %d %s", recorder.Code, recorder.Body)
+	}
+}
+
+func TestServeLogLevel(t *testing.T) {
+	defer log.SetLevel(log.GetLevel())
+	defer func(tokens map[string]string) { adminTokens = tokens }(adminTokens)
+	adminTokens = parseAdminTokens([]string{"jdoe:s3cret"})
+	put := func(body, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, "/loglevel", strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		serveLogLevel(recorder, r)
+		return recorder
+	}
+
+	log.SetLevel(log.InfoLevel)
+	if recorder := put("warn", ""); recorder.Code != http.StatusUnauthorized || log.GetLevel() != log.InfoLevel {
+		t.Errorf("Expected level change without token to be refused, got %d", recorder.Code)
+	}
+
+	recorder := put("warn\n", "s3cret")
+	if recorder.Code != http.StatusOK || strings.TrimSpace(recorder.Body.String()) != "warning" || log.GetLevel() != log.WarnLevel {
+		t.Errorf("Expected level to be set, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	recorder = put("verbose", "s3cret")
+	if recorder.Code != http.StatusBadRequest || log.GetLevel() != log.WarnLevel {
+		t.Errorf("Expected invalid level to be rejected, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	serveLogLevel(recorder, httptest.NewRequest(http.MethodGet, "/loglevel", nil))
+	if recorder.Code != http.StatusOK || strings.TrimSpace(recorder.Body.String()) != "warning" {
+		t.Errorf("Expected current level without token, got %d %s", recorder.Code, recorder.Body)
+	}
+
+	toggleDebugLevel(log.InfoLevel)
+	if log.GetLevel() != log.DebugLevel {
+		t.Errorf("Expected signal to enable debug level, got %s", log.GetLevel())
+	}
+	toggleDebugLevel(log.InfoLevel)
+	if log.GetLevel() != log.InfoLevel {
+		t.Errorf("Expected signal to restore configured level, got %s", log.GetLevel())
+	}
+}
+
+func TestCorrelationIDs(t *testing.T) {
+	defer iterationID.Store("")
+
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview"}})
+	startIterationLogging("4bf92f3577b34da6a3ce929d0e0e4736")
+	startCorrelation(ns)
+	fields := ns.logFields()
+	if fields["iteration_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || len(fields["correlation_id"].(string)) != 32 {
+		t.Errorf("Expected trace ID of iteration and correlation ID, got %v", fields)
+	}
+
+	// every iteration gets its own IDs even if it isn't traced
+	entry := startIterationLogging("")
+	if id := entry.Data["iteration_id"]; id == "" || id == fields["iteration_id"] {
+		t.Errorf("Expected new iteration ID, got %v", id)
+	}
+	if _, ok := ns.logFields()["correlation_id"]; ok {
+		t.Error("Expected correlation ID of previous iteration to be forgotten")
+	}
+}
+
+func TestDedupFormatter(t *testing.T) {
+	f := &dedupFormatter{next: &log.TextFormatter{DisableTimestamp: true}, window: time.Hour, seen: map[dedupKey]*dedupState{}}
+	now := time.Now()
+	format := func(level log.Level, namespace, message string) string {
+		entry := log.WithFields(log.Fields{"namespace": namespace})
+		entry.Level, entry.Message, entry.Time = level, message, now
+		out, err := f.Format(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+
+	if out := format(log.ErrorLevel, "preview", "Annotation 'url' not set"); !strings.Contains(out, "Annotation") {
+		t.Errorf("Expected first occurrence to be logged, got '%s'", out)
+	}
+	for i := 0; i < 3; i++ {
+		if out := format(log.ErrorLevel, "preview", "Annotation 'url' not set"); out != "" {
+			t.Errorf("Expected repeat to be suppressed, got '%s'", out)
+		}
+	}
+	if format(log.ErrorLevel, "review", "Annotation 'url' not set") == "" || format(log.InfoLevel, "preview", "Checking branch") == "" ||
+		format(log.InfoLevel, "preview", "Checking branch") == "" {
+		t.Error("Expected messages of other namespaces and info messages to be logged")
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	f.summarize(now.Add(time.Hour))
+	if !strings.Contains(buf.String(), "Repeated 3 more times in the last 1h0m0s: Annotation 'url' not set") || strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("Expected summary of suppressed repeats, got '%s'", buf.String())
+	}
+
+	// message which didn't repeat for the whole window is logged in full when it comes back
+	f.summarize(now.Add(2 * time.Hour))
+	if out := format(log.ErrorLevel, "preview", "Annotation 'url' not set"); out == "" {
+		t.Error("Expected forgotten message to be logged again")
+	}
+}
+
+func TestIterationSummary(t *testing.T) {
+	defer func() { lastSummary = nil }()
+
+	ns := newNamespace(corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "preview"}})
+	start := time.Now()
+	startIterationSummary(start)
+	for i := 0; i < 3; i++ {
+		countFound()
+		countEvaluated()
+	}
+	countSkipped(skipReasonPaused)
+	countSkipped(skipReasonPaused)
+	countDeleted()
+	countErrored(ns)
+	countErrored(ns)
+	finishIterationSummary(start.Add(12 * time.Second))
+
+	expected := "Iteration is completed in 12s: 3 namespaces found, 3 evaluated, 1 deleted, 2 skipped (paused: 2), 1 errored, 0 Github calls"
+	if s := lastIterationSummary(); s == nil || s.String() != expected {
+		t.Errorf("Expected '%s', got '%v'", expected, s)
+	}
+
+	recorder := httptest.NewRecorder()
+	serveStatus(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if !strings.Contains(recorder.Body.String(), `"lastIteration":{"found":3,"evaluated":3,"deleted":1,"skipped":{"paused":2},"errored":1`) {
+		t.Errorf("Expected summary in status, got %s", recorder.Body)
+	}
+
+	// outcomes outside of iteration aren't counted
+	countDeleted()
+	if lastIterationSummary().Deleted != 1 {
+		t.Error("Expected completed summary to stay unchanged")
+	}
+}
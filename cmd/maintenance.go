@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// maintenanceWindow is daily time range on some days of week, e.g. "Mon-Fri 08:00-18:00";
+// range ending before it starts (e.g. "22:00-06:00") crosses midnight and belongs to the day it starts on
+type maintenanceWindow struct {
+	days [7]bool
+	// start and end are offsets from midnight
+	start time.Duration
+	end   time.Duration
+}
+
+// maintenanceWindows are windows in location, destructive actions are allowed in any of them
+type maintenanceWindows struct {
+	windows  []maintenanceWindow
+	location *time.Location
+}
+
+// parseWeekdays parses "*", "Mon", "Mon-Fri" or "Sat+Sun"
+func parseWeekdays(val string) ([7]bool, error) {
+	days := [7]bool{}
+	if val == "*" {
+		return [7]bool{true, true, true, true, true, true, true}, nil
+	}
+	for _, part := range strings.Split(val, "+") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, ok := weekdays[strings.ToLower(bounds[0])]
+		if !ok {
+			return days, fmt.Errorf("unknown day '%s'", bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[strings.ToLower(bounds[1])]; !ok {
+				return days, fmt.Errorf("unknown day '%s'", bounds[1])
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock parses "HH:MM" as offset from midnight, "24:00" is allowed as the end of day
+func parseClock(val string) (time.Duration, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(val, "%d:%d", &h, &m); err != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time '%s'", val)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// parseMaintenanceWindow parses window like "Mon-Fri 08:00-18:00"
+func parseMaintenanceWindow(val string) (maintenanceWindow, error) {
+	w := maintenanceWindow{}
+	fields := strings.Fields(val)
+	if len(fields) != 2 {
+		return w, fmt.Errorf("window '%s' should look like 'Mon-Fri 08:00-18:00'", val)
+	}
+	var err error
+	if w.days, err = parseWeekdays(fields[0]); err != nil {
+		return w, err
+	}
+	clocks := strings.SplitN(fields[1], "-", 2)
+	if len(clocks) != 2 {
+		return w, fmt.Errorf("time range '%s' should look like '08:00-18:00'", fields[1])
+	}
+	if w.start, err = parseClock(clocks[0]); err != nil {
+		return w, err
+	}
+	if w.end, err = parseClock(clocks[1]); err != nil {
+		return w, err
+	}
+	return w, nil
+}
+
+// newMaintenanceWindows parses ';'-separated windows in timezone; it exits on misconfiguration
+func newMaintenanceWindows(val, timezone string) maintenanceWindows {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Env %s should be IANA timezone, e.g. 'Europe/Helsinki': %v", maintenanceTimezoneEnv, err))
+	}
+	mw := maintenanceWindows{location: location}
+	for _, item := range strings.Split(val, ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		w, err := parseMaintenanceWindow(item)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Env %s is invalid: %v", maintenanceWindowsEnv, err))
+		}
+		mw.windows = append(mw.windows, w)
+	}
+	return mw
+}
+
+// contains checks if t is in any of windows, it's always true if there're no windows
+func (mw maintenanceWindows) contains(t time.Time) bool {
+	if len(mw.windows) == 0 {
+		return true
+	}
+	t = t.In(mw.location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, mw.location)
+	offset := t.Sub(midnight)
+	yesterday := (t.Weekday() + 6) % 7
+	for _, w := range mw.windows {
+		if w.start < w.end {
+			if w.days[t.Weekday()] && offset >= w.start && offset < w.end {
+				return true
+			}
+			continue
+		}
+		// window crosses midnight
+		if (w.days[t.Weekday()] && offset >= w.start) || (w.days[yesterday] && offset < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInMaintenanceWindow lets namespace proceed to destructive steps only during maintenance windows,
+// so that deletions happen when humans are around to notice problems; branch checks and marking go on at all times
+func isInMaintenanceWindow(mw maintenanceWindows) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if mw.contains(time.Now()) {
+			return true
+		}
+		ns.logger().Info("Namespace is going to be deleted, but it's outside of maintenance windows, deletion is deferred")
+		skipNamespace(ns, skipReasonMaintenance, "deletion is deferred till maintenance window")
+		return false
+	}
+}
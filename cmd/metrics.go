@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "buhtig_s8k"
+
+var (
+	updateAvailableGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "update_available",
+		Help:      "1 if a newer release of the app is published, 0 otherwise.",
+	}, []string{"current_version", "latest_version", "changelog_url"})
+
+	namespacesSkippedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "namespaces_skipped_total",
+		Help:      "Number of checks which left namespace alone regardless of branch status, by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(updateAvailableGauge)
+	prometheus.MustRegister(namespacesSkippedCounter)
+}
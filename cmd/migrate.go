@@ -0,0 +1,230 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	log "github.com/sirupsen/logrus"
+
+	konnect "github.com/OpusCapita/buhtig-s8k/pkg/konnect"
+)
+
+// legacyAnnotationNames maps annotation names written by older CI templates to the current ones
+var legacyAnnotationNames = map[string]string{
+	"opuscapita.com/github-url":    githubURLAnnotationName,
+	"opuscapita.com/github-source": githubURLAnnotationName,
+	"opuscapita.com/source-url":    githubURLAnnotationName,
+	"opuscapita.com/helm":          helmReleaseAnnotationName,
+	"opuscapita.com/helm-releases": helmReleaseAnnotationName,
+}
+
+// matches legacy Github URL variants: http://, www., git@github.com:OWNER/REPO, '.git' suffix and '/branches/' or '/commits/' instead of '/tree/'
+var legacyGithubURLRe = regexp.MustCompile(`^(?:https?://(?:www\.)?github\.com/|git@github\.com:)([^/]+)/([^/]+?)(?:\.git)?/(?:tree|branches|commits)/(.+?)/*$`)
+
+// annotationChange describes single change migration applies to namespace
+type annotationChange struct {
+	name     string
+	oldValue *string
+	newValue *string
+}
+
+func (c annotationChange) String() string {
+	valueOf := func(v *string) string {
+		if v == nil {
+			return "<removed>"
+		}
+		return fmt.Sprintf("%q", *v)
+	}
+	return fmt.Sprintf("%s: %s -> %s", c.name, valueOf(c.oldValue), valueOf(c.newValue))
+}
+
+// normalizeGithubURL converts legacy Github URL variants to https://github.com/OWNER/REPO/tree/BRANCH
+func normalizeGithubURL(githubURL string) string {
+	trimmed := strings.TrimSpace(githubURL)
+	parts := legacyGithubURLRe.FindStringSubmatch(trimmed)
+	if parts == nil {
+		return trimmed
+	}
+	return fmt.Sprintf("https://github.com/%s/%s/tree/%s", parts[1], parts[2], parts[3])
+}
+
+// migrationConflict is legacy annotation whose value differs from the current annotation, it's left for human to resolve
+type migrationConflict struct {
+	legacyName  string
+	legacyValue string
+	name        string
+	value       string
+}
+
+func (c migrationConflict) String() string {
+	return fmt.Sprintf("%s=%q conflicts with %s=%q", c.legacyName, c.legacyValue, c.name, c.value)
+}
+
+// sameAnnotationValue checks if legacy value says the same as current one, Github URLs are compared normalized
+func sameAnnotationValue(name, legacyValue, value string) bool {
+	if name == githubURLAnnotationName {
+		return normalizeGithubURL(legacyValue) == normalizeGithubURL(value)
+	}
+	return legacyValue == value
+}
+
+// planMigration returns changes required to bring namespace annotations to the current schema. Legacy annotation is
+// removed only if the current one is missing or says the same, otherwise it's returned as conflict and left alone.
+func planMigration(ns *namespace) ([]annotationChange, []migrationConflict) {
+	annotations := ns.ObjectMeta.Annotations
+	changes := []annotationChange{}
+	conflicts := []migrationConflict{}
+
+	// iterate in stable order to get reproducible reports
+	legacyNames := []string{}
+	for name := range legacyAnnotationNames {
+		legacyNames = append(legacyNames, name)
+	}
+	sort.Strings(legacyNames)
+
+	migrated := map[string]string{}
+	for _, legacyName := range legacyNames {
+		val, ok := annotations[legacyName]
+		if !ok {
+			continue
+		}
+		current := legacyAnnotationNames[legacyName]
+		existing, exists := annotations[current]
+		if !exists {
+			existing, exists = migrated[current]
+		}
+		if exists && !sameAnnotationValue(current, val, existing) {
+			conflicts = append(conflicts, migrationConflict{legacyName: legacyName, legacyValue: val, name: current, value: existing})
+			continue
+		}
+		if !exists {
+			migrated[current] = val
+		}
+		oldVal := val
+		changes = append(changes, annotationChange{name: legacyName, oldValue: &oldVal})
+	}
+
+	for name, val := range migrated {
+		if name == githubURLAnnotationName {
+			val = normalizeGithubURL(val)
+		}
+		newVal := val
+		changes = append(changes, annotationChange{name: name, newValue: &newVal})
+	}
+
+	if val, ok := annotations[githubURLAnnotationName]; ok {
+		if normalized := normalizeGithubURL(val); normalized != val {
+			oldVal := val
+			changes = append(changes, annotationChange{name: githubURLAnnotationName, oldValue: &oldVal, newValue: &normalized})
+		}
+	}
+
+	return changes, conflicts
+}
+
+// migrateNamespaces detects legacy annotations of tracked namespaces and (unless dryRun) patches them;
+// it returns number of namespaces which need (or got) migration and number of conflicts left alone
+func migrateNamespaces(k8sClient kubernetes.Interface, dryRun bool) (int, int, error) {
+	nsList, err := k8sClient.CoreV1().Namespaces().List(metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	count, conflictCount := 0, 0
+	for _, k8sNs := range nsList.Items {
+		ns := newNamespace(k8sNs)
+		logger := ns.logger()
+		changes, conflicts := planMigration(ns)
+		for _, conflict := range conflicts {
+			logger.Warn("Migration conflict, legacy annotation is left alone: " + conflict.String())
+		}
+		conflictCount += len(conflicts)
+		if len(changes) == 0 {
+			continue
+		}
+		count++
+
+		patch := map[string]*string{}
+		for _, change := range changes {
+			logger.Info("Migration: " + change.String())
+			patch[change.name] = change.newValue
+		}
+
+		if dryRun {
+			continue
+		}
+		if err := ns.patchAnnotations(k8sClient, patch); err != nil {
+			logger.Error("Failed to migrate annotations")
+			logger.Error(err)
+		}
+	}
+	return count, conflictCount, nil
+}
+
+// runMigrate implements 'migrate' command which reports legacy annotations and patches them with '--apply'
+func runMigrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	apply := flags.Bool("apply", false, "patch namespaces instead of only reporting required changes")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	k8sConfig, err := konnect.NewConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	k8sClient, err := konnect.NewClient(k8sConfig)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	count, conflicts, err := migrateNamespaces(k8sClient, !*apply)
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	logger := log.WithFields(log.Fields{"count": count, "conflicts": conflicts})
+	if *apply {
+		logger.Info("Migrated namespaces")
+	} else {
+		logger.Info("Namespaces require migration, run with --apply to patch them")
+	}
+	if conflicts > 0 {
+		log.Warn("Some legacy annotations conflict with current ones, resolve them manually")
+	}
+	return 0
+}
+
+const (
+	// migrateModeOff disables migration on startup
+	migrateModeOff = "off"
+	// migrateModeReport only logs changes migration would make
+	migrateModeReport = "report"
+	// migrateModeApply patches namespaces
+	migrateModeApply = "apply"
+)
+
+// migrateOnStartup migrates legacy annotations according to mode, failure doesn't stop the app
+func migrateOnStartup(k8sClient kubernetes.Interface, mode string) {
+	if mode == migrateModeOff {
+		return
+	}
+	count, conflicts, err := migrateNamespaces(k8sClient, mode != migrateModeApply)
+	if err != nil {
+		log.WithError(err).Error("Failed to migrate legacy annotations")
+		return
+	}
+	if mode == migrateModeReport && count > 0 {
+		log.WithFields(log.Fields{"count": count, "conflicts": conflicts}).Warn(fmt.Sprintf("Namespaces require migration, set %s=%s to patch them", migrateOnStartupEnv, migrateModeApply))
+	}
+}
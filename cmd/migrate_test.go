@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNormalizeGithubURL(t *testing.T) {
+	expected := "https://github.com/OpusCapita/some-repo/tree/issue-34"
+	for _, url := range []string{
+		expected,
+		" " + expected + "/ ",
+		"http://github.com/OpusCapita/some-repo/tree/issue-34",
+		"https://www.github.com/OpusCapita/some-repo.git/tree/issue-34",
+		"git@github.com:OpusCapita/some-repo.git/tree/issue-34",
+		"https://github.com/OpusCapita/some-repo/branches/issue-34",
+	} {
+		if normalized := normalizeGithubURL(url); normalized != expected {
+			t.Errorf("Expected %s for %s, but got %s", expected, url, normalized)
+		}
+	}
+}
+
+func TestPlanMigration(t *testing.T) {
+	k8sNs := corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "One", Annotations: map[string]string{
+		"opuscapita.com/github-url":    "http://github.com/OpusCapita/some-repo/tree/issue-34",
+		"opuscapita.com/source-url":    "git@github.com:OpusCapita/some-repo.git/tree/issue-34",
+		helmReleaseAnnotationName:      "dev-one",
+		"opuscapita.com/helm":          "dev-legacy",
+		"opuscapita.com/helm-releases": "dev-one",
+	}}}
+
+	changes, conflicts := planMigration(newNamespace(k8sNs))
+
+	patch := map[string]*string{}
+	for _, change := range changes {
+		patch[change.name] = change.newValue
+	}
+
+	if val, ok := patch["opuscapita.com/github-url"]; !ok || val != nil {
+		t.Errorf("Expected legacy Github annotation to be removed, got %v", changes)
+	}
+	if val := patch[githubURLAnnotationName]; val == nil || *val != "https://github.com/OpusCapita/some-repo/tree/issue-34" {
+		t.Errorf("Expected normalized Github URL, got %v", changes)
+	}
+	// another variant of the same URL
+	if val, ok := patch["opuscapita.com/source-url"]; !ok || val != nil {
+		t.Errorf("Expected duplicate legacy Github annotation to be removed, got %v", changes)
+	}
+	if val, ok := patch["opuscapita.com/helm-releases"]; !ok || val != nil {
+		t.Errorf("Expected legacy Helm annotation with the same value to be removed, got %v", changes)
+	}
+	if _, ok := patch["opuscapita.com/helm"]; ok {
+		t.Errorf("Expected conflicting legacy Helm annotation to be kept, got %v", changes)
+	}
+	if _, ok := patch[helmReleaseAnnotationName]; ok {
+		t.Errorf("Expected current Helm annotation to be kept, got %v", changes)
+	}
+	if len(conflicts) != 1 || conflicts[0].legacyName != "opuscapita.com/helm" || conflicts[0].value != "dev-one" {
+		t.Errorf("Expected conflict of legacy Helm annotation, got %v", conflicts)
+	}
+
+	// legacy annotations disagreeing with each other
+	k8sNs = corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "Two", Annotations: map[string]string{
+		"opuscapita.com/github-url": "https://github.com/OpusCapita/one/tree/a",
+		"opuscapita.com/source-url": "https://github.com/OpusCapita/two/tree/b",
+	}}}
+	changes, conflicts = planMigration(newNamespace(k8sNs))
+	if len(changes) != 2 || len(conflicts) != 1 || conflicts[0].legacyName != "opuscapita.com/source-url" {
+		t.Errorf("Expected the first legacy annotation to be migrated and the other one to conflict, got %v %v", changes, conflicts)
+	}
+
+	if changes, conflicts := planMigration(newNamespace(corev1.Namespace{})); len(changes) != 0 || len(conflicts) != 0 {
+		t.Errorf("Expected no changes for namespace without annotations, got %v %v", changes, conflicts)
+	}
+}
+
+func TestMigrateNamespaces(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "one",
+		Labels: map[string]string{"opuscapita.com/buhtig-s8k": "true"},
+		Annotations: map[string]string{
+			helmReleaseAnnotationName:   "dev-one",
+			"opuscapita.com/helm":       "dev-legacy",
+			"opuscapita.com/github-url": "https://github.com/OpusCapita/some-repo/tree/issue-34",
+		},
+	}})
+	get := func() map[string]string {
+		k8sNs, _ := k8sClient.CoreV1().Namespaces().Get("one", metav1.GetOptions{})
+		return k8sNs.Annotations
+	}
+
+	migrateOnStartup(k8sClient, migrateModeReport)
+	if _, ok := get()["opuscapita.com/github-url"]; !ok {
+		t.Error("Expected report mode not to patch namespace")
+	}
+
+	count, conflicts, err := migrateNamespaces(k8sClient, false)
+	if err != nil || count != 1 || conflicts != 1 {
+		t.Fatalf("Expected one migrated namespace with one conflict, got %d %d (%v)", count, conflicts, err)
+	}
+	annotations := get()
+	if _, ok := annotations["opuscapita.com/github-url"]; ok || annotations[githubURLAnnotationName] == "" {
+		t.Errorf("Expected Github annotation to be migrated, got %v", annotations)
+	}
+	if annotations["opuscapita.com/helm"] != "dev-legacy" || annotations[helmReleaseAnnotationName] != "dev-one" {
+		t.Errorf("Expected conflicting annotations to be left alone, got %v", annotations)
+	}
+}
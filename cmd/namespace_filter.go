@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// namespaceNameFilter is the second line of defense against mistakenly labeled critical namespaces:
+// namespace is handled only if its name matches any of allow patterns (if there're any) and none of deny patterns
+type namespaceNameFilter struct {
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// newNamespaceNameFilter compiles patterns which should match the whole name; it exits on invalid pattern
+func newNamespaceNameFilter(allow, deny []string) namespaceNameFilter {
+	compile := func(env string, patterns []string) []*regexp.Regexp {
+		compiled := []*regexp.Regexp{}
+		for _, pattern := range patterns {
+			re, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				log.Fatal(fmt.Sprintf("Env %s should contain valid regular expressions: %v", env, err))
+			}
+			compiled = append(compiled, re)
+		}
+		return compiled
+	}
+	return namespaceNameFilter{allow: compile(namespaceAllowEnv, allow), deny: compile(namespaceDenyEnv, deny)}
+}
+
+// reject returns non-empty reason if namespace with name shouldn't be handled
+func (f namespaceNameFilter) reject(name string) string {
+	for _, re := range f.deny {
+		if re.MatchString(name) {
+			return fmt.Sprintf("name matches deny pattern '%s'", re)
+		}
+	}
+	if len(f.allow) == 0 {
+		return ""
+	}
+	for _, re := range f.allow {
+		if re.MatchString(name) {
+			return ""
+		}
+	}
+	return "name doesn't match any allow pattern"
+}
+
+// isNamespaceNameAllowed filters out namespaces rejected by name filter regardless of their labels
+func isNamespaceNameAllowed(f namespaceNameFilter) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if reason := f.reject(ns.Name()); reason != "" {
+			ns.logger().WithField("reason", reason).Warn("Namespace is labeled for cleanup, but it's left alone")
+			skipNamespace(ns, skipReasonNameFilter, reason)
+			return false
+		}
+		return true
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// isPullRequestNotifiedIfNeeded comments on pull request created from namespace's branch that environment was removed,
+// so developers get feedback about it; failure to comment doesn't stop the pipeline
+func isPullRequestNotifiedIfNeeded(enabled bool) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if !enabled || !ns.IsGithubSource() {
+			return true
+		}
+
+		logger := ns.logger()
+
+		owner, repo, branch, err := ns.GithubBranch()
+		if err != nil {
+			logger.Error(err)
+			return true
+		}
+
+		pr, err := ghClient.FindPullRequest(owner, repo, branch)
+		if err != nil {
+			logger.Error(err)
+			return true
+		}
+		if pr == nil {
+			logger.Debug("No pull request found for branch " + branch)
+			return true
+		}
+
+		body := fmt.Sprintf("Preview environment `%s` was removed at %s because branch `%s` was deleted.",
+			ns.Name(), time.Now().UTC().Format(time.RFC1123), branch)
+		if err := ghClient.CreateIssueComment(owner, repo, pr.Number, body); err != nil {
+			logger.Error(err)
+			return true
+		}
+
+		logger.WithField("url", pr.HTMLURL).Info("Commented on pull request")
+		return true
+	}
+}
+
+// context of commit status published by the app
+const commitStatusContext = "buhtig-s8k/teardown"
+
+// publishedCommitStatuses remembers last status published for namespace to avoid publishing the same failure every iteration;
+// entry is removed once namespace is deleted
+var publishedCommitStatuses sync.Map
+
+// publishCommitStatus sets commit status on the last commit of namespace's branch; since the branch is deleted
+// the commit is found as head of pull request created from it
+func publishCommitStatus(ns *namespace, state, description string) {
+	logger := ns.logger()
+
+	if last, ok := publishedCommitStatuses.Load(ns.Name()); ok && last == state {
+		return
+	}
+
+	owner, repo, branch, err := ns.GithubBranch()
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	pr, err := ghClient.FindPullRequest(owner, repo, branch)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	if pr == nil || pr.Head.SHA == "" {
+		logger.Debug("No pull request found for branch " + branch + ", can't determine its last commit")
+		return
+	}
+
+	if err := ghClient.CreateCommitStatus(owner, repo, pr.Head.SHA, state, commitStatusContext, description); err != nil {
+		logger.Error(err)
+		return
+	}
+	publishedCommitStatuses.Store(ns.Name(), state)
+	logger.WithFields(log.Fields{"state": state, "sha": pr.Head.SHA}).Info("Published commit status")
+}
+
+// isCommitStatusPublishedIfNeeded publishes successful teardown as commit status
+func isCommitStatusPublishedIfNeeded(enabled bool) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if enabled && ns.IsGithubSource() {
+			publishCommitStatus(ns, "success", fmt.Sprintf("Environment %s is torn down", ns.Name()))
+		}
+		// namespace is deleted, so nothing is published for it anymore
+		publishedCommitStatuses.Delete(ns.Name())
+		return true
+	}
+}
+
+// withFailureCommitStatus wraps destructive step so that its failure is published as commit status and is counted
+// in summary and budget of iteration; step which is waiting (e.g. for Velero Backup) isn't a failure
+func withFailureCommitStatus(enabled bool, budget *deletionBudget, step string, predicate func(*namespace) stepResult) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		result := predicate(ns)
+		if result != stepFailed {
+			return result == stepDone
+		}
+		// failure of destructive step is counted even if commit statuses are disabled
+		countErrored(ns)
+		budget.fail()
+		if enabled && ns.IsGithubSource() {
+			publishCommitStatus(ns, "failure", fmt.Sprintf("Teardown of %s failed at step '%s'", ns.Name(), step))
+		}
+		return false
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	observability "github.com/OpusCapita/buhtig-s8k/pkg/observability"
+)
+
+// observabilityCleaner is configured cleaner with template of object names it deletes
+type observabilityCleaner struct {
+	observability.Cleaner
+	nameTemplate string
+}
+
+// newObservabilityCleaners builds cleaners from config; it exits on misconfiguration
+func newObservabilityCleaners(targets []observabilityTarget) []observabilityCleaner {
+	cleaners := []observabilityCleaner{}
+	for _, target := range targets {
+		var cleaner observability.Cleaner
+		switch target.Type {
+		case "grafana":
+			cleaner = &observability.Grafana{URL: target.URL, Token: os.Getenv(target.TokenEnv)}
+		case "datadog":
+			cleaner = &observability.Datadog{Site: target.Site, APIKey: os.Getenv(target.APIKeyEnv), AppKey: os.Getenv(target.AppKeyEnv)}
+		case "newrelic":
+			cleaner = &observability.NewRelic{URL: target.URL, APIKey: os.Getenv(target.TokenEnv)}
+		default:
+			log.Fatal(fmt.Sprintf("Unknown observability target type '%s'", target.Type))
+		}
+
+		nameTemplate := target.NameTemplate
+		if nameTemplate == "" {
+			nameTemplate = "{{.Namespace}}"
+		}
+		cleaners = append(cleaners, observabilityCleaner{Cleaner: cleaner, nameTemplate: nameTemplate})
+	}
+	return cleaners
+}
+
+// isObservabilityCleanedIfNeeded deletes dashboards, monitors and synthetic checks named after removed environment
+// from configured observability tools; failures are logged but don't stop the pipeline
+func isObservabilityCleanedIfNeeded(cleaners []observabilityCleaner) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		logger := ns.logger()
+		data := newTemplateData(ns)
+
+		for _, cleaner := range cleaners {
+			name, err := renderTemplate(cleaner.nameTemplate, data)
+			if err != nil {
+				logger.Error(err)
+				continue
+			}
+
+			deleted, err := cleaner.Cleanup(name)
+			if err != nil {
+				logger.WithFields(log.Fields{"name": name, "target": cleaner.Name()}).Error("Failed to clean up observability objects")
+				logger.Error(err)
+			}
+			if deleted > 0 {
+				logger.WithFields(log.Fields{"name": name, "target": cleaner.Name(), "deleted": deleted}).Info("Deleted observability objects")
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/OpusCapita/buhtig-s8k/pkg/opa"
+)
+
+// policyInput is everything known about deletion candidate which custom policies can base their decisions on
+type policyInput struct {
+	Namespace corev1.Namespace  `json:"namespace"`
+	Branch    policyBranchInput `json:"branch"`
+	Time      policyTimeInput   `json:"time"`
+}
+
+// policyBranchInput is result of branch check
+type policyBranchInput struct {
+	Owner  string `json:"owner"`
+	Repo   string `json:"repo"`
+	Name   string `json:"name"`
+	Status int    `json:"status"`
+	// RepoStatus is 0 if repository wasn't checked, it's only checked when branch is missing
+	RepoStatus   int `json:"repoStatus"`
+	MissingCount int `json:"missingCount"`
+}
+
+// policyTimeInput is timing data of namespace, durations are in seconds
+type policyTimeInput struct {
+	Now         time.Time  `json:"now"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	AgeSeconds  int64      `json:"ageSeconds"`
+	DeleteAfter *time.Time `json:"deleteAfter,omitempty"`
+}
+
+// newPolicyInput collects input of custom policies, result of branch check is taken from cache of the iteration
+func newPolicyInput(ns *namespace, cache *branchCache, now time.Time) policyInput {
+	input := policyInput{Namespace: corev1.Namespace(*ns)}
+
+	data := newTemplateData(ns)
+	input.Branch = policyBranchInput{Owner: data.Owner, Repo: data.Repo, Name: data.Branch, MissingCount: ns.BranchMissingCount()}
+	if sourceURL, err := ns.GithubSourceURL(); err == nil {
+		input.Branch.Status, input.Branch.RepoStatus, _ = cache.cached(branchCacheKey(ns, sourceURL))
+	}
+
+	createdAt := ns.ObjectMeta.CreationTimestamp.Time
+	input.Time = policyTimeInput{Now: now, CreatedAt: createdAt, AgeSeconds: int64(now.Sub(createdAt) / time.Second)}
+	if deleteAfter := ns.DeleteAfter(); !deleteAfter.IsZero() {
+		input.Time.DeleteAfter = &deleteAfter
+	}
+	return input
+}
+
+// opaSettings configure policy gate evaluated by Open Policy Agent
+type opaSettings struct {
+	// client is nil if OPA isn't configured
+	client *opa.Client
+	// path of policy document, e.g. "buhtig_s8k/deletion"
+	path string
+}
+
+// isAllowedByPolicyIfNeeded evaluates Rego policy of operators in OPA and lets namespace proceed to deletion only if
+// policy allows it. Failed or undefined evaluation leaves namespace alone until the next iteration. Policy isn't
+// evaluated once teardown has started.
+func isAllowedByPolicyIfNeeded(settings opaSettings, cache *branchCache) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if settings.client == nil || len(ns.CompletedSteps()) > 0 {
+			return true
+		}
+		logger := ns.logger()
+
+		decision, err := settings.client.Decide(settings.path, newPolicyInput(ns, cache, time.Now()))
+		if err != nil {
+			logger.WithError(err).Error("Policy evaluation failed, deletion is postponed")
+			return false
+		}
+		if decision == nil {
+			logger.WithField("policy", settings.path).Warn("Policy is undefined, deletion is postponed")
+			return false
+		}
+		if !decision.Allow {
+			logger.Info("Deletion is denied by policy: " + decision.Reason)
+			auditAction(ns, "policy", nil, map[string]string{"decision": "denied", "reason": decision.Reason})
+			skipNamespace(ns, skipReasonPolicy, "deletion is denied by policy: "+decision.Reason)
+			return false
+		}
+		logger.Debug("Deletion is allowed by policy")
+		return true
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/OpusCapita/buhtig-s8k/pkg/otlp"
+)
+
+// values of OTEL_METRICS_EXPORTER
+const (
+	metricsExporterNone = "none"
+	metricsExporterOTLP = "otlp"
+)
+
+// meter pushes metrics of the app to OTLP receiver; it's nil if export of metrics is disabled
+var meter *otlp.Meter
+
+// startMetricsExport pushes metrics every export interval if export of metrics is enabled; Prometheus endpoint
+// keeps serving them anyway
+func startMetricsExport(settings otlpSettings) {
+	if settings.metricsExporter != metricsExporterOTLP {
+		return
+	}
+	meter = otlp.NewMeter(otlp.NewExporter(settings.endpoint, settings.serviceName, settings.headers), "buhtig-s8k", prometheus.DefaultGatherer)
+	log.Info(fmt.Sprintf("Metrics are exported to %s every %v", settings.endpoint, settings.metricsInterval))
+
+	go func() {
+		for range time.Tick(settings.metricsInterval) {
+			exportMetrics()
+		}
+	}()
+}
+
+// exportMetrics pushes current values of metrics if export of metrics is enabled
+func exportMetrics() {
+	if meter == nil {
+		return
+	}
+	if err := meter.Export(); err != nil {
+		log.Error("Failed to export metrics")
+		log.Error(err)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// pauseState toggles destructive actions at runtime; it's safe for concurrent use
+type pauseState struct {
+	mu     sync.RWMutex
+	paused bool
+	since  time.Time
+}
+
+// destructionPause is toggled by admin endpoints and signals
+var destructionPause = &pauseState{}
+
+var pausedGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Name:      "paused",
+	Help:      "1 if destructive actions are paused, 0 otherwise.",
+})
+
+func init() {
+	prometheus.MustRegister(pausedGauge)
+}
+
+// set pauses or resumes destructive actions, it's no-op if state doesn't change
+func (p *pauseState) set(paused bool, source string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paused == paused {
+		return
+	}
+	p.paused = paused
+	p.since = time.Now()
+	if paused {
+		pausedGauge.Set(1)
+		log.Warn("Destructive actions are paused by " + source)
+	} else {
+		pausedGauge.Set(0)
+		log.Info("Destructive actions are resumed by " + source)
+	}
+}
+
+// get returns whether destructive actions are paused and since when
+func (p *pauseState) get() (bool, time.Time) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.paused, p.since
+}
+
+// registerPauseHandlers exposes 'POST /pause', 'POST /resume' (both require admin token) and 'GET /status' on admin
+// listener
+// and makes SIGUSR1 pause and SIGUSR2 resume destructive actions
+func registerPauseHandlers() {
+	adminMux.HandleFunc("/pause", servePause(true))
+	adminMux.HandleFunc("/resume", servePause(false))
+	adminMux.HandleFunc("/status", serveStatus)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range signals {
+			destructionPause.set(sig == syscall.SIGUSR1, "signal "+sig.String())
+		}
+	}()
+}
+
+// servePause pauses or resumes destructive actions on behalf of holder of admin token
+func servePause(paused bool) http.HandlerFunc {
+	return requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		caller, _ := adminCaller(r)
+		destructionPause.set(paused, "admin endpoint "+r.URL.Path+" called by "+caller)
+		serveStatus(w, r)
+	})
+}
+
+// serveStatus responds with JSON describing runtime state of the app
+func serveStatus(w http.ResponseWriter, r *http.Request) {
+	paused, since := destructionPause.get()
+	status := map[string]interface{}{"paused": paused}
+	if !since.IsZero() {
+		status["pausedChangedAt"] = since.UTC().Format(time.RFC3339)
+	}
+	if summary := lastIterationSummary(); summary != nil {
+		status["lastIteration"] = summary
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// isNotPaused stops namespaces before destructive steps while destructive actions are paused;
+// teardown which is already running isn't interrupted
+func isNotPaused(p *pauseState) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if paused, _ := p.get(); paused {
+			ns.logger().Info("Namespace is going to be deleted, but destructive actions are paused, deletion is deferred")
+			skipNamespace(ns, skipReasonPaused, "destructive actions are paused")
+			return false
+		}
+		return true
+	}
+}
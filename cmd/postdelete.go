@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultPostDeleteTemplate renders namespace metadata with timing details
+const defaultPostDeleteTemplate = `{"event": "deleted", "namespace": {{json .Namespace}}, "owner": {{json .Owner}}, "repo": {{json .Repo}}, ` +
+	`"branch": {{json .Branch}}, "helmRelease": {{json .HelmRelease}}, "createdAt": {{json .CreatedAt}}, ` +
+	`"startedAt": {{json .StartedAt}}, "finishedAt": {{json .FinishedAt}}, "durationSeconds": {{.DurationSeconds}}}`
+
+// postDeleteData is data available in templates of post-delete webhooks
+type postDeleteData struct {
+	templateData
+	CreatedAt time.Time
+	// StartedAt is when namespace entered the pipeline in the iteration it was deleted
+	StartedAt       time.Time
+	FinishedAt      time.Time
+	DurationSeconds float64
+}
+
+// postDeleteHook is configured post-delete webhook
+type postDeleteHook struct {
+	url      string
+	secret   string
+	template string
+}
+
+// newPostDeleteHooks builds webhooks from config; it exits on misconfiguration
+func newPostDeleteHooks(targets []postDeleteWebhookTarget) []postDeleteHook {
+	hooks := []postDeleteHook{}
+	for _, target := range targets {
+		if target.URL == "" {
+			log.Fatal("URL of post-delete webhook is required")
+		}
+		hook := postDeleteHook{url: target.URL, template: target.Template}
+		if target.SecretEnv != "" {
+			hook.secret = os.Getenv(target.SecretEnv)
+		}
+		if hook.template == "" {
+			hook.template = defaultPostDeleteTemplate
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks
+}
+
+// isPostDeleteWebhookSentIfNeeded POSTs JSON payload about deleted environment to configured webhooks, so that
+// downstream systems can react without scraping logs; failures are logged but don't stop the pipeline
+func isPostDeleteWebhookSentIfNeeded(hooks []postDeleteHook) func(*namespace) bool {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	return func(ns *namespace) bool {
+		if len(hooks) == 0 {
+			return true
+		}
+		logger := ns.logger()
+
+		data := postDeleteData{
+			templateData: newTemplateData(ns),
+			CreatedAt:    ns.ObjectMeta.CreationTimestamp.Time,
+			FinishedAt:   time.Now(),
+		}
+		data.StartedAt = data.FinishedAt
+		if startedAt, ok := processingStartedAt.Load(ns.Name()); ok {
+			data.StartedAt = startedAt.(time.Time)
+		}
+		data.DurationSeconds = data.FinishedAt.Sub(data.StartedAt).Seconds()
+
+		for _, hook := range hooks {
+			body, err := renderTemplate(hook.template, data)
+			if err != nil {
+				logger.WithField("url", hook.url).WithError(err).Error("Failed to render post-delete webhook payload")
+				continue
+			}
+			if !json.Valid([]byte(body)) {
+				logger.WithFields(log.Fields{"url": hook.url, "payload": string(body)}).Error("Payload of post-delete webhook isn't valid JSON")
+				continue
+			}
+
+			status, reason, err := postWebhook(httpClient, hook.url, "deleted", []byte(hook.secret), []byte(body))
+			if err == nil && (status < 200 || status > 299) {
+				err = fmt.Errorf("responded with status %d: %s", status, reason)
+			}
+			if err != nil {
+				logger.WithField("url", hook.url).WithError(err).Error("Post-delete webhook failed")
+				continue
+			}
+			logger.WithFields(log.Fields{"url": hook.url, "status": status}).Debug("Post-delete webhook responded")
+		}
+		return true
+	}
+}
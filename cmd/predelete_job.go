@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// preDeleteJobKey is the key of ConfigMap holding Job template
+	preDeleteJobKey = "job.yaml"
+	// preDeleteJobName is used if template doesn't name the Job
+	preDeleteJobName = componentName + "-pre-delete"
+)
+
+// jobPollDelay is how often Job status is checked
+var jobPollDelay = 2 * time.Second
+
+// preDeleteJobSettings configure Job run before environment is deleted
+type preDeleteJobSettings struct {
+	// configMap is the default reference to ConfigMap with Job template as NAMESPACE/NAME or NAME,
+	// it's overridden by namespace annotation; empty means there's no Job by default
+	configMap string
+	// namespace of ConfigMaps referenced by name only
+	namespace string
+	timeout   time.Duration
+}
+
+// preDeleteJobConfigMap returns namespace and name of ConfigMap with Job template of namespace, name is empty if there's none
+func preDeleteJobConfigMap(ns *namespace, settings preDeleteJobSettings) (string, string) {
+	ref := settings.configMap
+	if val, ok := ns.ObjectMeta.Annotations[preDeleteJobAnnotationName]; ok {
+		ref = strings.TrimSpace(val)
+	}
+	if parts := strings.SplitN(ref, "/", 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return settings.namespace, ref
+}
+
+// renderPreDeleteJob renders Job template with data of namespace; Job is always created in the namespace
+func renderPreDeleteJob(text string, ns *namespace) (*batchv1.Job, error) {
+	rendered, err := renderTemplate(text, newTemplateData(ns))
+	if err != nil {
+		return nil, err
+	}
+	job := &batchv1.Job{}
+	if err := yaml.Unmarshal([]byte(rendered), job); err != nil {
+		return nil, fmt.Errorf("Failed to parse Job template: %v", err)
+	}
+	job.Namespace = ns.Name()
+	if job.Name == "" {
+		job.Name = preDeleteJobName
+	}
+	if job.Labels == nil {
+		job.Labels = map[string]string{}
+	}
+	job.Labels[managedByLabel] = componentName
+	return job, nil
+}
+
+// jobResult returns true when Job completed, false when it's still running and error when it failed
+func jobResult(job *batchv1.Job) (bool, error) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return true, nil
+		case batchv1.JobFailed:
+			return false, fmt.Errorf("Job %s failed: %s", job.Name, c.Message)
+		}
+	}
+	return false, nil
+}
+
+// isPreDeleteJobCompletedIfNeeded runs Job from template referenced by 'opuscapita.com/pre-delete-job' annotation
+// (or PRE_DELETE_JOB_CONFIGMAP) in the namespace and waits for it to complete before anything is deleted,
+// e.g. to dump database or to de-register environment from service catalog.
+func isPreDeleteJobCompletedIfNeeded(k8sClient kubernetes.Interface, settings preDeleteJobSettings) func(*namespace) stepResult {
+	return func(ns *namespace) stepResult {
+		cmNamespace, cmName := preDeleteJobConfigMap(ns, settings)
+		if cmName == "" {
+			return stepDone
+		}
+		logger := ns.logger()
+
+		cm, err := k8sClient.CoreV1().ConfigMaps(cmNamespace).Get(cmName, metav1.GetOptions{})
+		if err != nil {
+			logger.WithField("configmap", cmNamespace+"/"+cmName).WithError(err).Error("Failed to read Job template from ConfigMap")
+			return stepFailed
+		}
+		template, ok := cm.Data[preDeleteJobKey]
+		if !ok {
+			logger.WithFields(log.Fields{"configmap": cmNamespace + "/" + cmName, "key": preDeleteJobKey}).Error("ConfigMap doesn't have Job template key")
+			return stepFailed
+		}
+		job, err := renderPreDeleteJob(template, ns)
+		if err != nil {
+			logger.Error(err)
+			return stepFailed
+		}
+
+		return runJob(k8sClient, ns, job, settings.timeout, "pre-delete Job", cmNamespace+"/"+cmName)
+	}
+}
+
+// runJob creates Job unless it exists and waits for it to complete. Job which is still running after timeout
+// is waited for on the next call; failed Job is deleted, so that it's created again on the next call, and
+// completed Job is deleted too, so that it isn't mistaken for the result of a later run.
+// Description is used in logs and source (e.g. template) in audit trail.
+func runJob(k8sClient kubernetes.Interface, ns *namespace, job *batchv1.Job, timeout time.Duration, description, source string) stepResult {
+	logger := ns.logger()
+	jobs := k8sClient.BatchV1().Jobs(job.Namespace)
+
+	existing, err := jobs.Get(job.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		existing, err = jobs.Create(job)
+		auditAction(ns, "create-job", err, map[string]string{"job": job.Namespace + "/" + job.Name, "source": source})
+		if err == nil {
+			logger.WithField("job", job.Namespace+"/"+job.Name).Info("Created " + description)
+		}
+	}
+	if err != nil {
+		logger.WithField("job", job.Namespace+"/"+job.Name).WithError(err).Error("Failed to run " + description)
+		return stepFailed
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		done, err := jobResult(existing)
+		if err != nil {
+			logger.WithField("job", job.Name).WithError(err).Error(description + " failed")
+			propagation := metav1.DeletePropagationBackground
+			if err := jobs.Delete(job.Name, &metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil && !errors.IsNotFound(err) {
+				logger.WithField("job", job.Name).WithError(err).Error("Failed to delete failed " + description)
+			}
+			return stepFailed
+		}
+		if done {
+			logger.WithField("job", job.Name).Info(description + " completed")
+			propagation := metav1.DeletePropagationBackground
+			if err := jobs.Delete(job.Name, &metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil && !errors.IsNotFound(err) {
+				logger.WithField("job", job.Name).WithError(err).Warn("Failed to delete completed " + description)
+			}
+			return stepDone
+		}
+		if time.Now().After(deadline) {
+			logger.WithFields(log.Fields{"job": job.Name, "timeout": timeout.String()}).Warn(description + " didn't complete in time, will wait on next iteration")
+			return stepWaiting
+		}
+		time.Sleep(jobPollDelay)
+		if existing, err = jobs.Get(job.Name, metav1.GetOptions{}); err != nil {
+			logger.WithField("job", job.Name).WithError(err).Error("Failed to get " + description)
+			return stepFailed
+		}
+	}
+}
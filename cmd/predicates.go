@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	log "github.com/sirupsen/logrus"
+)
+
+// predicate is compiled CEL expression from config file
+type predicate struct {
+	name       string
+	expression string
+	program    cel.Program
+}
+
+// predicateEnv declares variables of expressions: 'ns' is namespace object, 'branch' and 'time' are the same
+// as in input of OPA policies
+func predicateEnv() (*cel.Env, error) {
+	object := decls.NewMapType(decls.String, decls.Dyn)
+	return cel.NewEnv(cel.Declarations(
+		decls.NewIdent("ns", object, nil),
+		decls.NewIdent("branch", object, nil),
+		decls.NewIdent("time", object, nil),
+	))
+}
+
+// compilePredicate parses and type-checks expression, which has to evaluate to bool
+func compilePredicate(env *cel.Env, expression string) (cel.Program, error) {
+	checked, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	// fields of variables are dynamic, so their type is only known at evaluation time
+	if !proto.Equal(checked.ResultType(), decls.Bool) && !proto.Equal(checked.ResultType(), decls.Dyn) {
+		return nil, fmt.Errorf("expression evaluates to %v, not bool", checked.ResultType())
+	}
+	return env.Program(checked)
+}
+
+// newPredicates compiles predicates from config; it exits on misconfiguration
+func newPredicates(targets []predicateTarget) []predicate {
+	env, err := predicateEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	predicates := []predicate{}
+	for i, target := range targets {
+		name := target.Name
+		if name == "" {
+			name = fmt.Sprintf("predicate #%d", i+1)
+		}
+		program, err := compilePredicate(env, target.Expression)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Failed to compile expression of %s: %v", name, err))
+		}
+		predicates = append(predicates, predicate{name: name, expression: target.Expression, program: program})
+	}
+	return predicates
+}
+
+// eval evaluates predicate with variables returned by predicateVars
+func (p predicate) eval(vars map[string]interface{}) (bool, error) {
+	value, _, err := p.program.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	matched, ok := value.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression evaluated to %v, not bool", value.Value())
+	}
+	return matched, nil
+}
+
+// predicateVars returns variables of expressions; input is marshaled to JSON, so that fields are named by their
+// JSON tags, and integral numbers become int, others double
+func predicateVars(input policyInput) (map[string]interface{}, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	fields := map[string]interface{}{}
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"ns":     convertNumbers(fields["namespace"]),
+		"branch": convertNumbers(fields["branch"]),
+		"time":   convertNumbers(fields["time"]),
+	}, nil
+}
+
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = convertNumbers(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = convertNumbers(v[k])
+		}
+	}
+	return v
+}
+
+// isMatchingPredicates lets namespace proceed to deletion only if all CEL expressions from 'predicates' of config file
+// evaluate to true. Expression which fails or doesn't evaluate to bool leaves namespace alone. Predicates aren't
+// evaluated once teardown has started.
+func isMatchingPredicates(predicates []predicate, cache *branchCache) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if len(predicates) == 0 || len(ns.CompletedSteps()) > 0 {
+			return true
+		}
+		logger := ns.logger()
+
+		vars, err := predicateVars(newPolicyInput(ns, cache, time.Now()))
+		if err != nil {
+			logger.Error(err)
+			return false
+		}
+
+		for _, p := range predicates {
+			matched, err := p.eval(vars)
+			if err != nil {
+				logger.WithField("predicate", p.name).WithError(err).Error("Failed to evaluate predicate, deletion is postponed")
+				return false
+			}
+			if !matched {
+				logger.WithFields(log.Fields{"predicate": p.name, "expression": p.expression}).Info("Namespace doesn't match predicate, deletion is skipped")
+				auditAction(ns, "predicate", nil, map[string]string{"decision": "skipped", "predicate": p.name})
+				skipNamespace(ns, skipReasonPredicate, fmt.Sprintf("namespace doesn't match %s", p.name))
+				return false
+			}
+		}
+		return true
+	}
+}
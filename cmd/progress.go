@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// names of destructive steps whose completion is persisted in namespace annotation
+const (
+	stepQuarantine       = "quarantine"
+	stepBackup           = "backup"
+	stepArchive          = "archive"
+	stepPreDeleteJob     = "pre-delete-job"
+	stepWorkflow         = "workflow"
+	stepJenkins          = "jenkins"
+	stepDatabase         = "database"
+	stepFlux             = "flux"
+	stepHelmRelease      = "helm-release"
+	stepExtraResources   = "extra-resources"
+	stepClusterResources = "cluster-resources"
+	stepDNS              = "dns"
+	stepLoadBalancers    = "load-balancers"
+	stepTerraform        = "terraform"
+	stepNamespace        = "namespace"
+)
+
+// stepResult is outcome of destructive step
+type stepResult int
+
+const (
+	// stepDone means step is completed (or isn't needed), so the next step can start
+	stepDone stepResult = iota
+	// stepWaiting means step is in progress (e.g. Velero Backup is running), it's checked again on the next iteration
+	stepWaiting
+	// stepFailed means step failed, it's retried on the next iteration
+	stepFailed
+)
+
+// stepResultOf adapts step which can't wait: its false is failure
+func stepResultOf(predicate func(*namespace) bool) func(*namespace) stepResult {
+	return func(ns *namespace) stepResult {
+		if predicate(ns) {
+			return stepDone
+		}
+		return stepFailed
+	}
+}
+
+// processingStartedAt holds time when namespace entered the pipeline in current iteration
+var processingStartedAt sync.Map
+
+// CompletedSteps returns destructive steps already done for namespace in previous attempts
+func (ns *namespace) CompletedSteps() []string {
+	val := ns.ObjectMeta.Annotations[completedStepsAnnotationName]
+	if val == "" {
+		return nil
+	}
+	return strings.Split(val, ",")
+}
+
+// isStepCompleted checks if step is already done for namespace
+func (ns *namespace) isStepCompleted(step string) bool {
+	for _, s := range ns.CompletedSteps() {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// markStepCompleted persists completion of step in namespace annotation
+func (ns *namespace) markStepCompleted(k8sClient kubernetes.Interface, step string) error {
+	if ns.isStepCompleted(step) {
+		return nil
+	}
+	steps := strings.Join(append(ns.CompletedSteps(), step), ",")
+	return ns.patchAnnotations(k8sClient, map[string]*string{completedStepsAnnotationName: &steps})
+}
+
+// stepRun is destructive step run for namespace; step abandoned at deadline outlives its iteration
+type stepRun struct {
+	step    string
+	persist bool
+
+	mu        sync.Mutex
+	abandoned bool
+	finished  bool
+	result    stepResult
+}
+
+// stepsInFlight holds *stepRun of namespaces by namespace name, so that step abandoned at deadline isn't started
+// again (and steps after it aren't started) while it's still running
+var stepsInFlight sync.Map
+
+// resumeAbandonedStep returns false if step abandoned at deadline in previous attempt is still running. Finished
+// step is forgotten and its completion is persisted on ns, which is fresh copy of namespace unlike the one the step
+// was started with.
+func resumeAbandonedStep(k8sClient kubernetes.Interface, ns *namespace) bool {
+	val, ok := stepsInFlight.Load(ns.Name())
+	if !ok {
+		return true
+	}
+	run := val.(*stepRun)
+	run.mu.Lock()
+	finished, result := run.finished, run.result
+	run.mu.Unlock()
+
+	logger := ns.logger().WithField("step", run.step)
+	if !finished {
+		logger.Info("Step abandoned at deadline is still running, will resume on next iteration")
+		return false
+	}
+	if result == stepDone && run.persist {
+		if err := ns.markStepCompleted(k8sClient, run.step); err != nil {
+			logger.Error(err)
+			return false
+		}
+	}
+	stepsInFlight.Delete(ns.Name())
+	return true
+}
+
+// withDeadline wraps destructive pipeline step so that:
+// - step which was completed in previous attempt isn't run again,
+// - step isn't started (or waited for) after namespace's processing deadline,
+// - step completion is persisted (unless persist is false, e.g. for the step which deletes namespace itself)
+// so that next iteration resumes from the failed step. Step can't be cancelled, so step exceeding deadline is left
+// running and no step of namespace is started until it finishes (see resumeAbandonedStep).
+func withDeadline(k8sClient kubernetes.Interface, step string, deadline time.Duration, persist bool, predicate func(*namespace) stepResult) func(*namespace) stepResult {
+	return func(ns *namespace) stepResult {
+		logger := ns.logger()
+
+		if !resumeAbandonedStep(k8sClient, ns) {
+			return stepWaiting
+		}
+
+		if ns.isStepCompleted(step) {
+			logger.WithField("step", step).Info("Step was completed in previous attempt, skipping")
+			return stepDone
+		}
+
+		remaining := deadline
+		if startedAt, ok := processingStartedAt.Load(ns.Name()); ok && deadline > 0 {
+			remaining = deadline - time.Since(startedAt.(time.Time))
+		}
+		if deadline > 0 && remaining <= 0 {
+			logger.WithFields(log.Fields{"step": step, "deadline": deadline.String()}).Warn("Processing deadline exceeded before step, will resume on next iteration")
+			return stepWaiting
+		}
+
+		run := &stepRun{step: step, persist: persist}
+		stepsInFlight.Store(ns.Name(), run)
+		span := startSpan(ns, "step "+step)
+		setStage(ns, step)
+
+		done := make(chan stepResult, 1)
+		go func() {
+			result := predicate(ns)
+
+			run.mu.Lock()
+			run.finished, run.result = true, result
+			abandoned := run.abandoned
+			run.mu.Unlock()
+			if abandoned {
+				// ns belongs to iteration which is over, completion is persisted by the next attempt
+				return
+			}
+
+			setStage(ns, "")
+			if result == stepDone {
+				endSpan(ns, span, nil)
+			} else {
+				endSpan(ns, span, fmt.Errorf("step '%s' isn't completed", step))
+			}
+			if result == stepDone && persist {
+				if err := ns.markStepCompleted(k8sClient, step); err != nil {
+					logger.Error(err)
+				}
+			}
+			stepsInFlight.Delete(ns.Name())
+			done <- result
+		}()
+
+		if deadline <= 0 {
+			return <-done
+		}
+
+		select {
+		case result := <-done:
+			return result
+		case <-time.After(remaining):
+			run.mu.Lock()
+			if run.finished {
+				// step finished just now, it's persisted as usual
+				run.mu.Unlock()
+				return <-done
+			}
+			run.abandoned = true
+			run.mu.Unlock()
+
+			setStage(ns, "")
+			endSpan(ns, span, fmt.Errorf("processing deadline exceeded during step '%s'", step))
+			logger.WithFields(log.Fields{"step": step, "deadline": deadline.String()}).Warn("Processing deadline exceeded during step, will resume on next iteration after step finishes")
+			return stepWaiting
+		}
+	}
+}
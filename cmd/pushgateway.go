@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	log "github.com/sirupsen/logrus"
+)
+
+// pushgatewaySettings configure pushing of metrics in RUN_ONCE mode, short-lived pod of CronJob can't be scraped reliably
+type pushgatewaySettings struct {
+	// url of Pushgateway, empty value disables pushing
+	url string
+	// job is value of "job" label of pushed metrics, metrics of previous run with the same job are replaced
+	job string
+}
+
+var iterationCompletedGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Name:      "last_iteration_completed_timestamp_seconds",
+	Help:      "Unix time when the last iteration was completed.",
+})
+
+func init() {
+	prometheus.MustRegister(iterationCompletedGauge)
+}
+
+// pushMetrics pushes all metrics of the app to Pushgateway replacing ones pushed by the previous run
+func pushMetrics(settings pushgatewaySettings, gatherer prometheus.Gatherer) error {
+	if settings.url == "" {
+		return nil
+	}
+	return push.New(settings.url, settings.job).Gatherer(gatherer).Push()
+}
+
+// exitAfterRun pushes metrics (to Pushgateway, OTLP receiver and StatsD agent) and exits in RUN_ONCE mode, exit code
+// is non-zero if iteration has crashed
+func exitAfterRun(settings pushgatewaySettings, iterationErr error) {
+	exportMetrics()
+	emitStatsdMetrics()
+	if err := pushMetrics(settings, prometheus.DefaultGatherer); err != nil {
+		log.WithField("url", settings.url).Error("Failed to push metrics")
+		log.Error(err)
+	}
+	if iterationErr != nil {
+		os.Exit(1)
+	}
+	log.Info(fmt.Sprintf("Iteration is completed in %s mode, exiting", runOnceEnv))
+	os.Exit(0)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+
+	cleanup "github.com/OpusCapita/buhtig-s8k/pkg/cleanup"
+)
+
+// quarantineConfigMapName is ConfigMap in quarantined namespace holding manifests of removed Ingresses
+const quarantineConfigMapName = componentName + "-quarantine"
+
+// scaleToZero scales workload down and keeps its replicas in annotation, so that it can be scaled back up;
+// workload which is already scaled down is left alone
+func scaleToZero(k8sClient kubernetes.Interface, ns *namespace, kind, name string, replicas *int32) error {
+	count := int32(1)
+	if replicas != nil {
+		count = *replicas
+	}
+	if count == 0 {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]string{quarantineReplicasAnnotationName: strconv.Itoa(int(count))}},
+		"spec":     map[string]interface{}{"replicas": 0},
+	})
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case "Deployment":
+		_, err = k8sClient.AppsV1().Deployments(ns.Name()).Patch(name, types.MergePatchType, patch)
+	case "StatefulSet":
+		_, err = k8sClient.AppsV1().StatefulSets(ns.Name()).Patch(name, types.MergePatchType, patch)
+	}
+	auditAction(ns, "scale-to-zero", err, map[string]string{"object": kind + " " + ns.Name() + "/" + name, "replicas": strconv.Itoa(int(count))})
+	return err
+}
+
+// ingressManifest returns manifest of Ingress which can be applied to restore it
+func ingressManifest(obj *unstructured.Unstructured) (string, error) {
+	obj = obj.DeepCopy()
+	unstructured.RemoveNestedField(obj.Object, "status")
+	for _, field := range []string{"resourceVersion", "uid", "selfLink", "creationTimestamp", "generation"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	manifest, err := yaml.Marshal(obj.Object)
+	return string(manifest), err
+}
+
+// removeIngresses deletes Ingresses of namespace and keeps their manifests in ConfigMap of the namespace
+func removeIngresses(k8sClient kubernetes.Interface, deleter *cleanup.Deleter, ns *namespace) error {
+	ingresses, err := ingressObjects(deleter, ns.Name())
+	if err != nil || len(ingresses) == 0 {
+		return err
+	}
+
+	configMaps := k8sClient.CoreV1().ConfigMaps(ns.Name())
+	configMap, err := configMaps.Get(quarantineConfigMapName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Name:   quarantineConfigMapName,
+			Labels: map[string]string{managedByLabel: componentName},
+		}}
+		configMap, err = configMaps.Create(configMap)
+	}
+	if err != nil {
+		return err
+	}
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	for _, ingress := range ingresses {
+		obj, err := deleter.Get(ingress)
+		if err != nil {
+			return err
+		}
+		if obj == nil {
+			continue
+		}
+		if configMap.Data[ingress.Name+".yaml"], err = ingressManifest(obj); err != nil {
+			return err
+		}
+	}
+	// manifests are saved before anything is deleted
+	if _, err := configMaps.Update(configMap); err != nil {
+		return err
+	}
+
+	for _, ingress := range ingresses {
+		_, err := deleter.Delete(ingress)
+		auditAction(ns, "delete-ingress", err, map[string]string{"object": ingress.String()})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quarantine scales Deployments and StatefulSets of namespace to zero and removes its Ingresses
+func quarantine(k8sClient kubernetes.Interface, deleter *cleanup.Deleter, ns *namespace) error {
+	deployments, err := k8sClient.AppsV1().Deployments(ns.Name()).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, d := range deployments.Items {
+		if err := scaleToZero(k8sClient, ns, "Deployment", d.Name, d.Spec.Replicas); err != nil {
+			return err
+		}
+	}
+	statefulSets, err := k8sClient.AppsV1().StatefulSets(ns.Name()).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, s := range statefulSets.Items {
+		if err := scaleToZero(k8sClient, ns, "StatefulSet", s.Name, s.Spec.Replicas); err != nil {
+			return err
+		}
+	}
+	return removeIngresses(k8sClient, deleter, ns)
+}
+
+// QuarantinedUntil returns time until which namespace is kept in quarantine, it's zero if namespace isn't quarantined
+func (ns *namespace) QuarantinedUntil() time.Time {
+	until, err := time.Parse(time.RFC3339, ns.ObjectMeta.Annotations[quarantinedUntilAnnotationName])
+	if err != nil {
+		return time.Time{}
+	}
+	return until
+}
+
+// isQuarantinedIfNeeded puts namespace into quarantine before it's deleted: its workloads are scaled to zero and
+// Ingresses are removed for the period, so that wrongly targeted environment can be restored by scaling it back up;
+// namespace proceeds to teardown once quarantine is over
+func isQuarantinedIfNeeded(k8sClient kubernetes.Interface, deleter *cleanup.Deleter, period time.Duration) func(*namespace) stepResult {
+	return func(ns *namespace) stepResult {
+		if period <= 0 {
+			return stepDone
+		}
+		logger := ns.logger()
+
+		until := ns.QuarantinedUntil()
+		if until.IsZero() {
+			if err := quarantine(k8sClient, deleter, ns); err != nil {
+				logger.WithError(err).Error("Failed to quarantine namespace")
+				return stepFailed
+			}
+			untilStr := time.Now().Add(period).UTC().Format(time.RFC3339)
+			if err := ns.patchAnnotations(k8sClient, map[string]*string{quarantinedUntilAnnotationName: &untilStr}); err != nil {
+				logger.Error(err)
+				return stepFailed
+			}
+			logger.WithField("until", untilStr).Info("Namespace is quarantined: workloads are scaled to zero and Ingresses are removed")
+			return stepWaiting
+		}
+
+		if time.Now().Before(until) {
+			logger.WithField("until", until.UTC().Format(time.RFC3339)).Debug("Namespace is quarantined")
+			return stepWaiting
+		}
+		return stepDone
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	summaryIssueTitle = "Preview environments summary"
+	summaryIssueLabel = "buhtig-s8k"
+)
+
+// environmentReport is a line of summary about environment which needs attention
+type environmentReport struct {
+	namespace string
+	branch    string
+	state     string
+	details   string
+}
+
+// runSummaryReporter periodically opens (or updates) an issue in every repository referenced by tracked namespaces
+// summarizing environments which are stale, pending deletion or failed cleanup; issue is closed when there's nothing to report
+func runSummaryReporter(k8sClient kubernetes.Interface, interval, staleAge time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		for {
+			<-time.After(interval)
+			if err := reportSummary(k8sClient, staleAge); err != nil {
+				log.Error("Failed to report environments summary")
+				log.Error(err)
+			}
+		}
+	}()
+}
+
+func reportSummary(k8sClient kubernetes.Interface, staleAge time.Duration) error {
+	nsList, err := k8sClient.CoreV1().Namespaces().List(metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return err
+	}
+
+	// reports grouped by "OWNER/REPO"; repository is present even without reports so that its issue gets closed
+	reports := map[string][]environmentReport{}
+	for _, k8sNs := range nsList.Items {
+		ns := newNamespace(k8sNs)
+		owner, repo, branch, err := ns.GithubBranch()
+		if err != nil {
+			continue
+		}
+		key := owner + "/" + repo
+		if report, ok := summarizeNamespace(ns, branch, staleAge); ok {
+			reports[key] = append(reports[key], report)
+		} else if _, ok := reports[key]; !ok {
+			reports[key] = nil
+		}
+	}
+
+	for key, repoReports := range reports {
+		parts := strings.SplitN(key, "/", 2)
+		if err := publishSummary(parts[0], parts[1], repoReports); err != nil {
+			log.WithField("target", key).Error("Failed to publish summary")
+			log.Error(err)
+		}
+	}
+	return nil
+}
+
+// summarizeNamespace returns report about namespace if it needs attention
+func summarizeNamespace(ns *namespace, branch string, staleAge time.Duration) (environmentReport, bool) {
+	report := environmentReport{namespace: ns.Name(), branch: branch}
+	switch {
+	case ns.Status.Phase == corev1.NamespaceTerminating:
+		report.state = "failed cleanup"
+		report.details = fmt.Sprintf("namespace is terminating since %s, blocked by finalizers: %s", ns.DeletionTimestamp.UTC().Format(time.RFC3339), strings.Join(ns.Finalizers(), ", "))
+	case len(ns.CompletedSteps()) > 0:
+		report.state = "failed cleanup"
+		report.details = fmt.Sprintf("cleanup is partially done: %v", ns.CompletedSteps())
+	case !ns.PendingApprovalSince().IsZero():
+		report.state = "pending approval"
+		report.details = fmt.Sprintf("deletion waits for approval since %s", ns.PendingApprovalSince().UTC().Format(time.RFC3339))
+	case !ns.DeleteAfter().IsZero():
+		report.state = "pending deletion"
+		report.details = fmt.Sprintf("namespace is marked for deletion after %s", ns.DeleteAfter().UTC().Format(time.RFC3339))
+	case ns.BranchMissingCount() > 0:
+		report.state = "pending deletion"
+		report.details = fmt.Sprintf("branch is missing on %d consecutive checks", ns.BranchMissingCount())
+	case staleAge > 0 && time.Since(ns.CreationTimestamp.Time) > staleAge:
+		report.state = "stale"
+		report.details = fmt.Sprintf("created %d days ago", int(time.Since(ns.CreationTimestamp.Time).Hours()/24))
+	default:
+		return report, false
+	}
+	return report, true
+}
+
+// publishSummary creates or updates summary issue of repository, or closes it if there're no reports
+func publishSummary(owner, repo string, reports []environmentReport) error {
+	issues, err := ghClient.ListOpenIssues(owner, repo, summaryIssueLabel)
+	if err != nil {
+		return err
+	}
+	number := 0
+	for _, issue := range issues {
+		if issue.Title == summaryIssueTitle {
+			number = issue.Number
+			break
+		}
+	}
+
+	if len(reports) == 0 {
+		if number == 0 {
+			return nil
+		}
+		return ghClient.UpdateIssue(owner, repo, number, map[string]string{
+			"body":  "All preview environments are fine.",
+			"state": "closed",
+		})
+	}
+
+	body := renderSummary(reports)
+	if number == 0 {
+		issue, err := ghClient.CreateIssue(owner, repo, summaryIssueTitle, body, summaryIssueLabel)
+		if err != nil {
+			return err
+		}
+		log.WithField("url", issue.HTMLURL).Info("Opened environments summary")
+		return nil
+	}
+	return ghClient.UpdateIssue(owner, repo, number, map[string]string{"body": body})
+}
+
+// renderSummary renders reports as Markdown table
+func renderSummary(reports []environmentReport) string {
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].state != reports[j].state {
+			return reports[i].state < reports[j].state
+		}
+		return reports[i].namespace < reports[j].namespace
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Preview environments which need attention (updated %s):\n\n", time.Now().UTC().Format(time.RFC1123))
+	buf.WriteString("| Namespace | Branch | State | Details |\n|---|---|---|---|\n")
+	for _, r := range reports {
+		fmt.Fprintf(&buf, "| `%s` | `%s` | %s | %s |\n", r.namespace, r.branch, r.state, r.details)
+	}
+	buf.WriteString("\nThis issue is maintained automatically by buhtig-s8k and is closed when there's nothing to report.\n")
+	return buf.String()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	cleanup "github.com/OpusCapita/buhtig-s8k/pkg/cleanup"
+)
+
+// validateExtraResources exits if extra resources are misconfigured
+func validateExtraResources(targets []extraResourceTarget) {
+	for _, target := range targets {
+		if target.Kind == "" {
+			log.Fatal("Kind of extra resource is required")
+		}
+		if target.Name == "" && target.Selector == "" {
+			log.Fatal(fmt.Sprintf("Either name or selector of extra resource %s is required", target.Kind))
+		}
+	}
+}
+
+// isExtraResourcesDeletedIfNeeded deletes objects of arbitrary kinds configured in 'extraResources' of config file,
+// e.g. per-branch custom resources living in shared namespaces
+func isExtraResourcesDeletedIfNeeded(deleter *cleanup.Deleter, targets []extraResourceTarget) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		logger := ns.logger()
+		data := newTemplateData(ns)
+
+		failed := false
+		for _, target := range targets {
+			deleted, err := deleteExtraResource(deleter, target, data)
+			for _, obj := range deleted {
+				auditAction(ns, "delete-extra-resource", nil, map[string]string{"object": obj.String()})
+				logger.WithField("object", obj.String()).Info("Deleted extra resource")
+			}
+			if err != nil {
+				logger.WithField("kind", target.Kind).WithError(err).Error("Failed to delete extra resources")
+				failed = true
+			}
+		}
+		return !failed
+	}
+}
+
+// deleteExtraResource renders templates of target and deletes matching objects
+func deleteExtraResource(deleter *cleanup.Deleter, target extraResourceTarget, data templateData) ([]cleanup.Object, error) {
+	gvk := schema.GroupVersionKind{Group: target.Group, Version: target.Version, Kind: target.Kind}
+	namespace, err := renderTemplate(target.Namespace, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if target.Name != "" {
+		name, err := renderTemplate(target.Name, data)
+		if err != nil {
+			return nil, err
+		}
+		obj := cleanup.Object{GroupVersionKind: gvk, Namespace: namespace, Name: name}
+		ok, err := deleter.Delete(obj)
+		if !ok || err != nil {
+			return nil, err
+		}
+		return []cleanup.Object{obj}, nil
+	}
+
+	selector, err := renderTemplate(target.Selector, data)
+	if err != nil {
+		return nil, err
+	}
+	return deleter.DeleteMatching(gvk, namespace, selector)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// classes of errors which retry policy can retry
+const (
+	// retryOnConflict retries conflicting updates, it's what 'retry.RetryOnConflict' does
+	retryOnConflict = "conflict"
+	// retryOnTimeout retries server timeouts and expired deadlines (incl. Tiller ones)
+	retryOnTimeout = "timeout"
+	// retryOnThrottled retries requests rejected due to rate limiting
+	retryOnThrottled = "throttled"
+	// retryOnUnavailable retries unavailable API server or Tiller (e.g. broken port-forward)
+	retryOnUnavailable = "unavailable"
+	// retryOnAll retries any error
+	retryOnAll = "all"
+)
+
+var retryClasses = []string{retryOnConflict, retryOnTimeout, retryOnThrottled, retryOnUnavailable, retryOnAll}
+
+// retryPolicy retries Helm and namespace deletions with exponential backoff
+type retryPolicy struct {
+	backoff wait.Backoff
+	// on lists classes of retryable errors
+	on []string
+}
+
+// newRetryPolicy builds retry policy from app config
+func newRetryPolicy(cfg config) retryPolicy {
+	return retryPolicy{
+		backoff: wait.Backoff{
+			Duration: cfg.retryBackoff,
+			Factor:   cfg.retryBackoffFactor,
+			Jitter:   0.1,
+			Steps:    cfg.retryMaxAttempts,
+			Cap:      cfg.retryMaxBackoff,
+		},
+		on: cfg.retryOn,
+	}
+}
+
+// retryable checks if err belongs to any of retryable classes
+func (p retryPolicy) retryable(err error) bool {
+	for _, class := range p.on {
+		if errorHasClass(err, class) {
+			return true
+		}
+	}
+	return false
+}
+
+// do runs fn until it succeeds, returns non-retryable error or attempts are exhausted; the last error is returned then
+func (p retryPolicy) do(fn func() error) error {
+	var lastErr error
+	err := wait.ExponentialBackoff(p.backoff, func() (bool, error) {
+		lastErr = fn()
+		switch {
+		case lastErr == nil:
+			return true, nil
+		case p.retryable(lastErr):
+			return false, nil
+		default:
+			return false, lastErr
+		}
+	})
+	if err == wait.ErrWaitTimeout {
+		return lastErr
+	}
+	return err
+}
+
+// errorHasClass checks if err belongs to class, both Kubernetes API and gRPC (Tiller) errors are recognized
+func errorHasClass(err error, class string) bool {
+	code := status.Code(err)
+	switch class {
+	case retryOnAll:
+		return true
+	case retryOnConflict:
+		return errors.IsConflict(err)
+	case retryOnTimeout:
+		return errors.IsServerTimeout(err) || errors.IsTimeout(err) || code == codes.DeadlineExceeded
+	case retryOnThrottled:
+		return errors.IsTooManyRequests(err) || code == codes.ResourceExhausted
+	case retryOnUnavailable:
+		return errors.IsServiceUnavailable(err) || code == codes.Unavailable ||
+			strings.Contains(err.Error(), "connection refused") || strings.Contains(err.Error(), "transport is closing")
+	}
+	return false
+}
+
+// String describes retry policy in logs
+func (p retryPolicy) String() string {
+	return fmt.Sprintf("up to %d attempts, backoff %s x%.1f (max %s), retry on %s",
+		p.backoff.Steps, p.backoff.Duration, p.backoff.Factor, p.backoff.Cap, strings.Join(p.on, ", "))
+}
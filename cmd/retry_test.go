@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestRetryPolicy_do(t *testing.T) {
+	p := retryPolicy{
+		backoff: wait.Backoff{Duration: time.Millisecond, Factor: 1, Steps: 3},
+		on:      []string{retryOnConflict, retryOnUnavailable},
+	}
+	conflict := k8serrors.NewConflict(schema.GroupResource{Resource: "namespaces"}, "ns", errors.New("modified"))
+	tillerDown := status.Error(codes.Unavailable, "transport is closing")
+
+	attempts := 0
+	err := p.do(func() error {
+		attempts++
+		if attempts == 1 {
+			return conflict
+		}
+		if attempts == 2 {
+			return tillerDown
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("Expected success on 3rd attempt, but got %v after %d attempts", err, attempts)
+	}
+
+	attempts = 0
+	err = p.do(func() error {
+		attempts++
+		return tillerDown
+	})
+	if err != tillerDown || attempts != 3 {
+		t.Errorf("Expected the last error after 3 attempts, but got %v after %d attempts", err, attempts)
+	}
+
+	attempts = 0
+	forbidden := k8serrors.NewForbidden(schema.GroupResource{Resource: "namespaces"}, "ns", errors.New("denied"))
+	err = p.do(func() error {
+		attempts++
+		return forbidden
+	})
+	if err != forbidden || attempts != 1 {
+		t.Errorf("Expected non-retryable error to be returned immediately, but got %v after %d attempts", err, attempts)
+	}
+}
+
+func TestErrorHasClass(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		class    string
+		expected bool
+	}{
+		{k8serrors.NewServerTimeout(schema.GroupResource{Resource: "namespaces"}, "delete", 1), retryOnTimeout, true},
+		{status.Error(codes.DeadlineExceeded, "deadline"), retryOnTimeout, true},
+		{k8serrors.NewTooManyRequests("slow down", 1), retryOnThrottled, true},
+		{errors.New("dial tcp 127.0.0.1:44134: connect: connection refused"), retryOnUnavailable, true},
+		{errors.New("boom"), retryOnUnavailable, false},
+		{errors.New("boom"), retryOnAll, true},
+	} {
+		if actual := errorHasClass(tc.err, tc.class); actual != tc.expected {
+			t.Errorf("Expected %v for error '%v' and class %s, but got %v", tc.expected, tc.err, tc.class, actual)
+		}
+	}
+}
+
+func TestReleaseDeletionStatus(t *testing.T) {
+	for err, expected := range map[error]string{
+		nil: releaseDeletionDeleted,
+		status.Error(codes.DeadlineExceeded, "hook"): releaseDeletionTimeout,
+		status.Error(codes.Unavailable, "tiller"):    releaseDeletionUnavailable,
+		errors.New("release is broken"):              releaseDeletionFailed,
+	} {
+		if actual := releaseDeletionStatus(err); actual != expected {
+			t.Errorf("Expected status %s of %v, got %s", expected, err, actual)
+		}
+	}
+}
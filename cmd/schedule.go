@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/OpusCapita/buhtig-s8k/pkg/cron"
+	log "github.com/sirupsen/logrus"
+)
+
+// iterationSchedule decides when the next iteration starts: after fixed interval, at the next activation
+// of any cron expression, or whichever comes first if both are configured
+type iterationSchedule struct {
+	// interval between iterations, 0 disables it
+	interval  time.Duration
+	schedules []*cron.Schedule
+	location  *time.Location
+}
+
+// newIterationSchedule parses ';'-separated cron expressions in timezone; interval is 1 minute by default
+// without cron expressions and disabled with them. It exits on misconfiguration.
+func newIterationSchedule(specs, timezone string) iterationSchedule {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Env %s should be IANA timezone, e.g. 'Europe/Helsinki': %v", iterationScheduleTimezoneEnv, err))
+	}
+	s := iterationSchedule{location: location}
+	for _, spec := range strings.Split(specs, ";") {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		schedule, err := cron.Parse(spec)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("Env %s is invalid: %v", iterationScheduleEnv, err))
+		}
+		s.schedules = append(s.schedules, schedule)
+	}
+
+	defaultInterval := time.Minute
+	if len(s.schedules) > 0 {
+		defaultInterval = 0
+	}
+	s.interval = envDuration(iterationIntervalEnv, defaultInterval)
+	if s.interval <= 0 && len(s.schedules) == 0 {
+		log.Fatal(fmt.Sprintf("Either %s or %s should be set", iterationIntervalEnv, iterationScheduleEnv))
+	}
+	return s
+}
+
+// next returns time of the next iteration after iteration finished at now
+func (s iterationSchedule) next(now time.Time) time.Time {
+	var next time.Time
+	if s.interval > 0 {
+		next = now.Add(s.interval)
+	}
+	for _, schedule := range s.schedules {
+		activation := schedule.Next(now.In(s.location))
+		if !activation.IsZero() && (next.IsZero() || activation.Before(next)) {
+			next = activation
+		}
+	}
+	return next
+}
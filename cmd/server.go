@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// adminMux is a router of admin HTTP listener; features register their handlers here before listener starts
+var adminMux = http.NewServeMux()
+
+// adminTokens maps bearer tokens accepted by protected admin endpoints to names of their holders, it's set from
+// ADMIN_TOKENS on startup; protected endpoints are refused while it's empty
+var adminTokens map[string]string
+
+// parseAdminTokens parses "NAME:TOKEN" items, token without name is held by "admin"
+func parseAdminTokens(items []string) map[string]string {
+	tokens := map[string]string{}
+	for _, item := range items {
+		name, token := "admin", item
+		if i := strings.Index(item, ":"); i >= 0 {
+			name, token = item[:i], item[i+1:]
+		}
+		if token != "" {
+			tokens[token] = name
+		}
+	}
+	return tokens
+}
+
+// adminCaller returns name of holder of bearer token sent with request, false if token is missing or unknown
+func adminCaller(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", false
+	}
+	sent := []byte(strings.TrimPrefix(header, "Bearer "))
+	name, found := "", false
+	for token, holder := range adminTokens {
+		if subtle.ConstantTimeCompare([]byte(token), sent) == 1 {
+			name, found = holder, true
+		}
+	}
+	return name, found
+}
+
+// requireAdminToken protects admin endpoint which changes state of the app or exposes sensitive data, since
+// admin listener is reachable by anything which can reach metrics
+func requireAdminToken(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(adminTokens) == 0 {
+			http.Error(w, "endpoint is disabled, set "+adminTokensEnv+" to enable it", http.StatusForbidden)
+			return
+		}
+		if _, ok := adminCaller(r); !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// startAdminServer starts HTTP listener for metrics and admin endpoints in background
+func startAdminServer(addr string) {
+	if addr == "" {
+		log.Info("Admin listener is disabled")
+		return
+	}
+
+	adminMux.Handle("/metrics", promhttp.Handler())
+	adminMux.HandleFunc("/readyz", serveReadiness)
+	adminMux.HandleFunc("/healthz", serveLiveness)
+
+	go func() {
+		log.Info("Starting admin listener on " + addr)
+		if err := http.ListenAndServe(addr, adminMux); err != nil {
+			log.Error("Admin listener failed")
+			log.Error(err)
+		}
+	}()
+}
+
+// startDebugServer starts HTTP listener of pprof and expvar endpoints in background; it's separate from admin
+// listener since profiles expose internals of the app and profiling can slow it down
+func startDebugServer(addr string) {
+	if addr == "" {
+		return
+	}
+
+	go func() {
+		log.Warn("Starting debug listener on " + addr + ", it shouldn't be exposed outside of the pod")
+		if err := http.ListenAndServe(addr, newDebugMux()); err != nil {
+			log.Error("Debug listener failed")
+			log.Error(err)
+		}
+	}()
+}
+
+// newDebugMux registers pprof and expvar handlers explicitly, since importing them registers handlers
+// on http.DefaultServeMux
+func newDebugMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+}
+
+// readinessFailures holds failed readiness checks by name, values are errors explaining the failure
+var readinessFailures sync.Map
+
+// setReadiness records result of readiness check, nil error means check passed
+func setReadiness(check string, err error) {
+	if err == nil {
+		readinessFailures.Delete(check)
+		return
+	}
+	readinessFailures.Store(check, err)
+}
+
+// runReadinessCheck runs check on startup and then periodically, interval 0 runs it only once
+func runReadinessCheck(check string, interval time.Duration, fn func() error) {
+	run := func() {
+		err := fn()
+		if err != nil {
+			log.WithField("check", check).WithError(err).Error("Readiness check failed")
+		}
+		setReadiness(check, err)
+	}
+
+	run()
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			<-time.After(interval)
+			run()
+		}
+	}()
+}
+
+// serveReadiness responds with 503 listing failed checks if there are any
+func serveReadiness(w http.ResponseWriter, r *http.Request) {
+	failures := []string{}
+	readinessFailures.Range(func(check, err interface{}) bool {
+		failures = append(failures, fmt.Sprintf("%s: %v", check, err))
+		return true
+	})
+	sort.Strings(failures)
+
+	if len(failures) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, failure := range failures {
+			fmt.Fprintln(w, failure)
+		}
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// loopWatchdog tracks progress of the main loop: every iteration should complete and the next one should start
+// within timeout, otherwise the loop is considered wedged (e.g. deadlocked or crashed without restart)
+type loopWatchdog struct {
+	timeout time.Duration
+
+	mu sync.Mutex
+	// deadline is when the loop should make progress next time, zero until the first iteration starts
+	deadline time.Time
+	// waitingFor describes progress expected by deadline
+	waitingFor string
+}
+
+// watchdog of the main loop, it's disabled until timeout is set on startup
+var watchdog = &loopWatchdog{}
+
+// iterationStarted expects iteration started at now to complete within timeout
+func (w *loopWatchdog) iterationStarted(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.deadline = now.Add(w.timeout)
+	w.waitingFor = fmt.Sprintf("iteration started at %s to complete", now.Format(time.RFC3339))
+}
+
+// iterationCompleted expects the next iteration to start within timeout after it's scheduled
+func (w *loopWatchdog) iterationCompleted(next time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.deadline = next.Add(w.timeout)
+	w.waitingFor = fmt.Sprintf("iteration scheduled at %s to start", next.Format(time.RFC3339))
+}
+
+// check returns error if the loop didn't make expected progress by deadline
+func (w *loopWatchdog) check(now time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timeout <= 0 || w.deadline.IsZero() || now.Before(w.deadline) {
+		return nil
+	}
+	return fmt.Errorf("main loop is stuck: waited for %s until %s", w.waitingFor, w.deadline.Format(time.RFC3339))
+}
+
+// serveLiveness responds with 503 if the main loop doesn't make progress, so that Kubernetes restarts the app
+func serveLiveness(w http.ResponseWriter, r *http.Request) {
+	if err := watchdog.check(time.Now()); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, err)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/OpusCapita/buhtig-s8k/pkg/slack"
+)
+
+// action IDs of buttons in approval message
+const (
+	slackActionApprove = "approve"
+	slackActionKeep    = "keep"
+)
+
+// approvalChannelAnnotationName overrides Slack channel where approval of namespace deletion is requested
+const approvalChannelAnnotationName = "opuscapita.com/approval-channel"
+
+// slackApprovals asks for approval of deletions in Slack channel with Approve/Keep buttons
+type slackApprovals struct {
+	client        *slack.Client
+	signingSecret string
+	channel       string
+}
+
+// approvalMessage returns message with buttons asking to approve deletion of namespace
+func approvalMessage(ns *namespace, channel string) slack.Message {
+	data := newTemplateData(ns)
+	text := fmt.Sprintf("Namespace `%s` is going to be deleted: branch `%s` of %s/%s is deleted.", data.Namespace, data.Branch, data.Owner, data.Repo)
+	button := func(text, actionID, style string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":      "button",
+			"text":      map[string]string{"type": "plain_text", "text": text},
+			"action_id": actionID,
+			"value":     data.Namespace,
+			"style":     style,
+		}
+	}
+	return slack.Message{
+		Channel: channel,
+		Text:    text,
+		Blocks: []interface{}{
+			map[string]interface{}{
+				"type": "section",
+				"text": map[string]string{"type": "mrkdwn", "text": text + " Approve deletion?"},
+			},
+			map[string]interface{}{
+				"type": "actions",
+				"elements": []interface{}{
+					button("Approve", slackActionApprove, "danger"),
+					button("Keep", slackActionKeep, "primary"),
+				},
+			},
+		},
+	}
+}
+
+// requestApproval posts approval message for namespace to the channel, annotation of namespace overrides it
+func (s *slackApprovals) requestApproval(ns *namespace) error {
+	channel := s.channel
+	if val := ns.ObjectMeta.Annotations[approvalChannelAnnotationName]; val != "" {
+		channel = val
+	}
+	_, err := s.client.PostMessage(approvalMessage(ns, channel))
+	return err
+}
+
+// handleInteraction acts on button clicked in approval message and returns text replacing the message
+func (s *slackApprovals) handleInteraction(k8sClient kubernetes.Interface, interaction *slack.Interaction) string {
+	if len(interaction.Actions) == 0 {
+		return ""
+	}
+	action := interaction.Actions[0]
+	user := interaction.User.Username
+	if user == "" {
+		user = interaction.User.ID
+	}
+
+	var err error
+	var outcome string
+	switch action.ActionID {
+	case slackActionApprove:
+		err = approveNamespace(k8sClient, action.Value, "slack:"+user)
+		outcome = fmt.Sprintf("Deletion of namespace `%s` is approved by <@%s>.", action.Value, interaction.User.ID)
+	case slackActionKeep:
+		err = rejectNamespace(k8sClient, action.Value, "slack:"+user)
+		outcome = fmt.Sprintf("Namespace `%s` is kept by <@%s>.", action.Value, interaction.User.ID)
+	default:
+		return ""
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"namespace": action.Value, "action": action.ActionID}).WithError(err).Warn("Failed to handle action requested in Slack")
+		return fmt.Sprintf("Failed to %s deletion of namespace `%s`: %v", action.ActionID, action.Value, err)
+	}
+	return outcome
+}
+
+// registerSlackHandlers exposes '/webhook/slack' endpoint on webhook listener, it should be configured
+// as Request URL of interactivity in Slack app
+func registerSlackHandlers(k8sClient kubernetes.Interface, s *slackApprovals) {
+	if s == nil {
+		return
+	}
+	webhookMux.HandleFunc("/webhook/slack", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayloadBytes))
+		if err != nil {
+			http.Error(w, "failed to read payload", http.StatusBadRequest)
+			return
+		}
+
+		err = slack.VerifyRequest(s.signingSecret, r.Header.Get(slack.TimestampHeader), body, r.Header.Get(slack.SignatureHeader), time.Now())
+		if err != nil {
+			log.Warn("Rejected Slack interaction: " + err.Error())
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		interaction, err := slack.ParseInteraction(body)
+		if err != nil {
+			http.Error(w, "malformed payload", http.StatusBadRequest)
+			return
+		}
+
+		if text := s.handleInteraction(k8sClient, interaction); text != "" && interaction.ResponseURL != "" {
+			if err := s.client.Respond(interaction.ResponseURL, slack.Message{Text: text, ReplaceOriginal: true}); err != nil {
+				log.Error("Failed to update Slack message")
+				log.Error(err)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/OpusCapita/buhtig-s8k/pkg/statsd"
+)
+
+// values of STATSD_FLAVOR
+const (
+	statsdFlavorDogStatsD = "dogstatsd"
+	statsdFlavorStatsD    = "statsd"
+)
+
+// statsdSettings configure emitting of metrics to StatsD or DogStatsD agent, e.g. Datadog agent
+type statsdSettings struct {
+	// addr is UDP address of agent, empty value disables emitting
+	addr string
+	// flavor decides how labels are sent: as DogStatsD tags or as suffix of metric name for plain StatsD
+	flavor   string
+	prefix   string
+	interval time.Duration
+}
+
+// statsdEmitter sends metrics of the app to StatsD agent; it's nil if emitting is disabled
+var statsdEmitter *statsd.Emitter
+
+// startStatsdEmitter sends metrics every interval if StatsD agent is configured
+func startStatsdEmitter(settings statsdSettings) {
+	if settings.addr == "" {
+		return
+	}
+	emitter, err := statsd.NewEmitter(settings.addr, settings.prefix, settings.flavor == statsdFlavorDogStatsD, prometheus.DefaultGatherer)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Failed to set up StatsD emitter: %v", err))
+	}
+	statsdEmitter = emitter
+	log.Info(fmt.Sprintf("Metrics are sent to %s agent at %s every %v", settings.flavor, settings.addr, settings.interval))
+
+	go func() {
+		for range time.Tick(settings.interval) {
+			emitStatsdMetrics()
+		}
+	}()
+}
+
+// emitStatsdMetrics sends current values of metrics if StatsD agent is configured
+func emitStatsdMetrics() {
+	if statsdEmitter == nil {
+		return
+	}
+	if err := statsdEmitter.Emit(); err != nil {
+		log.Error("Failed to send metrics to StatsD agent")
+		log.Error(err)
+	}
+}
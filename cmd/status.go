@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// annotations where outcome of the latest evaluation of namespace is written (see STATUS_ANNOTATIONS)
+const (
+	lastCheckedAnnotationName      = "opuscapita.com/last-checked"
+	lastBranchStatusAnnotationName = "opuscapita.com/last-branch-status"
+	nextActionAnnotationName       = "opuscapita.com/next-action"
+	skipReasonAnnotationName       = "opuscapita.com/skip-reason"
+)
+
+// namespaceStatus is outcome of namespace evaluation in current iteration
+type namespaceStatus struct {
+	ns           *namespace
+	checkedAt    time.Time
+	branchStatus int
+	// action is one of action* constants of decision, it becomes 'skip' if any later step skips namespace
+	action string
+	// reason explains why namespace is skipped or waits, it's empty if namespace is going to be deleted
+	reason string
+	// deleteAfter is deletion mark of namespace, it's zero if namespace isn't marked
+	deleteAfter time.Time
+	// deletedAt is time when namespace is deleted in iteration, it's zero if it isn't
+	deletedAt time.Time
+}
+
+// namespaceStatuses holds statuses of namespaces evaluated in current iteration by namespace name; namespace
+// goes through pipeline steps one by one, so its status isn't changed concurrently
+var namespaceStatuses sync.Map
+
+// setNamespaceStatus records decision made about namespace
+func setNamespaceStatus(e evaluation, d decision) {
+	status := &namespaceStatus{ns: e.ns, checkedAt: e.now, branchStatus: e.branchStatus, action: d.action, deleteAfter: d.deleteAfter}
+	if d.action != actionDelete {
+		status.reason = d.reason
+	}
+	namespaceStatuses.Store(e.ns.Name(), status)
+}
+
+// skipNamespace counts namespace skipped by pipeline step for reason (one of skipReason* constants or guard name)
+// and records message explaining it in namespace status
+func skipNamespace(ns *namespace, reason, message string) {
+	namespacesSkippedCounter.WithLabelValues(reason).Inc()
+	countSkipped(reason)
+	if val, ok := namespaceStatuses.Load(ns.Name()); ok {
+		status := val.(*namespaceStatus)
+		status.action = actionSkip
+		status.reason = message
+	}
+}
+
+// setNamespaceDeleted records that namespace is deleted
+func setNamespaceDeleted(ns *namespace) {
+	countDeleted()
+	if val, ok := namespaceStatuses.Load(ns.Name()); ok {
+		val.(*namespaceStatus).deletedAt = time.Now()
+	}
+}
+
+// annotations returns patch of status annotations, unchanged ones are omitted
+func (s *namespaceStatus) annotations() map[string]*string {
+	desired := map[string]string{
+		lastCheckedAnnotationName:      s.checkedAt.UTC().Format(time.RFC3339),
+		lastBranchStatusAnnotationName: strconv.Itoa(s.branchStatus),
+		nextActionAnnotationName:       s.action,
+		skipReasonAnnotationName:       s.reason,
+	}
+	patch := map[string]*string{}
+	for name, value := range desired {
+		current, ok := s.ns.ObjectMeta.Annotations[name]
+		switch {
+		case value == "" && ok:
+			patch[name] = nil
+		case value != "" && value != current:
+			v := value
+			patch[name] = &v
+		}
+	}
+	return patch
+}
+
+// writeNamespaceStatuses writes statuses of namespaces evaluated in iteration to their annotations if enabled,
+// statuses are forgotten anyway
+func writeNamespaceStatuses(k8sClient kubernetes.Interface, enabled bool) {
+	namespaceStatuses.Range(func(key, val interface{}) bool {
+		namespaceStatuses.Delete(key)
+		if !enabled {
+			return true
+		}
+		status := val.(*namespaceStatus)
+		patch := status.annotations()
+		if len(patch) == 0 {
+			return true
+		}
+		// namespace may be already gone if it's deleted in this iteration
+		if err := status.ns.patchAnnotations(k8sClient, patch); err != nil && !errors.IsNotFound(err) {
+			status.ns.logger().Error("Failed to write status annotations: " + err.Error())
+		}
+		return true
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// iterationSummary counts outcomes of namespaces in iteration, so that result of iteration is seen at a glance
+// instead of being inferred from per-namespace logs
+type iterationSummary struct {
+	mu          sync.Mutex
+	startedAt   time.Time
+	githubCalls int64
+
+	// Found is number of namespaces which entered the pipeline
+	Found int `json:"found"`
+	// Evaluated is number of namespaces which branch was checked and decision was made for
+	Evaluated int `json:"evaluated"`
+	// Deleted is number of deleted namespaces
+	Deleted int `json:"deleted"`
+	// Skipped is number of skipped namespaces by reason
+	Skipped map[string]int `json:"skipped"`
+	// Errored is number of namespaces which branch check or cleanup step failed
+	Errored int `json:"errored"`
+	errored map[string]bool
+
+	CompletedAt     time.Time `json:"completedAt"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	// GithubCalls is number of requests sent to Github API during iteration
+	GithubCalls int64 `json:"githubCalls"`
+}
+
+var (
+	// currentSummary collects outcomes of current iteration, lastSummary is summary of the latest completed one
+	currentSummary, lastSummary *iterationSummary
+	summaryMu                   sync.Mutex
+
+	lastIterationNamespacesGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_iteration_namespaces",
+		Help:      "Number of namespaces in the last completed iteration by outcome (found, evaluated, deleted, skipped, errored).",
+	}, []string{"outcome"})
+	lastIterationDurationGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_iteration_duration_seconds",
+		Help:      "Duration of the last completed iteration.",
+	})
+	lastIterationGithubCallsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_iteration_github_calls",
+		Help:      "Number of requests sent to Github API during the last completed iteration.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(lastIterationNamespacesGauge)
+	prometheus.MustRegister(lastIterationDurationGauge)
+	prometheus.MustRegister(lastIterationGithubCallsGauge)
+}
+
+// startIterationSummary starts collecting outcomes of new iteration
+func startIterationSummary(now time.Time) {
+	summaryMu.Lock()
+	defer summaryMu.Unlock()
+	currentSummary = &iterationSummary{startedAt: now, githubCalls: githubRateLimits.requests(), Skipped: map[string]int{}, errored: map[string]bool{}}
+}
+
+// updateSummary applies update to summary of current iteration, it does nothing outside of iteration
+// (e.g. in 'eval' command or tests)
+func updateSummary(update func(s *iterationSummary)) {
+	summaryMu.Lock()
+	s := currentSummary
+	summaryMu.Unlock()
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update(s)
+}
+
+func countFound()                { updateSummary(func(s *iterationSummary) { s.Found++ }) }
+func countEvaluated()            { updateSummary(func(s *iterationSummary) { s.Evaluated++ }) }
+func countDeleted()              { updateSummary(func(s *iterationSummary) { s.Deleted++ }) }
+func countSkipped(reason string) { updateSummary(func(s *iterationSummary) { s.Skipped[reason]++ }) }
+
+// countErrored counts namespace as errored once per iteration, even if several of its steps fail
+func countErrored(ns *namespace) {
+	updateSummary(func(s *iterationSummary) {
+		if !s.errored[ns.Name()] {
+			s.errored[ns.Name()] = true
+			s.Errored++
+		}
+	})
+}
+
+// finishIterationSummary logs summary of current iteration and exposes it as metrics and in /status
+func finishIterationSummary(now time.Time) {
+	summaryMu.Lock()
+	s := currentSummary
+	currentSummary = nil
+	summaryMu.Unlock()
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.CompletedAt = now
+	s.DurationSeconds = now.Sub(s.startedAt).Seconds()
+	s.GithubCalls = githubRateLimits.requests() - s.githubCalls
+	s.mu.Unlock()
+
+	summaryMu.Lock()
+	lastSummary = s
+	summaryMu.Unlock()
+
+	skipped := 0
+	for _, count := range s.Skipped {
+		skipped += count
+	}
+	for outcome, count := range map[string]int{"found": s.Found, "evaluated": s.Evaluated, "deleted": s.Deleted, "skipped": skipped, "errored": s.Errored} {
+		lastIterationNamespacesGauge.WithLabelValues(outcome).Set(float64(count))
+	}
+	lastIterationDurationGauge.Set(s.DurationSeconds)
+	lastIterationGithubCallsGauge.Set(float64(s.GithubCalls))
+
+	log.WithFields(log.Fields{
+		"found":        s.Found,
+		"evaluated":    s.Evaluated,
+		"deleted":      s.Deleted,
+		"skipped":      skipped,
+		"errored":      s.Errored,
+		"duration":     time.Duration(s.DurationSeconds * float64(time.Second)).Round(time.Millisecond).String(),
+		"github_calls": s.GithubCalls,
+	}).Info(s.String())
+}
+
+// String describes summary in one line, e.g. "Iteration is completed in 12s: 40 namespaces found, 38 evaluated,
+// 2 deleted, 5 skipped (paused: 3, protected: 2), 1 errored, 42 Github calls"
+func (s *iterationSummary) String() string {
+	var reasons []string
+	skipped := 0
+	for reason, count := range s.Skipped {
+		reasons = append(reasons, fmt.Sprintf("%s: %d", reason, count))
+		skipped += count
+	}
+	sort.Strings(reasons)
+	skippedText := fmt.Sprintf("%d skipped", skipped)
+	if len(reasons) > 0 {
+		skippedText += " (" + strings.Join(reasons, ", ") + ")"
+	}
+	duration := time.Duration(s.DurationSeconds * float64(time.Second)).Round(time.Second)
+	return fmt.Sprintf("Iteration is completed in %v: %d namespaces found, %d evaluated, %d deleted, %s, %d errored, %d Github calls",
+		duration, s.Found, s.Evaluated, s.Deleted, skippedText, s.Errored, s.GithubCalls)
+}
+
+// lastIterationSummary returns summary of the latest completed iteration, it's nil until the first one completes
+func lastIterationSummary() *iterationSummary {
+	summaryMu.Lock()
+	defer summaryMu.Unlock()
+	return lastSummary
+}
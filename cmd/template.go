@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+)
+
+// templateData is data available in user-defined templates (notifications, resource names, etc.)
+type templateData struct {
+	Namespace   string
+	Owner       string
+	Repo        string
+	Branch      string
+	HelmRelease string
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// newTemplateData collects template data from namespace; missing annotations result in empty fields
+func newTemplateData(ns *namespace) templateData {
+	data := templateData{
+		Namespace:   ns.Name(),
+		Labels:      ns.ObjectMeta.Labels,
+		Annotations: ns.ObjectMeta.Annotations,
+	}
+	data.Owner, data.Repo, data.Branch, _ = ns.GithubBranch()
+	data.HelmRelease, _ = ns.HelmRelease()
+	return data
+}
+
+// templateFuncs are functions available in user-defined templates
+var templateFuncs = template.FuncMap{
+	// json encodes value, e.g. to safely put strings into JSON payloads
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// trimPrefix, trimSuffix and replace help to derive values from names, e.g. branch from namespace name
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+}
+
+// renderTemplate executes Go template text with data
+func renderTemplate(text string, data interface{}) (string, error) {
+	tpl, err := template.New("").Option("missingkey=zero").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
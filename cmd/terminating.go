@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	cleanup "github.com/OpusCapita/buhtig-s8k/pkg/cleanup"
+)
+
+// how often namespaces are checked for being stuck in Terminating
+const stuckTerminatingCheckInterval = 5 * time.Minute
+
+var stuckTerminatingGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Name:      "namespaces_stuck_terminating",
+	Help:      "Number of namespaces which remain in Terminating longer than STUCK_TERMINATING_THRESHOLD.",
+})
+
+func init() {
+	prometheus.MustRegister(stuckTerminatingGauge)
+}
+
+// TerminatingFor returns how long namespace is terminating, it's 0 if it isn't
+func (ns *namespace) TerminatingFor(now time.Time) time.Duration {
+	if ns.Status.Phase != corev1.NamespaceTerminating || ns.ObjectMeta.DeletionTimestamp == nil {
+		return 0
+	}
+	return now.Sub(ns.ObjectMeta.DeletionTimestamp.Time)
+}
+
+// Finalizers returns finalizers blocking namespace removal: 'kubernetes' one of spec is removed once namespace
+// content is deleted, ones of metadata are removed by controllers which put them
+func (ns *namespace) Finalizers() []string {
+	finalizers := []string{}
+	for _, f := range ns.Spec.Finalizers {
+		finalizers = append(finalizers, string(f))
+	}
+	return append(finalizers, ns.ObjectMeta.Finalizers...)
+}
+
+// blockingResources describes what remains in stuck namespace: objects with finalizers, number of other objects
+// and API groups which failed discovery (namespace controller can't make sure their objects are gone)
+func blockingResources(deleter *cleanup.Deleter, ns *namespace) (string, error) {
+	objects, unavailable, err := deleter.ListNamespace(ns.Name())
+	if err != nil {
+		return "", err
+	}
+	blocking := []string{}
+	others := 0
+	for _, obj := range objects {
+		if len(obj.Finalizers) > 0 {
+			blocking = append(blocking, obj.String())
+		} else {
+			others++
+		}
+	}
+	parts := []string{}
+	if len(blocking) > 0 {
+		parts = append(parts, "objects with finalizers: "+strings.Join(blocking, "; "))
+	}
+	if others > 0 {
+		parts = append(parts, fmt.Sprintf("%d objects without finalizers", others))
+	}
+	if len(unavailable) > 0 {
+		parts = append(parts, "unavailable APIs: "+strings.Join(unavailable, ", "))
+	}
+	if len(parts) == 0 {
+		return "no objects remain", nil
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// stuckNamespaces remembers namespaces already reported as stuck, so that warning is logged once per namespace
+type stuckNamespaces struct {
+	mu       sync.Mutex
+	reported map[string]bool
+	// deleter lists resources remaining in reported namespaces, they aren't listed if it's nil
+	deleter *cleanup.Deleter
+}
+
+// check reports namespaces terminating longer than threshold and returns them
+func (s *stuckNamespaces) check(namespaces []corev1.Namespace, threshold time.Duration, now time.Time) []*namespace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stuck := []*namespace{}
+	seen := map[string]bool{}
+	for _, k8sNs := range namespaces {
+		ns := newNamespace(k8sNs)
+		if ns.TerminatingFor(now) <= threshold {
+			continue
+		}
+		stuck = append(stuck, ns)
+		seen[ns.Name()] = true
+		if s.reported[ns.Name()] {
+			continue
+		}
+		s.reported[ns.Name()] = true
+		finalizers := strings.Join(ns.Finalizers(), ", ")
+		ns.logger().WithFields(log.Fields{"terminating_for": ns.TerminatingFor(now).Round(time.Second).String(), "finalizers": finalizers}).Warn("Namespace is stuck in Terminating")
+		details := map[string]string{"finalizers": finalizers}
+		if s.deleter != nil {
+			if resources, err := blockingResources(s.deleter, ns); err != nil {
+				ns.logger().WithError(err).Error("Failed to list resources remaining in namespace")
+			} else {
+				ns.logger().Warn("Resources remaining in stuck namespace: " + resources)
+				details["resources"] = resources
+			}
+		}
+		recordEvent(ns, corev1.EventTypeWarning, eventStuckTerminating, fmt.Sprintf("Namespace is stuck in Terminating, blocked by finalizers: %s", finalizers))
+		auditAction(ns, "stuck-terminating", nil, details)
+	}
+	// namespaces which are gone (or not stuck anymore) are reported again if they get stuck later
+	for name := range s.reported {
+		if !seen[name] {
+			delete(s.reported, name)
+		}
+	}
+	stuckTerminatingGauge.Set(float64(len(stuck)))
+	return stuck
+}
+
+// forceFinalizeSettings configure removal of known-stuck finalizers from stuck namespaces
+type forceFinalizeSettings struct {
+	// timeout is how long namespace should be terminating before finalizers are removed, 0 disables removal
+	timeout time.Duration
+	// finalizers is allow-list of finalizers which can be removed
+	finalizers []string
+}
+
+// forceFinalize removes allowed finalizers from namespace: the ones of spec through finalize subresource,
+// the ones of metadata with update
+func forceFinalize(k8sClient kubernetes.Interface, ns *namespace, allowed []string) error {
+	isAllowed := func(finalizer string) bool {
+		for _, a := range allowed {
+			if a == finalizer {
+				return true
+			}
+		}
+		return false
+	}
+
+	k8sNs, err := k8sClient.CoreV1().Namespaces().Get(ns.Name(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	removed := []string{}
+	spec := []corev1.FinalizerName{}
+	for _, f := range k8sNs.Spec.Finalizers {
+		if isAllowed(string(f)) {
+			removed = append(removed, string(f))
+		} else {
+			spec = append(spec, f)
+		}
+	}
+	if len(spec) != len(k8sNs.Spec.Finalizers) {
+		k8sNs.Spec.Finalizers = spec
+		k8sNs, err = k8sClient.CoreV1().Namespaces().Finalize(k8sNs)
+		auditAction(ns, "force-finalize", err, map[string]string{"finalizers": strings.Join(removed, ", ")})
+		if err != nil {
+			return err
+		}
+	}
+
+	removedMeta := []string{}
+	meta := []string{}
+	for _, f := range k8sNs.ObjectMeta.Finalizers {
+		if isAllowed(f) {
+			removedMeta = append(removedMeta, f)
+		} else {
+			meta = append(meta, f)
+		}
+	}
+	if len(meta) != len(k8sNs.ObjectMeta.Finalizers) {
+		k8sNs.ObjectMeta.Finalizers = meta
+		_, err = k8sClient.CoreV1().Namespaces().Update(k8sNs)
+		auditAction(ns, "force-finalize", err, map[string]string{"finalizers": strings.Join(removedMeta, ", ")})
+		if err != nil {
+			return err
+		}
+	}
+
+	if removed = append(removed, removedMeta...); len(removed) > 0 {
+		ns.logger().Warn("Removed finalizers of stuck namespace: " + strings.Join(removed, ", "))
+	}
+	return nil
+}
+
+// runStuckNamespaceDetector periodically looks for namespaces which remain in Terminating longer than threshold
+// after their deletion was issued, main loop skips such namespaces. Resources remaining in stuck namespace are found
+// with API discovery and reported together with their finalizers. If force finalization is enabled, allowed
+// finalizers are removed from namespaces which are terminating longer than its timeout.
+func runStuckNamespaceDetector(k8sClient kubernetes.Interface, deleter *cleanup.Deleter, threshold time.Duration, force forceFinalizeSettings) {
+	if threshold <= 0 {
+		return
+	}
+	stuck := &stuckNamespaces{reported: map[string]bool{}, deleter: deleter}
+
+	go func() {
+		for {
+			nsList, err := k8sClient.CoreV1().Namespaces().List(metav1.ListOptions{LabelSelector: labelSelector})
+			if err != nil {
+				log.Error("Failed to check namespaces stuck in Terminating")
+				log.Error(err)
+			} else {
+				now := time.Now()
+				for _, ns := range stuck.check(nsList.Items, threshold, now) {
+					if force.timeout > 0 && ns.TerminatingFor(now) > force.timeout {
+						if err := forceFinalize(k8sClient, ns, force.finalizers); err != nil {
+							ns.logger().WithError(err).Error("Failed to remove finalizers")
+						}
+					}
+				}
+			}
+			<-time.After(stuckTerminatingCheckInterval)
+		}
+	}()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	log "github.com/sirupsen/logrus"
+
+	terraform "github.com/OpusCapita/buhtig-s8k/pkg/terraform"
+)
+
+// terraformPollDelay is how often state of destroy run is checked
+var terraformPollDelay = 10 * time.Second
+
+// terraformSettings configure destroy runs in Terraform Cloud
+type terraformSettings struct {
+	// client is nil if Terraform Cloud isn't configured
+	client *terraform.Client
+	// organization of workspaces referenced by name only
+	organization string
+	// organizations are other organizations which workspaces can be referenced as ORG/NAME in
+	organizations []string
+	// workspacePattern restricts names of workspaces which can be destroyed, nil allows any name
+	workspacePattern *regexp.Regexp
+	// workspaceTag is tag which workspaces should have to be destroyed, empty allows any workspace
+	workspaceTag string
+	timeout      time.Duration
+}
+
+// terraformWorkspace returns organization and name of workspace referenced by namespace annotation as ORG/NAME or NAME,
+// name is empty if there's no workspace. Workspace which isn't allowed by settings is an error, since destroy runs
+// are confirmed by the app and annotation could otherwise point to any workspace token has access to.
+func terraformWorkspace(ns *namespace, settings terraformSettings) (string, string, error) {
+	organization, workspace := settings.organization, strings.TrimSpace(ns.ObjectMeta.Annotations[terraformWorkspaceAnnotationName])
+	if parts := strings.SplitN(workspace, "/", 2); len(parts) == 2 {
+		organization, workspace = parts[0], parts[1]
+		allowed := organization == settings.organization
+		for _, o := range settings.organizations {
+			allowed = allowed || o == organization
+		}
+		if !allowed {
+			return "", "", fmt.Errorf("Terraform organization '%s' isn't allowed, it should be %s or in %s", organization, tfcOrganizationEnv, tfcOrganizationsEnv)
+		}
+	}
+	if workspace == "" {
+		return "", "", nil
+	}
+	if organization == "" {
+		return "", "", fmt.Errorf("Terraform workspace '%s' is referenced by name only, but %s isn't set", workspace, tfcOrganizationEnv)
+	}
+	if settings.workspacePattern != nil && !settings.workspacePattern.MatchString(workspace) {
+		return "", "", fmt.Errorf("Terraform workspace '%s' doesn't match %s '%s'", workspace, tfcWorkspacePatternEnv, settings.workspacePattern)
+	}
+	return organization, workspace, nil
+}
+
+// isTerraformDestroyedIfNeeded queues destroy run in Terraform Cloud workspace referenced by 'opuscapita.com/terraform-workspace'
+// annotation and waits for it, so that per-branch cloud infrastructure provisioned alongside namespace is cleaned up.
+// ID of run is kept in namespace annotation, so that it's waited for on the next iteration if it takes longer than timeout;
+// failed run is forgotten and a new one is queued on the next iteration.
+func isTerraformDestroyedIfNeeded(k8sClient kubernetes.Interface, settings terraformSettings) func(*namespace) stepResult {
+	return func(ns *namespace) stepResult {
+		logger := ns.logger()
+		organization, workspace, err := terraformWorkspace(ns, settings)
+		if err != nil {
+			logger.Error(err)
+			return stepFailed
+		}
+		if workspace == "" {
+			return stepDone
+		}
+		if settings.client == nil {
+			logger.WithField("workspace", workspace).Error("Namespace references Terraform workspace, but " + tfcTokenEnv + " isn't set")
+			return stepFailed
+		}
+
+		runID := ns.ObjectMeta.Annotations[terraformRunAnnotationName]
+		if runID == "" {
+			found, err := settings.client.GetWorkspace(organization, workspace)
+			if err != nil {
+				logger.Error(err)
+				return stepFailed
+			}
+			if found == nil {
+				logger.WithField("workspace", organization+"/"+workspace).Info("Terraform workspace doesn't exist, nothing to destroy")
+				return stepDone
+			}
+			if settings.workspaceTag != "" && !found.HasTag(settings.workspaceTag) {
+				logger.WithFields(log.Fields{"workspace": organization + "/" + workspace, "tag": settings.workspaceTag}).Error("Terraform workspace isn't tagged for destroy")
+				return stepFailed
+			}
+
+			runID, err = settings.client.CreateDestroyRun(found.ID, fmt.Sprintf("Environment %s is removed by %s", ns.Name(), componentName))
+			auditAction(ns, "terraform-destroy", err, map[string]string{"workspace": organization + "/" + workspace, "run": runID})
+			if err != nil {
+				logger.Error(err)
+				return stepFailed
+			}
+			if err := ns.patchAnnotations(k8sClient, map[string]*string{terraformRunAnnotationName: &runID}); err != nil {
+				logger.Error(err)
+				return stepFailed
+			}
+			logger.WithFields(log.Fields{"workspace": organization + "/" + workspace, "run": runID}).Info("Queued Terraform destroy run")
+		}
+
+		deadline := time.Now().Add(settings.timeout)
+		for {
+			run, err := settings.client.GetRun(runID)
+			if err != nil {
+				logger.Error(err)
+				return stepFailed
+			}
+			if run.IsFinished() {
+				if run.IsSucceeded() {
+					logger.WithFields(log.Fields{"run": runID, "status": run.Status}).Info("Terraform destroy run finished")
+					return stepDone
+				}
+				logger.WithFields(log.Fields{"run": runID, "status": run.Status}).Error("Terraform destroy run failed")
+				// new run is queued on the next iteration
+				if err := ns.patchAnnotations(k8sClient, map[string]*string{terraformRunAnnotationName: nil}); err != nil {
+					logger.Error(err)
+				}
+				return stepFailed
+			}
+			if run.Confirmable {
+				if err := settings.client.ApplyRun(runID, "Confirmed by "+componentName); err != nil {
+					logger.Error(err)
+					return stepFailed
+				}
+				logger.WithField("run", runID).Info("Confirmed Terraform destroy run")
+			}
+			if time.Now().After(deadline) {
+				logger.WithFields(log.Fields{"run": runID, "status": run.Status, "timeout": settings.timeout.String()}).Warn("Terraform destroy run didn't finish in time, will wait on next iteration")
+				return stepWaiting
+			}
+			time.Sleep(terraformPollDelay)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// branchCheckIntervalAnnotationName overrides BRANCH_CHECK_INTERVAL for namespace
+const branchCheckIntervalAnnotationName = "opuscapita.com/branch-check-interval"
+
+// how long branch deletion reported by webhook is remembered
+const deletedBranchHintTTL = 24 * time.Hour
+
+// BranchCheckInterval returns minimal interval between branch checks of namespace, annotation overrides global one
+func (ns *namespace) BranchCheckInterval(global time.Duration) time.Duration {
+	val, ok := ns.ObjectMeta.Annotations[branchCheckIntervalAnnotationName]
+	if !ok {
+		return global
+	}
+	interval, err := time.ParseDuration(val)
+	if err != nil || interval < 0 {
+		ns.logger().Warn("Annotation '" + branchCheckIntervalAnnotationName + "' should be non-negative duration, got '" + val + "', using global interval")
+		return global
+	}
+	return interval
+}
+
+// LastChecked returns time of the latest successful branch check, it's zero if it's unknown
+func (ns *namespace) LastChecked() time.Time {
+	lastChecked, err := time.Parse(time.RFC3339, ns.ObjectMeta.Annotations[lastCheckedAnnotationName])
+	if err != nil {
+		return time.Time{}
+	}
+	return lastChecked
+}
+
+// deletedBranchHints holds times when webhooks reported branches deleted by "owner/repo/branch" key,
+// namespaces of such branches are checked regardless of throttling
+var deletedBranchHints sync.Map
+
+// hintBranchDeleted remembers that branch of repository (e.g. "OpusCapita/app") is reported deleted
+func hintBranchDeleted(repo, branch string) {
+	now := time.Now()
+	deletedBranchHints.Range(func(key, val interface{}) bool {
+		if now.Sub(val.(time.Time)) > deletedBranchHintTTL {
+			deletedBranchHints.Delete(key)
+		}
+		return true
+	})
+	deletedBranchHints.Store(strings.ToLower(repo+"/"+branch), now)
+}
+
+// isCheckThrottled checks if branch of namespace was checked less than check interval ago. Only namespaces whose
+// branch was present on the latest check are throttled, so that confirmation of branch deletion isn't slowed down;
+// branch reported deleted by webhook after the latest check isn't throttled either.
+func isCheckThrottled(ns *namespace, global time.Duration, now time.Time) bool {
+	interval := ns.BranchCheckInterval(global)
+	lastChecked := ns.LastChecked()
+	if interval <= 0 || lastChecked.IsZero() || ns.BranchMissingCount() > 0 || !ns.DeleteAfter().IsZero() {
+		return false
+	}
+	if owner, repo, branch, err := ns.GithubBranch(); err == nil {
+		if hintedAt, ok := deletedBranchHints.Load(strings.ToLower(owner + "/" + repo + "/" + branch)); ok && hintedAt.(time.Time).After(lastChecked) {
+			return false
+		}
+	}
+	return now.Sub(lastChecked) < interval
+}
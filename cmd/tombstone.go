@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// tombstoneLabel marks ConfigMaps recording deleted namespaces, they're pruned after TOMBSTONE_RETENTION
+const tombstoneLabel = "opuscapita.com/tombstone"
+
+// tombstoneSettings configure tombstones of deleted namespaces
+type tombstoneSettings struct {
+	// retention is how long tombstone is kept, 0 disables tombstones
+	retention time.Duration
+	// namespace of ConfigMaps, it's the app's namespace
+	namespace string
+}
+
+// tombstoneName returns name of ConfigMap recording deletion of namespace
+func tombstoneName(ns string) string {
+	return fmt.Sprintf("%s-tombstone-%s", componentName, ns)
+}
+
+// deletionReason describes condition which initiated deletion of namespace
+func deletionReason(ns *namespace) string {
+	val, ok := namespaceStatuses.Load(ns.Name())
+	if !ok {
+		return "cleanup started earlier was resumed"
+	}
+	status := val.(*namespaceStatus)
+	reason := fmt.Sprintf("branch check returned status %d", status.branchStatus)
+	if count := ns.BranchMissingCount(); count > 0 {
+		reason += fmt.Sprintf(" on %d consecutive checks", count)
+	}
+	if !ns.DeleteAfter().IsZero() {
+		reason += ", grace period ended at " + ns.DeleteAfter().UTC().Format(time.RFC3339)
+	}
+	if approvedBy := ns.ObjectMeta.Annotations[approvedByAnnotationName]; approvedBy != "" {
+		reason += ", deletion was approved by " + approvedBy
+	}
+	return reason
+}
+
+// newTombstone returns ConfigMap recording deletion of namespace
+func newTombstone(ns *namespace, controllerNamespace string, deletedAt time.Time) *corev1.ConfigMap {
+	data := map[string]string{
+		"namespace":      ns.Name(),
+		"createdAt":      ns.CreationTimestamp.UTC().Format(time.RFC3339),
+		"deletedAt":      deletedAt.UTC().Format(time.RFC3339),
+		"reason":         deletionReason(ns),
+		"completedSteps": strings.Join(ns.CompletedSteps(), ","),
+	}
+	if sourceURL, err := ns.GithubSourceURL(); err == nil {
+		data["sourceURL"] = sourceURL
+	}
+	if owner, repo, branch, err := ns.GithubBranch(); err == nil {
+		data["repository"] = owner + "/" + repo
+		data["branch"] = branch
+	}
+	if release, err := ns.HelmRelease(); err == nil && ns.isStepCompleted(stepHelmRelease) {
+		data["helmReleases"] = release
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      tombstoneName(ns.Name()),
+			Namespace: controllerNamespace,
+			Labels:    map[string]string{managedByLabel: componentName, tombstoneLabel: "true", "opuscapita.com/namespace": ns.Name()},
+		},
+		Data: data,
+	}
+}
+
+// isTombstoneWrittenIfNeeded writes tombstone of deleted namespace to ConfigMap in the app's namespace,
+// tombstone of previous namespace with the same name is replaced; failure is logged only since namespace is gone
+func isTombstoneWrittenIfNeeded(k8sClient kubernetes.Interface, settings tombstoneSettings) func(*namespace) bool {
+	return func(ns *namespace) bool {
+		if settings.retention <= 0 {
+			return true
+		}
+
+		cm := newTombstone(ns, settings.namespace, time.Now())
+		configMaps := k8sClient.CoreV1().ConfigMaps(settings.namespace)
+		_, err := configMaps.Create(cm)
+		if errors.IsAlreadyExists(err) {
+			_, err = configMaps.Update(cm)
+		}
+		if err != nil {
+			ns.logger().WithError(err).Error("Failed to write tombstone")
+			return true
+		}
+		ns.logger().WithField("configmap", cm.Namespace+"/"+cm.Name).Debug("Tombstone is written")
+		return true
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/OpusCapita/buhtig-s8k/pkg/otlp"
+)
+
+// otlpSettings configure export of telemetry with OTLP/HTTP, standard OTEL_* env variables are used
+type otlpSettings struct {
+	// endpoint of OTLP receiver, e.g. "http://otel-collector:4318"; empty value disables export
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	// metricsExporter is "otlp" to push metrics besides serving them to Prometheus, or "none"
+	metricsExporter string
+	metricsInterval time.Duration
+}
+
+// tracer records spans of iterations and namespaces; it's nil if tracing is disabled, spans are nil then
+var tracer *otlp.Tracer
+
+// iterationSpan is span of current iteration, spans of namespaces entering the pipeline are its children
+var iterationSpan *otlp.Span
+
+// setupTracing enables tracing if OTLP endpoint is configured
+func setupTracing(settings otlpSettings) {
+	if settings.endpoint == "" {
+		return
+	}
+	tracer = otlp.NewTracer(otlp.NewExporter(settings.endpoint, settings.serviceName, settings.headers), "buhtig-s8k")
+	log.Info("Traces are exported to " + settings.endpoint)
+}
+
+// namespaceTrace holds span of namespace's journey through the pipeline and the innermost open span of its stages,
+// spans of stages are nested since namespace passes pipeline stages one by one
+type namespaceTrace struct {
+	mu            sync.Mutex
+	root, current *otlp.Span
+}
+
+// namespaceTraces holds traces of namespaces being processed in current iteration by namespace name
+var namespaceTraces sync.Map
+
+// startNamespaceSpan starts span of namespace's journey through the pipeline as a child of iteration span
+func startNamespaceSpan(ns *namespace) {
+	span := tracer.Start(iterationSpan, "namespace")
+	if span == nil {
+		return
+	}
+	span.SetAttribute("k8s.namespace.name", ns.Name())
+	if _, correlation := correlationIDs(ns); correlation != "" {
+		span.SetAttribute("buhtig_s8k.correlation_id", correlation)
+	}
+	namespaceTraces.Store(ns.Name(), &namespaceTrace{root: span, current: span})
+}
+
+// endNamespaceSpan ends span of namespace (and spans of stages left open) once namespace leaves the pipeline
+func endNamespaceSpan(name string, completed bool) {
+	val, ok := namespaceTraces.Load(name)
+	if !ok {
+		return
+	}
+	namespaceTraces.Delete(name)
+	trace := val.(*namespaceTrace)
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	for span := trace.current; span != trace.root && span != nil; span = span.Parent() {
+		span.End(nil)
+	}
+	trace.root.SetAttribute("buhtig_s8k.completed", completed)
+	trace.root.End(nil)
+}
+
+// startSpan starts span of stage as a child of the innermost open span of namespace, it's nil if namespace
+// isn't traced
+func startSpan(ns *namespace, name string) *otlp.Span {
+	return pushSpan(ns, func(parent *otlp.Span) *otlp.Span { return tracer.Start(parent, name) })
+}
+
+// startClientSpan starts span of call to remote service (Github API, Kubernetes API, etc.) like startSpan
+func startClientSpan(ns *namespace, name string) *otlp.Span {
+	return pushSpan(ns, func(parent *otlp.Span) *otlp.Span { return tracer.StartClient(parent, name) })
+}
+
+func pushSpan(ns *namespace, start func(parent *otlp.Span) *otlp.Span) *otlp.Span {
+	val, ok := namespaceTraces.Load(ns.Name())
+	if !ok {
+		return nil
+	}
+	trace := val.(*namespaceTrace)
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	trace.current = start(trace.current)
+	return trace.current
+}
+
+// endSpan ends span of stage started by startSpan
+func endSpan(ns *namespace, span *otlp.Span, err error) {
+	if span == nil {
+		return
+	}
+	span.End(err)
+	if val, ok := namespaceTraces.Load(ns.Name()); ok {
+		trace := val.(*namespaceTrace)
+		trace.mu.Lock()
+		if trace.current == span {
+			trace.current = span.Parent()
+		}
+		trace.mu.Unlock()
+	}
+}
+
+// endIterationSpan ends spans of namespaces which didn't leave the pipeline and iteration span, then exports them
+func endIterationSpan(completed int) {
+	iteration := iterationSpan
+	if iteration == nil {
+		return
+	}
+	namespaceTraces.Range(func(name, _ interface{}) bool {
+		endNamespaceSpan(name.(string), false)
+		return true
+	})
+	iteration.SetAttribute("buhtig_s8k.namespaces_completed", completed)
+	iteration.End(nil)
+
+	dropped, err := tracer.Flush()
+	if err != nil {
+		log.Error("Failed to export traces")
+		log.Error(err)
+	}
+	if dropped > 0 {
+		log.WithField("dropped", dropped).Warn("Spans were dropped, too many spans were recorded since the last export")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+
+	log "github.com/sirupsen/logrus"
+
+	github "github.com/OpusCapita/buhtig-s8k/pkg/github"
+)
+
+// version of the app, injected at build time via -ldflags "-X main.version=..."
+var version = "dev"
+
+// runUpdateChecker periodically checks Github releases of the app and reports if newer version is available
+func runUpdateChecker(ghClient *github.Client, repo string, interval time.Duration) {
+	parts := strings.SplitN(repo, "/", 2)
+	if repo == "" || interval <= 0 || len(parts) != 2 {
+		log.Info("Update check is disabled")
+		return
+	}
+
+	current, err := semver.NewVersion(version)
+	if err != nil {
+		log.Debug(fmt.Sprintf("Version '%s' is not a semantic version, update check is disabled", version))
+		return
+	}
+
+	go func() {
+		notified := ""
+		for {
+			latest, err := checkForUpdate(ghClient, parts[0], parts[1], current)
+			if err != nil {
+				log.Warn("Failed to check for updates")
+				log.Warn(err)
+			} else if latest != nil && latest.TagName != notified {
+				log.WithFields(log.Fields{"latest": latest.TagName, "running": version, "url": latest.HTMLURL}).Warn("New version is available")
+				notified = latest.TagName
+			}
+			<-time.After(interval)
+		}
+	}()
+}
+
+// checkForUpdate returns latest release if it's newer than current version, nil otherwise;
+// updateAvailableGauge is updated accordingly
+func checkForUpdate(ghClient *github.Client, owner, repo string, current *semver.Version) (*github.Release, error) {
+	release, err := ghClient.LatestRelease(owner, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := semver.NewVersion(release.TagName)
+	if err != nil {
+		return nil, fmt.Errorf("Release tag '%s' is not a semantic version: %v", release.TagName, err)
+	}
+
+	updateAvailableGauge.Reset()
+	if !latest.GreaterThan(current) {
+		updateAvailableGauge.WithLabelValues(version, release.TagName, release.HTMLURL).Set(0)
+		return nil, nil
+	}
+	updateAvailableGauge.WithLabelValues(version, release.TagName, release.HTMLURL).Set(1)
+	return release, nil
+}
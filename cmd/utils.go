@@ -4,7 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -24,6 +26,82 @@ func assertEnv(vars ...string) {
 	log.Info("Environment is fine")
 }
 
+// envOrDefault returns value of env variable or provided default if it's not defined
+func envOrDefault(name, def string) string {
+	if val, ok := os.LookupEnv(name); ok {
+		return val
+	}
+	return def
+}
+
+// envDuration parses env variable as time.Duration (e.g. "90s", "24h");
+// it exits if value is malformed because misconfiguration should be noticed immediately
+func envDuration(name string, def time.Duration) time.Duration {
+	val, ok := os.LookupEnv(name)
+	if !ok || val == "" {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Env %s is not a valid duration: %v", name, err))
+	}
+	return d
+}
+
+// envList parses env variable as comma-separated list, empty items are dropped
+func envList(name string, def []string) []string {
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	list := []string{}
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// envInt parses env variable as integer; it exits if value is malformed
+func envInt(name string, def int) int {
+	val, ok := os.LookupEnv(name)
+	if !ok || val == "" {
+		return def
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Env %s is not a valid integer: %v", name, err))
+	}
+	return i
+}
+
+// envFloat parses env variable as floating point number; it exits if value is malformed
+func envFloat(name string, def float64) float64 {
+	val, ok := os.LookupEnv(name)
+	if !ok || val == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Env %s is not a valid number: %v", name, err))
+	}
+	return f
+}
+
+// envBool parses env variable as boolean ("true", "1", "false", etc.); it exits if value is malformed
+func envBool(name string, def bool) bool {
+	val, ok := os.LookupEnv(name)
+	if !ok || val == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("Env %s is not a valid boolean: %v", name, err))
+	}
+	return b
+}
+
 // prettyPrint prints arbitrary structure in human-readable format
 func prettyPrint(i interface{}) string {
 	s, _ := json.MarshalIndent(i, "", "\t")
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+
+	aws "github.com/OpusCapita/buhtig-s8k/pkg/aws"
+	azure "github.com/OpusCapita/buhtig-s8k/pkg/azure"
+	bitbucket "github.com/OpusCapita/buhtig-s8k/pkg/bitbucket"
+	codecommit "github.com/OpusCapita/buhtig-s8k/pkg/codecommit"
+	gitea "github.com/OpusCapita/buhtig-s8k/pkg/gitea"
+	github "github.com/OpusCapita/buhtig-s8k/pkg/github"
+	gitlab "github.com/OpusCapita/buhtig-s8k/pkg/gitlab"
+	vcs "github.com/OpusCapita/buhtig-s8k/pkg/vcs"
+)
+
+// environment variables with credentials of VCS providers (GH_TOKEN is required and defined in main.go)
+const (
+	gitlabTokenEnv = "GITLAB_TOKEN"
+
+	bitbucketUsernameEnv    = "BITBUCKET_USERNAME"
+	bitbucketAppPasswordEnv = "BITBUCKET_APP_PASSWORD"
+	bitbucketServerURLEnv   = "BITBUCKET_SERVER_URL"
+	bitbucketServerTokenEnv = "BITBUCKET_SERVER_TOKEN"
+
+	giteaURLEnv   = "GITEA_URL"
+	giteaTokenEnv = "GITEA_TOKEN"
+
+	azureDevOpsTokenEnv = "AZURE_DEVOPS_TOKEN"
+)
+
+// vcsProviders selects VCS provider by source URL of namespace
+var vcsProviders = vcs.NewRegistry()
+
+// registerVCSProviders registers all supported providers; self-hosted ones match only URLs of configured instances.
+// Named providers from config file are registered too, they are used only by namespaces selecting them explicitly.
+func registerVCSProviders(targets []vcsProviderTarget) {
+	if os.Getenv(bitbucketServerURLEnv) != "" {
+		vcsProviders.Register(bitbucket.NewServerClient(os.Getenv(bitbucketServerURLEnv), os.Getenv(bitbucketServerTokenEnv)))
+	}
+	if os.Getenv(giteaURLEnv) != "" {
+		vcsProviders.Register(gitea.NewClient(os.Getenv(giteaURLEnv), os.Getenv(giteaTokenEnv)))
+	}
+	vcsProviders.Register(ghClient)
+	githubRateLimits.add("github", ghTokenEnv, ghClient)
+	vcsProviders.Register(bitbucket.NewCloudClient(os.Getenv(bitbucketUsernameEnv), os.Getenv(bitbucketAppPasswordEnv)))
+	vcsProviders.Register(azure.NewClient(os.Getenv(azureDevOpsTokenEnv)))
+	if sess, err := aws.NewSession(); err != nil {
+		log.WithError(err).Warn("AWS session can't be created, CodeCommit branches won't be checked")
+	} else {
+		vcsProviders.Register(codecommit.NewClient(sess))
+	}
+	// GitLab matches URLs of any host by its '/-/tree/' path, so it goes last
+	vcsProviders.Register(gitlab.NewClient(os.Getenv(gitlabTokenEnv)))
+
+	for _, target := range targets {
+		provider, err := newVCSProvider(target)
+		if err != nil {
+			log.Fatal(err)
+		}
+		vcsProviders.RegisterNamed(target.Name, provider)
+		if client, ok := provider.(*github.Client); ok {
+			githubRateLimits.add(target.Name, target.TokenEnv, client)
+		}
+	}
+}
+
+// newVCSProvider builds named provider from config
+func newVCSProvider(target vcsProviderTarget) (vcs.Provider, error) {
+	if target.Name == "" {
+		return nil, fmt.Errorf("VCS provider of type '%s' has no name", target.Type)
+	}
+	token := os.Getenv(target.TokenEnv)
+	switch target.Type {
+	case "github":
+		if target.URL == "" {
+			return github.NewClient(token), nil
+		}
+		return github.NewEnterpriseClient(target.URL, token), nil
+	case "gitlab":
+		return gitlab.NewClient(token), nil
+	case "bitbucket-cloud":
+		return bitbucket.NewCloudClient(os.Getenv(target.UsernameEnv), os.Getenv(target.PasswordEnv)), nil
+	case "bitbucket-server":
+		return bitbucket.NewServerClient(target.URL, token), nil
+	case "gitea":
+		return gitea.NewClient(target.URL, token), nil
+	case "azure-devops":
+		return azure.NewClient(token), nil
+	case "codecommit":
+		sess, err := aws.NewSession()
+		if err != nil {
+			return nil, err
+		}
+		return codecommit.NewClient(sess), nil
+	}
+	return nil, fmt.Errorf("Unknown type '%s' of VCS provider '%s'", target.Type, target.Name)
+}
+
+// lookupProvider returns VCS provider of namespace: it's selected by annotation if present, otherwise it's detected from URL
+func lookupProvider(ns *namespace, sourceURL string) (vcs.Provider, error) {
+	if name := ns.ObjectMeta.Annotations[vcsProviderAnnotationName]; name != "" {
+		return vcsProviders.Named(name)
+	}
+	return vcsProviders.Lookup(sourceURL)
+}
+
+// rateLimitWarnings holds reset time of the last rate limit warning by provider name, so it's logged once per pause
+var rateLimitWarnings sync.Map
+
+// rateLimitedUntil returns time when exhausted rate limit of provider resets, zero time if requests can be sent
+func rateLimitedUntil(provider vcs.Provider) time.Time {
+	limiter, ok := provider.(vcs.RateLimiter)
+	if !ok {
+		return time.Time{}
+	}
+
+	reset := limiter.RateLimitedUntil()
+	if !reset.IsZero() {
+		if warned, ok := rateLimitWarnings.Load(provider.Name()); !ok || !warned.(time.Time).Equal(reset) {
+			log.WithFields(log.Fields{"provider": provider.Name(), "rate_limit_reset": reset.Format(time.RFC3339)}).Warn("Rate limit is exhausted, branch checks are paused")
+			rateLimitWarnings.Store(provider.Name(), reset)
+		}
+	}
+	return reset
+}
+
+// githubRateLimitCollector exports rate limits of Github clients, it reads them on scrape so values are as fresh
+// as the latest response of Github
+type githubRateLimitCollector struct {
+	mu      sync.Mutex
+	clients []githubRateLimitClient
+
+	remaining, reset *prometheus.Desc
+}
+
+// githubRateLimitClient is Github client labeled by provider name and env variable of its token, which identifies
+// token without exposing it
+type githubRateLimitClient struct {
+	provider, token string
+	client          *github.Client
+}
+
+var githubRateLimits = &githubRateLimitCollector{
+	remaining: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", "github_rate_limit_remaining"),
+		"Number of Github API requests left in the current rate limit window, by provider and token.", []string{"provider", "token"}, nil),
+	reset: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", "github_rate_limit_reset_seconds"),
+		"Seconds until Github API rate limit resets, by provider and token.", []string{"provider", "token"}, nil),
+}
+
+func init() {
+	prometheus.MustRegister(githubRateLimits)
+}
+
+func (c *githubRateLimitCollector) add(provider, token string, client *github.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clients = append(c.clients, githubRateLimitClient{provider: provider, token: token, client: client})
+}
+
+// requests returns number of requests sent to Github API by all clients
+func (c *githubRateLimitCollector) requests() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var total int64
+	for _, gh := range c.clients {
+		total += gh.client.Requests()
+	}
+	return total
+}
+
+// Describe implements prometheus.Collector
+func (c *githubRateLimitCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.remaining
+	ch <- c.reset
+}
+
+// Collect implements prometheus.Collector, clients which haven't received rate limit yet are omitted
+func (c *githubRateLimitCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, gh := range c.clients {
+		remaining, reset, ok := gh.client.RateLimit()
+		if !ok {
+			continue
+		}
+		untilReset := time.Until(reset).Seconds()
+		if untilReset < 0 {
+			untilReset = 0
+		}
+		ch <- prometheus.MustNewConstMetric(c.remaining, prometheus.GaugeValue, float64(remaining), gh.provider, gh.token)
+		ch <- prometheus.MustNewConstMetric(c.reset, prometheus.GaugeValue, untilReset, gh.provider, gh.token)
+	}
+}
+
+// checkSourceBranch checks branch referenced by source URL and returns HTTP status of the check;
+// if branch is missing then repository is checked too and its status is returned as repoStatus
+func checkSourceBranch(provider vcs.Provider, sourceURL string) (branchStatus, repoStatus int, err error) {
+	if branchStatus, err = provider.CheckBranch(sourceURL); err != nil || branchStatus != 404 {
+		return branchStatus, 0, err
+	}
+	// verify that repository itself is accessible, most providers respond with 404 for branches of missing repository too
+	repoStatus, err = provider.CheckRepo(sourceURL)
+	return branchStatus, repoStatus, err
+}
+
+// branchCache deduplicates branch checks within an iteration: namespaces referencing the same branch
+// share result of a single check, concurrent callers wait for the check in flight. It's safe for concurrent use.
+type branchCache struct {
+	mu    sync.Mutex
+	calls map[string]*branchCacheCall
+}
+
+type branchCacheCall struct {
+	done                     chan struct{}
+	branchStatus, repoStatus int
+	err                      error
+}
+
+func newBranchCache() *branchCache {
+	return &branchCache{calls: map[string]*branchCacheCall{}}
+}
+
+// branchCacheKey identifies branch of namespace in cache, the same branch may be referenced by several namespaces
+func branchCacheKey(ns *namespace, sourceURL string) string {
+	return ns.ObjectMeta.Annotations[vcsProviderAnnotationName] + " " + strings.TrimSuffix(sourceURL, "/")
+}
+
+// cached returns result of completed check for key, ok is false if branch wasn't checked (yet)
+func (c *branchCache) cached(key string) (branchStatus, repoStatus int, ok bool) {
+	c.mu.Lock()
+	call, found := c.calls[key]
+	c.mu.Unlock()
+	if !found {
+		return 0, 0, false
+	}
+	select {
+	case <-call.done:
+		return call.branchStatus, call.repoStatus, call.err == nil
+	default:
+		return 0, 0, false
+	}
+}
+
+// check returns cached result for key or calls checkSourceBranch
+func (c *branchCache) check(key string, provider vcs.Provider, sourceURL string) (branchStatus, repoStatus int, err error) {
+	c.mu.Lock()
+	call, ok := c.calls[key]
+	if !ok {
+		call = &branchCacheCall{done: make(chan struct{})}
+		c.calls[key] = call
+	}
+	c.mu.Unlock()
+
+	if ok {
+		<-call.done
+		return call.branchStatus, call.repoStatus, call.err
+	}
+
+	call.branchStatus, call.repoStatus, call.err = checkSourceBranch(provider, sourceURL)
+	close(call.done)
+	return call.branchStatus, call.repoStatus, call.err
+}
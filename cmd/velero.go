@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+
+	log "github.com/sirupsen/logrus"
+
+	cleanup "github.com/OpusCapita/buhtig-s8k/pkg/cleanup"
+)
+
+var (
+	veleroBackupKind = schema.GroupVersionKind{Group: "velero.io", Version: "v1", Kind: "Backup"}
+	veleroPollDelay  = 10 * time.Second
+)
+
+// veleroSettings configure Velero backup of namespace before deletion
+type veleroSettings struct {
+	enabled bool
+	// namespace where Velero is installed
+	namespace       string
+	ttl             time.Duration
+	storageLocation string
+	timeout         time.Duration
+}
+
+// newVeleroBackup returns Backup of the namespace
+func newVeleroBackup(ns *namespace, settings veleroSettings) *unstructured.Unstructured {
+	name := fmt.Sprintf("%s-%d", ns.Name(), time.Now().Unix())
+	// names of Backups are also used as labels by Velero, so they're limited to 63 characters
+	if len(name) > 63 {
+		name = fmt.Sprintf("%s-%d", ns.Name()[:63-11], time.Now().Unix())
+	}
+	spec := map[string]interface{}{
+		"includedNamespaces": []interface{}{ns.Name()},
+		"ttl":                settings.ttl.String(),
+	}
+	if settings.storageLocation != "" {
+		spec["storageLocation"] = settings.storageLocation
+	}
+
+	backup := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	backup.SetGroupVersionKind(veleroBackupKind)
+	backup.SetNamespace(settings.namespace)
+	backup.SetName(name)
+	backup.SetLabels(map[string]string{managedByLabel: componentName, "opuscapita.com/namespace": ns.Name()})
+	return backup
+}
+
+// isBackedUpIfNeeded creates Velero Backup of the namespace and waits for its completion before anything is deleted,
+// giving operators a restore path when namespace is removed by mistake (e.g. due to transient 404 of branch check).
+// Name of Backup is kept in namespace annotation, so that it's waited for on the next iteration if it takes longer
+// than timeout. Failed Backup is forgotten and a new one is created on the next iteration.
+func isBackedUpIfNeeded(k8sClient kubernetes.Interface, deleter *cleanup.Deleter, settings veleroSettings) func(*namespace) stepResult {
+	return func(ns *namespace) stepResult {
+		if !settings.enabled {
+			return stepDone
+		}
+		logger := ns.logger()
+
+		name := ns.ObjectMeta.Annotations[veleroBackupAnnotationName]
+		if name == "" {
+			backup := newVeleroBackup(ns, settings)
+			err := deleter.Create(backup)
+			auditAction(ns, "create-velero-backup", err, map[string]string{"backup": backup.GetNamespace() + "/" + backup.GetName()})
+			if err != nil {
+				logger.WithError(err).Error("Failed to create Velero Backup")
+				return stepFailed
+			}
+			name = backup.GetName()
+			if err := ns.patchAnnotations(k8sClient, map[string]*string{veleroBackupAnnotationName: &name}); err != nil {
+				logger.Error(err)
+				return stepFailed
+			}
+			logger.WithField("backup", name).Info("Created Velero Backup")
+		}
+
+		obj := cleanup.Object{GroupVersionKind: veleroBackupKind, Namespace: settings.namespace, Name: name}
+		deadline := time.Now().Add(settings.timeout)
+		for {
+			backup, err := deleter.Get(obj)
+			if err != nil {
+				logger.WithField("backup", name).WithError(err).Error("Failed to get Velero Backup")
+				return stepFailed
+			}
+
+			phase := ""
+			if backup != nil {
+				phase, _, _ = unstructured.NestedString(backup.Object, "status", "phase")
+			}
+			switch phase {
+			case "Completed":
+				logger.WithField("backup", name).Info("Velero Backup completed")
+				return stepDone
+			case "", "New", "InProgress":
+				if backup == nil {
+					logger.WithField("backup", name).Error("Velero Backup is gone")
+					break
+				}
+				if time.Now().After(deadline) {
+					logger.WithFields(log.Fields{"backup": name, "timeout": settings.timeout.String()}).Warn("Velero Backup didn't complete in time, will wait on next iteration")
+					return stepWaiting
+				}
+				time.Sleep(veleroPollDelay)
+				continue
+			default:
+				// e.g. Failed, PartiallyFailed or FailedValidation
+				logger.WithFields(log.Fields{"backup": name, "phase": phase}).Error("Velero Backup failed")
+			}
+
+			// new Backup is created on the next iteration
+			if err := ns.patchAnnotations(k8sClient, map[string]*string{veleroBackupAnnotationName: nil}); err != nil {
+				logger.Error(err)
+			}
+			return stepFailed
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	webhook "github.com/OpusCapita/buhtig-s8k/pkg/webhook"
+)
+
+// max size of webhook payload, Github caps payloads at 25MB but 'delete' events are tiny
+const maxWebhookPayloadBytes = 1024 * 1024
+
+// iterationTrigger requests an iteration to start before regular schedule; buffer of 1 coalesces requests
+var iterationTrigger = make(chan struct{}, 1)
+
+// triggerIteration asks main loop to start next iteration as soon as current one completes
+func triggerIteration() {
+	select {
+	case iterationTrigger <- struct{}{}:
+	default:
+		// iteration is already requested
+	}
+}
+
+// webhookMux serves webhook listener, other features (e.g. Slack approvals) register their callbacks on it
+var webhookMux = http.NewServeMux()
+
+// startWebhookServer starts listener receiving Github webhooks; 'delete' events for branches trigger
+// an early iteration so environments are cleaned up without waiting for the next scheduled run.
+// Every request must be signed with secret (X-Hub-Signature-256) and deliveries and payloads are accepted only once.
+// Github endpoint is disabled if secret isn't set, listener still serves callbacks registered by other features.
+func startWebhookServer(addr, secret string) {
+	if addr == "" {
+		return
+	}
+	if secret != "" {
+		registerGithubWebhook(secret)
+	} else {
+		log.Warn(fmt.Sprintf("Env %s isn't set, Github webhooks are disabled", webhookSecretEnv))
+	}
+
+	go func() {
+		log.Info("Starting webhook listener on " + addr)
+		if err := http.ListenAndServe(addr, webhookMux); err != nil {
+			log.Error("Webhook listener failed")
+			log.Error(err)
+		}
+	}()
+}
+
+// registerGithubWebhook exposes '/webhook/github' endpoint verifying payloads with secret
+func registerGithubWebhook(secret string) {
+	webhookMux.HandleFunc("/webhook/github", githubWebhookHandler(secret))
+}
+
+// githubWebhookHandler verifies payloads with secret and rejects replays. Delivery ID header isn't signed, so
+// replayed payload with a fresh ID is caught by digest of the payload itself.
+func githubWebhookHandler(secret string) http.HandlerFunc {
+	deliveries := webhook.NewDeliveryCache(24*time.Hour, 10000)
+	payloads := webhook.NewDeliveryCache(24*time.Hour, 10000)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := log.WithFields(log.Fields{"delivery": r.Header.Get(webhook.DeliveryHeader)})
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayloadBytes))
+		if err != nil {
+			http.Error(w, "failed to read payload", http.StatusBadRequest)
+			return
+		}
+
+		if err := webhook.VerifySignature([]byte(secret), body, r.Header.Get(webhook.SignatureHeader)); err != nil {
+			logger.Warn("Rejected webhook: " + err.Error())
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		// signature is checked first, so that unauthenticated requests can't poison the cache
+		delivery := r.Header.Get(webhook.DeliveryHeader)
+		if delivery == "" {
+			http.Error(w, "delivery ID is missing", http.StatusBadRequest)
+			return
+		}
+		if deliveries.Seen(delivery) {
+			logger.Warn("Rejected replayed webhook delivery")
+			http.Error(w, "delivery was already processed", http.StatusConflict)
+			return
+		}
+		if payloads.Seen(webhook.Digest(body)) {
+			logger.Warn("Rejected replayed webhook payload")
+			http.Error(w, "payload was already processed", http.StatusConflict)
+			return
+		}
+
+		event := r.Header.Get("X-GitHub-Event")
+		if event == "delete" {
+			payload := struct {
+				Ref        string `json:"ref"`
+				RefType    string `json:"ref_type"`
+				Repository struct {
+					FullName string `json:"full_name"`
+				} `json:"repository"`
+			}{}
+			if err := json.Unmarshal(body, &payload); err != nil {
+				http.Error(w, "malformed payload", http.StatusBadRequest)
+				return
+			}
+			if payload.RefType == "branch" {
+				logger.WithFields(log.Fields{"repo": payload.Repository.FullName, "branch": payload.Ref}).Info("Branch deleted, triggering iteration")
+				hintBranchDeleted(payload.Repository.FullName, payload.Ref)
+				triggerIteration()
+			}
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
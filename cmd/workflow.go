@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// workflowPollDelay is how often state of teardown workflow run is checked
+var workflowPollDelay = 10 * time.Second
+
+// teardownWorkflowSettings configure Github Actions workflow run before environment is deleted
+type teardownWorkflowSettings struct {
+	// workflow is the default file name (or ID) of workflow, it's overridden by namespace annotation;
+	// empty means there's no workflow by default
+	workflow string
+	// ref which workflow is run on, default branch of repository if empty (branch of namespace is already deleted)
+	ref     string
+	timeout time.Duration
+}
+
+// teardownWorkflow returns workflow of namespace, it's empty if there's none
+func teardownWorkflow(ns *namespace, settings teardownWorkflowSettings) string {
+	if val, ok := ns.ObjectMeta.Annotations[teardownWorkflowAnnotationName]; ok {
+		return strings.TrimSpace(val)
+	}
+	return settings.workflow
+}
+
+// isTeardownWorkflowCompletedIfNeeded dispatches workflow_dispatch event of Github Actions workflow with 'branch', 'namespace'
+// and 'correlation_id' inputs and waits for the run to succeed, so that repositories can own custom teardown logic.
+// Github doesn't tell which run is created by dispatch, so the earliest one created afterwards whose 'run-name' contains
+// correlation ID (UID of namespace) is waited for; dispatches of other namespaces on the same ref can't be mistaken for it.
+// Dispatch time and run ID are kept in namespace annotations, so that run is waited for on the next iteration if it takes
+// longer than timeout; failed run is forgotten and workflow is dispatched again on the next iteration.
+func isTeardownWorkflowCompletedIfNeeded(k8sClient kubernetes.Interface, settings teardownWorkflowSettings) func(*namespace) stepResult {
+	return func(ns *namespace) stepResult {
+		workflow := teardownWorkflow(ns, settings)
+		if workflow == "" || !ns.IsGithubSource() {
+			return stepDone
+		}
+
+		logger := ns.logger()
+
+		owner, repo, branch, err := ns.GithubBranch()
+		if err != nil {
+			logger.Error(err)
+			return stepFailed
+		}
+
+		ref := settings.ref
+		if ref == "" {
+			if ref, err = ghClient.DefaultBranch(owner, repo); err != nil {
+				logger.Error(err)
+				return stepFailed
+			}
+		}
+
+		var runID int64
+		if val := ns.ObjectMeta.Annotations[teardownWorkflowRunAnnotationName]; val != "" {
+			if runID, err = strconv.ParseInt(val, 10, 64); err != nil {
+				logger.WithFields(log.Fields{"annotation": teardownWorkflowRunAnnotationName, "value": val}).Error("Annotation should be ID of workflow run")
+				return stepFailed
+			}
+		}
+
+		dispatchedAt, err := time.Parse(time.RFC3339, ns.ObjectMeta.Annotations[teardownWorkflowDispatchedAnnotationName])
+		if runID == 0 && err != nil {
+			// run is created after dispatch, Github reports its creation time with seconds precision
+			dispatchedAt = time.Now().Truncate(time.Second)
+			err := ghClient.DispatchWorkflow(owner, repo, workflow, ref, map[string]string{"branch": branch, "namespace": ns.Name(), "correlation_id": string(ns.UID)})
+			auditAction(ns, "dispatch-workflow", err, map[string]string{"repository": owner + "/" + repo, "workflow": workflow, "ref": ref})
+			if err != nil {
+				logger.Error(err)
+				return stepFailed
+			}
+			val := dispatchedAt.UTC().Format(time.RFC3339)
+			if err := ns.patchAnnotations(k8sClient, map[string]*string{teardownWorkflowDispatchedAnnotationName: &val}); err != nil {
+				logger.Error(err)
+				return stepFailed
+			}
+			logger.WithFields(log.Fields{"workflow": workflow, "ref": ref}).Info("Dispatched workflow")
+		}
+
+		deadline := time.Now().Add(settings.timeout)
+		for {
+			if runID == 0 {
+				run, err := ghClient.FindWorkflowRun(owner, repo, workflow, ref, dispatchedAt, string(ns.UID))
+				if err != nil {
+					logger.Error(err)
+					return stepFailed
+				}
+				if run != nil {
+					runID = run.ID
+					val := strconv.FormatInt(runID, 10)
+					if err := ns.patchAnnotations(k8sClient, map[string]*string{teardownWorkflowRunAnnotationName: &val}); err != nil {
+						logger.Error(err)
+						return stepFailed
+					}
+					logger.WithField("url", run.HTMLURL).Info("Waiting for workflow run")
+				}
+			}
+
+			if runID != 0 {
+				run, err := ghClient.GetWorkflowRun(owner, repo, runID)
+				if err != nil {
+					logger.Error(err)
+					return stepFailed
+				}
+				if run.IsCompleted() {
+					if run.IsSucceeded() {
+						logger.WithFields(log.Fields{"run": runID, "conclusion": run.Conclusion}).Info("Workflow run finished")
+						return stepDone
+					}
+					logger.WithFields(log.Fields{"url": run.HTMLURL, "conclusion": run.Conclusion}).Error("Workflow run failed")
+					// workflow is dispatched again on the next iteration
+					if err := ns.patchAnnotations(k8sClient, map[string]*string{teardownWorkflowRunAnnotationName: nil, teardownWorkflowDispatchedAnnotationName: nil}); err != nil {
+						logger.Error(err)
+					}
+					return stepFailed
+				}
+			}
+
+			if time.Now().After(deadline) {
+				logger.WithFields(log.Fields{"workflow": workflow, "timeout": settings.timeout.String()}).Warn("Workflow didn't finish in time, will wait on next iteration")
+				return stepWaiting
+			}
+			time.Sleep(workflowPollDelay)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Package admission serves Kubernetes admission webhooks: it decodes AdmissionReview sent by API server, passes its
+// request to handler and encodes response of the handler
+package admission
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// max size of AdmissionReview, API server limits objects to a few megabytes
+const maxReviewBytes = 3 * 1024 * 1024
+
+// Handler reviews admission request, UID of response is set by Serve
+type Handler func(*admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse
+
+// Serve returns HTTP handler of admission webhook
+func Serve(handler Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxReviewBytes))
+		if err != nil {
+			http.Error(w, "failed to read AdmissionReview", http.StatusBadRequest)
+			return
+		}
+		review := admissionv1beta1.AdmissionReview{}
+		if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+			http.Error(w, "malformed AdmissionReview", http.StatusBadRequest)
+			return
+		}
+
+		response := handler(review.Request)
+		response.UID = review.Request.UID
+		review.Request = nil
+		review.Response = response
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(review)
+	})
+}
+
+// Allow returns response admitting object
+func Allow() *admissionv1beta1.AdmissionResponse {
+	return &admissionv1beta1.AdmissionResponse{Allowed: true}
+}
+
+// Deny returns response rejecting object with message shown to user
+func Deny(message string) *admissionv1beta1.AdmissionResponse {
+	return &admissionv1beta1.AdmissionResponse{
+		Allowed: false,
+		Result:  &metav1.Status{Status: metav1.StatusFailure, Reason: metav1.StatusReasonInvalid, Message: message, Code: http.StatusUnprocessableEntity},
+	}
+}
+
+// PatchOperation is operation of JSON patch (RFC 6902)
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Patch returns response admitting object modified by JSON patch, empty patch admits object as is
+func Patch(ops []PatchOperation) (*admissionv1beta1.AdmissionResponse, error) {
+	response := Allow()
+	if len(ops) == 0 {
+		return response, nil
+	}
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	patchType := admissionv1beta1.PatchTypeJSONPatch
+	response.Patch = patch
+	response.PatchType = &patchType
+	return response, nil
+}
+
+// EscapePathSegment escapes key (e.g. annotation name with '/') for use in path of JSON patch
+func EscapePathSegment(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
@@ -0,0 +1,44 @@
+package admission
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestServe(t *testing.T) {
+	handler := Serve(func(req *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+		if req.Name == "bad" {
+			return Deny("bad name")
+		}
+		return Allow()
+	})
+
+	for name, allowed := range map[string]bool{"good": true, "bad": false} {
+		body, _ := json.Marshal(admissionv1beta1.AdmissionReview{Request: &admissionv1beta1.AdmissionRequest{UID: types.UID("uid-" + name), Name: name}})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body)))
+
+		review := admissionv1beta1.AdmissionReview{}
+		if err := json.Unmarshal(w.Body.Bytes(), &review); err != nil {
+			t.Fatal(err)
+		}
+		if review.Request != nil || review.Response == nil || review.Response.UID != types.UID("uid-"+name) || review.Response.Allowed != allowed {
+			t.Errorf("Unexpected review of %s: %+v", name, review)
+		}
+		if !allowed && review.Response.Result.Message != "bad name" {
+			t.Errorf("Expected message of denial, got %+v", review.Response.Result)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader([]byte("{}"))))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected review without request to be rejected, got %d", w.Code)
+	}
+}
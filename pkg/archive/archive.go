@@ -0,0 +1,135 @@
+// Package archive exports manifests of namespace and uploads them to object storage (S3 or GCS)
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// skippedResources aren't exported: events are noise and secrets are only exported on demand
+var skippedResources = map[schema.GroupResource]bool{
+	{Resource: "events"}:                         true,
+	{Group: "events.k8s.io", Resource: "events"}: true,
+}
+
+var secretsResource = schema.GroupResource{Resource: "secrets"}
+
+// Storage stores archives
+type Storage interface {
+	// Upload stores data of content type under key and returns URL of stored object
+	Upload(key, contentType string, data []byte) (string, error)
+}
+
+// ResourceDiscovery discovers namespaced resources served by the cluster, it's implemented by discovery client
+type ResourceDiscovery interface {
+	ServerPreferredNamespacedResources() ([]*metav1.APIResourceList, error)
+}
+
+// Exporter exports all namespaced resources of namespace
+type Exporter struct {
+	discovery     ResourceDiscovery
+	dynamicClient dynamic.Interface
+	// IncludeSecrets exports Secrets as well, they're skipped by default since archive may be less protected than cluster
+	IncludeSecrets bool
+}
+
+// NewExporter returns Exporter
+func NewExporter(discovery ResourceDiscovery, dynamicClient dynamic.Interface) *Exporter {
+	return &Exporter{discovery: discovery, dynamicClient: dynamicClient}
+}
+
+// Export returns gzipped tarball with YAML file per resource (e.g. 'deployments.apps.yaml') holding all objects of it
+func (e *Exporter) Export(namespace string) ([]byte, error) {
+	// partial discovery failures (e.g. unavailable aggregated APIs) shouldn't prevent export of the rest
+	resourceLists, err := e.discovery.ServerPreferredNamespacedResources()
+	if err != nil && len(resourceLists) == 0 {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+	for _, list := range resourceLists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, r := range list.APIResources {
+			gr := schema.GroupResource{Group: gv.Group, Resource: r.Name}
+			if strings.Contains(r.Name, "/") || skippedResources[gr] || gr == secretsResource && !e.IncludeSecrets || !hasVerb(r.Verbs, "list") {
+				continue
+			}
+
+			objects, err := e.dynamicClient.Resource(gv.WithResource(r.Name)).Namespace(namespace).List(metav1.ListOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("Failed to list %s: %v", gr, err)
+			}
+			if len(objects.Items) == 0 {
+				continue
+			}
+			for i := range objects.Items {
+				cleanObject(&objects.Items[i])
+			}
+			data, err := yaml.Marshal(objects)
+			if err != nil {
+				return nil, err
+			}
+			files[gr.String()+".yaml"] = data
+		}
+	}
+	return tarball(files)
+}
+
+// cleanObject removes fields which are meaningless outside of the cluster
+func cleanObject(obj *unstructured.Unstructured) {
+	unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "selfLink")
+}
+
+func hasVerb(verbs []string, verb string) bool {
+	for _, v := range verbs {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
+
+// tarball packs files into gzipped tar in order of their names
+func tarball(files map[string][]byte) ([]byte, error) {
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, name := range names {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), ModTime: now}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,134 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+type staticDiscovery []*metav1.APIResourceList
+
+func (d staticDiscovery) ServerPreferredNamespacedResources() ([]*metav1.APIResourceList, error) {
+	return d, nil
+}
+
+func newObject(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func untar(t *testing.T, data []byte) map[string]string {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		content, _ := ioutil.ReadAll(tr)
+		files[header.Name] = string(content)
+	}
+	return files
+}
+
+func TestExporter_Export(t *testing.T) {
+	verbs := metav1.Verbs{"list", "get"}
+	discovery := staticDiscovery{
+		{GroupVersion: "v1", APIResources: []metav1.APIResource{
+			{Name: "configmaps", Kind: "ConfigMap", Namespaced: true, Verbs: verbs},
+			{Name: "secrets", Kind: "Secret", Namespaced: true, Verbs: verbs},
+			{Name: "events", Kind: "Event", Namespaced: true, Verbs: verbs},
+			{Name: "pods/log", Kind: "Pod", Namespaced: true, Verbs: metav1.Verbs{"get"}},
+		}},
+		{GroupVersion: "apps/v1", APIResources: []metav1.APIResource{
+			{Name: "deployments", Kind: "Deployment", Namespaced: true, Verbs: verbs},
+		}},
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newObject("v1", "ConfigMap", "preview-a", "config"),
+		newObject("v1", "ConfigMap", "other", "config-of-other"),
+		newObject("v1", "Secret", "preview-a", "credentials"),
+		newObject("v1", "Event", "preview-a", "event"),
+	)
+
+	data, err := NewExporter(discovery, dynamicClient).Export("preview-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := untar(t, data)
+	if len(files) != 1 || !strings.Contains(files["configmaps.yaml"], "name: config\n") || strings.Contains(files["configmaps.yaml"], "config-of-other") {
+		t.Errorf("Unexpected archive %v", files)
+	}
+
+	exporter := NewExporter(discovery, dynamicClient)
+	exporter.IncludeSecrets = true
+	data, _ = exporter.Export("preview-a")
+	if files := untar(t, data); !strings.Contains(files["secrets.yaml"], "name: credentials") {
+		t.Errorf("Expected secrets in archive %v", files)
+	}
+}
+
+func TestS3_Upload(t *testing.T) {
+	var path, contentHash string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		contentHash = r.Header.Get("X-Amz-Content-Sha256")
+	}))
+	defer server.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials("AKID", "secret", ""),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	}))
+	s3 := NewS3(sess, "archive", "eu-west-1")
+	u, err := s3.Upload("envs/preview a.tar.gz", "application/gzip", []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "s3://archive/envs/preview a.tar.gz" || path != "/archive/envs/preview%20a.tar.gz" || contentHash == "" {
+		t.Errorf("Unexpected upload %s to %s (%s)", u, path, contentHash)
+	}
+}
+
+func TestGCS_Upload(t *testing.T) {
+	var name string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/b/archive/o" || r.URL.Query().Get("uploadType") != "media" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		name = r.URL.Query().Get("name")
+	}))
+	defer server.Close()
+
+	gcs := &GCS{httpClient: http.DefaultClient, bucket: "archive", endpoint: server.URL}
+	u, err := gcs.Upload("envs/preview-a.tar.gz", "application/gzip", []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != "gs://archive/envs/preview-a.tar.gz" || name != "envs/preview-a.tar.gz" {
+		t.Errorf("Unexpected upload %s as %s", u, name)
+	}
+}
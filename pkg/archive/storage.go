@@ -0,0 +1,90 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+
+	gcp "github.com/OpusCapita/buhtig-s8k/pkg/gcp"
+)
+
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// S3 uploads archives to AWS S3 bucket with credentials resolved by default credentials chain of AWS SDK
+type S3 struct {
+	api    s3iface.S3API
+	bucket string
+}
+
+// NewS3 returns S3 storage of bucket in region using session, see aws.NewSession
+func NewS3(sess *session.Session, bucket, region string) *S3 {
+	return &S3{api: s3.New(sess, aws.NewConfig().WithRegion(region)), bucket: bucket}
+}
+
+// Upload implements Storage
+func (s *S3) Upload(key, contentType string, data []byte) (string, error) {
+	_, err := s.api.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+		Body:        bytes.NewReader(data),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to upload %s to S3 bucket %s: %v", key, s.bucket, err)
+	}
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key), nil
+}
+
+// GCS uploads archives to Google Cloud Storage bucket
+type GCS struct {
+	httpClient *http.Client
+	bucket     string
+	// endpoint is URL of upload API, it's replaced in tests
+	endpoint string
+}
+
+// NewGCS returns GCS storage of bucket; credentials are read from service account key file if it's not empty
+// and from GCE metadata server otherwise
+func NewGCS(bucket, keyFile string) (*GCS, error) {
+	httpClient, err := gcp.NewHTTPClient(keyFile, 5*time.Minute, gcsScope)
+	if err != nil {
+		return nil, err
+	}
+	return &GCS{httpClient: httpClient, bucket: bucket, endpoint: "https://storage.googleapis.com/upload/storage/v1"}, nil
+}
+
+// Upload implements Storage
+func (g *GCS) Upload(key, contentType string, data []byte) (string, error) {
+	u := fmt.Sprintf("%s/b/%s/o?uploadType=media&name=%s", g.endpoint, url.PathEscape(g.bucket), url.QueryEscape(key))
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	if err := do(g.httpClient, req); err != nil {
+		return "", fmt.Errorf("Failed to upload %s to GCS bucket %s: %v", key, g.bucket, err)
+	}
+	return fmt.Sprintf("gs://%s/%s", g.bucket, key), nil
+}
+
+func do(httpClient *http.Client, req *http.Request) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Record is a single entry of audit trail describing destructive action done by the app
+type Record struct {
+	Time      time.Time         `json:"time"`
+	Action    string            `json:"action"`
+	Namespace string            `json:"namespace"`
+	Success   bool              `json:"success"`
+	Error     string            `json:"error,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// Logger writes audit records as JSON lines to underlying writer
+type Logger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLogger returns audit logger which writes to w
+func NewLogger(w io.Writer) *Logger {
+	return &Logger{w: w}
+}
+
+// Log writes record; time is set to now if it's empty
+func (l *Logger) Log(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,219 @@
+package audit
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotated files are named like 'audit.log.20190702T150405.000' (and '.gz' suffix when compressed)
+const rotatedTimeFormat = "20060102T150405.000"
+
+// FileWriter is io.Writer which appends to a file and rotates it when it grows
+// bigger than MaxSize or older than MaxAge. It's safe for concurrent use.
+type FileWriter struct {
+	// Path of the current file
+	Path string
+	// MaxSize in bytes, rotation by size is disabled if <= 0
+	MaxSize int64
+	// MaxAge of the current file, rotation by age is disabled if <= 0
+	MaxAge time.Duration
+	// MaxBackups is number of rotated files to keep, all of them are kept if <= 0
+	MaxBackups int
+	// Compress rotated files with gzip
+	Compress bool
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// Write appends p to the file, rotating it beforehand if needed
+func (w *FileWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.needsRotation(int64(len(p))) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file
+func (w *FileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// Tail returns up to n last bytes of the current file
+func (w *FileWriter) Tail(n int64) ([]byte, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	f, err := os.Open(w.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	offset := info.Size() - n
+	if offset < 0 {
+		offset = 0
+	}
+	buf := make([]byte, info.Size()-offset)
+	_, err = f.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (w *FileWriter) needsRotation(incoming int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.MaxSize > 0 && w.size+incoming > w.MaxSize {
+		return true
+	}
+	if w.MaxAge > 0 && time.Since(w.openedAt) > w.MaxAge {
+		return true
+	}
+	return false
+}
+
+// open opens existing file for appending or creates a new one
+func (w *FileWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.Path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	// file age is counted from its modification time, which is close enough for pre-existing files
+	w.openedAt = time.Now()
+	if w.size > 0 {
+		w.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+// rotate renames current file to timestamped backup, opens a new one and removes obsolete backups
+func (w *FileWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	backup := fmt.Sprintf("%s.%s", w.Path, time.Now().Format(rotatedTimeFormat))
+	if err := os.Rename(w.Path, backup); err != nil {
+		return err
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	if w.Compress {
+		// compression can take a while for big files, don't block writers
+		go func() {
+			if err := compressFile(backup); err == nil {
+				w.removeObsoleteBackups()
+			}
+		}()
+		return nil
+	}
+
+	w.removeObsoleteBackups()
+	return nil
+}
+
+// backups returns paths of rotated files sorted from newest to oldest
+func (w *FileWriter) backups() []string {
+	matches, _ := filepath.Glob(w.Path + ".*")
+	var backups []string
+	for _, m := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(m, w.Path+"."), ".gz")
+		if _, err := time.Parse(rotatedTimeFormat, suffix); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups
+}
+
+func (w *FileWriter) removeObsoleteBackups() {
+	if w.MaxBackups <= 0 {
+		return
+	}
+	backups := w.backups()
+	for i := w.MaxBackups; i < len(backups); i++ {
+		os.Remove(backups[i])
+	}
+}
+
+// compressFile gzips file to 'path.gz' and removes the original one
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
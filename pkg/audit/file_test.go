@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileWriter_RotateBySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := &FileWriter{Path: filepath.Join(dir, "audit.log"), MaxSize: 10, MaxBackups: 2}
+	defer w.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := w.Write([]byte("123456\n")); err != nil {
+			t.Fatal(err)
+		}
+		// make sure backups get distinct names
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	if backups := w.backups(); len(backups) != 2 {
+		t.Errorf("Expected 2 backups, but got %v", backups)
+	}
+
+	tail, err := w.Tail(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(tail) != "56\n" {
+		t.Errorf("Expected tail '56\\n', but got %q", tail)
+	}
+}
+
+func TestFileWriter_RotateByAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := &FileWriter{Path: filepath.Join(dir, "audit.log"), MaxAge: time.Millisecond}
+	defer w.Close()
+
+	w.Write([]byte("first\n"))
+	time.Sleep(5 * time.Millisecond)
+	w.Write([]byte("second\n"))
+
+	if backups := w.backups(); len(backups) != 1 {
+		t.Errorf("Expected 1 backup, but got %v", backups)
+	}
+}
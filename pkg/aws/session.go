@@ -0,0 +1,24 @@
+// Package aws creates sessions of AWS SDK shared by clients of AWS services
+package aws
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// NewSession returns session of AWS SDK, its default credentials chain resolves credentials from environment
+// variables, web identity token (IAM roles for service accounts in EKS), shared config, ECS container endpoint
+// and EC2 instance metadata; region is taken from environment (AWS_REGION or AWS_DEFAULT_REGION) unless
+// clients set one
+func NewSession() (*session.Session, error) {
+	return session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+}
+
+// Region returns region configured in environment (empty if it's not configured)
+func Region() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
@@ -0,0 +1,136 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBaseURL = "https://dev.azure.com"
+	apiVersion     = "5.1"
+)
+
+// matches https://dev.azure.com/ORG/PROJECT/_git/REPO and legacy https://ORG.visualstudio.com/PROJECT/_git/REPO
+var (
+	repoURLRe       = regexp.MustCompile(`^https://dev\.azure\.com/([^/]+)/([^/]+)/_git/([^/?#]+)`)
+	legacyRepoURLRe = regexp.MustCompile(`^https://([^/.]+)\.visualstudio\.com/(?:DefaultCollection/)?([^/]+)/_git/([^/?#]+)`)
+)
+
+// IsBranchURL checks if URL looks like Azure DevOps Repos branch URL
+func IsBranchURL(branchURL string) bool {
+	_, _, _, _, err := ParseBranchURL(branchURL)
+	return err == nil
+}
+
+// ParseBranchURL expects URL like https://dev.azure.com/ORG/PROJECT/_git/REPO?version=GBBRANCH and returns its parts
+func ParseBranchURL(branchURL string) (org, project, repo, branch string, err error) {
+	parts := repoURLRe.FindStringSubmatch(branchURL)
+	if parts == nil {
+		parts = legacyRepoURLRe.FindStringSubmatch(branchURL)
+	}
+	if parts == nil {
+		return "", "", "", "", fmt.Errorf("branchURL doesn't match regexp: %s", branchURL)
+	}
+
+	u, err := url.Parse(branchURL)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	// version is prefixed with type: GB for branch, GT for tag and GC for commit
+	version := u.Query().Get("version")
+	if !strings.HasPrefix(version, "GB") || len(version) == 2 {
+		return "", "", "", "", fmt.Errorf("branchURL doesn't reference branch: %s", branchURL)
+	}
+
+	if org, err = url.PathUnescape(parts[1]); err != nil {
+		return "", "", "", "", err
+	}
+	if project, err = url.PathUnescape(parts[2]); err != nil {
+		return "", "", "", "", err
+	}
+	if repo, err = url.PathUnescape(parts[3]); err != nil {
+		return "", "", "", "", err
+	}
+	return org, project, repo, strings.TrimPrefix(version, "GB"), nil
+}
+
+// Client is a thin wrapper around Azure DevOps Services REST API
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+}
+
+// NewClient returns Azure DevOps client which authenticates requests with personal access token
+func NewClient(token string) *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		baseURL:    defaultBaseURL,
+		token:      token,
+	}
+}
+
+// BranchStatus queries branch and returns status code of HTTP response (404 means branch doesn't exist);
+// refs API filters by prefix, so 404 is reported if no ref matches branch exactly
+func (c *Client) BranchStatus(org, project, repo, branch string) (int, error) {
+	query := url.Values{}
+	query.Set("filter", "heads/"+branch)
+	query.Set("api-version", apiVersion)
+
+	resp, err := c.get(fmt.Sprintf("%s/refs?%s", c.repoURL(org, project, repo), query.Encode()))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+
+	refs := struct {
+		Value []struct {
+			Name string `json:"name"`
+		} `json:"value"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&refs); err != nil {
+		return 0, err
+	}
+	for _, ref := range refs.Value {
+		if ref.Name == "refs/heads/"+branch {
+			return http.StatusOK, nil
+		}
+	}
+	return http.StatusNotFound, nil
+}
+
+// RepoStatus queries repository and returns status code of HTTP response
+func (c *Client) RepoStatus(org, project, repo string) (int, error) {
+	resp, err := c.get(fmt.Sprintf("%s?api-version=%s", c.repoURL(org, project, repo), apiVersion))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func (c *Client) repoURL(org, project, repo string) string {
+	return fmt.Sprintf("%s/%s/%s/_apis/git/repositories/%s", c.baseURL, url.PathEscape(org), url.PathEscape(project), url.PathEscape(repo))
+}
+
+func (c *Client) get(apiURL string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	// personal access token is sent as password of basic auth with empty user name
+	if c.token != "" {
+		req.SetBasicAuth("", c.token)
+	}
+	return c.httpClient.Do(req)
+}
@@ -0,0 +1,55 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseBranchURL(t *testing.T) {
+	for _, branchURL := range []string{
+		"https://dev.azure.com/org/My%20Project/_git/repo?version=GBfeature%2Fx",
+		"https://org.visualstudio.com/My%20Project/_git/repo?path=%2F&version=GBfeature/x",
+	} {
+		org, project, repo, branch, err := ParseBranchURL(branchURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if org != "org" || project != "My Project" || repo != "repo" || branch != "feature/x" {
+			t.Errorf("Unexpected parts of %s: %s, %s, %s, %s", branchURL, org, project, repo, branch)
+		}
+	}
+
+	if IsBranchURL("https://dev.azure.com/org/project/_git/repo?version=GTv1.0") {
+		t.Errorf("Tag URL shouldn't be recognized as branch one")
+	}
+	if IsBranchURL("https://github.com/owner/repo/tree/branch") {
+		t.Errorf("Github URL shouldn't be recognized as Azure DevOps one")
+	}
+}
+
+func TestClient_BranchStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, token, ok := r.BasicAuth(); !ok || token != "pat" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/org/project/_apis/git/repositories/repo/refs" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// filter matches prefixes, so exact match is up to the client
+		fmt.Fprint(w, `{"value": [{"name": "refs/heads/feature/x"}, {"name": "refs/heads/feature/x-2"}], "count": 2}`)
+	}))
+	defer server.Close()
+
+	c := NewClient("pat")
+	c.baseURL = server.URL
+	if status, _ := c.BranchStatus("org", "project", "repo", "feature/x"); status != 200 {
+		t.Errorf("Expected 200 for existing branch, but got %d", status)
+	}
+	if status, _ := c.BranchStatus("org", "project", "repo", "feature"); status != 404 {
+		t.Errorf("Expected 404 for deleted branch, but got %d", status)
+	}
+}
@@ -0,0 +1,89 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	vcs "github.com/OpusCapita/buhtig-s8k/pkg/vcs"
+)
+
+// Name implements vcs.Provider
+func (c *Client) Name() string {
+	return "azure-devops"
+}
+
+// Match implements vcs.Provider
+func (c *Client) Match(sourceURL *url.URL) bool {
+	return IsBranchURL(sourceURL.String())
+}
+
+// CheckBranch implements vcs.Provider
+func (c *Client) CheckBranch(sourceURL string) (int, error) {
+	org, project, repo, branch, err := ParseBranchURL(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return c.BranchStatus(org, project, repo, branch)
+}
+
+// CheckRepo implements vcs.Provider
+func (c *Client) CheckRepo(sourceURL string) (int, error) {
+	org, project, repo, _, err := ParseBranchURL(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return c.RepoStatus(org, project, repo)
+}
+
+// CheckPR implements vcs.Provider
+func (c *Client) CheckPR(sourceURL string) (*vcs.PullRequest, error) {
+	org, project, repo, branch, err := ParseBranchURL(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("searchCriteria.sourceRefName", "refs/heads/"+branch)
+	query.Set("searchCriteria.status", "all")
+	query.Set("$top", "1")
+	query.Set("api-version", apiVersion)
+
+	resp, err := c.get(fmt.Sprintf("%s/pullrequests?%s", c.repoURL(org, project, repo), query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Azure DevOps responded with status %d to pull requests query", resp.StatusCode)
+	}
+
+	prs := struct {
+		Value []struct {
+			PullRequestID int    `json:"pullRequestId"`
+			Status        string `json:"status"`
+		} `json:"value"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&prs); err != nil {
+		return nil, err
+	}
+	if len(prs.Value) == 0 {
+		return nil, nil
+	}
+
+	pr := prs.Value[0]
+	// Azure DevOps statuses are 'active', 'abandoned' and 'completed'
+	state := vcs.StateClosed
+	switch pr.Status {
+	case "active":
+		state = vcs.StateOpen
+	case "completed":
+		state = vcs.StateMerged
+	}
+	return &vcs.PullRequest{
+		Number: pr.PullRequestID,
+		State:  state,
+		URL:    fmt.Sprintf("https://dev.azure.com/%s/%s/_git/%s/pullrequest/%d", url.PathEscape(org), url.PathEscape(project), url.PathEscape(repo), pr.PullRequestID),
+	}, nil
+}
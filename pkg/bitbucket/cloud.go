@@ -0,0 +1,74 @@
+package bitbucket
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+const cloudAPIURL = "https://api.bitbucket.org/2.0"
+
+// matches https://bitbucket.org/WORKSPACE/REPO/branch/BRANCH and https://bitbucket.org/WORKSPACE/REPO/src/BRANCH
+var cloudBranchURLRe = regexp.MustCompile(`^https://bitbucket\.org/([^/]+)/([^/]+)/(?:branch|src)/(.+?)/?$`)
+
+// IsCloudBranchURL checks if URL looks like Bitbucket Cloud branch URL
+func IsCloudBranchURL(branchURL string) bool {
+	return cloudBranchURLRe.MatchString(branchURL)
+}
+
+// ParseCloudBranchURL expects URL like https://bitbucket.org/WORKSPACE/REPO/branch/BRANCH and returns its parts
+func ParseCloudBranchURL(branchURL string) (workspace, repo, branch string, err error) {
+	parts := cloudBranchURLRe.FindStringSubmatch(branchURL)
+	if parts == nil {
+		return "", "", "", fmt.Errorf("branchURL doesn't match regexp: %s", branchURL)
+	}
+	return parts[1], parts[2], parts[3], nil
+}
+
+// CloudClient is a thin wrapper around Bitbucket Cloud REST API 2.0
+type CloudClient struct {
+	httpClient  *http.Client
+	baseURL     string
+	username    string
+	appPassword string
+}
+
+// NewCloudClient returns Bitbucket Cloud client which authenticates requests with username and app password
+func NewCloudClient(username, appPassword string) *CloudClient {
+	return &CloudClient{
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		baseURL:     cloudAPIURL,
+		username:    username,
+		appPassword: appPassword,
+	}
+}
+
+// BranchStatus queries branch and returns status code of HTTP response (404 means branch doesn't exist)
+func (c *CloudClient) BranchStatus(workspace, repo, branch string) (int, error) {
+	return c.status(fmt.Sprintf("%s/repositories/%s/%s/refs/branches/%s", c.baseURL, workspace, repo, url.PathEscape(branch)))
+}
+
+// RepoStatus queries repository and returns status code of HTTP response
+func (c *CloudClient) RepoStatus(workspace, repo string) (int, error) {
+	return c.status(fmt.Sprintf("%s/repositories/%s/%s", c.baseURL, workspace, repo))
+}
+
+func (c *CloudClient) status(apiURL string) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.appPassword)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
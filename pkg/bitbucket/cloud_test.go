@@ -0,0 +1,50 @@
+package bitbucket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseCloudBranchURL(t *testing.T) {
+	for _, branchURL := range []string{
+		"https://bitbucket.org/workspace/repo/branch/feature/x",
+		"https://bitbucket.org/workspace/repo/src/feature/x/",
+	} {
+		workspace, repo, branch, err := ParseCloudBranchURL(branchURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if workspace != "workspace" || repo != "repo" || branch != "feature/x" {
+			t.Errorf("Unexpected parts of %s: %s, %s, %s", branchURL, workspace, repo, branch)
+		}
+	}
+
+	if IsCloudBranchURL("https://github.com/owner/repo/tree/branch") {
+		t.Errorf("Github URL shouldn't be recognized as Bitbucket one")
+	}
+}
+
+func TestCloudClient_BranchStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.RawPath == "/repositories/workspace/repo/refs/branches/feature%2Fx" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c := NewCloudClient("user", "secret")
+	c.baseURL = server.URL
+	if status, _ := c.BranchStatus("workspace", "repo", "feature/x"); status != 200 {
+		t.Errorf("Expected 200 for existing branch, but got %d", status)
+	}
+	if status, _ := c.BranchStatus("workspace", "repo", "gone"); status != 404 {
+		t.Errorf("Expected 404 for deleted branch, but got %d", status)
+	}
+}
@@ -0,0 +1,178 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	vcs "github.com/OpusCapita/buhtig-s8k/pkg/vcs"
+)
+
+// Name implements vcs.Provider
+func (c *CloudClient) Name() string {
+	return "bitbucket-cloud"
+}
+
+// Match implements vcs.Provider
+func (c *CloudClient) Match(sourceURL *url.URL) bool {
+	return sourceURL.Host == "bitbucket.org"
+}
+
+// CheckBranch implements vcs.Provider
+func (c *CloudClient) CheckBranch(sourceURL string) (int, error) {
+	workspace, repo, branch, err := ParseCloudBranchURL(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return c.BranchStatus(workspace, repo, branch)
+}
+
+// CheckRepo implements vcs.Provider
+func (c *CloudClient) CheckRepo(sourceURL string) (int, error) {
+	workspace, repo, _, err := ParseCloudBranchURL(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return c.RepoStatus(workspace, repo)
+}
+
+// CheckPR implements vcs.Provider
+func (c *CloudClient) CheckPR(sourceURL string) (*vcs.PullRequest, error) {
+	workspace, repo, branch, err := ParseCloudBranchURL(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("q", fmt.Sprintf(`source.branch.name="%s"`, branch))
+	query.Set("sort", "-updated_on")
+	// only open pull requests are returned by default
+	for _, state := range []string{"OPEN", "MERGED", "DECLINED", "SUPERSEDED"} {
+		query.Add("state", state)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/repositories/%s/%s/pullrequests?%s", c.baseURL, workspace, repo, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.appPassword)
+	}
+
+	page := struct {
+		Values []struct {
+			ID    int    `json:"id"`
+			State string `json:"state"`
+			Links struct {
+				HTML struct {
+					Href string `json:"href"`
+				} `json:"html"`
+			} `json:"links"`
+		} `json:"values"`
+	}{}
+	if err := getJSON(c.httpClient, req, &page); err != nil {
+		return nil, err
+	}
+	if len(page.Values) == 0 {
+		return nil, nil
+	}
+
+	pr := page.Values[0]
+	return &vcs.PullRequest{Number: pr.ID, State: pullRequestState(pr.State), URL: pr.Links.HTML.Href}, nil
+}
+
+// Name implements vcs.Provider
+func (c *ServerClient) Name() string {
+	return "bitbucket-server"
+}
+
+// Match implements vcs.Provider
+func (c *ServerClient) Match(sourceURL *url.URL) bool {
+	return c.IsBranchURL(sourceURL.String())
+}
+
+// CheckBranch implements vcs.Provider
+func (c *ServerClient) CheckBranch(sourceURL string) (int, error) {
+	project, repo, branch, err := c.ParseBranchURL(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return c.BranchStatus(project, repo, branch)
+}
+
+// CheckRepo implements vcs.Provider
+func (c *ServerClient) CheckRepo(sourceURL string) (int, error) {
+	project, repo, _, err := c.ParseBranchURL(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return c.RepoStatus(project, repo)
+}
+
+// CheckPR implements vcs.Provider
+func (c *ServerClient) CheckPR(sourceURL string) (*vcs.PullRequest, error) {
+	project, repo, branch, err := c.ParseBranchURL(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("at", "refs/heads/"+branch)
+	query.Set("direction", "OUTGOING")
+	query.Set("state", "ALL")
+	query.Set("order", "NEWEST")
+
+	req, err := c.newRequest(fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/pull-requests?%s", c.baseURL, project, repo, query.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	page := struct {
+		Values []struct {
+			ID    int    `json:"id"`
+			State string `json:"state"`
+			Links struct {
+				Self []struct {
+					Href string `json:"href"`
+				} `json:"self"`
+			} `json:"links"`
+		} `json:"values"`
+	}{}
+	if err := getJSON(c.httpClient, req, &page); err != nil {
+		return nil, err
+	}
+	if len(page.Values) == 0 {
+		return nil, nil
+	}
+
+	pr := page.Values[0]
+	result := &vcs.PullRequest{Number: pr.ID, State: pullRequestState(pr.State)}
+	if len(pr.Links.Self) > 0 {
+		result.URL = pr.Links.Self[0].Href
+	}
+	return result, nil
+}
+
+// pullRequestState maps states of both Bitbucket flavours ('OPEN', 'MERGED', 'DECLINED', 'SUPERSEDED') to vcs.State*
+func pullRequestState(state string) string {
+	switch state {
+	case "OPEN":
+		return vcs.StateOpen
+	case "MERGED":
+		return vcs.StateMerged
+	}
+	return vcs.StateClosed
+}
+
+func getJSON(httpClient *http.Client, req *http.Request, out interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s responded with status %d", req.URL, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
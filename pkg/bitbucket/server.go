@@ -0,0 +1,135 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// matches path of repository browse URL, e.g. /projects/KEY/repos/REPO/browse or /users/USER/repos/REPO/browse
+var serverRepoPathRe = regexp.MustCompile(`^/(projects|users)/([^/]+)/repos/([^/]+)(/browse.*)?$`)
+
+// ServerClient is a thin wrapper around Bitbucket Server (Data Center) REST API 1.0
+type ServerClient struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+}
+
+// NewServerClient returns client of Bitbucket Server installed at baseURL (including context path, if any)
+// which authenticates requests with personal access token
+func NewServerClient(baseURL, token string) *ServerClient {
+	return &ServerClient{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+	}
+}
+
+// IsBranchURL checks if URL points to branch of this Bitbucket Server
+func (c *ServerClient) IsBranchURL(branchURL string) bool {
+	_, _, _, err := c.ParseBranchURL(branchURL)
+	return err == nil
+}
+
+// ParseBranchURL expects URL like BASE_URL/projects/KEY/repos/REPO/browse?at=refs/heads/BRANCH and returns its parts;
+// repositories of users are returned with project key '~USER' as Bitbucket Server API expects
+func (c *ServerClient) ParseBranchURL(branchURL string) (project, repo, branch string, err error) {
+	if c.baseURL == "" || !strings.HasPrefix(branchURL, c.baseURL+"/") {
+		return "", "", "", fmt.Errorf("branchURL doesn't belong to Bitbucket Server: %s", branchURL)
+	}
+	u, err := url.Parse(strings.TrimPrefix(branchURL, c.baseURL))
+	if err != nil {
+		return "", "", "", err
+	}
+	parts := serverRepoPathRe.FindStringSubmatch(u.Path)
+	branch = strings.TrimPrefix(u.Query().Get("at"), "refs/heads/")
+	if parts == nil || branch == "" {
+		return "", "", "", fmt.Errorf("branchURL doesn't match regexp: %s", branchURL)
+	}
+	project = parts[2]
+	if parts[1] == "users" {
+		project = "~" + project
+	}
+	return project, parts[3], branch, nil
+}
+
+// BranchStatus queries branch and returns status code of HTTP response (404 means branch doesn't exist);
+// Bitbucket Server has no endpoint for a single branch, so branches are filtered by name and 404 is reported
+// if none of them matches exactly on any page
+func (c *ServerClient) BranchStatus(project, repo, branch string) (int, error) {
+	query := url.Values{}
+	query.Set("filterText", branch)
+	query.Set("limit", "100")
+
+	for start := 0; ; {
+		query.Set("start", strconv.Itoa(start))
+		req, err := c.newRequest(fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s/branches?%s", c.baseURL, project, repo, query.Encode()))
+		if err != nil {
+			return 0, err
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return 0, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return resp.StatusCode, nil
+		}
+
+		page := struct {
+			Values []struct {
+				DisplayID string `json:"displayId"`
+			} `json:"values"`
+			IsLastPage    bool `json:"isLastPage"`
+			NextPageStart int  `json:"nextPageStart"`
+		}{}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return 0, err
+		}
+		for _, b := range page.Values {
+			if b.DisplayID == branch {
+				return http.StatusOK, nil
+			}
+		}
+		// nextPageStart should move forward, otherwise paging would never end
+		if page.IsLastPage || page.NextPageStart <= start {
+			return http.StatusNotFound, nil
+		}
+		start = page.NextPageStart
+	}
+}
+
+// RepoStatus queries repository and returns status code of HTTP response
+func (c *ServerClient) RepoStatus(project, repo string) (int, error) {
+	req, err := c.newRequest(fmt.Sprintf("%s/rest/api/1.0/projects/%s/repos/%s", c.baseURL, project, repo))
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func (c *ServerClient) newRequest(apiURL string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
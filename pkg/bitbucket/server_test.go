@@ -0,0 +1,66 @@
+package bitbucket
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServerClient_ParseBranchURL(t *testing.T) {
+	c := NewServerClient("https://git.example.com/bitbucket/", "")
+
+	project, repo, branch, err := c.ParseBranchURL("https://git.example.com/bitbucket/projects/KEY/repos/repo/browse?at=refs%2Fheads%2Ffeature%2Fx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project != "KEY" || repo != "repo" || branch != "feature/x" {
+		t.Errorf("Unexpected parts: %s, %s, %s", project, repo, branch)
+	}
+
+	project, _, _, err = c.ParseBranchURL("https://git.example.com/bitbucket/users/john/repos/repo/browse?at=feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project != "~john" {
+		t.Errorf("Expected user repository to have project key '~john', but got '%s'", project)
+	}
+
+	if c.IsBranchURL("https://bitbucket.org/workspace/repo/branch/feature") {
+		t.Errorf("URL of another host shouldn't be recognized as Bitbucket Server one")
+	}
+	if NewServerClient("", "").IsBranchURL("https://git.example.com/bitbucket/projects/KEY/repos/repo/browse?at=feature") {
+		t.Errorf("No URL should be recognized if base URL isn't configured")
+	}
+}
+
+func TestServerClient_BranchStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/rest/api/1.0/projects/KEY/repos/repo/branches" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// filterText matches substrings, so exact match is up to the client, and it's on the second page
+		if r.URL.Query().Get("start") == "0" {
+			fmt.Fprint(w, `{"values": [{"displayId": "feature/x-2"}], "isLastPage": false, "nextPageStart": 1}`)
+			return
+		}
+		fmt.Fprint(w, `{"values": [{"displayId": "feature/x"}], "isLastPage": true}`)
+	}))
+	defer server.Close()
+
+	c := NewServerClient(server.URL, "token")
+	if status, _ := c.BranchStatus("KEY", "repo", "feature/x"); status != 200 {
+		t.Errorf("Expected 200 for existing branch, but got %d", status)
+	}
+	if status, _ := c.BranchStatus("KEY", "repo", "feature"); status != 404 {
+		t.Errorf("Expected 404 for deleted branch, but got %d", status)
+	}
+	if status, _ := c.BranchStatus("KEY", "gone", "feature/x"); status != 404 {
+		t.Errorf("Expected 404 for missing repository, but got %d", status)
+	}
+}
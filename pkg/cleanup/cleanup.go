@@ -0,0 +1,261 @@
+package cleanup
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+)
+
+// Deleter deletes objects of arbitrary kinds (e.g. custom resources) using dynamic client.
+// Kinds which aren't served by the cluster are silently skipped, so that optional integrations
+// (Flux, external-dns, etc.) don't fail on clusters without them. Integrations which need to create
+// objects before deletion (e.g. Velero backups) use it as well.
+type Deleter struct {
+	dynamicClient dynamic.Interface
+	mapper        meta.RESTMapper
+	discovery     ResourceDiscovery
+}
+
+// ResourceDiscovery discovers namespaced resources served by the cluster, it's implemented by discovery client
+type ResourceDiscovery interface {
+	ServerPreferredNamespacedResources() ([]*metav1.APIResourceList, error)
+}
+
+// NewDeleter returns Deleter
+func NewDeleter(k8sClient kubernetes.Interface, config *rest.Config) (*Deleter, error) {
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(k8sClient.Discovery()))
+	return NewDeleterForClients(dynamicClient, mapper, k8sClient.Discovery()), nil
+}
+
+// NewDeleterForClients returns Deleter using given clients, e.g. fake ones in tests
+func NewDeleterForClients(dynamicClient dynamic.Interface, mapper meta.RESTMapper, discovery ResourceDiscovery) *Deleter {
+	return &Deleter{dynamicClient: dynamicClient, mapper: mapper, discovery: discovery}
+}
+
+// Object references object to delete
+type Object struct {
+	schema.GroupVersionKind
+	Namespace string
+	Name      string
+}
+
+// String returns human-readable reference of object, e.g. 'HelmRelease flux-system/app'
+func (o Object) String() string {
+	if o.Namespace == "" {
+		return o.Kind + " " + o.Name
+	}
+	return o.Kind + " " + o.Namespace + "/" + o.Name
+}
+
+// resource returns dynamic client of kind in namespace; preferred version is used if version is empty.
+// It's nil if kind isn't served by the cluster.
+func (d *Deleter) resource(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, error) {
+	versions := []string{}
+	if gvk.Version != "" {
+		versions = append(versions, gvk.Version)
+	}
+	mapping, err := d.mapper.RESTMapping(gvk.GroupKind(), versions...)
+	if meta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace || namespace == "" {
+		return d.dynamicClient.Resource(mapping.Resource), nil
+	}
+	return d.dynamicClient.Resource(mapping.Resource).Namespace(namespace), nil
+}
+
+// Delete deletes object; it returns false if object (or its kind) doesn't exist
+func (d *Deleter) Delete(obj Object) (bool, error) {
+	resource, err := d.resource(obj.GroupVersionKind, obj.Namespace)
+	if resource == nil || err != nil {
+		return false, err
+	}
+	propagation := metav1.DeletePropagationBackground
+	err = resource.Delete(obj.Name, &metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Exists checks if object exists; objects of kinds unknown to the cluster don't exist
+func (d *Deleter) Exists(obj Object) (bool, error) {
+	resource, err := d.resource(obj.GroupVersionKind, obj.Namespace)
+	if resource == nil || err != nil {
+		return false, err
+	}
+	_, err = resource.Get(obj.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Get returns object or nil if object (or its kind) doesn't exist
+func (d *Deleter) Get(obj Object) (*unstructured.Unstructured, error) {
+	resource, err := d.resource(obj.GroupVersionKind, obj.Namespace)
+	if resource == nil || err != nil {
+		return nil, err
+	}
+	found, err := resource.Get(obj.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	return found, err
+}
+
+// Create creates object, unlike other methods it fails if kind isn't served by the cluster
+func (d *Deleter) Create(obj *unstructured.Unstructured) error {
+	resource, err := d.resource(obj.GroupVersionKind(), obj.GetNamespace())
+	if err != nil {
+		return err
+	}
+	if resource == nil {
+		return fmt.Errorf("Kind %s isn't served by the cluster", obj.GroupVersionKind())
+	}
+	_, err = resource.Create(obj, metav1.CreateOptions{})
+	return err
+}
+
+// List returns objects of kind matching label selector; namespace is ignored for cluster-scoped kinds
+// and empty namespace means all namespaces
+func (d *Deleter) List(gvk schema.GroupVersionKind, namespace, selector string) ([]Object, error) {
+	return d.ListFunc(gvk, namespace, selector, nil)
+}
+
+// ListFunc is like List, but returns only objects which match is true for; nil match matches everything
+func (d *Deleter) ListFunc(gvk schema.GroupVersionKind, namespace, selector string, match func(*unstructured.Unstructured) bool) ([]Object, error) {
+	resource, err := d.resource(gvk, namespace)
+	if resource == nil || err != nil {
+		return nil, err
+	}
+	list, err := resource.List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	objects := []Object{}
+	for i := range list.Items {
+		item := &list.Items[i]
+		if match != nil && !match(item) {
+			continue
+		}
+		objects = append(objects, Object{GroupVersionKind: item.GroupVersionKind(), Namespace: item.GetNamespace(), Name: item.GetName()})
+	}
+	return objects, nil
+}
+
+// DeleteMatching deletes objects of kind matching label selector (see List), deleted objects are returned
+func (d *Deleter) DeleteMatching(gvk schema.GroupVersionKind, namespace, selector string) ([]Object, error) {
+	return d.DeleteMatchingFunc(gvk, namespace, selector, nil)
+}
+
+// DeleteMatchingFunc deletes objects returned by ListFunc, deleted objects are returned
+func (d *Deleter) DeleteMatchingFunc(gvk schema.GroupVersionKind, namespace, selector string, match func(*unstructured.Unstructured) bool) ([]Object, error) {
+	objects, err := d.ListFunc(gvk, namespace, selector, match)
+	if err != nil {
+		return nil, err
+	}
+	deleted := []Object{}
+	for _, obj := range objects {
+		ok, err := d.Delete(obj)
+		if err != nil {
+			return deleted, err
+		}
+		if ok {
+			deleted = append(deleted, obj)
+		}
+	}
+	return deleted, nil
+}
+
+// RemainingObject is object found in namespace by ListNamespace
+type RemainingObject struct {
+	Object
+	Finalizers []string
+	// Deleting is true if deletion of object was issued
+	Deleting bool
+}
+
+// String returns reference of object followed by its finalizers, e.g. 'Certificate app/tls (finalizers: cert-manager)'
+func (o RemainingObject) String() string {
+	if len(o.Finalizers) == 0 {
+		return o.Object.String()
+	}
+	return fmt.Sprintf("%s (finalizers: %s)", o.Object, strings.Join(o.Finalizers, ", "))
+}
+
+// listedResources returns namespaced resources which can be listed; events are skipped as they don't block anything
+func listedResources(resourceLists []*metav1.APIResourceList) map[schema.GroupVersionResource]string {
+	resources := map[schema.GroupVersionResource]string{}
+	for _, list := range resourceLists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, r := range list.APIResources {
+			if strings.Contains(r.Name, "/") || r.Name == "events" {
+				continue
+			}
+			for _, verb := range r.Verbs {
+				if verb == "list" {
+					resources[gv.WithResource(r.Name)] = r.Kind
+				}
+			}
+		}
+	}
+	return resources
+}
+
+// ListNamespace lists objects of all kinds remaining in namespace using API discovery, e.g. to find out what blocks
+// namespace deletion. API groups which failed discovery (e.g. aggregated APIs with unavailable backend, they block
+// namespace deletion too) are returned separately, objects of other groups are listed anyway.
+func (d *Deleter) ListNamespace(namespace string) ([]RemainingObject, []string, error) {
+	resourceLists, err := d.discovery.ServerPreferredNamespacedResources()
+	unavailable := []string{}
+	if failed, ok := err.(*discovery.ErrGroupDiscoveryFailed); ok {
+		for gv := range failed.Groups {
+			unavailable = append(unavailable, gv.String())
+		}
+		sort.Strings(unavailable)
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	objects := []RemainingObject{}
+	for gvr, kind := range listedResources(resourceLists) {
+		list, err := d.dynamicClient.Resource(gvr).Namespace(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, unavailable, fmt.Errorf("Failed to list %s: %v", gvr.GroupResource(), err)
+		}
+		for _, item := range list.Items {
+			objects = append(objects, RemainingObject{
+				Object:     Object{GroupVersionKind: gvr.GroupVersion().WithKind(kind), Namespace: item.GetNamespace(), Name: item.GetName()},
+				Finalizers: item.GetFinalizers(),
+				Deleting:   item.GetDeletionTimestamp() != nil,
+			})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].String() < objects[j].String()
+	})
+	return objects, unavailable, nil
+}
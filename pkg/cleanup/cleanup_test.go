@@ -0,0 +1,138 @@
+package cleanup
+
+import (
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+var helmReleaseKind = schema.GroupVersionKind{Group: "helm.toolkit.fluxcd.io", Version: "v2beta1", Kind: "HelmRelease"}
+
+func newObject(gvk schema.GroupVersionKind, namespace, name string, labels map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetLabels(labels)
+	return obj
+}
+
+func newTestDeleter(objects ...runtime.Object) *Deleter {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{helmReleaseKind.GroupVersion()})
+	mapper.Add(helmReleaseKind, meta.RESTScopeNamespace)
+	return &Deleter{dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...), mapper: mapper}
+}
+
+func TestDeleter_Delete(t *testing.T) {
+	d := newTestDeleter(newObject(helmReleaseKind, "flux-system", "app", nil))
+
+	// version is resolved by mapper if it's not set
+	obj := Object{GroupVersionKind: schema.GroupVersionKind{Group: "helm.toolkit.fluxcd.io", Kind: "HelmRelease"}, Namespace: "flux-system", Name: "app"}
+	if ok, err := d.Delete(obj); !ok || err != nil {
+		t.Errorf("Expected object to be deleted, but got %v (%v)", ok, err)
+	}
+	if ok, err := d.Delete(obj); ok || err != nil {
+		t.Errorf("Expected missing object to be skipped, but got %v (%v)", ok, err)
+	}
+
+	unknown := Object{GroupVersionKind: schema.GroupVersionKind{Group: "example.com", Kind: "Unknown"}, Name: "app"}
+	if ok, err := d.Delete(unknown); ok || err != nil {
+		t.Errorf("Expected object of unknown kind to be skipped, but got %v (%v)", ok, err)
+	}
+}
+
+func TestDeleter_DeleteMatching(t *testing.T) {
+	d := newTestDeleter(
+		newObject(helmReleaseKind, "flux-system", "preview-a", map[string]string{"env": "preview-a"}),
+		newObject(helmReleaseKind, "other", "preview-a-too", map[string]string{"env": "preview-a"}),
+		newObject(helmReleaseKind, "flux-system", "preview-b", map[string]string{"env": "preview-b"}),
+	)
+
+	deleted, err := d.DeleteMatching(helmReleaseKind, "", "env=preview-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 2 {
+		t.Errorf("Expected 2 objects to be deleted in all namespaces, but got %v", deleted)
+	}
+
+	remaining, _ := d.List(helmReleaseKind, "flux-system", "")
+	if len(remaining) != 1 || remaining[0].String() != "HelmRelease flux-system/preview-b" {
+		t.Errorf("Expected only unrelated object to remain, but got %v", remaining)
+	}
+}
+
+func TestDeleter_Exists(t *testing.T) {
+	d := newTestDeleter(newObject(helmReleaseKind, "flux-system", "app", nil))
+
+	obj := Object{GroupVersionKind: helmReleaseKind, Namespace: "flux-system", Name: "app"}
+	if ok, err := d.Exists(obj); !ok || err != nil {
+		t.Errorf("Expected object to exist, but got %v (%v)", ok, err)
+	}
+	d.Delete(obj)
+	if ok, err := d.Exists(obj); ok || err != nil {
+		t.Errorf("Expected object to be gone, but got %v (%v)", ok, err)
+	}
+}
+
+func TestDeleter_CreateGet(t *testing.T) {
+	d := newTestDeleter()
+
+	obj := Object{GroupVersionKind: helmReleaseKind, Namespace: "flux-system", Name: "app"}
+	if found, err := d.Get(obj); found != nil || err != nil {
+		t.Errorf("Expected object to be missing, but got %v (%v)", found, err)
+	}
+	if err := d.Create(newObject(helmReleaseKind, "flux-system", "app", map[string]string{"a": "b"})); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := d.Get(obj); found == nil || found.GetLabels()["a"] != "b" || err != nil {
+		t.Errorf("Expected created object, but got %v (%v)", found, err)
+	}
+	unknown := schema.GroupVersionKind{Group: "velero.io", Version: "v1", Kind: "Backup"}
+	if err := d.Create(newObject(unknown, "velero", "backup", nil)); err == nil {
+		t.Errorf("Expected error for unknown kind")
+	}
+}
+
+type staticDiscovery struct {
+	resources []*metav1.APIResourceList
+	err       error
+}
+
+func (d staticDiscovery) ServerPreferredNamespacedResources() ([]*metav1.APIResourceList, error) {
+	return d.resources, d.err
+}
+
+func TestDeleter_ListNamespace(t *testing.T) {
+	stuck := newObject(helmReleaseKind, "preview", "app", nil)
+	stuck.SetFinalizers([]string{"finalizers.fluxcd.io"})
+	d := newTestDeleter(stuck, newObject(helmReleaseKind, "preview", "db", nil), newObject(helmReleaseKind, "other", "app", nil))
+	d.discovery = staticDiscovery{
+		resources: []*metav1.APIResourceList{{
+			GroupVersion: helmReleaseKind.GroupVersion().String(),
+			APIResources: []metav1.APIResource{
+				{Name: "helmreleases", Kind: "HelmRelease", Namespaced: true, Verbs: []string{"list", "delete"}},
+				{Name: "helmreleases/status", Kind: "HelmRelease", Namespaced: true, Verbs: []string{"get"}},
+			},
+		}},
+		err: &discovery.ErrGroupDiscoveryFailed{Groups: map[schema.GroupVersion]error{{Group: "metrics.k8s.io", Version: "v1beta1"}: errors.New("unavailable")}},
+	}
+
+	objects, unavailable, err := d.ListNamespace("preview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[0].String() != "HelmRelease preview/app (finalizers: finalizers.fluxcd.io)" || objects[1].String() != "HelmRelease preview/db" {
+		t.Errorf("Expected objects of namespace with their finalizers, but got %v", objects)
+	}
+	if len(unavailable) != 1 || unavailable[0] != "metrics.k8s.io/v1beta1" {
+		t.Errorf("Expected failed discovery of metrics API to be reported, but got %v", unavailable)
+	}
+}
@@ -0,0 +1,97 @@
+package codecommit
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/codecommit"
+	"github.com/aws/aws-sdk-go/service/codecommit/codecommitiface"
+)
+
+// matches console URL like https://REGION.console.aws.amazon.com/codesuite/codecommit/repositories/REPO/browse/refs/heads/BRANCH
+var branchURLRe = regexp.MustCompile(`^https://(?:([a-z0-9-]+)\.)?console\.aws\.amazon\.com/codesuite/codecommit/repositories/([^/]+)/browse/refs/heads/([^?#]+)`)
+
+// IsBranchURL checks if URL looks like CodeCommit branch URL
+func IsBranchURL(branchURL string) bool {
+	_, _, _, err := ParseBranchURL(branchURL)
+	return err == nil
+}
+
+// ParseBranchURL expects console URL of CodeCommit branch and returns its parts;
+// region is taken from host or from 'region' query parameter
+func ParseBranchURL(branchURL string) (region, repo, branch string, err error) {
+	parts := branchURLRe.FindStringSubmatch(branchURL)
+	if parts == nil {
+		return "", "", "", fmt.Errorf("branchURL doesn't match regexp: %s", branchURL)
+	}
+	u, err := url.Parse(branchURL)
+	if err != nil {
+		return "", "", "", err
+	}
+	region = parts[1]
+	if r := u.Query().Get("region"); r != "" {
+		region = r
+	}
+	if region == "" {
+		return "", "", "", fmt.Errorf("branchURL doesn't specify region: %s", branchURL)
+	}
+	if branch, err = url.PathUnescape(strings.TrimSuffix(parts[3], "/")); err != nil {
+		return "", "", "", err
+	}
+	return region, parts[2], branch, nil
+}
+
+// Client calls CodeCommit API with credentials resolved by default credentials chain of AWS SDK
+type Client struct {
+	session *session.Session
+	// api returns CodeCommit API of region, it's replaced in tests
+	api func(region string) codecommitiface.CodeCommitAPI
+}
+
+// NewClient returns CodeCommit client using session, see aws.NewSession
+func NewClient(sess *session.Session) *Client {
+	c := &Client{session: sess}
+	c.api = func(region string) codecommitiface.CodeCommitAPI {
+		return codecommit.New(c.session, aws.NewConfig().WithRegion(region))
+	}
+	return c
+}
+
+// BranchStatus calls GetBranch and returns status code in terms of HTTP (404 means branch doesn't exist)
+func (c *Client) BranchStatus(region, repo, branch string) (int, error) {
+	_, err := c.api(region).GetBranch(&codecommit.GetBranchInput{
+		RepositoryName: aws.String(repo),
+		BranchName:     aws.String(branch),
+	})
+	return status("GetBranch", err)
+}
+
+// RepoStatus calls GetRepository and returns status code in terms of HTTP (404 means repository doesn't exist)
+func (c *Client) RepoStatus(region, repo string) (int, error) {
+	_, err := c.api(region).GetRepository(&codecommit.GetRepositoryInput{RepositoryName: aws.String(repo)})
+	return status("GetRepository", err)
+}
+
+// status translates result of API operation to status code; CodeCommit reports missing objects as 400 with
+// exception type, such responses are translated to 404 to make them look like responses of other VCS
+func status(operation string, err error) (int, error) {
+	if err == nil {
+		return http.StatusOK, nil
+	}
+	if apiErr, ok := err.(awserr.Error); ok {
+		switch apiErr.Code() {
+		case codecommit.ErrCodeBranchDoesNotExistException, codecommit.ErrCodeRepositoryDoesNotExistException:
+			return http.StatusNotFound, nil
+		}
+	}
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() != http.StatusBadRequest {
+		return reqErr.StatusCode(), nil
+	}
+	return 0, fmt.Errorf("CodeCommit %s failed: %v", operation, err)
+}
@@ -0,0 +1,74 @@
+package codecommit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func TestParseBranchURL(t *testing.T) {
+	for _, branchURL := range []string{
+		"https://eu-west-1.console.aws.amazon.com/codesuite/codecommit/repositories/repo/browse/refs/heads/feature/x",
+		"https://console.aws.amazon.com/codesuite/codecommit/repositories/repo/browse/refs/heads/feature/x?region=eu-west-1",
+	} {
+		region, repo, branch, err := ParseBranchURL(branchURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if region != "eu-west-1" || repo != "repo" || branch != "feature/x" {
+			t.Errorf("Unexpected parts of %s: %s, %s, %s", branchURL, region, repo, branch)
+		}
+	}
+
+	if IsBranchURL("https://console.aws.amazon.com/codesuite/codecommit/repositories/repo/browse/refs/heads/feature") {
+		t.Errorf("URL without region shouldn't be recognized")
+	}
+}
+
+func TestClient_BranchStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		payload := map[string]string{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		switch {
+		case r.Header.Get("X-Amz-Target") != "CodeCommit_20150413.GetBranch":
+			w.WriteHeader(http.StatusBadRequest)
+		case payload["repositoryName"] != "repo":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type": "RepositoryDoesNotExistException", "message": "repository does not exist"}`)
+		case payload["branchName"] != "feature":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type": "BranchDoesNotExistException", "message": "branch does not exist"}`)
+		default:
+			fmt.Fprint(w, `{"branch": {"branchName": "feature", "commitId": "abcdef"}}`)
+		}
+	}))
+	defer server.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("AKID", "secret", ""),
+		Endpoint:    aws.String(server.URL),
+		MaxRetries:  aws.Int(0),
+	}))
+	c := NewClient(sess)
+
+	if status, err := c.BranchStatus("eu-west-1", "repo", "feature"); status != 200 {
+		t.Errorf("Expected 200 for existing branch, but got %d (%v)", status, err)
+	}
+	if status, err := c.BranchStatus("eu-west-1", "repo", "gone"); status != 404 {
+		t.Errorf("Expected 404 for deleted branch, but got %d (%v)", status, err)
+	}
+	if status, err := c.BranchStatus("eu-west-1", "gone", "feature"); status != 404 {
+		t.Errorf("Expected 404 for deleted repository, but got %d (%v)", status, err)
+	}
+}
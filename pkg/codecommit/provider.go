@@ -0,0 +1,41 @@
+package codecommit
+
+import (
+	"net/url"
+
+	vcs "github.com/OpusCapita/buhtig-s8k/pkg/vcs"
+)
+
+// Name implements vcs.Provider
+func (c *Client) Name() string {
+	return "codecommit"
+}
+
+// Match implements vcs.Provider
+func (c *Client) Match(sourceURL *url.URL) bool {
+	return IsBranchURL(sourceURL.String())
+}
+
+// CheckBranch implements vcs.Provider
+func (c *Client) CheckBranch(sourceURL string) (int, error) {
+	region, repo, branch, err := ParseBranchURL(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return c.BranchStatus(region, repo, branch)
+}
+
+// CheckRepo implements vcs.Provider
+func (c *Client) CheckRepo(sourceURL string) (int, error) {
+	region, repo, _, err := ParseBranchURL(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return c.RepoStatus(region, repo)
+}
+
+// CheckPR implements vcs.Provider; CodeCommit can't look up pull requests by source branch
+// without fetching every pull request of repository, so it isn't supported
+func (c *Client) CheckPR(sourceURL string) (*vcs.PullRequest, error) {
+	return nil, vcs.ErrNotSupported
+}
@@ -0,0 +1,58 @@
+// Package crd defines custom resources of the app, they're read and written with dynamic client so that no
+// generated clientset is needed; manifests of CustomResourceDefinitions are in build/deployment/crds.yaml
+package crd
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// API group and version of custom resources
+const (
+	Group   = "opuscapita.com"
+	Version = "v1alpha1"
+)
+
+// Condition is an observation of resource state, similar to conditions of built-in resources
+type Condition struct {
+	Type   string                 `json:"type"`
+	Status corev1.ConditionStatus `json:"status"`
+	// Reason is a CamelCase word, Message is human-readable details
+	Reason             string      `json:"reason,omitempty"`
+	Message            string      `json:"message,omitempty"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// setCondition adds or updates condition of the same type, transition time is only changed along with status
+func setCondition(conditions []Condition, c Condition, now time.Time) []Condition {
+	c.LastTransitionTime = metav1.NewTime(now.UTC().Truncate(time.Second))
+	for i := range conditions {
+		if conditions[i].Type != c.Type {
+			continue
+		}
+		if conditions[i].Status == c.Status {
+			c.LastTransitionTime = conditions[i].LastTransitionTime
+		}
+		conditions[i] = c
+		return conditions
+	}
+	return append(conditions, c)
+}
+
+// toUnstructured converts typed resource to unstructured one accepted by dynamic client
+func toUnstructured(obj interface{}) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+// fromUnstructured converts unstructured resource returned by dynamic client to typed one
+func fromUnstructured(u *unstructured.Unstructured, obj interface{}) error {
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), obj)
+}
@@ -0,0 +1,233 @@
+package crd
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// BranchEnvironmentKind is kind of resource representing tracked namespace
+const BranchEnvironmentKind = "BranchEnvironment"
+
+// BranchEnvironmentResource is resource of BranchEnvironments for dynamic client
+var BranchEnvironmentResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "branchenvironments"}
+
+// phases of environment lifecycle
+const (
+	// PhaseActive means branch of environment exists
+	PhaseActive = "Active"
+	// PhaseMarkedForDeletion means branch is missing and deletion waits for confirmation or grace period
+	PhaseMarkedForDeletion = "MarkedForDeletion"
+	// PhaseDeleting means teardown of environment is started but not finished yet
+	PhaseDeleting = "Deleting"
+	// PhaseDeleted means namespace of environment is deleted
+	PhaseDeleted = "Deleted"
+)
+
+// states of environment branch
+const (
+	BranchPresent = "Present"
+	BranchMissing = "Missing"
+	BranchUnknown = "Unknown"
+)
+
+// types of environment conditions
+const (
+	// ConditionBranchExists reports result of the latest branch check
+	ConditionBranchExists = "BranchExists"
+	// ConditionDeletionScheduled is true if branch deletion is being confirmed or grace period runs
+	ConditionDeletionScheduled = "DeletionScheduled"
+	// ConditionSkipped is true if environment is left alone regardless of branch status (e.g. it's protected)
+	ConditionSkipped = "Skipped"
+	// ConditionDeleted is true once namespace is deleted
+	ConditionDeleted = "Deleted"
+)
+
+// BranchEnvironment represents tracked namespace, it lives in the app's namespace and is named after namespace
+type BranchEnvironment struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BranchEnvironmentSpec   `json:"spec"`
+	Status BranchEnvironmentStatus `json:"status,omitempty"`
+}
+
+// BranchEnvironmentSpec is taken from namespace annotations, except for overrides which are set by users
+type BranchEnvironmentSpec struct {
+	// Namespace is name of tracked namespace
+	Namespace string `json:"namespace"`
+	// SourceURL is URL of branch
+	SourceURL string `json:"sourceURL,omitempty"`
+	// Repository ("owner/repo") and Branch are parsed from Github source URL
+	Repository string `json:"repository,omitempty"`
+	Branch     string `json:"branch,omitempty"`
+	// Releases are Helm releases deployed to namespace
+	Releases []string `json:"releases,omitempty"`
+	// Overrides are namespace annotations (e.g. "opuscapita.com/deletion-grace-period") which take precedence over
+	// annotations of namespace itself
+	Overrides map[string]string `json:"overrides,omitempty"`
+}
+
+// BranchEnvironmentStatus is written by the app after every branch check
+type BranchEnvironmentStatus struct {
+	Phase       string `json:"phase,omitempty"`
+	BranchState string `json:"branchState,omitempty"`
+	// BranchStatus is HTTP status of the latest branch check
+	BranchStatus int `json:"branchStatus,omitempty"`
+	// NextAction is decision of the latest evaluation: delete, wait or skip
+	NextAction string `json:"nextAction,omitempty"`
+	// Reason explains why environment waits or is skipped
+	Reason         string       `json:"reason,omitempty"`
+	CompletedSteps []string     `json:"completedSteps,omitempty"`
+	LastChecked    *metav1.Time `json:"lastChecked,omitempty"`
+	DeleteAfter    *metav1.Time `json:"deleteAfter,omitempty"`
+	DeletedAt      *metav1.Time `json:"deletedAt,omitempty"`
+	Conditions     []Condition  `json:"conditions,omitempty"`
+}
+
+// SetCondition adds or updates condition of the same type
+func (s *BranchEnvironmentStatus) SetCondition(c Condition, now time.Time) {
+	s.Conditions = setCondition(s.Conditions, c, now)
+}
+
+// SetBranchStatus sets branch state and BranchExists condition according to HTTP status of branch check
+func (s *BranchEnvironmentStatus) SetBranchStatus(status int, now time.Time) {
+	s.BranchStatus = status
+	c := Condition{Type: ConditionBranchExists}
+	switch status {
+	case 200:
+		s.BranchState = BranchPresent
+		c.Status, c.Reason = corev1.ConditionTrue, "BranchFound"
+	case 404:
+		s.BranchState = BranchMissing
+		c.Status, c.Reason = corev1.ConditionFalse, "BranchNotFound"
+	default:
+		s.BranchState = BranchUnknown
+		c.Status, c.Reason = corev1.ConditionUnknown, "CheckFailed"
+	}
+	s.SetCondition(c, now)
+}
+
+// conditionStatus converts bool to status of condition
+func conditionStatus(ok bool) corev1.ConditionStatus {
+	if ok {
+		return corev1.ConditionTrue
+	}
+	return corev1.ConditionFalse
+}
+
+// SetPhase sets phase and conditions derived from it, reason of skip or wait is condition message
+func (s *BranchEnvironmentStatus) SetPhase(phase, nextAction, reason string, now time.Time) {
+	s.Phase = phase
+	s.NextAction = nextAction
+	s.Reason = reason
+
+	scheduled := Condition{Type: ConditionDeletionScheduled, Status: conditionStatus(phase == PhaseMarkedForDeletion), Reason: "BranchPresent"}
+	if phase == PhaseMarkedForDeletion {
+		scheduled.Reason, scheduled.Message = "BranchMissing", reason
+	} else if phase == PhaseDeleting || phase == PhaseDeleted {
+		scheduled.Reason = "DeletionStarted"
+	}
+	s.SetCondition(scheduled, now)
+
+	skipped := Condition{Type: ConditionSkipped, Status: conditionStatus(nextAction == "skip" && s.BranchState != BranchPresent), Reason: "Evaluated"}
+	if skipped.Status == corev1.ConditionTrue {
+		skipped.Reason, skipped.Message = "LeftAlone", reason
+	}
+	s.SetCondition(skipped, now)
+
+	deleted := Condition{Type: ConditionDeleted, Status: conditionStatus(phase == PhaseDeleted), Reason: "NamespaceExists"}
+	if phase == PhaseDeleted {
+		deleted.Reason = "NamespaceDeleted"
+	}
+	s.SetCondition(deleted, now)
+}
+
+// EnvironmentClient reads and writes BranchEnvironments of namespace
+type EnvironmentClient struct {
+	resource dynamic.ResourceInterface
+}
+
+// NewEnvironmentClient returns client of BranchEnvironments in namespace
+func NewEnvironmentClient(dynamicClient dynamic.Interface, namespace string) *EnvironmentClient {
+	return &EnvironmentClient{resource: dynamicClient.Resource(BranchEnvironmentResource).Namespace(namespace)}
+}
+
+// Get returns environment by name, it's nil if environment doesn't exist
+func (c *EnvironmentClient) Get(name string) (*BranchEnvironment, error) {
+	u, err := c.resource.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	env := &BranchEnvironment{}
+	return env, fromUnstructured(u, env)
+}
+
+// List returns all environments
+func (c *EnvironmentClient) List() ([]BranchEnvironment, error) {
+	list, err := c.resource.List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	envs := make([]BranchEnvironment, len(list.Items))
+	for i := range list.Items {
+		if err := fromUnstructured(&list.Items[i], &envs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return envs, nil
+}
+
+// Create creates environment, its status is written separately with UpdateStatus
+func (c *EnvironmentClient) Create(env *BranchEnvironment) (*BranchEnvironment, error) {
+	env.APIVersion = Group + "/" + Version
+	env.Kind = BranchEnvironmentKind
+	return c.write(env, func(u *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+		return c.resource.Create(u, metav1.CreateOptions{})
+	})
+}
+
+// Update updates spec and metadata of environment
+func (c *EnvironmentClient) Update(env *BranchEnvironment) (*BranchEnvironment, error) {
+	return c.write(env, func(u *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+		return c.resource.Update(u, metav1.UpdateOptions{})
+	})
+}
+
+// UpdateStatus updates status subresource of environment
+func (c *EnvironmentClient) UpdateStatus(env *BranchEnvironment) (*BranchEnvironment, error) {
+	return c.write(env, func(u *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+		return c.resource.UpdateStatus(u, metav1.UpdateOptions{})
+	})
+}
+
+// Delete deletes environment, missing one isn't an error
+func (c *EnvironmentClient) Delete(name string) error {
+	err := c.resource.Delete(name, &metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// write sends environment with function of dynamic client and returns the result
+func (c *EnvironmentClient) write(env *BranchEnvironment, send func(*unstructured.Unstructured) (*unstructured.Unstructured, error)) (*BranchEnvironment, error) {
+	u, err := toUnstructured(env)
+	if err != nil {
+		return nil, err
+	}
+	u, err = send(u)
+	if err != nil {
+		return nil, err
+	}
+	written := &BranchEnvironment{}
+	return written, fromUnstructured(u, written)
+}
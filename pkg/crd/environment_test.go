@@ -0,0 +1,103 @@
+package crd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestEnvironmentClient(t *testing.T) {
+	c := NewEnvironmentClient(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme()), "buhtig")
+
+	if env, err := c.Get("app-feature"); env != nil || err != nil {
+		t.Fatalf("Expected missing environment to be nil, got %v, %v", env, err)
+	}
+
+	env, err := c.Create(&BranchEnvironment{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-feature"},
+		Spec: BranchEnvironmentSpec{
+			Namespace: "app-feature",
+			SourceURL: "https://github.com/OpusCapita/app/tree/feature",
+			Releases:  []string{"app-feature"},
+			Overrides: map[string]string{"opuscapita.com/deletion-grace-period": "72h"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	env.Status.Phase = PhaseActive
+	env.Status.SetBranchStatus(200, now)
+	if _, err := c.UpdateStatus(env); err != nil {
+		t.Fatal(err)
+	}
+
+	envs, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(envs) != 1 || envs[0].Spec.Overrides["opuscapita.com/deletion-grace-period"] != "72h" || envs[0].Status.BranchState != BranchPresent {
+		t.Errorf("Expected environment to be read back, got %+v", envs)
+	}
+
+	if err := c.Delete("app-feature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delete("app-feature"); err != nil {
+		t.Errorf("Expected deletion of missing environment to succeed, got %v", err)
+	}
+}
+
+func TestSetBranchStatus(t *testing.T) {
+	now := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	s := BranchEnvironmentStatus{}
+
+	s.SetBranchStatus(200, now)
+	s.SetBranchStatus(200, now.Add(time.Hour))
+	if len(s.Conditions) != 1 || s.Conditions[0].Status != corev1.ConditionTrue || !s.Conditions[0].LastTransitionTime.Time.Equal(now) {
+		t.Errorf("Expected transition time to be kept while status doesn't change, got %+v", s.Conditions)
+	}
+
+	s.SetBranchStatus(404, now.Add(2*time.Hour))
+	c := s.Conditions[0]
+	if s.BranchState != BranchMissing || c.Status != corev1.ConditionFalse || c.Reason != "BranchNotFound" || !c.LastTransitionTime.Time.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("Expected condition to transition to False, got %s %+v", s.BranchState, c)
+	}
+
+	s.SetBranchStatus(502, now)
+	if s.BranchState != BranchUnknown || s.Conditions[0].Status != corev1.ConditionUnknown {
+		t.Errorf("Expected unknown branch state, got %s %+v", s.BranchState, s.Conditions[0])
+	}
+}
+
+func TestSetPhase(t *testing.T) {
+	now := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	s := BranchEnvironmentStatus{}
+	s.SetBranchStatus(404, now)
+	s.SetPhase(PhaseMarkedForDeletion, "wait", "grace period isn't over", now)
+
+	statuses := map[string]corev1.ConditionStatus{}
+	for _, c := range s.Conditions {
+		statuses[c.Type] = c.Status
+	}
+	expected := map[string]corev1.ConditionStatus{
+		ConditionBranchExists:      corev1.ConditionFalse,
+		ConditionDeletionScheduled: corev1.ConditionTrue,
+		ConditionSkipped:           corev1.ConditionFalse,
+		ConditionDeleted:           corev1.ConditionFalse,
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected conditions %v, got %v", expected, statuses)
+	}
+
+	s.SetPhase(PhaseDeleted, "", "namespace is deleted", now.Add(time.Hour))
+	if s.Phase != PhaseDeleted || s.Conditions[3].Status != corev1.ConditionTrue || s.Conditions[3].Reason != "NamespaceDeleted" {
+		t.Errorf("Expected Deleted condition, got %s %+v", s.Phase, s.Conditions)
+	}
+}
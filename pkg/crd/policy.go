@@ -0,0 +1,159 @@
+package crd
+
+import (
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// kinds of cleanup policies: CleanupPolicy applies to namespace it's created in, ClusterCleanupPolicy applies to
+// namespaces selected by its namespaceSelector
+const (
+	CleanupPolicyKind        = "CleanupPolicy"
+	ClusterCleanupPolicyKind = "ClusterCleanupPolicy"
+)
+
+// resources of cleanup policies for dynamic client
+var (
+	CleanupPolicyResource        = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "cleanuppolicies"}
+	ClusterCleanupPolicyResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "clustercleanuppolicies"}
+)
+
+// CleanupPolicy configures cleanup of namespaces, both kinds of policies share this type
+type CleanupPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CleanupPolicySpec   `json:"spec"`
+	Status CleanupPolicyStatus `json:"status,omitempty"`
+}
+
+// CleanupPolicySpec holds settings of selected namespaces, empty values are taken from less specific policies
+// or app configuration
+type CleanupPolicySpec struct {
+	// NamespaceSelector selects namespaces ClusterCleanupPolicy applies to, nil selector selects all of them;
+	// it's ignored in CleanupPolicy
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Priority orders ClusterCleanupPolicies selecting the same namespace, values of the highest one are used first
+	Priority int `json:"priority,omitempty"`
+
+	// GracePeriod is duration between confirmation of branch deletion and deletion of namespace, e.g. "72h"
+	GracePeriod string `json:"gracePeriod,omitempty"`
+	// BranchMissingConfirmations is number of consecutive checks which should find branch missing
+	BranchMissingConfirmations int `json:"branchMissingConfirmations,omitempty"`
+	// RepoMissingPolicy is what to do if repository is missing: skip or delete
+	RepoMissingPolicy string `json:"repoMissingPolicy,omitempty"`
+	// VCSProvider is name of provider checking branches, e.g. "gitlab"
+	VCSProvider string `json:"vcsProvider,omitempty"`
+	// ApprovalChannel is Slack channel where approval of deletion is requested
+	ApprovalChannel string `json:"approvalChannel,omitempty"`
+	// Protected keeps namespaces from being deleted automatically
+	Protected *bool `json:"protected,omitempty"`
+	// Annotations are default annotations of namespaces, e.g. "opuscapita.com/helm-timeout"
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ConditionValid reports if policy is valid, invalid policies aren't applied
+const ConditionValid = "Valid"
+
+// CleanupPolicyStatus is written by the app when it reads policy
+type CleanupPolicyStatus struct {
+	// ObservedGeneration is generation of spec which conditions describe
+	ObservedGeneration int64       `json:"observedGeneration,omitempty"`
+	Conditions         []Condition `json:"conditions,omitempty"`
+}
+
+// SetValid sets Valid condition according to validation error of generation of spec, it returns false if status
+// is unchanged
+func (p *CleanupPolicy) SetValid(err error, now time.Time) bool {
+	c := Condition{Type: ConditionValid, Status: corev1.ConditionTrue, Reason: "Valid"}
+	if err != nil {
+		c.Status, c.Reason, c.Message = corev1.ConditionFalse, "Invalid", err.Error()
+	}
+	for _, current := range p.Status.Conditions {
+		if current.Type == c.Type && current.Status == c.Status && current.Message == c.Message && p.Status.ObservedGeneration == p.Generation {
+			return false
+		}
+	}
+	p.Status.ObservedGeneration = p.Generation
+	p.Status.Conditions = setCondition(p.Status.Conditions, c, now)
+	return true
+}
+
+// Selects checks if ClusterCleanupPolicy selects namespace with labels
+func (p *CleanupPolicy) Selects(nsLabels map[string]string) (bool, error) {
+	if p.Spec.NamespaceSelector == nil {
+		return true, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(p.Spec.NamespaceSelector)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(nsLabels)), nil
+}
+
+// PolicyClient lists cleanup policies
+type PolicyClient struct {
+	dynamicClient dynamic.Interface
+}
+
+// NewPolicyClient returns client of cleanup policies
+func NewPolicyClient(dynamicClient dynamic.Interface) *PolicyClient {
+	return &PolicyClient{dynamicClient: dynamicClient}
+}
+
+// ListNamespaced returns CleanupPolicies of all namespaces ordered by namespace and name
+func (c *PolicyClient) ListNamespaced() ([]CleanupPolicy, error) {
+	return c.list(c.dynamicClient.Resource(CleanupPolicyResource), func(policies []CleanupPolicy, i, j int) bool {
+		if policies[i].Namespace != policies[j].Namespace {
+			return policies[i].Namespace < policies[j].Namespace
+		}
+		return policies[i].Name < policies[j].Name
+	})
+}
+
+// ListCluster returns ClusterCleanupPolicies ordered by priority, the highest first, and name
+func (c *PolicyClient) ListCluster() ([]CleanupPolicy, error) {
+	return c.list(c.dynamicClient.Resource(ClusterCleanupPolicyResource), func(policies []CleanupPolicy, i, j int) bool {
+		if policies[i].Spec.Priority != policies[j].Spec.Priority {
+			return policies[i].Spec.Priority > policies[j].Spec.Priority
+		}
+		return policies[i].Name < policies[j].Name
+	})
+}
+
+// UpdateStatus updates status subresource of policy, policy without namespace is ClusterCleanupPolicy
+func (c *PolicyClient) UpdateStatus(p *CleanupPolicy) error {
+	var resource dynamic.ResourceInterface = c.dynamicClient.Resource(ClusterCleanupPolicyResource)
+	if p.Namespace != "" {
+		resource = c.dynamicClient.Resource(CleanupPolicyResource).Namespace(p.Namespace)
+	}
+	u, err := toUnstructured(p)
+	if err != nil {
+		return err
+	}
+	_, err = resource.UpdateStatus(u, metav1.UpdateOptions{})
+	return err
+}
+
+func (c *PolicyClient) list(resource dynamic.ResourceInterface, less func([]CleanupPolicy, int, int) bool) ([]CleanupPolicy, error) {
+	list, err := resource.List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]CleanupPolicy, len(list.Items))
+	for i := range list.Items {
+		if err := fromUnstructured(&list.Items[i], &policies[i]); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(policies, func(i, j int) bool {
+		return less(policies, i, j)
+	})
+	return policies, nil
+}
@@ -0,0 +1,81 @@
+package crd
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func clusterPolicy(name string, priority int64) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": Group + "/" + Version,
+		"kind":       ClusterCleanupPolicyKind,
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       map[string]interface{}{"priority": priority, "gracePeriod": "24h"},
+	}}
+}
+
+func TestPolicyClient_ListCluster(t *testing.T) {
+	c := NewPolicyClient(dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		clusterPolicy("b-default", 0), clusterPolicy("team", 10), clusterPolicy("a-default", 0)))
+
+	policies, err := c.ListCluster()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, p := range policies {
+		names = append(names, p.Name)
+	}
+	if len(names) != 3 || names[0] != "team" || names[1] != "a-default" || names[2] != "b-default" {
+		t.Errorf("Expected policies ordered by priority and name, got %v", names)
+	}
+	if policies[0].Spec.GracePeriod != "24h" {
+		t.Errorf("Expected spec to be read, got %+v", policies[0].Spec)
+	}
+}
+
+func TestCleanupPolicy_Selects(t *testing.T) {
+	p := CleanupPolicy{}
+	if ok, _ := p.Selects(map[string]string{"team": "a"}); !ok {
+		t.Error("Expected policy without selector to select all namespaces")
+	}
+
+	p.Spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+	if ok, _ := p.Selects(map[string]string{"team": "a"}); !ok {
+		t.Error("Expected matching namespace to be selected")
+	}
+	if ok, _ := p.Selects(map[string]string{"team": "b"}); ok {
+		t.Error("Expected other namespace not to be selected")
+	}
+
+	p.Spec.NamespaceSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "team", Operator: "Bogus"}}}
+	if _, err := p.Selects(nil); err == nil {
+		t.Error("Expected invalid selector to be reported")
+	}
+}
+
+func TestCleanupPolicy_SetValid(t *testing.T) {
+	now := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	p := CleanupPolicy{ObjectMeta: metav1.ObjectMeta{Generation: 1}}
+	if !p.SetValid(nil, now) || p.SetValid(nil, now) {
+		t.Error("Expected status to change only once")
+	}
+	if !p.SetValid(errors.New("gracePeriod is invalid"), now) {
+		t.Error("Expected status to change on error")
+	}
+	c := p.Status.Conditions[0]
+	if c.Status != corev1.ConditionFalse || c.Message != "gracePeriod is invalid" || p.Status.ObservedGeneration != 1 {
+		t.Errorf("Expected invalid condition, got %+v", p.Status)
+	}
+	p.Generation = 2
+	if !p.SetValid(errors.New("gracePeriod is invalid"), now) || p.Status.ObservedGeneration != 2 {
+		t.Error("Expected status to change with generation")
+	}
+}
@@ -0,0 +1,173 @@
+// Package cron parses standard 5-field cron expressions (the same syntax as robfig/cron has)
+// and computes their activation times
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bounds of field values together with their names
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minutes = bounds{0, 59, nil}
+	hours   = bounds{0, 23, nil}
+	dom     = bounds{1, 31, nil}
+	months  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Sunday is both 0 and 7
+	dow = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// descriptors are shortcuts of common expressions
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Schedule is parsed cron expression, every field is a bitset of allowed values
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar are true if fields are '*', day matches if any of restricted day fields matches
+	domStar, dowStar bool
+}
+
+// Parse parses expression like "*/15 8-18 * * Mon-Fri" or descriptor like "@hourly"
+func Parse(spec string) (*Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression '%s' should have 5 fields: minute, hour, day of month, month and day of week", spec)
+	}
+
+	s := &Schedule{domStar: fields[2] == "*" || fields[2] == "?", dowStar: fields[4] == "*" || fields[4] == "?"}
+	var err error
+	if s.minute, err = parseField(fields[0], minutes); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[1], hours); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(fields[2], dom); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[3], months); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(fields[4], dow); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parseField parses comma-separated list of '*', values, ranges and steps, e.g. "1,10-20/5,*/30"
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangeAndStep := strings.SplitN(item, "/", 2)
+		low, high := b.min, b.max
+		switch r := rangeAndStep[0]; {
+		case r == "*" || r == "?":
+		default:
+			parts := strings.SplitN(r, "-", 2)
+			var err error
+			if low, err = parseValue(parts[0], b); err != nil {
+				return 0, err
+			}
+			high = low
+			if len(parts) == 2 {
+				if high, err = parseValue(parts[1], b); err != nil {
+					return 0, err
+				}
+			} else if len(rangeAndStep) == 2 {
+				// "5/15" means "5-MAX/15"
+				high = b.max
+			}
+		}
+		step := uint64(1)
+		if len(rangeAndStep) == 2 {
+			var err error
+			if step, err = strconv.ParseUint(rangeAndStep[1], 10, 8); err != nil || step == 0 {
+				return 0, fmt.Errorf("invalid step in '%s'", item)
+			}
+		}
+		if low > high {
+			return 0, fmt.Errorf("invalid range '%s'", item)
+		}
+		for v := uint64(low); v <= uint64(high); v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// parseValue parses number or name within bounds
+func parseValue(val string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(val)]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(val, 10, 8)
+	if err != nil || uint(v) < b.min || uint(v) > b.max {
+		return 0, fmt.Errorf("value '%s' should be between %d and %d", val, b.min, b.max)
+	}
+	return uint(v), nil
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the earliest activation time after t in location of t, zero time is returned
+// if there's none in the next 5 years (e.g. for February 30th)
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	limit := t.Year() + 5
+
+	for t.Year() <= limit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,44 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule_Next(t *testing.T) {
+	// 2019-07-01 is Monday
+	from := time.Date(2019, 7, 1, 10, 20, 30, 0, time.UTC)
+	for spec, expected := range map[string]time.Time{
+		"* * * * *":            time.Date(2019, 7, 1, 10, 21, 0, 0, time.UTC),
+		"*/15 * * * *":         time.Date(2019, 7, 1, 10, 30, 0, 0, time.UTC),
+		"0 8-18 * * *":         time.Date(2019, 7, 1, 11, 0, 0, 0, time.UTC),
+		"0 2 * * *":            time.Date(2019, 7, 2, 2, 0, 0, 0, time.UTC),
+		"30 9 * * Sat,sun":     time.Date(2019, 7, 6, 9, 30, 0, 0, time.UTC),
+		"0 0 * * 7":            time.Date(2019, 7, 7, 0, 0, 0, 0, time.UTC),
+		"0 0 1 JAN *":          time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 13 * 5":           time.Date(2019, 7, 5, 0, 0, 0, 0, time.UTC),
+		"@hourly":              time.Date(2019, 7, 1, 11, 0, 0, 0, time.UTC),
+		"@weekly":              time.Date(2019, 7, 7, 0, 0, 0, 0, time.UTC),
+		"5/20 10 * * *":        time.Date(2019, 7, 1, 10, 25, 0, 0, time.UTC),
+		"0 0 29 2 *":           time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		"0 0 30 2 *":           {},
+		"0,45 10-12/2 1-5 7 *": time.Date(2019, 7, 1, 10, 45, 0, 0, time.UTC),
+	} {
+		s, err := Parse(spec)
+		if err != nil {
+			t.Errorf("Failed to parse '%s': %v", spec, err)
+			continue
+		}
+		if next := s.Next(from); !next.Equal(expected) {
+			t.Errorf("Expected next activation of '%s' at %v, but got %v", spec, expected, next)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "* * * * Funday"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Expected error for '%s'", spec)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	gcp "github.com/OpusCapita/buhtig-s8k/pkg/gcp"
+)
+
+const cloudDNSScope = "https://www.googleapis.com/auth/ndev.clouddns.readwrite"
+
+// CloudDNS deletes records from Google Cloud DNS managed zone
+type CloudDNS struct {
+	httpClient *http.Client
+	project    string
+	zone       string
+	// endpoint is API URL, it's replaced in tests
+	endpoint string
+}
+
+// NewCloudDNS returns Cloud DNS provider of managed zone; credentials are read from service account key file
+// if it's not empty and from GCE metadata server (e.g. GKE Workload Identity) otherwise
+func NewCloudDNS(project, zone, keyFile string) (*CloudDNS, error) {
+	httpClient, err := gcp.NewHTTPClient(keyFile, 30*time.Second, cloudDNSScope)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudDNS{httpClient: httpClient, project: project, zone: zone, endpoint: "https://dns.googleapis.com/dns/v1"}, nil
+}
+
+// Name implements Provider
+func (c *CloudDNS) Name() string {
+	return "clouddns/" + c.project + "/" + c.zone
+}
+
+// recordSets returns record sets whose name equals name
+func (c *CloudDNS) recordSets(base, name string) ([]map[string]interface{}, error) {
+	list := struct {
+		RRSets []map[string]interface{} `json:"rrsets"`
+	}{}
+	if err := c.doJSON(http.MethodGet, base+"/rrsets?name="+url.QueryEscape(name), nil, &list); err != nil {
+		return nil, err
+	}
+	sets := []map[string]interface{}{}
+	for _, rrset := range list.RRSets {
+		if rrName, _ := rrset["name"].(string); strings.ToLower(rrName) == name {
+			sets = append(sets, rrset)
+		}
+	}
+	return sets, nil
+}
+
+// DeleteRecords implements Provider
+func (c *CloudDNS) DeleteRecords(hostname string, owner Ownership) (int, error) {
+	name := fqdn(hostname)
+	base := fmt.Sprintf("%s/projects/%s/managedZones/%s", c.endpoint, url.PathEscape(c.project), url.PathEscape(c.zone))
+
+	sets, err := c.recordSets(base, name)
+	if err != nil {
+		return 0, err
+	}
+	txtName, txtSets := owner.txtName(hostname), sets
+	if txtName != name {
+		if txtSets, err = c.recordSets(base, txtName); err != nil {
+			return 0, err
+		}
+	}
+
+	owned := false
+	for _, rrset := range txtSets {
+		if rrset["type"] != "TXT" {
+			continue
+		}
+		values := []string{}
+		rrdatas, _ := rrset["rrdatas"].([]interface{})
+		for _, rrdata := range rrdatas {
+			if value, ok := rrdata.(string); ok {
+				values = append(values, value)
+			}
+		}
+		owned = owned || owner.owns(values)
+	}
+	if !owned {
+		return 0, nil
+	}
+
+	// deletions should be exactly the same as existing record sets
+	deletions := []map[string]interface{}{}
+	for _, rrset := range sets {
+		if rrType, _ := rrset["type"].(string); deletedTypes[rrType] {
+			deletions = append(deletions, rrset)
+		}
+	}
+	if txtName != name {
+		for _, rrset := range txtSets {
+			if rrset["type"] == "TXT" {
+				deletions = append(deletions, rrset)
+			}
+		}
+	}
+	if len(deletions) == 0 {
+		return 0, nil
+	}
+	if err := c.doJSON(http.MethodPost, base+"/changes", map[string]interface{}{"deletions": deletions}, nil); err != nil {
+		return 0, err
+	}
+	return len(deletions), nil
+}
+
+func (c *CloudDNS) doJSON(method, url string, payload, out interface{}) error {
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, url, &body)
+	if err != nil {
+		return err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Cloud DNS %s %s responded with status %d: %s", method, url, resp.StatusCode, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,55 @@
+// Package dns deletes DNS records created for branch hostnames (e.g. by external-dns) directly in DNS providers,
+// so that stale preview URLs don't keep resolving after environment is removed.
+package dns
+
+import (
+	"strings"
+)
+
+// record types which are deleted; TXT records are deleted as well since external-dns keeps ownership records there
+var deletedTypes = map[string]bool{"A": true, "AAAA": true, "CNAME": true, "TXT": true}
+
+// resourceKey is the key of external-dns ownership record naming source of the record
+const resourceKey = "external-dns/resource="
+
+// Ownership identifies records external-dns created for sources of environment. Records are deleted only if
+// ownership TXT record of hostname names one of Resources, so that records of other environments sharing
+// the hostname (e.g. path-based Ingresses) and records created outside of external-dns are left alone.
+type Ownership struct {
+	// TXTPrefix is '--txt-prefix' of external-dns, ownership record of hostname is named with it
+	TXTPrefix string
+	// Resources are sources of environment as external-dns names them, e.g. 'ingress/NAMESPACE/NAME',
+	// 'service/NAMESPACE/NAME' or 'crd/NAMESPACE/NAME'
+	Resources map[string]bool
+}
+
+// txtName returns name of ownership record of hostname
+func (o Ownership) txtName(hostname string) string {
+	return fqdn(o.TXTPrefix + strings.TrimSuffix(hostname, "."))
+}
+
+// owns checks if values of TXT record set contain ownership record naming one of resources
+func (o Ownership) owns(values []string) bool {
+	for _, value := range values {
+		for _, item := range strings.Split(strings.Trim(value, `"`), ",") {
+			if strings.HasPrefix(item, resourceKey) && o.Resources[strings.TrimPrefix(item, resourceKey)] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Provider deletes records of hostname from a single DNS zone
+type Provider interface {
+	// Name of the provider for logging
+	Name() string
+	// DeleteRecords deletes A, AAAA, CNAME and TXT records whose name equals hostname, as well as ownership record,
+	// if they're owned by environment; it returns number of deleted record sets, 0 if records aren't owned
+	DeleteRecords(hostname string, owner Ownership) (int, error)
+}
+
+// fqdn returns hostname with trailing dot, which is how providers return record names
+func fqdn(hostname string) string {
+	return strings.TrimSuffix(strings.ToLower(hostname), ".") + "."
+}
@@ -0,0 +1,119 @@
+package dns
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const ownershipRecord = `"heritage=external-dns,external-dns/owner=default,external-dns/resource=ingress/preview/web"`
+
+func TestRoute53_DeleteRecords(t *testing.T) {
+	var changes string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			t.Errorf("Request isn't signed")
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/2013-04-01/hostedzone/Z1/rrset":
+			if name := r.URL.Query().Get("name"); name != "feature.example.com." {
+				t.Errorf("Unexpected name %s", name)
+			}
+			w.Write([]byte(`<ListResourceRecordSetsResponse><ResourceRecordSets>` +
+				`<ResourceRecordSet><Name>feature.example.com.</Name><Type>A</Type><AliasTarget><HostedZoneId>Z2</HostedZoneId><DNSName>lb.example.com.</DNSName><EvaluateTargetHealth>false</EvaluateTargetHealth></AliasTarget></ResourceRecordSet>` +
+				`<ResourceRecordSet><Name>feature.example.com.</Name><Type>TXT</Type><TTL>300</TTL><ResourceRecords><ResourceRecord><Value>` + strings.Replace(ownershipRecord, `"`, "&quot;", -1) + `</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>` +
+				`<ResourceRecordSet><Name>feature.example.com.</Name><Type>MX</Type><TTL>300</TTL></ResourceRecordSet>` +
+				`<ResourceRecordSet><Name>other.example.com.</Name><Type>A</Type><TTL>300</TTL></ResourceRecordSet>` +
+				`</ResourceRecordSets></ListResourceRecordSetsResponse>`))
+		case r.Method == http.MethodPost && r.URL.Path == "/2013-04-01/hostedzone/Z1/rrset/":
+			body, _ := ioutil.ReadAll(r.Body)
+			changes = string(body)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("AKIDEXAMPLE", "secret", ""),
+		Endpoint:    aws.String(server.URL),
+		MaxRetries:  aws.Int(0),
+	}))
+	r53 := NewRoute53(sess, "/hostedzone/Z1")
+
+	// records of another environment sharing the hostname are left alone
+	deleted, err := r53.DeleteRecords("Feature.example.com", Ownership{Resources: map[string]bool{"ingress/other/web": true}})
+	if err != nil || deleted != 0 || changes != "" {
+		t.Errorf("Expected records owned by other namespace to be kept, got %d %s (%v)", deleted, changes, err)
+	}
+
+	deleted, err = r53.DeleteRecords("Feature.example.com", Ownership{Resources: map[string]bool{"ingress/preview/web": true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 deleted record sets, got %d", deleted)
+	}
+	if strings.Count(changes, "<Action>DELETE</Action>") != 2 ||
+		!strings.Contains(changes, "<DNSName>lb.example.com.</DNSName>") ||
+		strings.Contains(changes, "MX") || strings.Contains(changes, "other.example.com") {
+		t.Errorf("Unexpected changes %s", changes)
+	}
+}
+
+func TestCloudDNS_DeleteRecords(t *testing.T) {
+	var deletions []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/projects/p/managedZones/z/rrsets":
+			rrsets := []map[string]interface{}{}
+			switch r.URL.Query().Get("name") {
+			case "feature.example.com.":
+				rrsets = []map[string]interface{}{
+					{"name": "feature.example.com.", "type": "CNAME", "ttl": 300, "rrdatas": []string{"lb.example.com."}},
+					{"name": "feature.example.com.", "type": "NS", "ttl": 300, "rrdatas": []string{"ns.example.com."}},
+				}
+			case "txt-feature.example.com.":
+				rrsets = []map[string]interface{}{
+					{"name": "txt-feature.example.com.", "type": "TXT", "ttl": 300, "rrdatas": []string{ownershipRecord}},
+				}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"rrsets": rrsets})
+		case r.Method == http.MethodPost && r.URL.Path == "/projects/p/managedZones/z/changes":
+			change := struct {
+				Deletions []map[string]interface{} `json:"deletions"`
+			}{}
+			json.NewDecoder(r.Body).Decode(&change)
+			deletions = change.Deletions
+			w.Write([]byte("{}"))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &CloudDNS{httpClient: http.DefaultClient, project: "p", zone: "z", endpoint: server.URL}
+	owner := Ownership{TXTPrefix: "txt-", Resources: map[string]bool{"ingress/preview/web": true}}
+
+	// without ownership record records weren't created by external-dns for the environment
+	if deleted, err := c.DeleteRecords("feature.example.com", Ownership{Resources: owner.Resources}); err != nil || deleted != 0 || deletions != nil {
+		t.Errorf("Expected records without ownership record to be kept, got %d %v (%v)", deleted, deletions, err)
+	}
+
+	deleted, err := c.DeleteRecords("feature.example.com", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 || len(deletions) != 2 || deletions[0]["type"] != "CNAME" || deletions[1]["name"] != "txt-feature.example.com." {
+		t.Errorf("Unexpected deletions %v", deletions)
+	}
+}
@@ -0,0 +1,113 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/route53"
+	"github.com/aws/aws-sdk-go/service/route53/route53iface"
+)
+
+// Route53 deletes records from AWS Route53 hosted zone with credentials resolved by default credentials chain
+// of AWS SDK
+type Route53 struct {
+	api    route53iface.Route53API
+	zoneID string
+}
+
+// NewRoute53 returns Route53 provider of hosted zone using session, see aws.NewSession; Route53 is a global
+// service signed for us-east-1
+func NewRoute53(sess *session.Session, zoneID string) *Route53 {
+	return &Route53{
+		api:    route53.New(sess, aws.NewConfig().WithRegion("us-east-1")),
+		zoneID: strings.TrimPrefix(zoneID, "/hostedzone/"),
+	}
+}
+
+// Name implements Provider
+func (r *Route53) Name() string {
+	return "route53/" + r.zoneID
+}
+
+// recordSets returns record sets whose name equals name
+func (r *Route53) recordSets(name string) ([]*route53.ResourceRecordSet, error) {
+	list, err := r.api.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(r.zoneID),
+		StartRecordName: aws.String(name),
+		MaxItems:        aws.String("100"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Route53 ListResourceRecordSets failed: %v", err)
+	}
+	// listing starts at name, but continues with subsequent records
+	sets := []*route53.ResourceRecordSet{}
+	for _, rs := range list.ResourceRecordSets {
+		if strings.ToLower(aws.StringValue(rs.Name)) == name {
+			sets = append(sets, rs)
+		}
+	}
+	return sets, nil
+}
+
+// DeleteRecords implements Provider
+func (r *Route53) DeleteRecords(hostname string, owner Ownership) (int, error) {
+	name := fqdn(hostname)
+	sets, err := r.recordSets(name)
+	if err != nil {
+		return 0, err
+	}
+	txtName, txtSets := owner.txtName(hostname), sets
+	if txtName != name {
+		if txtSets, err = r.recordSets(txtName); err != nil {
+			return 0, err
+		}
+	}
+
+	owned := false
+	for _, rs := range txtSets {
+		if aws.StringValue(rs.Type) != "TXT" {
+			continue
+		}
+		values := []string{}
+		for _, rr := range rs.ResourceRecords {
+			values = append(values, aws.StringValue(rr.Value))
+		}
+		owned = owned || owner.owns(values)
+	}
+	if !owned {
+		return 0, nil
+	}
+
+	// deletion requires exactly the same record set (incl. routing policy, alias target, etc.), so listed ones
+	// are passed as is
+	changes := []*route53.Change{}
+	for _, rs := range sets {
+		if deletedTypes[aws.StringValue(rs.Type)] {
+			changes = append(changes, &route53.Change{Action: aws.String(route53.ChangeActionDelete), ResourceRecordSet: rs})
+		}
+	}
+	if txtName != name {
+		for _, rs := range txtSets {
+			if aws.StringValue(rs.Type) == "TXT" {
+				changes = append(changes, &route53.Change{Action: aws.String(route53.ChangeActionDelete), ResourceRecordSet: rs})
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return 0, nil
+	}
+
+	_, err = r.api.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(r.zoneID),
+		ChangeBatch: &route53.ChangeBatch{
+			Comment: aws.String(fmt.Sprintf("Environment of %s is removed", hostname)),
+			Changes: changes,
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Route53 ChangeResourceRecordSets failed: %v", err)
+	}
+	return len(changes), nil
+}
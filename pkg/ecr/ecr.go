@@ -0,0 +1,81 @@
+// Package ecr deletes image tags from AWS Elastic Container Registry repositories
+package ecr
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+)
+
+// batchSize is the maximum number of images BatchDeleteImage accepts
+const batchSize = 100
+
+// Client calls ECR API with credentials resolved by default credentials chain of AWS SDK
+// (IRSA web identity token in EKS)
+type Client struct {
+	session *session.Session
+	// api returns ECR API of region, it's replaced in tests
+	api func(region string) ecriface.ECRAPI
+}
+
+// NewClient returns ECR client using session, see aws.NewSession
+func NewClient(sess *session.Session) *Client {
+	c := &Client{session: sess}
+	c.api = func(region string) ecriface.ECRAPI {
+		return ecr.New(c.session, aws.NewConfig().WithRegion(region))
+	}
+	return c
+}
+
+// ListTags returns all tags of images in repository
+func (c *Client) ListTags(region, repo string) ([]string, error) {
+	tags := []string{}
+	input := &ecr.ListImagesInput{
+		RepositoryName: aws.String(repo),
+		Filter:         &ecr.ListImagesFilter{TagStatus: aws.String(ecr.TagStatusTagged)},
+		MaxResults:     aws.Int64(1000),
+	}
+	err := c.api(region).ListImagesPages(input, func(page *ecr.ListImagesOutput, _ bool) bool {
+		for _, id := range page.ImageIds {
+			tags = append(tags, aws.StringValue(id.ImageTag))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ECR ListImages failed: %v", err)
+	}
+	return tags, nil
+}
+
+// DeleteTags deletes tags from repository and returns number of deleted ones; image is deleted by ECR
+// when its last tag is deleted. Missing tags aren't reported as errors.
+func (c *Client) DeleteTags(region, repo string, tags []string) (int, error) {
+	deleted := 0
+	for start := 0; start < len(tags); start += batchSize {
+		end := start + batchSize
+		if end > len(tags) {
+			end = len(tags)
+		}
+		ids := []*ecr.ImageIdentifier{}
+		for _, tag := range tags[start:end] {
+			ids = append(ids, &ecr.ImageIdentifier{ImageTag: aws.String(tag)})
+		}
+
+		resp, err := c.api(region).BatchDeleteImage(&ecr.BatchDeleteImageInput{RepositoryName: aws.String(repo), ImageIds: ids})
+		if err != nil {
+			return deleted, fmt.Errorf("ECR BatchDeleteImage failed: %v", err)
+		}
+		deleted += len(resp.ImageIds)
+		for _, f := range resp.Failures {
+			code := aws.StringValue(f.FailureCode)
+			if code != ecr.ImageFailureCodeImageNotFound && code != ecr.ImageFailureCodeImageTagDoesNotMatchDigest {
+				return deleted, fmt.Errorf("Failed to delete tag %s from ECR repository %s: %s %s",
+					aws.StringValue(f.ImageId.ImageTag), repo, code, aws.StringValue(f.FailureReason))
+			}
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,69 @@
+package ecr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func TestClient(t *testing.T) {
+	var deleteRequests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload := map[string]interface{}{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload["repositoryName"] != "app" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type": "RepositoryNotFoundException", "message": "repository does not exist"}`)
+			return
+		}
+		switch r.Header.Get("X-Amz-Target") {
+		case "AmazonEC2ContainerRegistry_V20150921.ListImages":
+			if payload["nextToken"] == nil {
+				fmt.Fprint(w, `{"imageIds": [{"imageDigest": "sha256:1", "imageTag": "feature-x"}], "nextToken": "t"}`)
+			} else {
+				fmt.Fprint(w, `{"imageIds": [{"imageDigest": "sha256:2", "imageTag": "master"}]}`)
+			}
+		case "AmazonEC2ContainerRegistry_V20150921.BatchDeleteImage":
+			deleteRequests = append(deleteRequests, payload)
+			fmt.Fprint(w, `{"imageIds": [{"imageDigest": "sha256:1", "imageTag": "feature-x"}],
+				"failures": [{"imageId": {"imageTag": "gone"}, "failureCode": "ImageNotFound", "failureReason": "not found"}]}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("AKID", "secret", ""),
+		Endpoint:    aws.String(server.URL),
+		MaxRetries:  aws.Int(0),
+	}))
+	c := NewClient(sess)
+
+	tags, err := c.ListTags("eu-west-1", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, []string{"feature-x", "master"}) {
+		t.Errorf("Unexpected tags %v", tags)
+	}
+
+	deleted, err := c.DeleteTags("eu-west-1", "app", []string{"feature-x", "gone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 || len(deleteRequests) != 1 {
+		t.Errorf("Expected 1 deleted tag in 1 request, got %d in %d", deleted, len(deleteRequests))
+	}
+
+	if _, err := c.ListTags("eu-west-1", "missing"); err == nil {
+		t.Errorf("Expected error for missing repository")
+	}
+}
@@ -0,0 +1,88 @@
+// Package gcp authenticates requests to Google Cloud APIs
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+const metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// NewHTTPClient returns HTTP client which authorizes requests with access tokens of service account; credentials are
+// read from service account key file if it's not empty and from GCE metadata server (e.g. GKE Workload Identity) otherwise
+func NewHTTPClient(keyFile string, timeout time.Duration, scopes ...string) (*http.Client, error) {
+	var tokenSource oauth2.TokenSource = &metadataTokenSource{httpClient: &http.Client{Timeout: 10 * time.Second}, scopes: scopes}
+	if keyFile != "" {
+		data, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		key := struct {
+			ClientEmail  string `json:"client_email"`
+			PrivateKey   string `json:"private_key"`
+			PrivateKeyID string `json:"private_key_id"`
+			TokenURI     string `json:"token_uri"`
+		}{}
+		if err := json.Unmarshal(data, &key); err != nil {
+			return nil, fmt.Errorf("Failed to parse service account key %s: %v", keyFile, err)
+		}
+		cfg := &jwt.Config{
+			Email:        key.ClientEmail,
+			PrivateKey:   []byte(key.PrivateKey),
+			PrivateKeyID: key.PrivateKeyID,
+			TokenURL:     key.TokenURI,
+			Scopes:       scopes,
+		}
+		tokenSource = cfg.TokenSource(context.Background())
+	}
+
+	httpClient := oauth2.NewClient(context.Background(), oauth2.ReuseTokenSource(nil, tokenSource))
+	httpClient.Timeout = timeout
+	return httpClient, nil
+}
+
+// metadataTokenSource gets access tokens of service account attached to GCE instance (or to pod with Workload Identity)
+type metadataTokenSource struct {
+	httpClient *http.Client
+	scopes     []string
+}
+
+// Token implements oauth2.TokenSource
+func (s *metadataTokenSource) Token() (*oauth2.Token, error) {
+	req, err := http.NewRequest(http.MethodGet, metadataTokenURL+"?scopes="+url.QueryEscape(strings.Join(s.scopes, ",")), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GCE metadata server responded with status %d", resp.StatusCode)
+	}
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		TokenType   string `json:"token_type"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken: token.AccessToken,
+		TokenType:   token.TokenType,
+		Expiry:      time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}, nil
+}
@@ -0,0 +1,80 @@
+package gitea
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// matches path of branch URL relative to base URL, e.g. /OWNER/REPO/src/branch/BRANCH
+var branchPathRe = regexp.MustCompile(`^/([^/]+)/([^/]+)/src/branch/(.+?)/?$`)
+
+// Client is a thin wrapper around REST API v1 of Gitea (and its fork Forgejo)
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+}
+
+// NewClient returns client of Gitea instance at baseURL (including sub-path, if any)
+// which authenticates requests with access token; empty token means anonymous access
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+	}
+}
+
+// IsBranchURL checks if URL points to branch of this Gitea instance
+func (c *Client) IsBranchURL(branchURL string) bool {
+	_, _, _, err := c.ParseBranchURL(branchURL)
+	return err == nil
+}
+
+// ParseBranchURL expects URL like BASE_URL/OWNER/REPO/src/branch/BRANCH and returns its parts
+func (c *Client) ParseBranchURL(branchURL string) (owner, repo, branch string, err error) {
+	if c.baseURL == "" || !strings.HasPrefix(branchURL, c.baseURL+"/") {
+		return "", "", "", fmt.Errorf("branchURL doesn't belong to Gitea: %s", branchURL)
+	}
+	parts := branchPathRe.FindStringSubmatch(strings.TrimPrefix(branchURL, c.baseURL))
+	if parts == nil {
+		return "", "", "", fmt.Errorf("branchURL doesn't match regexp: %s", branchURL)
+	}
+	// branch is shown URL-encoded in Gitea UI, e.g. 'feature%2Fx'
+	if branch, err = url.PathUnescape(parts[3]); err != nil {
+		return "", "", "", err
+	}
+	return parts[1], parts[2], branch, nil
+}
+
+// BranchStatus queries branch and returns status code of HTTP response (404 means branch doesn't exist)
+func (c *Client) BranchStatus(owner, repo, branch string) (int, error) {
+	return c.status(fmt.Sprintf("%s/api/v1/repos/%s/%s/branches/%s", c.baseURL, owner, repo, url.PathEscape(branch)))
+}
+
+// RepoStatus queries repository and returns status code of HTTP response
+func (c *Client) RepoStatus(owner, repo string) (int, error) {
+	return c.status(fmt.Sprintf("%s/api/v1/repos/%s/%s", c.baseURL, owner, repo))
+}
+
+func (c *Client) status(apiURL string) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "token "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
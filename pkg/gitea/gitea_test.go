@@ -0,0 +1,49 @@
+package gitea
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient_ParseBranchURL(t *testing.T) {
+	c := NewClient("https://git.example.com/", "")
+
+	owner, repo, branch, err := c.ParseBranchURL("https://git.example.com/owner/repo/src/branch/feature%2Fx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != "owner" || repo != "repo" || branch != "feature/x" {
+		t.Errorf("Unexpected parts: %s, %s, %s", owner, repo, branch)
+	}
+
+	if c.IsBranchURL("https://git.example.com/owner/repo/src/commit/abcdef") {
+		t.Errorf("Commit URL shouldn't be recognized as branch one")
+	}
+	if c.IsBranchURL("https://github.com/owner/repo/tree/branch") {
+		t.Errorf("URL of another host shouldn't be recognized as Gitea one")
+	}
+}
+
+func TestClient_BranchStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.RawPath == "/api/v1/repos/owner/repo/branches/feature%2Fx" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, "secret")
+	if status, _ := c.BranchStatus("owner", "repo", "feature/x"); status != 200 {
+		t.Errorf("Expected 200 for existing branch, but got %d", status)
+	}
+	if status, _ := c.BranchStatus("owner", "repo", "gone"); status != 404 {
+		t.Errorf("Expected 404 for deleted branch, but got %d", status)
+	}
+}
@@ -0,0 +1,87 @@
+package gitea
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	vcs "github.com/OpusCapita/buhtig-s8k/pkg/vcs"
+)
+
+// Name implements vcs.Provider
+func (c *Client) Name() string {
+	return "gitea"
+}
+
+// Match implements vcs.Provider
+func (c *Client) Match(sourceURL *url.URL) bool {
+	return c.IsBranchURL(sourceURL.String())
+}
+
+// CheckBranch implements vcs.Provider
+func (c *Client) CheckBranch(sourceURL string) (int, error) {
+	owner, repo, branch, err := c.ParseBranchURL(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return c.BranchStatus(owner, repo, branch)
+}
+
+// CheckRepo implements vcs.Provider
+func (c *Client) CheckRepo(sourceURL string) (int, error) {
+	owner, repo, _, err := c.ParseBranchURL(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return c.RepoStatus(owner, repo)
+}
+
+// CheckPR implements vcs.Provider; Gitea can't filter pull requests by head branch,
+// so the first page of recently updated ones is searched
+func (c *Client) CheckPR(sourceURL string) (*vcs.PullRequest, error) {
+	owner, repo, branch, err := c.ParseBranchURL(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v1/repos/%s/%s/pulls?state=all&sort=recentupdate&limit=50", c.baseURL, owner, repo), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "token "+c.token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s responded with status %d", req.URL, resp.StatusCode)
+	}
+
+	pulls := []struct {
+		Number  int    `json:"number"`
+		State   string `json:"state"`
+		Merged  bool   `json:"merged"`
+		HTMLURL string `json:"html_url"`
+		Head    struct {
+			Ref string `json:"ref"`
+		} `json:"head"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&pulls); err != nil {
+		return nil, err
+	}
+	for _, pr := range pulls {
+		if pr.Head.Ref != branch {
+			continue
+		}
+		state := pr.State
+		if pr.Merged {
+			state = vcs.StateMerged
+		}
+		return &vcs.PullRequest{Number: pr.Number, State: state, URL: pr.HTMLURL}, nil
+	}
+	return nil, nil
+}
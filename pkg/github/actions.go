@@ -0,0 +1,90 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// conclusions of completed workflow run
+const (
+	ConclusionSuccess = "success"
+	ConclusionSkipped = "skipped"
+)
+
+// WorkflowRun describes Github Actions workflow run (only fields we're interested in)
+type WorkflowRun struct {
+	ID         int64     `json:"id"`
+	Status     string    `json:"status"`
+	Conclusion string    `json:"conclusion"`
+	HTMLURL    string    `json:"html_url"`
+	CreatedAt  time.Time `json:"created_at"`
+	// DisplayTitle is 'run-name' of workflow if it's set
+	DisplayTitle string `json:"display_title"`
+}
+
+// IsCompleted checks if run has finished, successfully or not
+func (r *WorkflowRun) IsCompleted() bool {
+	return r.Status == "completed"
+}
+
+// IsSucceeded checks if run has finished successfully
+func (r *WorkflowRun) IsSucceeded() bool {
+	return r.IsCompleted() && (r.Conclusion == ConclusionSuccess || r.Conclusion == ConclusionSkipped)
+}
+
+// DefaultBranch returns name of default branch of repository
+func (c *Client) DefaultBranch(owner, repo string) (string, error) {
+	repository := struct {
+		DefaultBranch string `json:"default_branch"`
+	}{}
+	err := c.do(http.MethodGet, fmt.Sprintf("%s/repos/%s/%s", c.baseURL, owner, repo), nil, &repository)
+	return repository.DefaultBranch, err
+}
+
+// DispatchWorkflow creates workflow_dispatch event for workflow (its file name or ID) on ref;
+// Github doesn't return created run, see FindWorkflowRun
+func (c *Client) DispatchWorkflow(owner, repo, workflow, ref string, inputs map[string]string) error {
+	payload := map[string]interface{}{"ref": ref, "inputs": inputs}
+	return c.do(http.MethodPost, fmt.Sprintf("%s/repos/%s/%s/actions/workflows/%s/dispatches", c.baseURL, owner, repo, url.PathEscape(workflow)), payload, nil)
+}
+
+// FindWorkflowRun returns the earliest run of workflow triggered by workflow_dispatch event on ref, created not before
+// since and whose display title contains correlationID (workflow puts dispatch input into its 'run-name'), so that runs
+// dispatched for others aren't claimed; nil is returned if there's no such run (yet)
+func (c *Client) FindWorkflowRun(owner, repo, workflow, ref string, since time.Time, correlationID string) (*WorkflowRun, error) {
+	query := url.Values{}
+	query.Set("event", "workflow_dispatch")
+	query.Set("branch", ref)
+	query.Set("created", ">="+since.UTC().Format(time.RFC3339))
+	query.Set("per_page", "100")
+
+	runs := struct {
+		WorkflowRuns []WorkflowRun `json:"workflow_runs"`
+	}{}
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/actions/workflows/%s/runs?%s", c.baseURL, owner, repo, url.PathEscape(workflow), query.Encode())
+	if err := c.do(http.MethodGet, apiURL, nil, &runs); err != nil {
+		return nil, err
+	}
+
+	var earliest *WorkflowRun
+	for i := range runs.WorkflowRuns {
+		run := &runs.WorkflowRuns[i]
+		if run.CreatedAt.Before(since) || !strings.Contains(run.DisplayTitle, correlationID) {
+			continue
+		}
+		if earliest == nil || run.CreatedAt.Before(earliest.CreatedAt) {
+			earliest = run
+		}
+	}
+	return earliest, nil
+}
+
+// GetWorkflowRun returns workflow run by its ID
+func (c *Client) GetWorkflowRun(owner, repo string, id int64) (*WorkflowRun, error) {
+	run := &WorkflowRun{}
+	err := c.do(http.MethodGet, fmt.Sprintf("%s/repos/%s/%s/actions/runs/%d", c.baseURL, owner, repo, id), nil, run)
+	return run, err
+}
@@ -0,0 +1,70 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClient_Workflows(t *testing.T) {
+	var dispatched map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /repos/owner/repo":
+			fmt.Fprint(w, `{"default_branch": "main"}`)
+		case "POST /repos/owner/repo/actions/workflows/teardown.yml/dispatches":
+			json.NewDecoder(r.Body).Decode(&dispatched)
+			w.WriteHeader(http.StatusNoContent)
+		case "GET /repos/owner/repo/actions/workflows/teardown.yml/runs":
+			if r.URL.Query().Get("event") != "workflow_dispatch" || r.URL.Query().Get("branch") != "main" {
+				fmt.Fprint(w, `{"workflow_runs": []}`)
+				return
+			}
+			fmt.Fprint(w, `{"workflow_runs": [
+				{"id": 4, "display_title": "Teardown uid-b", "status": "queued", "created_at": "2019-07-01T10:00:01Z"},
+				{"id": 3, "display_title": "Teardown uid-a", "status": "queued", "created_at": "2019-07-01T10:00:09Z"},
+				{"id": 2, "display_title": "Teardown uid-a", "status": "queued", "created_at": "2019-07-01T10:00:05Z"},
+				{"id": 1, "display_title": "Teardown uid-a", "status": "completed", "created_at": "2019-07-01T09:00:00Z"}
+			]}`)
+		case "GET /repos/owner/repo/actions/runs/2":
+			fmt.Fprint(w, `{"id": 2, "status": "completed", "conclusion": "failure"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{httpClient: http.DefaultClient, baseURL: server.URL}
+
+	if branch, err := c.DefaultBranch("owner", "repo"); err != nil || branch != "main" {
+		t.Errorf("Expected default branch 'main', but got '%s' (%v)", branch, err)
+	}
+
+	if err := c.DispatchWorkflow("owner", "repo", "teardown.yml", "main", map[string]string{"branch": "feature"}); err != nil {
+		t.Fatal(err)
+	}
+	if dispatched["ref"] != "main" || dispatched["inputs"].(map[string]interface{})["branch"] != "feature" {
+		t.Errorf("Unexpected dispatch payload %v", dispatched)
+	}
+
+	since, _ := time.Parse(time.RFC3339, "2019-07-01T10:00:00Z")
+	// earlier run dispatched for other namespace isn't claimed
+	run, err := c.FindWorkflowRun("owner", "repo", "teardown.yml", "main", since, "uid-a")
+	if err != nil || run == nil || run.ID != 2 {
+		t.Fatalf("Expected run 2, but got %+v (%v)", run, err)
+	}
+	if run, err := c.FindWorkflowRun("owner", "repo", "teardown.yml", "main", since, "uid-c"); err != nil || run != nil {
+		t.Errorf("Expected no run, but got %+v (%v)", run, err)
+	}
+	if run, err := c.FindWorkflowRun("owner", "repo", "teardown.yml", "other", since, "uid-a"); err != nil || run != nil {
+		t.Errorf("Expected no run, but got %+v (%v)", run, err)
+	}
+
+	run, err = c.GetWorkflowRun("owner", "repo", 2)
+	if err != nil || !run.IsCompleted() || run.IsSucceeded() {
+		t.Errorf("Expected failed run, but got %+v (%v)", run, err)
+	}
+}
@@ -0,0 +1,365 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const defaultBaseURL = "https://api.github.com"
+
+var branchURLRe = regexp.MustCompile("https://github.com/([^/]+)/([^/]+)/tree/(.+)")
+
+// ParseBranchURL expects URL like https://github.com/OWNER/REPO/tree/BRANCH and returns its parts
+func ParseBranchURL(branchURL string) (owner, repo, branch string, err error) {
+	parts := branchURLRe.FindStringSubmatch(branchURL)
+	if parts == nil || len(parts) < 4 {
+		return "", "", "", fmt.Errorf("branchURL doesn't match regexp: %v", parts)
+	}
+	return parts[1], parts[2], parts[3], nil
+}
+
+// Client is a thin wrapper around Github REST API v3
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	rateLimit  *rateLimitTransport
+}
+
+// NewClient returns Github client which authenticates requests with provided token;
+// empty token means anonymous access (with much lower rate limits)
+func NewClient(token string) *Client {
+	return NewEnterpriseClient(defaultBaseURL, token)
+}
+
+// NewEnterpriseClient returns client of Github Enterprise Server with API at baseURL, e.g. https://ghe.example.com/api/v3
+func NewEnterpriseClient(baseURL, token string) *Client {
+	var base http.RoundTripper
+	if token != "" {
+		tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+		base = oauth2.NewClient(context.Background(), tokenSource).Transport
+	}
+	rateLimit := newRateLimitTransport(base)
+	return &Client{httpClient: &http.Client{Transport: rateLimit}, baseURL: strings.TrimSuffix(baseURL, "/"), rateLimit: rateLimit}
+}
+
+// BranchStatus queries branch and returns status code of HTTP response (404 means branch doesn't exist)
+func (c *Client) BranchStatus(owner, repo, branch string) (int, error) {
+	return c.status(fmt.Sprintf("%s/repos/%s/%s/branches/%s", c.baseURL, owner, repo, branch))
+}
+
+// RepoStatus queries repository and returns status code of HTTP response;
+// note that Github responds with 404 both for deleted repository and for private repository token has no access to
+func (c *Client) RepoStatus(owner, repo string) (int, error) {
+	return c.status(fmt.Sprintf("%s/repos/%s/%s", c.baseURL, owner, repo))
+}
+
+func (c *Client) status(url string) (int, error) {
+	return c.statusOf(http.MethodGet, url)
+}
+
+// linkNextRe matches URL of the next page in Link header of paginated response
+var linkNextRe = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// do sends request with optional JSON payload and decodes JSON response into out (if it's not nil);
+// response statuses other than 2xx are returned as errors
+func (c *Client) do(method, url string, payload, out interface{}) error {
+	_, err := c.doPage(method, url, payload, out)
+	return err
+}
+
+// doPage is like do, but also returns URL of the next page from Link header, it's empty on the last page
+func (c *Client) doPage(method, url string, payload, out interface{}) (string, error) {
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return "", err
+		}
+	}
+
+	req, err := http.NewRequest(method, url, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("%s %s responded with status %d: %s", method, url, resp.StatusCode, msg)
+	}
+
+	var next string
+	if match := linkNextRe.FindStringSubmatch(resp.Header.Get("Link")); match != nil {
+		next = match[1]
+	}
+	if out == nil {
+		return next, nil
+	}
+	return next, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// PullRequest describes Github pull request (only fields we're interested in)
+type PullRequest struct {
+	Number   int     `json:"number"`
+	State    string  `json:"state"`
+	HTMLURL  string  `json:"html_url"`
+	MergedAt *string `json:"merged_at"`
+	Head     struct {
+		SHA string `json:"sha"`
+	} `json:"head"`
+}
+
+// FindPullRequest returns the most recently updated pull request (open or closed) created from branch,
+// nil is returned if there's no such pull request
+func (c *Client) FindPullRequest(owner, repo, branch string) (*PullRequest, error) {
+	query := url.Values{}
+	query.Set("head", owner+":"+branch)
+	query.Set("state", "all")
+	query.Set("sort", "updated")
+	query.Set("direction", "desc")
+
+	pulls := []PullRequest{}
+	if err := c.do(http.MethodGet, fmt.Sprintf("%s/repos/%s/%s/pulls?%s", c.baseURL, owner, repo, query.Encode()), nil, &pulls); err != nil {
+		return nil, err
+	}
+	if len(pulls) == 0 {
+		return nil, nil
+	}
+	return &pulls[0], nil
+}
+
+// CreateIssueComment adds comment to issue or pull request
+func (c *Client) CreateIssueComment(owner, repo string, number int, body string) error {
+	payload := map[string]string{"body": body}
+	return c.do(http.MethodPost, fmt.Sprintf("%s/repos/%s/%s/issues/%d/comments", c.baseURL, owner, repo, number), payload, nil)
+}
+
+// Release describes Github release (only fields we're interested in)
+type Release struct {
+	TagName string `json:"tag_name"`
+	Name    string `json:"name"`
+	HTMLURL string `json:"html_url"`
+}
+
+// LatestRelease returns the most recent non-prerelease, non-draft release of repository
+func (c *Client) LatestRelease(owner, repo string) (*Release, error) {
+	resp, err := c.httpClient.Get(fmt.Sprintf("%s/repos/%s/%s/releases/latest", c.baseURL, owner, repo))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected status %d for latest release of %s/%s", resp.StatusCode, owner, repo)
+	}
+
+	release := &Release{}
+	if err := json.NewDecoder(resp.Body).Decode(release); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// Deployment describes Github deployment (only fields we're interested in)
+type Deployment struct {
+	ID          int64  `json:"id"`
+	Ref         string `json:"ref"`
+	Environment string `json:"environment"`
+}
+
+// ListDeployments returns deployments created for ref (e.g. branch), all pages are read
+func (c *Client) ListDeployments(owner, repo, ref string) ([]Deployment, error) {
+	query := url.Values{}
+	query.Set("ref", ref)
+	query.Set("per_page", "100")
+
+	deployments := []Deployment{}
+	next := fmt.Sprintf("%s/repos/%s/%s/deployments?%s", c.baseURL, owner, repo, query.Encode())
+	for next != "" {
+		page := []Deployment{}
+		var err error
+		if next, err = c.doPage(http.MethodGet, next, nil, &page); err != nil {
+			return nil, err
+		}
+		deployments = append(deployments, page...)
+	}
+	return deployments, nil
+}
+
+// DeactivateDeployment sets status of deployment to 'inactive'
+func (c *Client) DeactivateDeployment(owner, repo string, id int64) error {
+	payload := map[string]string{"state": "inactive", "description": "Environment is removed"}
+	return c.do(http.MethodPost, fmt.Sprintf("%s/repos/%s/%s/deployments/%d/statuses", c.baseURL, owner, repo, id), payload, nil)
+}
+
+// DeleteDeployment deletes deployment; Github allows deleting only inactive deployments
+func (c *Client) DeleteDeployment(owner, repo string, id int64) error {
+	return c.do(http.MethodDelete, fmt.Sprintf("%s/repos/%s/%s/deployments/%d", c.baseURL, owner, repo, id), nil, nil)
+}
+
+// DeleteEnvironment deletes deployment environment of repository; missing environment isn't an error
+func (c *Client) DeleteEnvironment(owner, repo, name string) error {
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/environments/%s", c.baseURL, owner, repo, url.PathEscape(name))
+	status, err := c.statusOf(http.MethodDelete, apiURL)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusNoContent && status != http.StatusNotFound {
+		return fmt.Errorf("DELETE %s responded with status %d", apiURL, status)
+	}
+	return nil
+}
+
+// statusOf sends request without payload and returns response status
+func (c *Client) statusOf(method, url string) (int, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// Issue describes Github issue (only fields we're interested in)
+type Issue struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	State   string `json:"state"`
+	HTMLURL string `json:"html_url"`
+}
+
+// ListOpenIssues returns open issues of repository having label
+func (c *Client) ListOpenIssues(owner, repo, label string) ([]Issue, error) {
+	query := url.Values{}
+	query.Set("state", "open")
+	query.Set("labels", label)
+	query.Set("per_page", "100")
+
+	issues := []Issue{}
+	err := c.do(http.MethodGet, fmt.Sprintf("%s/repos/%s/%s/issues?%s", c.baseURL, owner, repo, query.Encode()), nil, &issues)
+	return issues, err
+}
+
+// CreateIssue opens new issue with label
+func (c *Client) CreateIssue(owner, repo, title, body, label string) (*Issue, error) {
+	payload := map[string]interface{}{"title": title, "body": body, "labels": []string{label}}
+	issue := &Issue{}
+	err := c.do(http.MethodPost, fmt.Sprintf("%s/repos/%s/%s/issues", c.baseURL, owner, repo), payload, issue)
+	return issue, err
+}
+
+// UpdateIssue changes fields of issue, e.g. {"body": "...", "state": "closed"}
+func (c *Client) UpdateIssue(owner, repo string, number int, fields map[string]string) error {
+	return c.do(http.MethodPatch, fmt.Sprintf("%s/repos/%s/%s/issues/%d", c.baseURL, owner, repo, number), fields, nil)
+}
+
+// CreateCommitStatus sets status of commit for context; state is one of "error", "failure", "pending" or "success"
+func (c *Client) CreateCommitStatus(owner, repo, sha, state, context, description string) error {
+	payload := map[string]string{"state": state, "context": context, "description": description}
+	return c.do(http.MethodPost, fmt.Sprintf("%s/repos/%s/%s/statuses/%s", c.baseURL, owner, repo, sha), payload, nil)
+}
+
+// TokenInfo describes token the client authenticates with
+type TokenInfo struct {
+	// Login of user (or bot) owning the token
+	Login string
+	// Scopes of classic personal access token, nil if Github doesn't report them (e.g. for fine-grained tokens)
+	Scopes []string
+	// RateLimitRemaining is number of requests left in the current rate limit window which ends at RateLimitReset
+	RateLimitRemaining int
+	RateLimitReset     time.Time
+}
+
+// HasScope checks if token has any of scopes; it's always true if scopes aren't reported
+func (t *TokenInfo) HasScope(scopes ...string) bool {
+	if t.Scopes == nil {
+		return true
+	}
+	for _, have := range t.Scopes {
+		for _, want := range scopes {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TokenInfo queries the user owning token, its scopes and rate limit
+func (c *Client) TokenInfo() (*TokenInfo, error) {
+	req, err := http.NewRequest(http.MethodGet, c.baseURL+"/user", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, fmt.Errorf("Github rejected token, it's invalid, expired or revoked: %s", errorMessage(resp))
+	case http.StatusForbidden:
+		return nil, fmt.Errorf("Github forbids access with token (e.g. SSO authorization is missing): %s", errorMessage(resp))
+	default:
+		return nil, fmt.Errorf("GET /user responded with status %d: %s", resp.StatusCode, errorMessage(resp))
+	}
+
+	user := struct {
+		Login string `json:"login"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, err
+	}
+
+	info := &TokenInfo{Login: user.Login}
+	if _, ok := resp.Header["X-Oauth-Scopes"]; ok {
+		info.Scopes = []string{}
+		for _, scope := range strings.Split(resp.Header.Get("X-OAuth-Scopes"), ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				info.Scopes = append(info.Scopes, scope)
+			}
+		}
+	}
+	info.RateLimitRemaining, _ = strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		info.RateLimitReset = time.Unix(reset, 0)
+	}
+	return info, nil
+}
+
+// errorMessage returns message of Github error response, status text if body has no message
+func errorMessage(resp *http.Response) string {
+	body := struct {
+		Message string `json:"message"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Message == "" {
+		return http.StatusText(resp.StatusCode)
+	}
+	return body.Message
+}
@@ -0,0 +1,162 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	vcs "github.com/OpusCapita/buhtig-s8k/pkg/vcs"
+)
+
+func TestParseBranchURL(t *testing.T) {
+	owner, repo, branch, err := ParseBranchURL("https://github.com/OpusCapita/some-repo/tree/feature/issue-34")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != "OpusCapita" || repo != "some-repo" || branch != "feature/issue-34" {
+		t.Errorf("Unexpected parts: %s, %s, %s", owner, repo, branch)
+	}
+
+	if _, _, _, err := ParseBranchURL("https://gitlab.com/group/project"); err == nil {
+		t.Errorf("Expected error for non-Github URL")
+	}
+}
+
+func TestClient_BranchAndRepoStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/owner/repo":
+			w.WriteHeader(http.StatusOK)
+		case "/repos/owner/repo/branches/master":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{httpClient: http.DefaultClient, baseURL: server.URL}
+
+	if status, _ := c.BranchStatus("owner", "repo", "master"); status != 200 {
+		t.Errorf("Expected 200 for existing branch, but got %d", status)
+	}
+	if status, _ := c.BranchStatus("owner", "repo", "gone"); status != 404 {
+		t.Errorf("Expected 404 for deleted branch, but got %d", status)
+	}
+	if status, _ := c.RepoStatus("owner", "repo"); status != 200 {
+		t.Errorf("Expected 200 for existing repo, but got %d", status)
+	}
+	if status, _ := c.RepoStatus("owner", "gone"); status != 404 {
+		t.Errorf("Expected 404 for deleted repo, but got %d", status)
+	}
+}
+
+func TestClient_CheckPR(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/owner/repo/pulls" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.URL.Query().Get("head") {
+		case "owner:merged":
+			fmt.Fprint(w, `[{"number": 2, "state": "closed", "merged_at": "2019-07-01T10:00:00Z", "html_url": "https://github.com/owner/repo/pull/2"}]`)
+		case "owner:open":
+			fmt.Fprint(w, `[{"number": 1, "state": "open", "merged_at": null}]`)
+		default:
+			fmt.Fprint(w, `[]`)
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{httpClient: http.DefaultClient, baseURL: server.URL}
+
+	if pr, err := c.CheckPR("https://github.com/owner/repo/tree/merged"); err != nil || pr == nil || pr.State != vcs.StateMerged || pr.Number != 2 {
+		t.Errorf("Expected merged pull request #2, but got %+v (%v)", pr, err)
+	}
+	if pr, err := c.CheckPR("https://github.com/owner/repo/tree/open"); err != nil || pr == nil || pr.State != vcs.StateOpen {
+		t.Errorf("Expected open pull request, but got %+v (%v)", pr, err)
+	}
+	if pr, err := c.CheckPR("https://github.com/owner/repo/tree/none"); err != nil || pr != nil {
+		t.Errorf("Expected no pull request, but got %+v (%v)", pr, err)
+	}
+}
+
+func TestClient_TokenInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer classic":
+			w.Header().Set("X-OAuth-Scopes", "read:org, public_repo")
+		case "Bearer fine-grained":
+		case "Bearer sso":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"message": "Resource protected by organization SAML enforcement."}`)
+			return
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message": "Bad credentials"}`)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		w.Header().Set("X-RateLimit-Reset", "1562000000")
+		fmt.Fprint(w, `{"login": "bot"}`)
+	}))
+	defer server.Close()
+
+	info, err := NewEnterpriseClient(server.URL, "classic").TokenInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Login != "bot" || info.RateLimitRemaining != 4999 || info.RateLimitReset.Unix() != 1562000000 {
+		t.Errorf("Unexpected token info %+v", info)
+	}
+	if !info.HasScope("repo", "public_repo") || info.HasScope("repo") {
+		t.Errorf("Unexpected scopes %v", info.Scopes)
+	}
+
+	info, err = NewEnterpriseClient(server.URL, "fine-grained").TokenInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.HasScope("repo") {
+		t.Errorf("Token without reported scopes should pass scope check")
+	}
+
+	if _, err := NewEnterpriseClient(server.URL, "invalid").TokenInfo(); err == nil || !strings.Contains(err.Error(), "rejected token") || !strings.Contains(err.Error(), "Bad credentials") {
+		t.Errorf("Expected descriptive error for invalid token, got %v", err)
+	}
+	if _, err := NewEnterpriseClient(server.URL, "sso").TokenInfo(); err == nil || !strings.Contains(err.Error(), "SAML enforcement") {
+		t.Errorf("Expected descriptive error for forbidden token, got %v", err)
+	}
+}
+
+func TestClient_ListDeployments(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/owner/repo/deployments" || r.URL.Query().Get("ref") != "feature" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("page") == "2" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/owner/repo/deployments?ref=feature&page=1>; rel="prev", <%s/repos/owner/repo/deployments?ref=feature&page=1>; rel="first"`, server.URL, server.URL))
+			fmt.Fprint(w, `[{"id": 3, "ref": "feature", "environment": "preview"}]`)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s/repos/owner/repo/deployments?ref=feature&page=2>; rel="next", <%s/repos/owner/repo/deployments?ref=feature&page=2>; rel="last"`, server.URL, server.URL))
+		fmt.Fprint(w, `[{"id": 1, "ref": "feature", "environment": "preview"}, {"id": 2, "ref": "feature", "environment": "qa"}]`)
+	}))
+	defer server.Close()
+
+	c := &Client{httpClient: http.DefaultClient, baseURL: server.URL}
+	deployments, err := c.ListDeployments("owner", "repo", "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployments) != 3 || deployments[2].ID != 3 {
+		t.Errorf("Expected deployments of all pages, got %+v", deployments)
+	}
+	if _, err := c.ListDeployments("owner", "gone", "feature"); err == nil {
+		t.Error("Expected error for missing repository")
+	}
+}
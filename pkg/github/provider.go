@@ -0,0 +1,68 @@
+package github
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	vcs "github.com/OpusCapita/buhtig-s8k/pkg/vcs"
+)
+
+// matches branch URL of any Github instance, e.g. https://ghe.example.com/OWNER/REPO/tree/BRANCH
+var anyHostBranchURLRe = regexp.MustCompile(`^https?://[^/]+/([^/]+)/([^/]+)/tree/(.+)$`)
+
+// parseAnyHostBranchURL is ParseBranchURL which accepts Github Enterprise hosts too
+func parseAnyHostBranchURL(branchURL string) (owner, repo, branch string, err error) {
+	parts := anyHostBranchURLRe.FindStringSubmatch(branchURL)
+	if parts == nil {
+		return "", "", "", fmt.Errorf("branchURL doesn't match regexp: %s", branchURL)
+	}
+	return parts[1], parts[2], parts[3], nil
+}
+
+// Name implements vcs.Provider
+func (c *Client) Name() string {
+	return "github"
+}
+
+// Match implements vcs.Provider; only github.com is auto-detected,
+// Github Enterprise instances are selected by name (see vcs.Registry.RegisterNamed)
+func (c *Client) Match(sourceURL *url.URL) bool {
+	return sourceURL.Host == "github.com"
+}
+
+// CheckBranch implements vcs.Provider
+func (c *Client) CheckBranch(sourceURL string) (int, error) {
+	owner, repo, branch, err := parseAnyHostBranchURL(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return c.BranchStatus(owner, repo, branch)
+}
+
+// CheckRepo implements vcs.Provider
+func (c *Client) CheckRepo(sourceURL string) (int, error) {
+	owner, repo, _, err := parseAnyHostBranchURL(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return c.RepoStatus(owner, repo)
+}
+
+// CheckPR implements vcs.Provider
+func (c *Client) CheckPR(sourceURL string) (*vcs.PullRequest, error) {
+	owner, repo, branch, err := parseAnyHostBranchURL(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+	pr, err := c.FindPullRequest(owner, repo, branch)
+	if err != nil || pr == nil {
+		return nil, err
+	}
+
+	state := pr.State
+	if pr.MergedAt != nil {
+		state = vcs.StateMerged
+	}
+	return &vcs.PullRequest{Number: pr.Number, State: state, URL: pr.HTMLURL}, nil
+}
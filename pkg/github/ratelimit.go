@@ -0,0 +1,113 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimitError is returned instead of sending request while rate limit is exhausted
+type RateLimitError struct {
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("Github rate limit is exhausted until %s", e.Reset.Format(time.RFC3339))
+}
+
+// rateLimitTransport tracks rate limit reported in response headers and short-circuits requests
+// until reset once it's exhausted, so they don't fail with 403 one by one for the rest of the hour
+type rateLimitTransport struct {
+	base http.RoundTripper
+	// requests counts requests sent to Github, short-circuited ones aren't counted
+	requests int64
+
+	mu        sync.Mutex
+	remaining int
+	reset     time.Time
+}
+
+func newRateLimitTransport(base http.RoundTripper) *rateLimitTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &rateLimitTransport{base: base, remaining: -1}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if reset := t.exhaustedUntil(); !reset.IsZero() {
+		return nil, &RateLimitError{Reset: reset}
+	}
+
+	atomic.AddInt64(&t.requests, 1)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	t.update(resp)
+	return resp, nil
+}
+
+// update remembers rate limit reported by response
+func (t *rateLimitTransport) update(resp *http.Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining")); err == nil {
+		t.remaining = remaining
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			t.reset = time.Unix(reset, 0)
+		}
+	}
+	// secondary rate limits are reported with Retry-After header
+	if resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			t.remaining = 0
+			t.reset = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+	}
+}
+
+// exhaustedUntil returns reset time if rate limit is exhausted, zero time otherwise
+func (t *rateLimitTransport) exhaustedUntil() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.remaining != 0 || time.Now().After(t.reset) {
+		return time.Time{}
+	}
+	return t.reset
+}
+
+// RateLimitedUntil implements vcs.RateLimiter: it returns time when exhausted rate limit resets,
+// zero time means requests can be sent
+func (c *Client) RateLimitedUntil() time.Time {
+	if c.rateLimit == nil {
+		return time.Time{}
+	}
+	return c.rateLimit.exhaustedUntil()
+}
+
+// RateLimit returns number of requests left and time when rate limit resets as reported by the latest response,
+// ok is false until any response reports them
+func (c *Client) RateLimit() (remaining int, reset time.Time, ok bool) {
+	if c.rateLimit == nil {
+		return 0, time.Time{}, false
+	}
+	c.rateLimit.mu.Lock()
+	defer c.rateLimit.mu.Unlock()
+	return c.rateLimit.remaining, c.rateLimit.reset, c.rateLimit.remaining >= 0
+}
+
+// Requests returns number of requests sent to Github API by client, requests which weren't sent because rate limit
+// was exhausted aren't counted
+func (c *Client) Requests() int64 {
+	if c.rateLimit == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&c.rateLimit.requests)
+}
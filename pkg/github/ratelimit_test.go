@@ -0,0 +1,48 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClient_RateLimit(t *testing.T) {
+	requests := 0
+	reset := time.Now().Add(time.Hour).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	c := NewEnterpriseClient(server.URL, "")
+	if !c.RateLimitedUntil().IsZero() {
+		t.Errorf("Rate limit shouldn't be exhausted before any request")
+	}
+	if _, _, ok := c.RateLimit(); ok {
+		t.Errorf("Rate limit shouldn't be known before any request")
+	}
+
+	if status, err := c.BranchStatus("owner", "repo", "master"); err != nil || status != 200 {
+		t.Fatalf("Expected the first request to succeed, but got %d (%v)", status, err)
+	}
+	if until := c.RateLimitedUntil(); until.Unix() != reset {
+		t.Errorf("Expected rate limit to be exhausted until %d, but got %v", reset, until)
+	}
+	if remaining, until, ok := c.RateLimit(); !ok || remaining != 0 || until.Unix() != reset {
+		t.Errorf("Expected rate limit to be reported, but got %d until %v (%v)", remaining, until, ok)
+	}
+
+	_, err := c.BranchStatus("owner", "repo", "master")
+	if err == nil || requests != 1 {
+		t.Errorf("Expected request to be short-circuited, but it was sent (%d requests, %v)", requests, err)
+	}
+	if c.Requests() != 1 {
+		t.Errorf("Expected only sent requests to be counted, got %d", c.Requests())
+	}
+}
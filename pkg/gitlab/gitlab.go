@@ -0,0 +1,67 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// matches https://gitlab.com/GROUP[/SUBGROUP...]/PROJECT/-/tree/BRANCH, including self-hosted instances
+var branchURLRe = regexp.MustCompile(`^(https?://[^/]+)/(.+?)/-/tree/(.+)$`)
+
+// IsBranchURL checks if URL looks like GitLab branch URL
+func IsBranchURL(branchURL string) bool {
+	return branchURLRe.MatchString(branchURL)
+}
+
+// ParseBranchURL expects URL like https://gitlab.com/GROUP/PROJECT/-/tree/BRANCH and returns
+// base URL of GitLab instance, full path of project and branch
+func ParseBranchURL(branchURL string) (baseURL, project, branch string, err error) {
+	parts := branchURLRe.FindStringSubmatch(branchURL)
+	if parts == nil {
+		return "", "", "", fmt.Errorf("branchURL doesn't match regexp: %s", branchURL)
+	}
+	return parts[1], parts[2], parts[3], nil
+}
+
+// Client is a thin wrapper around GitLab REST API v4
+type Client struct {
+	httpClient *http.Client
+	token      string
+}
+
+// NewClient returns GitLab client which authenticates requests with provided personal/project access token
+func NewClient(token string) *Client {
+	return &Client{httpClient: &http.Client{Timeout: 30 * time.Second}, token: token}
+}
+
+// BranchStatus queries branch and returns status code of HTTP response (404 means branch doesn't exist)
+func (c *Client) BranchStatus(baseURL, project, branch string) (int, error) {
+	return c.status(fmt.Sprintf("%s/api/v4/projects/%s/repository/branches/%s", baseURL, url.PathEscape(project), url.PathEscape(branch)))
+}
+
+// ProjectStatus queries project and returns status code of HTTP response;
+// GitLab responds with 404 both for deleted project and for private project token has no access to
+func (c *Client) ProjectStatus(baseURL, project string) (int, error) {
+	return c.status(fmt.Sprintf("%s/api/v4/projects/%s", baseURL, url.PathEscape(project)))
+}
+
+func (c *Client) status(apiURL string) (int, error) {
+	req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	if c.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,45 @@
+package gitlab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseBranchURL(t *testing.T) {
+	baseURL, project, branch, err := ParseBranchURL("https://gitlab.example.com/group/subgroup/project/-/tree/feature/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if baseURL != "https://gitlab.example.com" || project != "group/subgroup/project" || branch != "feature/x" {
+		t.Errorf("Unexpected parts: %s, %s, %s", baseURL, project, branch)
+	}
+
+	if IsBranchURL("https://github.com/owner/repo/tree/branch") {
+		t.Errorf("Github URL shouldn't be recognized as GitLab one")
+	}
+}
+
+func TestClient_BranchStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// project path and branch are URL-encoded as single path segments
+		if r.URL.RawPath == "/api/v4/projects/group%2Fproject/repository/branches/feature%2Fx" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c := NewClient("token")
+	if status, _ := c.BranchStatus(server.URL, "group/project", "feature/x"); status != 200 {
+		t.Errorf("Expected 200 for existing branch, but got %d", status)
+	}
+	if status, _ := c.BranchStatus(server.URL, "group/project", "gone"); status != 404 {
+		t.Errorf("Expected 404 for deleted branch, but got %d", status)
+	}
+}
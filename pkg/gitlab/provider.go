@@ -0,0 +1,90 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	vcs "github.com/OpusCapita/buhtig-s8k/pkg/vcs"
+)
+
+// Name implements vcs.Provider
+func (c *Client) Name() string {
+	return "gitlab"
+}
+
+// Match implements vcs.Provider; any host is matched as long as URL has GitLab-specific '/-/tree/' path
+func (c *Client) Match(sourceURL *url.URL) bool {
+	return IsBranchURL(sourceURL.String())
+}
+
+// CheckBranch implements vcs.Provider
+func (c *Client) CheckBranch(sourceURL string) (int, error) {
+	baseURL, project, branch, err := ParseBranchURL(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return c.BranchStatus(baseURL, project, branch)
+}
+
+// CheckRepo implements vcs.Provider
+func (c *Client) CheckRepo(sourceURL string) (int, error) {
+	baseURL, project, _, err := ParseBranchURL(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	return c.ProjectStatus(baseURL, project)
+}
+
+// CheckPR implements vcs.Provider by looking up merge requests of branch
+func (c *Client) CheckPR(sourceURL string) (*vcs.PullRequest, error) {
+	baseURL, project, branch, err := ParseBranchURL(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("source_branch", branch)
+	query.Set("state", "all")
+	query.Set("order_by", "updated_at")
+
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/v4/projects/%s/merge_requests?%s", baseURL, url.PathEscape(project), query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s responded with status %d", req.URL, resp.StatusCode)
+	}
+
+	mergeRequests := []struct {
+		IID    int    `json:"iid"`
+		State  string `json:"state"`
+		WebURL string `json:"web_url"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&mergeRequests); err != nil {
+		return nil, err
+	}
+	if len(mergeRequests) == 0 {
+		return nil, nil
+	}
+
+	mr := mergeRequests[0]
+	// GitLab states are 'opened', 'closed', 'locked' and 'merged'
+	state := vcs.StateClosed
+	switch mr.State {
+	case "opened", "locked":
+		state = vcs.StateOpen
+	case "merged":
+		state = vcs.StateMerged
+	}
+	return &vcs.PullRequest{Number: mr.IID, State: state, URL: mr.WebURL}, nil
+}
@@ -1,74 +1,228 @@
 package helm
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"k8s.io/helm/pkg/helm"
-	"k8s.io/helm/pkg/helm/environment"
 	"k8s.io/helm/pkg/helm/portforwarder"
 	"k8s.io/helm/pkg/kube"
 	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/tlsutil"
 
 	log "github.com/sirupsen/logrus"
 
+	helm3 "github.com/OpusCapita/buhtig-s8k/pkg/helm3"
+
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-
-	"k8s.io/client-go/util/homedir"
-	"k8s.io/helm/pkg/helm/helmpath"
 )
 
 const (
 	tillerNamespaceEnv = "TILLER_NAMESPACE"
+
+	// tillerConnectionTimeout is in seconds
+	tillerConnectionTimeout = 60
 )
 
-// DeleteRelease deletes provided Helm release
-// we need to port-forward to get access to Tiller server. Port-forwarding logic is taken from helm lib.
-func DeleteRelease(name string, client kubernetes.Interface, config *rest.Config) error {
-	logger := log.WithFields(log.Fields{"helm-release": name, "func": "helm.DeleteRelease"})
+// Tiller holds port-forward tunnel to Tiller server shared by all operations (port-forwarding logic is taken from helm lib).
+// Tunnel is opened on first use, checked before every operation and reopened if Tiller doesn't respond.
+// It's safe for concurrent use.
+type Tiller struct {
+	client    kubernetes.Interface
+	config    *rest.Config
+	namespace string
+	tls       *tls.Config
 
-	var (
-		tillerTunnel *kube.Tunnel
-		settings     environment.EnvSettings
-	)
+	mu     sync.Mutex
+	tunnel *kube.Tunnel
+	host   string
+}
+
+// tunnelFailures counts failed attempts to open tunnel to Tiller by all Tiller connections
+var tunnelFailures int64
+
+// TunnelFailures returns number of failed attempts to open tunnel to Tiller (including tunnels which were opened
+// but Tiller didn't respond through them) since the app is started
+func TunnelFailures() int64 {
+	return atomic.LoadInt64(&tunnelFailures)
+}
+
+// TLSOptions configure TLS connection to Tiller, files are usually mounted from secret
+type TLSOptions struct {
+	// Enable TLS, it's implied by Verify
+	Enable bool
+	// Verify certificate of Tiller against CACertFile
+	Verify bool
+	// CertFile and KeyFile are client certificate and its key
+	CertFile string
+	KeyFile  string
+	// CACertFile is certificate of CA which signed certificate of Tiller
+	CACertFile string
+	// ServerName is expected in certificate of Tiller
+	ServerName string
+}
+
+// TLSConfig returns TLS config for connection to Tiller, it's nil if TLS isn't enabled
+func TLSConfig(opts TLSOptions) (*tls.Config, error) {
+	if !opts.Enable && !opts.Verify {
+		return nil, nil
+	}
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("client certificate and key are required for TLS connection to Tiller")
+	}
+	if opts.Verify && opts.CACertFile == "" {
+		return nil, errors.New("CA certificate is required to verify Tiller")
+	}
+	return tlsutil.ClientConfig(tlsutil.Options{
+		CertFile:           opts.CertFile,
+		KeyFile:            opts.KeyFile,
+		CaCertFile:         opts.CACertFile,
+		InsecureSkipVerify: !opts.Verify,
+		ServerName:         opts.ServerName,
+	})
+}
 
+// NewTiller returns Tiller connection, Tiller namespace is taken from TILLER_NAMESPACE env variable ("kube-system" by default).
+// Connection is plain gRPC if tlsConfig is nil.
+func NewTiller(client kubernetes.Interface, config *rest.Config, tlsConfig *tls.Config) *Tiller {
+	return &Tiller{client: client, config: config, namespace: tillerNamespace(), tls: tlsConfig}
+}
+
+// tillerNamespace returns namespace of Tiller and its storage
+func tillerNamespace() string {
 	if tns, ok := os.LookupEnv(tillerNamespaceEnv); ok {
-		settings.TillerNamespace = tns
-	} else {
-		settings.TillerNamespace = "kube-system"
+		return tns
 	}
+	return "kube-system"
+}
+
+// helmClient returns Helm client connected to Tiller through healthy tunnel
+func (t *Tiller) helmClient() (*helm.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
-	settings.Home = helmpath.Home(homedir.HomeDir() + "/.helm")
-	settings.TillerConnectionTimeout = 60
+	logger := log.WithFields(log.Fields{"func": "helm.Tiller"})
 
-	if settings.TillerHost == "" {
-		tillerTunnel, err := portforwarder.New(settings.TillerNamespace, client, config)
-		if err != nil {
-			return err
+	if t.tunnel != nil {
+		helmClient := t.newHelmClient()
+		if err := helmClient.PingTiller(); err == nil {
+			return helmClient, nil
 		}
+		logger.Warn("Tiller doesn't respond, reopening tunnel")
+		t.closeTunnel()
+	}
+
+	tunnel, err := portforwarder.New(t.namespace, t.client, t.config)
+	if err != nil {
+		atomic.AddInt64(&tunnelFailures, 1)
+		return nil, err
+	}
+	t.tunnel = tunnel
+	t.host = fmt.Sprintf("127.0.0.1:%d", tunnel.Local)
+	logger.Debug(fmt.Sprintf("Created tunnel using local port: '%d'", tunnel.Local))
+
+	// fail quickly if tiller doesn't respond (maybe will provide more useful errors in this case)
+	helmClient := t.newHelmClient()
+	if err := helmClient.PingTiller(); err != nil {
+		atomic.AddInt64(&tunnelFailures, 1)
+		t.closeTunnel()
+		return nil, err
+	}
+	return helmClient, nil
+}
+
+func (t *Tiller) newHelmClient() *helm.Client {
+	options := []helm.Option{helm.Host(t.host), helm.ConnectTimeout(tillerConnectionTimeout)}
+	if t.tls != nil {
+		options = append(options, helm.WithTLS(t.tls))
+	}
+	return helm.NewClient(options...)
+}
+
+func (t *Tiller) closeTunnel() {
+	if t.tunnel != nil {
+		log.Debug("Closing tunnel to Tiller")
+		t.tunnel.Close()
+		t.tunnel = nil
+	}
+}
 
-		settings.TillerHost = fmt.Sprintf("127.0.0.1:%d", tillerTunnel.Local)
-		logger.Debug(fmt.Sprintf("Created tunnel using local port: '%d'\n", tillerTunnel.Local))
+// Ping checks that Tiller responds, tunnel is opened if needed
+func (t *Tiller) Ping() error {
+	if _, err := t.helmClient(); err != nil {
+		return fmt.Errorf("Tiller in namespace %s doesn't respond: %v", t.namespace, err)
 	}
+	return nil
+}
 
-	// Set up the gRPC config.
-	logger.Debug(fmt.Sprintf("SERVER: %q\n", settings.TillerHost))
+// Close closes tunnel to Tiller; Tiller can still be used after that, new tunnel is opened then
+func (t *Tiller) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closeTunnel()
+}
 
-	defer func() {
-		if tillerTunnel != nil {
-			logger.Debug("Closing tunnel to Tiller")
-			tillerTunnel.Close()
+// ReleaseManifest returns manifest of release together with manifests of its hooks, it's empty if release doesn't exist
+func (t *Tiller) ReleaseManifest(name string) (string, error) {
+	helmClient, err := t.helmClient()
+	if err != nil {
+		return "", err
+	}
+	resp, err := helmClient.ReleaseContent(name)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return "", nil
 		}
-	}()
+		return "", err
+	}
+	rel := resp.GetRelease()
+	manifest := rel.GetManifest()
+	for _, hook := range rel.GetHooks() {
+		manifest += "\n---\n" + hook.GetManifest()
+	}
+	return manifest, nil
+}
 
-	options := []helm.Option{helm.Host(settings.TillerHost), helm.ConnectTimeout(settings.TillerConnectionTimeout)}
+// ReleaseSnapshot returns values and manifest of release, it's nil if release doesn't exist
+func (t *Tiller) ReleaseSnapshot(name string) (*helm3.Snapshot, error) {
+	helmClient, err := t.helmClient()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := helmClient.ReleaseContent(name)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return snapshot(resp.GetRelease()), nil
+}
 
-	// create Helm client finally
-	helmClient := helm.NewClient(options...)
+// DeleteOptions control how release is deleted
+type DeleteOptions struct {
+	// DisableHooks prevents hooks from running (--no-hooks)
+	DisableHooks bool
+	// KeepHistory keeps release record in Tiller instead of purging it
+	KeepHistory bool
+	// Timeout of hooks, Tiller's default is used if it's 0
+	Timeout time.Duration
+}
 
-	// fail quickly if tiller doesn't respond (maybe will provide more useful errors in this case)
-	if err := helmClient.PingTiller(); err != nil {
+// DeleteRelease deletes provided Helm release; if namespace isn't empty then release
+// is deleted only if it's installed into that namespace
+func (t *Tiller) DeleteRelease(name, namespace string, opts DeleteOptions) error {
+	logger := log.WithFields(log.Fields{"helm-release": name, "func": "helm.DeleteRelease"})
+
+	helmClient, err := t.helmClient()
+	if err != nil {
 		return err
 	}
 
@@ -78,6 +232,9 @@ func DeleteRelease(name string, client kubernetes.Interface, config *rest.Config
 		logger.Error(err)
 		return nil
 	}
+	if namespace != "" && rs.GetNamespace() != namespace {
+		return fmt.Errorf("Release %s is installed into namespace %s, not %s", name, rs.GetNamespace(), namespace)
+	}
 	statusCode := rs.GetInfo().GetStatus().GetCode()
 	logger.Debug(fmt.Sprintf("Release status: %d", statusCode))
 	if statusCode == release.Status_DELETED || statusCode == release.Status_DELETING {
@@ -85,8 +242,13 @@ func DeleteRelease(name string, client kubernetes.Interface, config *rest.Config
 		return nil
 	}
 
-	logger.Info("Deleting Helm release")
-	resp, err := helmClient.DeleteRelease(name, helm.DeletePurge(true))
+	deleteOptions := []helm.DeleteOption{helm.DeletePurge(!opts.KeepHistory), helm.DeleteDisableHooks(opts.DisableHooks)}
+	if opts.Timeout > 0 {
+		deleteOptions = append(deleteOptions, helm.DeleteTimeout(int64(opts.Timeout.Seconds())))
+	}
+
+	logger.Info(fmt.Sprintf("Deleting Helm release (%+v)", opts))
+	resp, err := helmClient.DeleteRelease(name, deleteOptions...)
 	if err != nil {
 		logger.Error(err)
 		return err
@@ -0,0 +1,157 @@
+package helm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	release3 "helm.sh/helm/v3/pkg/release"
+	"k8s.io/helm/pkg/proto/hapi/release"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestTLSConfig(t *testing.T) {
+	cfg, err := TLSConfig(TLSOptions{CertFile: "tls.crt", KeyFile: "tls.key"})
+	if cfg != nil || err != nil {
+		t.Errorf("Expected no TLS config when TLS isn't enabled, but got %v (%v)", cfg, err)
+	}
+
+	if _, err := TLSConfig(TLSOptions{Enable: true}); err == nil {
+		t.Error("Expected error when client certificate is missing")
+	}
+
+	if _, err := TLSConfig(TLSOptions{Verify: true, CertFile: "tls.crt", KeyFile: "tls.key"}); err == nil {
+		t.Error("Expected error when CA certificate is missing")
+	}
+
+	if _, err := TLSConfig(TLSOptions{Enable: true, CertFile: "missing.crt", KeyFile: "missing.key"}); err == nil {
+		t.Error("Expected error when client certificate can't be read")
+	}
+}
+
+func TestTillerless_DeleteRelease_Purge(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	tillerless, err := NewTillerless(client, nil, StorageConfigMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []int32{1, 2} {
+		rel := &release.Release{
+			Name:      "app",
+			Namespace: "preview",
+			Version:   version,
+			Info:      &release.Info{Status: &release.Status{Code: release.Status_DELETED}},
+		}
+		if err := tillerless.storage.Create(releaseKey(rel), rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tillerless.DeleteRelease("app", "other", DeleteOptions{}); err == nil {
+		t.Error("Expected error for release installed into another namespace")
+	}
+
+	// resources of deleted release are already gone, so only history is purged
+	if err := tillerless.DeleteRelease("app", "preview", DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	cms, _ := client.CoreV1().ConfigMaps("kube-system").List(metav1.ListOptions{})
+	if len(cms.Items) != 0 {
+		t.Errorf("Expected release history to be purged, but got %d records", len(cms.Items))
+	}
+
+	if err := tillerless.DeleteRelease("app", "preview", DeleteOptions{}); err != nil {
+		t.Errorf("Expected no error for missing release, but got %v", err)
+	}
+}
+
+func TestConvertRelease(t *testing.T) {
+	rel := convertRelease(&release.Release{
+		Name:      "app",
+		Namespace: "preview",
+		Version:   3,
+		Manifest:  "kind: ConfigMap",
+		Hooks: []*release.Hook{{
+			Name:           "cleanup",
+			Kind:           "Job",
+			Events:         []release.Hook_Event{release.Hook_PRE_DELETE},
+			Weight:         5,
+			DeletePolicies: []release.Hook_DeletePolicy{release.Hook_SUCCEEDED},
+		}},
+	})
+
+	if rel.Name != "app" || rel.Namespace != "preview" || rel.Version != 3 || rel.Manifest != "kind: ConfigMap" {
+		t.Errorf("Unexpected release %+v", rel)
+	}
+	if len(rel.Hooks) != 1 || rel.Hooks[0].Events[0] != release3.HookPreDelete || rel.Hooks[0].DeletePolicies[0] != release3.HookSucceeded || rel.Hooks[0].Weight != 5 {
+		t.Errorf("Unexpected hooks %+v", rel.Hooks)
+	}
+}
+
+func TestPurgeOrphanedReleases(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "alive"}})
+	storage, err := newStorage(client, StorageConfigMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releases := []*release.Release{
+		{Name: "orphan", Namespace: "gone", Version: 1},
+		{Name: "orphan", Namespace: "gone", Version: 2},
+		{Name: "app", Namespace: "alive", Version: 1},
+	}
+	for _, rel := range releases {
+		rel.Info = &release.Info{Status: &release.Status{Code: release.Status_DEPLOYED}}
+		if err := storage.Create(releaseKey(rel), rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purged, err := PurgeOrphanedReleases(client, StorageConfigMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 1 || purged[0] != "orphan" {
+		t.Errorf("Expected only orphaned release to be purged, but got %v", purged)
+	}
+	cms, _ := client.CoreV1().ConfigMaps("kube-system").List(metav1.ListOptions{})
+	if len(cms.Items) != 1 || cms.Items[0].Name != "app.v1" {
+		t.Errorf("Expected only record of release in existing namespace to be kept, but got %v", cms.Items)
+	}
+}
+
+func TestTiller_TunnelFailures(t *testing.T) {
+	before := TunnelFailures()
+	tiller := NewTiller(fake.NewSimpleClientset(), nil, nil)
+	if _, err := tiller.ReleaseManifest("app"); err == nil {
+		t.Fatal("Expected error without Tiller pod")
+	}
+	if failures := TunnelFailures() - before; failures != 1 {
+		t.Errorf("Expected failed tunnel to be counted, got %d", failures)
+	}
+}
+
+func TestPing(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	tillerless, err := NewTillerless(client, nil, StorageSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tillerless.Ping(); err != nil {
+		t.Errorf("Expected readable storage, got %v", err)
+	}
+	client.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+	if err := tillerless.Ping(); err == nil || !strings.Contains(err.Error(), "secrets in namespace kube-system") {
+		t.Errorf("Expected descriptive error, got %v", err)
+	}
+
+	if err := NewTiller(fake.NewSimpleClientset(), nil, nil).Ping(); err == nil || !strings.Contains(err.Error(), "Tiller in namespace kube-system doesn't respond") {
+		t.Errorf("Expected descriptive error, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package helm
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/helm/pkg/proto/hapi/release"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PurgeOrphanedReleases purges records of Helm 2 releases whose namespace doesn't exist anymore (e.g. it was deleted
+// manually without deleting release), names of purged releases are returned. Tiller isn't needed for that.
+func PurgeOrphanedReleases(client kubernetes.Interface, storage string) ([]string, error) {
+	logger := log.WithFields(log.Fields{"func": "helm.PurgeOrphanedReleases"})
+
+	d, err := newStorage(client, storage)
+	if err != nil {
+		return nil, err
+	}
+	records, err := d.List(func(*release.Release) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+
+	// release is moved between namespaces only by reinstalling it, but the latest revision is checked to be sure
+	latest := map[string]*release.Release{}
+	for _, rel := range records {
+		if l, ok := latest[rel.Name]; !ok || rel.Version > l.Version {
+			latest[rel.Name] = rel
+		}
+	}
+
+	missingNamespaces := map[string]bool{}
+	for _, rel := range latest {
+		if _, checked := missingNamespaces[rel.Namespace]; checked || rel.Namespace == "" {
+			continue
+		}
+		_, err := client.CoreV1().Namespaces().Get(rel.Namespace, metav1.GetOptions{})
+		switch {
+		case errors.IsNotFound(err):
+			missingNamespaces[rel.Namespace] = true
+		case err != nil:
+			return nil, err
+		default:
+			missingNamespaces[rel.Namespace] = false
+		}
+	}
+
+	purged := []string{}
+	for _, rel := range records {
+		if !missingNamespaces[latest[rel.Name].Namespace] {
+			continue
+		}
+		if _, err := d.Delete(releaseKey(rel)); err != nil && !isReleaseNotFound(err, rel.Name) {
+			return purged, err
+		}
+		logger.Debug(fmt.Sprintf("Purged record %s of release installed into missing namespace %s", releaseKey(rel), rel.Namespace))
+		if rel == latest[rel.Name] {
+			purged = append(purged, rel.Name)
+		}
+	}
+	return purged, nil
+}
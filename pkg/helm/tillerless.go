@@ -0,0 +1,222 @@
+package helm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OpusCapita/buhtig-s8k/pkg/helm3"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	log "github.com/sirupsen/logrus"
+	release3 "helm.sh/helm/v3/pkg/release"
+	"k8s.io/helm/pkg/proto/hapi/release"
+	"k8s.io/helm/pkg/storage/driver"
+	storageerrors "k8s.io/helm/pkg/storage/errors"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// storages of Tiller releases ('--storage' flag of Tiller)
+const (
+	StorageConfigMap = "configmap"
+	StorageSecret    = "secret"
+)
+
+// Releases deletes Helm 2 releases either through Tiller or without it
+type Releases interface {
+	DeleteRelease(name, namespace string, opts DeleteOptions) error
+	// ReleaseManifest returns manifest of release together with manifests of its hooks, it's empty if release doesn't exist
+	ReleaseManifest(name string) (string, error)
+	// ReleaseSnapshot returns values and manifest of release, it's nil if release doesn't exist
+	ReleaseSnapshot(name string) (*helm3.Snapshot, error)
+	// Ping checks that releases can be read, i.e. that Tiller responds or its storage is readable
+	Ping() error
+	Close()
+}
+
+// Tillerless deletes Helm 2 releases without Tiller: release is read directly from Tiller's storage
+// in TILLER_NAMESPACE, its resources are deleted the way Helm 3 does it and then release record is purged
+// (or marked as deleted if history is kept). It's safe for concurrent use.
+type Tillerless struct {
+	storage     driver.Driver
+	uninstaller *helm3.Client
+	// client and storageKind are used to check access to storage without reading releases
+	client      kubernetes.Interface
+	storageKind string
+}
+
+// NewTillerless returns Tillerless; storage is one of Storage* constants
+func NewTillerless(client kubernetes.Interface, uninstaller *helm3.Client, storage string) (*Tillerless, error) {
+	d, err := newStorage(client, storage)
+	if err != nil {
+		return nil, err
+	}
+	return &Tillerless{storage: d, uninstaller: uninstaller, client: client, storageKind: storage}, nil
+}
+
+// newStorage returns driver of Tiller's storage in TILLER_NAMESPACE
+func newStorage(client kubernetes.Interface, storage string) (driver.Driver, error) {
+	namespace := tillerNamespace()
+	switch storage {
+	case StorageConfigMap:
+		return driver.NewConfigMaps(client.CoreV1().ConfigMaps(namespace)), nil
+	case StorageSecret:
+		return driver.NewSecrets(client.CoreV1().Secrets(namespace)), nil
+	}
+	return nil, fmt.Errorf("unknown Tiller storage '%s'", storage)
+}
+
+// DeleteRelease deletes provided Helm release; if namespace isn't empty then release
+// is deleted only if it's installed into that namespace
+func (t *Tillerless) DeleteRelease(name, namespace string, opts DeleteOptions) error {
+	logger := log.WithFields(log.Fields{"helm-release": name, "func": "helm.Tillerless.DeleteRelease"})
+
+	history, err := t.history(name)
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 {
+		logger.Debug("Release doesn't exist, nothing to delete")
+		return nil
+	}
+	rel := history[0]
+
+	if namespace != "" && rel.GetNamespace() != namespace {
+		return fmt.Errorf("Release %s is installed into namespace %s, not %s", name, rel.GetNamespace(), namespace)
+	}
+
+	statusCode := rel.GetInfo().GetStatus().GetCode()
+	if statusCode != release.Status_DELETED {
+		logger.Info(fmt.Sprintf("Deleting Helm release without Tiller (%+v)", opts))
+		err := t.uninstaller.UninstallResources(convertRelease(rel), helm3.UninstallOptions{DisableHooks: opts.DisableHooks, Timeout: opts.Timeout})
+		if err != nil {
+			return err
+		}
+	} else if opts.KeepHistory {
+		logger.Debug("Release is already deleted")
+		return nil
+	}
+
+	if opts.KeepHistory {
+		now := time.Now()
+		rel.Info.Status.Code = release.Status_DELETED
+		rel.Info.Description = "Deletion complete"
+		rel.Info.Deleted = &timestamp.Timestamp{Seconds: now.Unix(), Nanos: int32(now.Nanosecond())}
+		return t.storage.Update(releaseKey(rel), rel)
+	}
+
+	for _, r := range history {
+		if _, err := t.storage.Delete(releaseKey(r)); err != nil && !isReleaseNotFound(err, r.Name) {
+			return err
+		}
+	}
+	logger.Info("Release is purged")
+	return nil
+}
+
+// ReleaseManifest returns manifest of the latest revision of release together with manifests of its hooks
+func (t *Tillerless) ReleaseManifest(name string) (string, error) {
+	history, err := t.history(name)
+	if err != nil || len(history) == 0 {
+		return "", err
+	}
+	return helm3.FullManifest(convertRelease(history[0])), nil
+}
+
+// ReleaseSnapshot returns snapshot of the latest revision of release
+func (t *Tillerless) ReleaseSnapshot(name string) (*helm3.Snapshot, error) {
+	history, err := t.history(name)
+	if err != nil || len(history) == 0 {
+		return nil, err
+	}
+	return snapshot(history[0]), nil
+}
+
+// history returns revisions of release from the latest to the oldest one
+func (t *Tillerless) history(name string) ([]*release.Release, error) {
+	history, err := t.storage.Query(map[string]string{"NAME": name, "OWNER": "TILLER"})
+	if isReleaseNotFound(err, name) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].Version > history[j].Version })
+	return history, nil
+}
+
+// Ping checks that Tiller's storage can be listed
+func (t *Tillerless) Ping() error {
+	namespace := tillerNamespace()
+	opts := metav1.ListOptions{LabelSelector: "OWNER=TILLER", Limit: 1}
+	var err error
+	if t.storageKind == StorageSecret {
+		_, err = t.client.CoreV1().Secrets(namespace).List(opts)
+	} else {
+		_, err = t.client.CoreV1().ConfigMaps(namespace).List(opts)
+	}
+	if err != nil {
+		return fmt.Errorf("Tiller storage (%ss in namespace %s) can't be read: %v", t.storageKind, namespace, err)
+	}
+	return nil
+}
+
+// Close does nothing, there's no connection to close
+func (t *Tillerless) Close() {}
+
+// isReleaseNotFound checks if err is returned by storage for missing release, storage errors are created on every call
+// and thus can only be compared by message
+func isReleaseNotFound(err error, name string) bool {
+	return err != nil && err.Error() == storageerrors.ErrReleaseNotFound(name).Error()
+}
+
+// releaseKey is the name of storage record, the same as Tiller uses
+func releaseKey(rel *release.Release) string {
+	return fmt.Sprintf("%s.v%d", rel.Name, rel.Version)
+}
+
+// snapshot converts Helm 2 release to version-agnostic snapshot
+func snapshot(rel *release.Release) *helm3.Snapshot {
+	metadata := rel.GetChart().GetMetadata()
+	return &helm3.Snapshot{
+		Name:         rel.GetName(),
+		Namespace:    rel.GetNamespace(),
+		Revision:     int(rel.GetVersion()),
+		Chart:        metadata.GetName(),
+		ChartVersion: metadata.GetVersion(),
+		AppVersion:   metadata.GetAppVersion(),
+		Values:       rel.GetConfig().GetRaw(),
+		Manifest:     helm3.FullManifest(convertRelease(rel)),
+	}
+}
+
+// convertRelease converts Helm 2 release to Helm 3 one, so that it can be uninstalled by Helm 3 client
+func convertRelease(rel *release.Release) *release3.Release {
+	converted := &release3.Release{
+		Name:      rel.Name,
+		Namespace: rel.Namespace,
+		Version:   int(rel.Version),
+		Manifest:  rel.Manifest,
+	}
+	for _, hook := range rel.Hooks {
+		h := &release3.Hook{Name: hook.Name, Kind: hook.Kind, Path: hook.Path, Manifest: hook.Manifest, Weight: int(hook.Weight)}
+		for _, event := range hook.Events {
+			// e.g. PRE_DELETE -> pre-delete
+			h.Events = append(h.Events, release3.HookEvent(strings.ToLower(strings.Replace(event.String(), "_", "-", -1))))
+		}
+		for _, policy := range hook.DeletePolicies {
+			switch policy {
+			case release.Hook_SUCCEEDED:
+				h.DeletePolicies = append(h.DeletePolicies, release3.HookSucceeded)
+			case release.Hook_FAILED:
+				h.DeletePolicies = append(h.DeletePolicies, release3.HookFailed)
+			case release.Hook_BEFORE_HOOK_CREATION:
+				h.DeletePolicies = append(h.DeletePolicies, release3.HookBeforeHookCreation)
+			}
+		}
+		converted.Hooks = append(converted.Hooks, h)
+	}
+	return converted
+}
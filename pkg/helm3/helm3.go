@@ -0,0 +1,261 @@
+package helm3
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/yaml"
+)
+
+// resources annotated with 'helm.sh/resource-policy: keep' survive uninstall
+const (
+	resourcePolicyAnnotation = "helm.sh/resource-policy"
+	resourcePolicyKeep       = "keep"
+)
+
+// defaultHookTimeout is how long hooks are waited for if UninstallOptions don't set timeout
+const defaultHookTimeout = 5 * time.Minute
+
+// Client uninstalls Helm 3 releases stored in secrets (default storage driver of Helm 3) with Helm's own
+// uninstall action, so that resources are deleted in the same order and hooks are run the same way as
+// 'helm uninstall' does it
+type Client struct {
+	k8sClient     kubernetes.Interface
+	dynamicClient dynamic.Interface
+	mapper        meta.RESTMapper
+	config        *rest.Config
+	discovery     discovery.CachedDiscoveryInterface
+	// kubeClient returns Helm's client operating on resources of release in namespace
+	kubeClient func(namespace string) kube.Interface
+	// capabilities of cluster are discovered by Helm if they're nil
+	capabilities *chartutil.Capabilities
+}
+
+// NewClient returns Helm 3 client
+func NewClient(k8sClient kubernetes.Interface, config *rest.Config) (*Client, error) {
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	cached := memory.NewMemCacheClient(k8sClient.Discovery())
+	c := &Client{
+		k8sClient:     k8sClient,
+		dynamicClient: dynamicClient,
+		mapper:        restmapper.NewDeferredDiscoveryRESTMapper(cached),
+		config:        config,
+		discovery:     cached,
+	}
+	c.kubeClient = func(namespace string) kube.Interface {
+		kubeClient := kube.New(c.getter(namespace))
+		kubeClient.Log = log.WithField("helm-namespace", namespace).Debugf
+		return kubeClient
+	}
+	return c, nil
+}
+
+// restClientGetter provides Helm with clients of the cluster we're connected to, namespace is
+// the default one of release resources
+type restClientGetter struct {
+	config    *rest.Config
+	discovery discovery.CachedDiscoveryInterface
+	mapper    meta.RESTMapper
+	namespace string
+}
+
+func (c *Client) getter(namespace string) *restClientGetter {
+	return &restClientGetter{config: c.config, discovery: c.discovery, mapper: c.mapper, namespace: namespace}
+}
+
+func (g *restClientGetter) ToRESTConfig() (*rest.Config, error) {
+	return g.config, nil
+}
+
+func (g *restClientGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	return g.discovery, nil
+}
+
+func (g *restClientGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	return g.mapper, nil
+}
+
+func (g *restClientGetter) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	overrides := &clientcmd.ConfigOverrides{Context: clientcmdapi.Context{Namespace: g.namespace}}
+	return clientcmd.NewDefaultClientConfig(*clientcmdapi.NewConfig(), overrides)
+}
+
+// storage returns storage of releases in namespace
+func (c *Client) storage(namespace string) *storage.Storage {
+	return storage.Init(driver.NewSecrets(c.k8sClient.CoreV1().Secrets(namespace)))
+}
+
+// configuration returns configuration of Helm actions on releases of namespace kept in store
+func (c *Client) configuration(namespace string, store *storage.Storage) *action.Configuration {
+	return &action.Configuration{
+		RESTClientGetter: c.getter(namespace),
+		Releases:         store,
+		KubeClient:       c.kubeClient(namespace),
+		Capabilities:     c.capabilities,
+		Log:              log.WithField("helm-namespace", namespace).Debugf,
+	}
+}
+
+// latestRelease returns the latest revision of release, nil if release doesn't exist
+func latestRelease(store *storage.Storage, name string) (*release.Release, error) {
+	history, err := store.History(name)
+	if err == driver.ErrReleaseNotFound || (err == nil && len(history) == 0) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	releaseutil.SortByRevision(history)
+	return history[len(history)-1], nil
+}
+
+// ReleaseExists checks if there's any revision of release in namespace
+func (c *Client) ReleaseExists(namespace, name string) (bool, error) {
+	rel, err := latestRelease(c.storage(namespace), name)
+	return rel != nil, err
+}
+
+// UninstallOptions control how release is uninstalled
+type UninstallOptions struct {
+	// DisableHooks prevents hooks from running (--no-hooks)
+	DisableHooks bool
+	// KeepHistory marks release as uninstalled instead of removing its history (--keep-history)
+	KeepHistory bool
+	// Timeout of waiting for hooks, 5 minutes if it's 0
+	Timeout time.Duration
+}
+
+// Uninstall does what 'helm uninstall' does: runs pre-delete hooks of release, deletes its resources,
+// runs post-delete hooks and then removes release history (or marks release as uninstalled)
+func (c *Client) Uninstall(namespace, name string, opts UninstallOptions) error {
+	logger := log.WithFields(log.Fields{"helm-release": name, "helm-namespace": namespace, "func": "helm3.Uninstall"})
+
+	store := c.storage(namespace)
+	rel, err := latestRelease(store, name)
+	if err != nil {
+		return err
+	}
+	if rel == nil {
+		logger.Debug("Release doesn't exist, nothing to uninstall")
+		return nil
+	}
+	// Helm fails to uninstall such release again, while it's exactly what we want
+	if rel.Info != nil && rel.Info.Status == release.StatusUninstalled && opts.KeepHistory {
+		logger.Debug("Release is already uninstalled")
+		return nil
+	}
+
+	if err := c.uninstall(namespace, store, name, opts); err != nil {
+		return err
+	}
+	if opts.KeepHistory {
+		logger.Info("Release is uninstalled, its history is kept")
+	} else {
+		logger.Info("Release is uninstalled")
+	}
+	return nil
+}
+
+// UninstallResources runs pre-delete hooks of release, deletes its resources and runs post-delete hooks,
+// release storage isn't touched. It's used for Helm 2 releases which are converted to Helm 3 ones.
+func (c *Client) UninstallResources(rel *release.Release, opts UninstallOptions) error {
+	// Helm uninstalls releases it reads from storage, so release is put into storage of its own
+	deployed := *rel
+	deployed.Info = &release.Info{Status: release.StatusDeployed}
+	store := storage.Init(driver.NewMemory())
+	if err := store.Create(&deployed); err != nil {
+		return err
+	}
+	opts.KeepHistory = false
+	return c.uninstall(rel.Namespace, store, rel.Name, opts)
+}
+
+func (c *Client) uninstall(namespace string, store *storage.Storage, name string, opts UninstallOptions) error {
+	uninstall := action.NewUninstall(c.configuration(namespace, store))
+	uninstall.DisableHooks = opts.DisableHooks
+	uninstall.KeepHistory = opts.KeepHistory
+	uninstall.Timeout = opts.Timeout
+	if uninstall.Timeout <= 0 {
+		uninstall.Timeout = defaultHookTimeout
+	}
+	_, err := uninstall.Run(name)
+	return err
+}
+
+// delete deletes object, missing object isn't an error
+func (c *Client) delete(obj *unstructured.Unstructured, namespace string) error {
+	resource, err := c.resourceFor(obj, namespace)
+	if err != nil {
+		return err
+	}
+	propagation := metav1.DeletePropagationBackground
+	err = resource.Delete(obj.GetName(), &metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// resourceFor returns dynamic client of object's resource; namespace of release is used if object doesn't set one
+func (c *Client) resourceFor(obj *unstructured.Unstructured, namespace string) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return c.dynamicClient.Resource(mapping.Resource), nil
+	}
+	if obj.GetNamespace() != "" {
+		namespace = obj.GetNamespace()
+	}
+	return c.dynamicClient.Resource(mapping.Resource).Namespace(namespace), nil
+}
+
+// parseManifest splits multi-document YAML into objects, empty documents (e.g. with comments only) are skipped
+func parseManifest(manifest string) ([]*unstructured.Unstructured, error) {
+	objects := []*unstructured.Unstructured{}
+	for _, doc := range strings.Split("\n"+manifest, "\n---") {
+		data, err := yaml.YAMLToJSON([]byte(doc))
+		if err != nil {
+			return nil, err
+		}
+		if string(data) == "null" {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal(data, &obj.Object); err != nil {
+			return nil, err
+		}
+		if obj.GetKind() == "" {
+			continue
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
@@ -0,0 +1,316 @@
+package helm3
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/kube"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/resource"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testManifest = `
+---
+# Source: app/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-config
+---
+# Source: app/templates/pvc.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-data
+  annotations:
+    helm.sh/resource-policy: keep
+`
+
+// recordingKubeClient records objects which Helm creates and deletes
+type recordingKubeClient struct {
+	kubefake.PrintingKubeClient
+	created, deleted []string
+}
+
+func (c *recordingKubeClient) Build(reader io.Reader, _ bool) (kube.ResourceList, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := parseManifest(string(data))
+	if err != nil {
+		return nil, err
+	}
+	resources := kube.ResourceList{}
+	for _, obj := range objects {
+		resources = append(resources, &resource.Info{Name: obj.GetName(), Namespace: obj.GetNamespace(), Object: obj})
+	}
+	return resources, nil
+}
+
+func (c *recordingKubeClient) Create(resources kube.ResourceList) (*kube.Result, error) {
+	c.created = append(c.created, describe(resources)...)
+	return &kube.Result{Created: resources}, nil
+}
+
+func (c *recordingKubeClient) Delete(resources kube.ResourceList) (*kube.Result, []error) {
+	c.deleted = append(c.deleted, describe(resources)...)
+	return &kube.Result{Deleted: resources}, nil
+}
+
+func describe(resources kube.ResourceList) []string {
+	described := []string{}
+	for _, info := range resources {
+		described = append(described, info.Object.GetObjectKind().GroupVersionKind().Kind+" "+info.Name)
+	}
+	return described
+}
+
+func newTestClient(k8sClient *fake.Clientset) (*Client, *recordingKubeClient) {
+	kubeClient := &recordingKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: ioutil.Discard}}
+	return &Client{
+		k8sClient:    k8sClient,
+		kubeClient:   func(string) kube.Interface { return kubeClient },
+		capabilities: chartutil.DefaultCapabilities,
+	}, kubeClient
+}
+
+// testRelease returns deployed release with resources of known and unknown kinds and pre-delete hook
+func testRelease() *release.Release {
+	return &release.Release{
+		Name:      "app",
+		Namespace: "preview",
+		Version:   1,
+		Info:      &release.Info{Status: release.StatusDeployed},
+		Manifest: testManifest + `
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+`,
+		Hooks: []*release.Hook{{
+			Name:           "migrate",
+			Kind:           "Job",
+			Manifest:       "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n",
+			Events:         []release.HookEvent{release.HookPreDelete},
+			DeletePolicies: []release.HookDeletePolicy{release.HookSucceeded},
+		}},
+	}
+}
+
+// storeRelease stores release the way Helm 3 does it
+func storeRelease(t *testing.T, k8sClient *fake.Clientset, rel *release.Release) {
+	key := fmt.Sprintf("sh.helm.release.v1.%s.v%d", rel.Name, rel.Version)
+	if err := driver.NewSecrets(k8sClient.CoreV1().Secrets(rel.Namespace)).Create(key, rel); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClient_Uninstall(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+	storeRelease(t, k8sClient, testRelease())
+	c, kubeClient := newTestClient(k8sClient)
+
+	if exists, err := c.ReleaseExists("preview", "app"); !exists || err != nil {
+		t.Fatalf("Expected release to exist, got %v (%v)", exists, err)
+	}
+
+	if err := c.Uninstall("preview", "app", UninstallOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"Job migrate"}; !reflect.DeepEqual(kubeClient.created, expected) {
+		t.Errorf("Expected pre-delete hook to run, got %v", kubeClient.created)
+	}
+	// hook is deleted after it succeeds; Service goes before Deployment, kinds unknown to Helm go last and
+	// resource with 'keep' policy isn't deleted at all
+	expected := []string{"Job migrate", "Service app", "Deployment app", "ConfigMap app-config", "Widget app"}
+	if !reflect.DeepEqual(kubeClient.deleted, expected) {
+		t.Errorf("Expected deletions %v, got %v", expected, kubeClient.deleted)
+	}
+	if exists, _ := c.ReleaseExists("preview", "app"); exists {
+		t.Errorf("Expected release history to be purged")
+	}
+
+	// uninstalling missing release is no-op
+	if err := c.Uninstall("preview", "app", UninstallOptions{}); err != nil {
+		t.Errorf("Expected no error for missing release, but got %v", err)
+	}
+}
+
+func TestClient_Uninstall_KeepHistory(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+	storeRelease(t, k8sClient, testRelease())
+	c, kubeClient := newTestClient(k8sClient)
+
+	if err := c.Uninstall("preview", "app", UninstallOptions{KeepHistory: true, DisableHooks: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(kubeClient.created) != 0 {
+		t.Errorf("Expected hooks to be disabled, but %v were created", kubeClient.created)
+	}
+
+	kept, err := latestRelease(c.storage("preview"), "app")
+	if err != nil || kept == nil {
+		t.Fatalf("Expected release history to be kept, but got %v (%v)", kept, err)
+	}
+	if kept.Info.Status != release.StatusUninstalled || kept.Manifest != testRelease().Manifest {
+		t.Errorf("Expected release to be marked as uninstalled, but got status '%s'", kept.Info.Status)
+	}
+
+	// Helm refuses to uninstall release again, but for us it's done
+	if err := c.Uninstall("preview", "app", UninstallOptions{KeepHistory: true}); err != nil {
+		t.Errorf("Expected no error for uninstalled release, but got %v", err)
+	}
+}
+
+func TestClient_UninstallResources(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+	c, kubeClient := newTestClient(k8sClient)
+
+	rel := testRelease()
+	rel.Info = nil
+	if err := c.UninstallResources(rel, UninstallOptions{DisableHooks: true}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"Service app", "Deployment app", "ConfigMap app-config", "Widget app"}; !reflect.DeepEqual(kubeClient.deleted, expected) {
+		t.Errorf("Expected deletions %v, got %v", expected, kubeClient.deleted)
+	}
+	if secrets, _ := k8sClient.CoreV1().Secrets("preview").List(metav1.ListOptions{}); len(secrets.Items) != 0 {
+		t.Errorf("Expected storage of Helm 3 releases to be untouched, but got %v", secrets.Items)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	objects, err := parseManifest("# only comment\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: svc\n---\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[0].GetKind() != "Service" || objects[1].GetKind() != "Deployment" {
+		t.Errorf("Expected Service and Deployment, but got %v", objects)
+	}
+}
+
+func TestClient_Leftovers(t *testing.T) {
+	clusterRole := &unstructured.Unstructured{}
+	clusterRole.SetAPIVersion("rbac.authorization.k8s.io/v1")
+	clusterRole.SetKind("ClusterRole")
+	clusterRole.SetName("app-reader")
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRoleBinding"}, meta.RESTScopeRoot)
+	c := &Client{dynamicClient: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), clusterRole), mapper: mapper}
+
+	manifest := testManifest + `
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: app-reader
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: app-reader
+---
+apiVersion: example.com/v1
+kind: Unknown
+metadata:
+  name: app
+`
+	leftovers, err := c.Leftovers(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftovers) != 1 || leftovers[0].GetName() != "app-reader" || leftovers[0].GetKind() != "ClusterRole" {
+		t.Fatalf("Expected existing ClusterRole to be reported, but got %v", leftovers)
+	}
+
+	if err := c.DeleteLeftover(leftovers[0]); err != nil {
+		t.Fatal(err)
+	}
+	if leftovers, _ := c.Leftovers(manifest); len(leftovers) != 0 {
+		t.Errorf("Expected no leftovers after deletion, but got %v", leftovers)
+	}
+}
+
+func TestClient_WaitForDeletion(t *testing.T) {
+	deletionPollInterval = time.Millisecond
+
+	configMap := &unstructured.Unstructured{}
+	configMap.SetAPIVersion("v1")
+	configMap.SetKind("ConfigMap")
+	configMap.SetName("app-config")
+	configMap.SetNamespace("preview")
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), configMap)
+	c := &Client{dynamicClient: dynamicClient, mapper: mapper}
+
+	if err := c.WaitForDeletion(testManifest, "preview", 10*time.Millisecond); err == nil || !strings.Contains(err.Error(), "ConfigMap app-config") {
+		t.Errorf("Expected timeout listing remaining ConfigMap, but got %v", err)
+	}
+
+	// object is deleted while waiting
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		gvr := schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+		dynamicClient.Resource(gvr).Namespace("preview").Delete("app-config", nil)
+	}()
+	if err := c.WaitForDeletion(testManifest, "preview", time.Second); err != nil {
+		t.Errorf("Expected no error after objects are deleted, but got %v", err)
+	}
+}
+
+func TestClient_ReleaseSnapshot(t *testing.T) {
+	rel := testRelease()
+	rel.Chart = &chart.Chart{Metadata: &chart.Metadata{Name: "app", Version: "1.2.3"}}
+	rel.Config = map[string]interface{}{"image": map[string]interface{}{"tag": "feature-x"}}
+
+	k8sClient := fake.NewSimpleClientset()
+	storeRelease(t, k8sClient, rel)
+	c, _ := newTestClient(k8sClient)
+	snapshot, err := c.ReleaseSnapshot("preview", "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Chart != "app" || snapshot.ChartVersion != "1.2.3" || snapshot.Revision != 1 ||
+		snapshot.Values != "image:\n  tag: feature-x\n" || !strings.HasSuffix(snapshot.Manifest, "name: migrate\n") {
+		t.Errorf("Unexpected snapshot %+v", snapshot)
+	}
+
+	if snapshot, err := c.ReleaseSnapshot("preview", "missing"); snapshot != nil || err != nil {
+		t.Errorf("Expected no snapshot of missing release, got %v (%v)", snapshot, err)
+	}
+}
@@ -0,0 +1,67 @@
+package helm3
+
+import (
+	"helm.sh/helm/v3/pkg/release"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ReleaseManifest returns manifest of the latest revision of release together with manifests of its hooks,
+// it's empty if release doesn't exist
+func (c *Client) ReleaseManifest(namespace, name string) (string, error) {
+	rel, err := latestRelease(c.storage(namespace), name)
+	if err != nil || rel == nil {
+		return "", err
+	}
+	return FullManifest(rel), nil
+}
+
+// FullManifest joins manifest of release with manifests of its hooks (e.g. CRDs installed by hooks)
+func FullManifest(rel *release.Release) string {
+	manifest := rel.Manifest
+	for _, hook := range rel.Hooks {
+		manifest += "\n---\n" + hook.Manifest
+	}
+	return manifest
+}
+
+// Leftovers returns cluster-scoped objects of manifest which still exist, e.g. CRDs, ClusterRoles or webhook
+// configurations which uninstall left behind. Objects of kinds unknown to the cluster are skipped.
+func (c *Client) Leftovers(manifest string) ([]*unstructured.Unstructured, error) {
+	objects, err := parseManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	leftovers := []*unstructured.Unstructured{}
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, err
+		}
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			continue
+		}
+		_, err = c.dynamicClient.Resource(mapping.Resource).Get(obj.GetName(), metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		leftovers = append(leftovers, obj)
+	}
+	return leftovers, nil
+}
+
+// DeleteLeftover deletes cluster-scoped object returned by Leftovers
+func (c *Client) DeleteLeftover(obj *unstructured.Unstructured) error {
+	return c.delete(obj, "")
+}
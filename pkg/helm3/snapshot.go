@@ -0,0 +1,49 @@
+package helm3
+
+import (
+	"sigs.k8s.io/yaml"
+)
+
+// Snapshot is everything needed to install release again exactly as it was; Helm 2 releases are snapshotted
+// to it as well
+type Snapshot struct {
+	Name         string `json:"name"`
+	Namespace    string `json:"namespace"`
+	Revision     int    `json:"revision"`
+	Chart        string `json:"chart"`
+	ChartVersion string `json:"chartVersion"`
+	AppVersion   string `json:"appVersion,omitempty"`
+	// Values are user-supplied values as YAML
+	Values string `json:"values"`
+	// Manifest is rendered manifest together with manifests of hooks
+	Manifest string `json:"manifest"`
+}
+
+// ReleaseSnapshot returns snapshot of the latest revision of release, it's nil if release doesn't exist
+func (c *Client) ReleaseSnapshot(namespace, name string) (*Snapshot, error) {
+	rel, err := latestRelease(c.storage(namespace), name)
+	if err != nil || rel == nil {
+		return nil, err
+	}
+	values := ""
+	if len(rel.Config) > 0 {
+		data, err := yaml.Marshal(rel.Config)
+		if err != nil {
+			return nil, err
+		}
+		values = string(data)
+	}
+	snapshot := &Snapshot{
+		Name:      rel.Name,
+		Namespace: rel.Namespace,
+		Revision:  rel.Version,
+		Values:    values,
+		Manifest:  FullManifest(rel),
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		snapshot.Chart = rel.Chart.Metadata.Name
+		snapshot.ChartVersion = rel.Chart.Metadata.Version
+		snapshot.AppVersion = rel.Chart.Metadata.AppVersion
+	}
+	return snapshot, nil
+}
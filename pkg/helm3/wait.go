@@ -0,0 +1,57 @@
+package helm3
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// deletionPollInterval is how often objects are checked while waiting for their deletion
+var deletionPollInterval = 2 * time.Second
+
+// WaitForDeletion waits until objects of manifest are gone (e.g. finalizers of chart resources have run);
+// namespace is used for objects which don't set one, objects kept due to resource policy and objects
+// of kinds unknown to the cluster are ignored
+func (c *Client) WaitForDeletion(manifest, namespace string, timeout time.Duration) error {
+	objects, err := parseManifest(manifest)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := []string{}
+		for _, obj := range objects {
+			if obj.GetAnnotations()[resourcePolicyAnnotation] == resourcePolicyKeep {
+				continue
+			}
+			resource, err := c.resourceFor(obj, namespace)
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			_, err = resource.Get(obj.GetName(), metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			remaining = append(remaining, fmt.Sprintf("%s %s", obj.GetKind(), obj.GetName()))
+		}
+
+		if len(remaining) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("objects of release aren't deleted in %s: %s", timeout, strings.Join(remaining, ", "))
+		}
+		time.Sleep(deletionPollInterval)
+	}
+}
@@ -0,0 +1,230 @@
+// Package history keeps rolling history of namespace deletions and failures in ConfigMaps, one ConfigMap per day
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// outcomes of entries
+const (
+	OutcomeDeleted = "deleted"
+	OutcomeFailed  = "failed"
+)
+
+// key of ConfigMap data holding entries as JSON lines
+const entriesKey = "entries"
+
+// format of date in names of shards
+const shardDateFormat = "20060102"
+
+// how many times conflicting update of shard is retried
+const conflictRetries = 5
+
+// Entry is a single deletion or failure
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Namespace  string    `json:"namespace"`
+	Repository string    `json:"repository,omitempty"`
+	Branch     string    `json:"branch,omitempty"`
+	Outcome    string    `json:"outcome"`
+	// Action is the failed action, e.g. "delete-helm-release"
+	Action string `json:"action,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Query filters entries, zero values match everything
+type Query struct {
+	Namespace string
+	Outcome   string
+	Since     time.Time
+	// Limit is maximal number of the latest entries to return
+	Limit int
+}
+
+func (q Query) matches(e Entry) bool {
+	return (q.Namespace == "" || e.Namespace == q.Namespace) &&
+		(q.Outcome == "" || e.Outcome == q.Outcome) &&
+		!e.Time.Before(q.Since)
+}
+
+// Store keeps entries in ConfigMaps PREFIX-YYYYMMDD which are labeled with labels
+type Store struct {
+	k8sClient kubernetes.Interface
+	namespace string
+	prefix    string
+	labels    map[string]string
+	// mu serializes updates of shards by this process, updates by others are detected as conflicts
+	mu sync.Mutex
+}
+
+// NewStore returns store of ConfigMaps in namespace
+func NewStore(k8sClient kubernetes.Interface, namespace, prefix string, labels map[string]string) *Store {
+	return &Store{k8sClient: k8sClient, namespace: namespace, prefix: prefix, labels: labels}
+}
+
+func (s *Store) shardName(t time.Time) string {
+	return s.prefix + "-" + t.UTC().Format(shardDateFormat)
+}
+
+// Append adds entry to shard of its day; time is set to now if it's empty
+func (s *Store) Append(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	configMaps := s.k8sClient.CoreV1().ConfigMaps(s.namespace)
+	name := s.shardName(e.Time)
+	for i := 0; ; i++ {
+		cm, err := configMaps.Get(name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: s.namespace, Labels: s.labels},
+				Data:       map[string]string{entriesKey: string(line) + "\n"},
+			}
+			_, err = configMaps.Create(cm)
+		} else if err == nil {
+			if cm.Data == nil {
+				cm.Data = map[string]string{}
+			}
+			cm.Data[entriesKey] += string(line) + "\n"
+			_, err = configMaps.Update(cm)
+		}
+		if (errors.IsConflict(err) || errors.IsAlreadyExists(err)) && i < conflictRetries {
+			continue
+		}
+		return err
+	}
+}
+
+// shards returns shards ordered from the oldest one
+func (s *Store) shards() ([]corev1.ConfigMap, error) {
+	list, err := s.k8sClient.CoreV1().ConfigMaps(s.namespace).List(metav1.ListOptions{LabelSelector: labels.SelectorFromSet(s.labels).String()})
+	if err != nil {
+		return nil, err
+	}
+	shards := []corev1.ConfigMap{}
+	for _, cm := range list.Items {
+		if strings.HasPrefix(cm.Name, s.prefix+"-") {
+			shards = append(shards, cm)
+		}
+	}
+	sort.Slice(shards, func(i, j int) bool {
+		return shards[i].Name < shards[j].Name
+	})
+	return shards, nil
+}
+
+// parse returns entries of shard, malformed lines are skipped
+func parse(cm corev1.ConfigMap) []Entry {
+	entries := []Entry{}
+	scanner := bufio.NewScanner(strings.NewReader(cm.Data[entriesKey]))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// List returns entries matching query, the latest ones first
+func (s *Store) List(q Query) ([]Entry, error) {
+	shards, err := s.shards()
+	if err != nil {
+		return nil, err
+	}
+	entries := []Entry{}
+	for _, cm := range shards {
+		for _, e := range parse(cm) {
+			if q.matches(e) {
+				entries = append(entries, e)
+			}
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.After(entries[j].Time)
+	})
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+	}
+	return entries, nil
+}
+
+// Prune removes entries older than maxAge and the oldest ones beyond maxCount; zero values disable
+// the corresponding limit. Number of removed entries is returned.
+func (s *Store) Prune(maxAge time.Duration, maxCount int, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shards, err := s.shards()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	parsed := make([][]Entry, len(shards))
+	for i, cm := range shards {
+		parsed[i] = parse(cm)
+		total += len(parsed[i])
+	}
+
+	// excess entries are removed from the oldest shards
+	excess := 0
+	if maxCount > 0 && total > maxCount {
+		excess = total - maxCount
+	}
+	removed := 0
+	configMaps := s.k8sClient.CoreV1().ConfigMaps(s.namespace)
+	for i, cm := range shards {
+		kept := []Entry{}
+		for _, e := range parsed[i] {
+			if excess > 0 || maxAge > 0 && now.Sub(e.Time) > maxAge {
+				if excess > 0 {
+					excess--
+				}
+				continue
+			}
+			kept = append(kept, e)
+		}
+		if len(kept) == len(parsed[i]) {
+			continue
+		}
+
+		if len(kept) == 0 {
+			err = configMaps.Delete(cm.Name, &metav1.DeleteOptions{})
+		} else {
+			var data strings.Builder
+			for _, e := range kept {
+				line, _ := json.Marshal(e)
+				data.Write(append(line, '\n'))
+			}
+			cm.Data[entriesKey] = data.String()
+			_, err = configMaps.Update(&cm)
+		}
+		if err != nil && !errors.IsNotFound(err) {
+			return removed, fmt.Errorf("Failed to prune %s: %v", cm.Name, err)
+		}
+		removed += len(parsed[i]) - len(kept)
+	}
+	return removed, nil
+}
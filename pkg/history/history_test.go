@@ -0,0 +1,60 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStore(t *testing.T) {
+	k8sClient := fake.NewSimpleClientset()
+	s := NewStore(k8sClient, "buhtig", "history", map[string]string{"history": "true"})
+
+	day := time.Date(2019, 7, 1, 10, 0, 0, 0, time.UTC)
+	for _, e := range []Entry{
+		{Time: day, Namespace: "a", Outcome: OutcomeDeleted},
+		{Time: day.Add(time.Hour), Namespace: "b", Outcome: OutcomeFailed, Action: "delete-helm-release", Error: "timeout"},
+		{Time: day.Add(24 * time.Hour), Namespace: "b", Outcome: OutcomeDeleted},
+		{Time: day.Add(48 * time.Hour), Namespace: "c", Outcome: OutcomeDeleted},
+	} {
+		if err := s.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := k8sClient.CoreV1().ConfigMaps("buhtig").Get("history-20190702", metav1.GetOptions{}); err != nil {
+		t.Errorf("Expected entries to be sharded by day, got %v", err)
+	}
+
+	entries, err := s.List(Query{Namespace: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Outcome != OutcomeDeleted || entries[1].Error != "timeout" {
+		t.Errorf("Expected entries of namespace, the latest first, got %v", entries)
+	}
+	if entries, _ := s.List(Query{Outcome: OutcomeDeleted, Since: day.Add(time.Minute), Limit: 1}); len(entries) != 1 || entries[0].Namespace != "c" {
+		t.Errorf("Expected the latest deletion, got %v", entries)
+	}
+
+	// entries of the first day are past max age
+	removed, err := s.Prune(36*time.Hour, 0, day.Add(49*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ = s.List(Query{})
+	if removed != 2 || len(entries) != 2 || entries[1].Namespace != "b" {
+		t.Errorf("Expected 2 old entries to be pruned, got %d removed and %v remaining", removed, entries)
+	}
+	// the oldest entries beyond max count are removed
+	if removed, _ := s.Prune(0, 1, day.Add(49*time.Hour)); removed != 1 {
+		t.Errorf("Expected 1 entry beyond max count to be pruned, got %d", removed)
+	}
+	if entries, _ = s.List(Query{}); len(entries) != 1 || entries[0].Namespace != "c" {
+		t.Errorf("Expected only the latest entry to remain, got %v", entries)
+	}
+	if _, err := k8sClient.CoreV1().ConfigMaps("buhtig").Get("history-20190701", metav1.GetOptions{}); err == nil {
+		t.Error("Expected empty shard to be deleted")
+	}
+}
@@ -0,0 +1,143 @@
+// Package jenkins triggers parameterized Jenkins jobs and follows their builds
+package jenkins
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// results of finished build
+const (
+	ResultSuccess = "SUCCESS"
+	ResultFailure = "FAILURE"
+	ResultAborted = "ABORTED"
+)
+
+// Client calls Jenkins remote access API
+type Client struct {
+	httpClient *http.Client
+	url        string
+	username   string
+	// token is API token of user, requests authenticated with it don't need CSRF crumb
+	token string
+}
+
+// NewClient returns client of Jenkins at URL authenticated as user with API token
+func NewClient(url, username, token string) *Client {
+	return &Client{httpClient: &http.Client{Timeout: 30 * time.Second}, url: strings.TrimSuffix(url, "/"), username: username, token: token}
+}
+
+// Build is state of build (only fields we're interested in)
+type Build struct {
+	Number   int    `json:"number"`
+	URL      string `json:"url"`
+	Building bool   `json:"building"`
+	// Result is empty while build is running
+	Result string `json:"result"`
+}
+
+// IsFinished checks if build has finished, successfully or not
+func (b *Build) IsFinished() bool {
+	return !b.Building && b.Result != ""
+}
+
+// IsSucceeded checks if build has finished successfully
+func (b *Build) IsSucceeded() bool {
+	return b.IsFinished() && b.Result == ResultSuccess
+}
+
+// jobURL returns URL of job, job in folders is named like "folder/job"
+func (c *Client) jobURL(job string) string {
+	var path strings.Builder
+	for _, part := range strings.Split(strings.Trim(job, "/"), "/") {
+		path.WriteString("/job/" + url.PathEscape(part))
+	}
+	return c.url + path.String()
+}
+
+// TriggerBuild queues build of job with parameters and returns URL of queue item, see QueuedBuild
+func (c *Client) TriggerBuild(job string, parameters map[string]string) (string, error) {
+	apiURL := c.jobURL(job) + "/build"
+	if len(parameters) > 0 {
+		query := url.Values{}
+		for k, v := range parameters {
+			query.Set(k, v)
+		}
+		apiURL = c.jobURL(job) + "/buildWithParameters?" + query.Encode()
+	}
+
+	resp, err := c.request(http.MethodPost, apiURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", responseError(http.MethodPost, apiURL, resp)
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("POST %s didn't return location of queue item", apiURL)
+	}
+	return location, nil
+}
+
+// QueuedBuild returns build started from queue item, it's nil while item is still in the queue;
+// cancelled item is returned as error
+func (c *Client) QueuedBuild(queueURL string) (*Build, error) {
+	item := struct {
+		Cancelled  bool   `json:"cancelled"`
+		Why        string `json:"why"`
+		Executable *Build `json:"executable"`
+	}{}
+	if err := c.get(queueURL, &item); err != nil {
+		return nil, err
+	}
+	if item.Cancelled {
+		return nil, fmt.Errorf("Queue item %s is cancelled", queueURL)
+	}
+	return item.Executable, nil
+}
+
+// GetBuild returns build by its URL
+func (c *Client) GetBuild(buildURL string) (*Build, error) {
+	build := &Build{}
+	err := c.get(buildURL, build)
+	return build, err
+}
+
+// get decodes JSON representation of object at URL into out
+func (c *Client) get(objectURL string, out interface{}) error {
+	apiURL := strings.TrimSuffix(objectURL, "/") + "/api/json"
+	resp, err := c.request(http.MethodGet, apiURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(http.MethodGet, apiURL, resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) request(method, url string) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.token)
+	}
+	return c.httpClient.Do(req)
+}
+
+func responseError(method, url string, resp *http.Response) error {
+	msg, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("%s %s responded with status %d: %s", method, url, resp.StatusCode, msg)
+}
@@ -0,0 +1,64 @@
+package jenkins
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, token, _ := r.BasicAuth(); user != "bot" || token != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /job/envs/job/teardown/buildWithParameters":
+			if r.URL.Query().Get("NAMESPACE") != "feature-a" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Location", server.URL+"/queue/item/7/")
+			w.WriteHeader(http.StatusCreated)
+		case "GET /queue/item/7/api/json":
+			fmt.Fprintf(w, `{"cancelled": false, "executable": {"number": 3, "url": "%s/job/envs/job/teardown/3/"}}`, server.URL)
+		case "GET /queue/item/8/api/json":
+			fmt.Fprint(w, `{"cancelled": true}`)
+		case "GET /queue/item/9/api/json":
+			fmt.Fprint(w, `{"why": "Waiting for next available executor"}`)
+		case "GET /job/envs/job/teardown/3/api/json":
+			fmt.Fprint(w, `{"number": 3, "building": false, "result": "SUCCESS"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL+"/", "bot", "secret")
+
+	queueURL, err := c.TriggerBuild("envs/teardown", map[string]string{"NAMESPACE": "feature-a"})
+	if err != nil || queueURL != server.URL+"/queue/item/7/" {
+		t.Fatalf("Expected queue item 7, but got '%s' (%v)", queueURL, err)
+	}
+
+	queued, err := c.QueuedBuild(queueURL)
+	if err != nil || queued == nil || queued.Number != 3 {
+		t.Fatalf("Expected build 3, but got %+v (%v)", queued, err)
+	}
+	if build, err := c.QueuedBuild(server.URL + "/queue/item/9/"); err != nil || build != nil {
+		t.Errorf("Expected item still in the queue, but got %+v (%v)", build, err)
+	}
+	if _, err := c.QueuedBuild(server.URL + "/queue/item/8/"); err == nil {
+		t.Error("Expected error for cancelled item")
+	}
+
+	if build, err := c.GetBuild(queued.URL); err != nil || !build.IsSucceeded() {
+		t.Errorf("Expected succeeded build, but got %+v (%v)", build, err)
+	}
+
+	if _, err := c.TriggerBuild("missing", nil); err == nil {
+		t.Error("Expected error for missing job")
+	}
+}
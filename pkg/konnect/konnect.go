@@ -2,7 +2,9 @@ package konnect
 
 import (
 	"flag"
+	"io/ioutil"
 	"os"
+	"strings"
 
 	"path/filepath"
 
@@ -13,23 +15,27 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-// NewConfig returns K8s config
+// kubeconfig is registered on the global flag set, so that the app parses its flags once (see NewConfig)
+var kubeconfig = flag.String("kubeconfig", defaultKubeconfig(), "(optional) absolute path to the kubeconfig file, used with APP_ENV=outside_cluster")
+
+func defaultKubeconfig() string {
+	if home := homedir.HomeDir(); home != "" {
+		return filepath.Join(home, ".kube", "config")
+	}
+	return ""
+}
+
+// NewConfig returns K8s config; flags are parsed unless the app has parsed them already
 func NewConfig() (*rest.Config, error) {
 	var err error
 	var config *rest.Config
 
 	if os.Getenv("APP_ENV") == "outside_cluster" {
 		//outside-cluster config (for development)
-		var kubeconfig *string
-
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-		} else {
-			kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
+		if !flag.Parsed() {
+			flag.Parse()
 		}
 
-		flag.Parse()
-
 		config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig)
 		if err != nil {
 			return nil, err
@@ -49,3 +55,20 @@ func NewConfig() (*rest.Config, error) {
 func NewClient(config *rest.Config) (client *kubernetes.Clientset, err error) {
 	return kubernetes.NewForConfig(config)
 }
+
+// serviceAccountNamespaceFile is where Kubernetes mounts namespace of the pod
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// CurrentNamespace returns namespace the app runs in: value of POD_NAMESPACE env variable
+// (see Downward API), namespace of mounted service account or "default"
+func CurrentNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	if data, err := ioutil.ReadFile(serviceAccountNamespaceFile); err == nil {
+		if ns := strings.TrimSpace(string(data)); ns != "" {
+			return ns
+		}
+	}
+	return "default"
+}
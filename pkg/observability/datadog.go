@@ -0,0 +1,151 @@
+package observability
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Datadog deletes monitors, dashboards and synthetic tests with matching name
+type Datadog struct {
+	// Site is Datadog site, e.g. "datadoghq.com" or "datadoghq.eu"
+	Site   string
+	APIKey string
+	AppKey string
+	// baseURL overrides URL of API derived from Site, e.g. in tests
+	baseURL string
+}
+
+// datadogPageSize is number of dashboards or synthetic tests requested per page
+const datadogPageSize = 100
+
+// Name implements Cleaner
+func (d *Datadog) Name() string {
+	return "datadog"
+}
+
+func (d *Datadog) api(path string) string {
+	if d.baseURL != "" {
+		return d.baseURL + path
+	}
+	site := d.Site
+	if site == "" {
+		site = "datadoghq.com"
+	}
+	return fmt.Sprintf("https://api.%s%s", site, path)
+}
+
+func (d *Datadog) headers() map[string]string {
+	return map[string]string{"DD-API-KEY": d.APIKey, "DD-APPLICATION-KEY": d.AppKey}
+}
+
+// Cleanup implements Cleaner
+func (d *Datadog) Cleanup(name string) (int, error) {
+	deleted := 0
+	for _, cleanup := range []func(string) (int, error){d.cleanupMonitors, d.cleanupDashboards, d.cleanupSynthetics} {
+		n, err := cleanup(name)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+func (d *Datadog) cleanupMonitors(name string) (int, error) {
+	query := url.Values{}
+	query.Set("name", name)
+
+	monitors := []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}{}
+	if err := doJSON(http.MethodGet, d.api("/api/v1/monitor?"+query.Encode()), d.headers(), nil, &monitors); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, monitor := range monitors {
+		if monitor.Name != name {
+			continue
+		}
+		if err := doJSON(http.MethodDelete, d.api(fmt.Sprintf("/api/v1/monitor/%d", monitor.ID)), d.headers(), nil, nil); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (d *Datadog) cleanupDashboards(name string) (int, error) {
+	ids := []string{}
+	for start := 0; ; start += datadogPageSize {
+		query := url.Values{}
+		query.Set("count", strconv.Itoa(datadogPageSize))
+		query.Set("start", strconv.Itoa(start))
+
+		page := struct {
+			Dashboards []struct {
+				ID    string `json:"id"`
+				Title string `json:"title"`
+			} `json:"dashboards"`
+		}{}
+		if err := doJSON(http.MethodGet, d.api("/api/v1/dashboard?"+query.Encode()), d.headers(), nil, &page); err != nil {
+			return 0, err
+		}
+		for _, dashboard := range page.Dashboards {
+			if dashboard.Title == name {
+				ids = append(ids, dashboard.ID)
+			}
+		}
+		if len(page.Dashboards) < datadogPageSize {
+			break
+		}
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		if err := doJSON(http.MethodDelete, d.api("/api/v1/dashboard/"+id), d.headers(), nil, nil); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (d *Datadog) cleanupSynthetics(name string) (int, error) {
+	ids := []string{}
+	for pageNumber := 0; ; pageNumber++ {
+		query := url.Values{}
+		query.Set("page_size", strconv.Itoa(datadogPageSize))
+		query.Set("page_number", strconv.Itoa(pageNumber))
+
+		page := struct {
+			Tests []struct {
+				PublicID string `json:"public_id"`
+				Name     string `json:"name"`
+			} `json:"tests"`
+		}{}
+		if err := doJSON(http.MethodGet, d.api("/api/v1/synthetics/tests?"+query.Encode()), d.headers(), nil, &page); err != nil {
+			return 0, err
+		}
+		for _, test := range page.Tests {
+			if test.Name == name {
+				ids = append(ids, test.PublicID)
+			}
+		}
+		if len(page.Tests) < datadogPageSize {
+			break
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	payload := map[string][]string{"public_ids": ids}
+	if err := doJSON(http.MethodPost, d.api("/api/v1/synthetics/tests/delete"), d.headers(), payload, nil); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,80 @@
+package observability
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDatadog_Cleanup(t *testing.T) {
+	requests := []string{}
+	failing := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("DD-API-KEY") != "api" || r.Header.Get("DD-APPLICATION-KEY") != "app" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		request := r.Method + " " + r.URL.Path
+		if request == failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		query := r.URL.Query()
+		switch request {
+		case "GET /api/v1/monitor":
+			fmt.Fprint(w, `[{"id": 1, "name": "preview-a"}, {"id": 2, "name": "preview-a-2"}]`)
+			return
+		case "GET /api/v1/dashboard":
+			// matching dashboard is on the second page
+			if query.Get("start") == "0" {
+				dashboards := []string{}
+				for i := 0; i < datadogPageSize; i++ {
+					dashboards = append(dashboards, fmt.Sprintf(`{"id": "other-%d", "title": "other"}`, i))
+				}
+				fmt.Fprintf(w, `{"dashboards": [%s]}`, strings.Join(dashboards, ","))
+				return
+			}
+			fmt.Fprint(w, `{"dashboards": [{"id": "abc", "title": "preview-a"}, {"id": "def", "title": "Preview-A"}]}`)
+			return
+		case "GET /api/v1/synthetics/tests":
+			if query.Get("page_number") == "0" {
+				tests := []string{}
+				for i := 0; i < datadogPageSize; i++ {
+					tests = append(tests, fmt.Sprintf(`{"public_id": "other-%d", "name": "other"}`, i))
+				}
+				fmt.Fprintf(w, `{"tests": [%s]}`, strings.Join(tests, ","))
+				return
+			}
+			fmt.Fprint(w, `{"tests": [{"public_id": "xyz", "name": "preview-a"}, {"public_id": "uvw", "name": "preview-a-old"}]}`)
+			return
+		case "POST /api/v1/synthetics/tests/delete":
+			payload := map[string][]string{}
+			json.NewDecoder(r.Body).Decode(&payload)
+			request += " " + strings.Join(payload["public_ids"], ",")
+		}
+		requests = append(requests, request)
+	}))
+	defer server.Close()
+
+	d := &Datadog{APIKey: "api", AppKey: "app", baseURL: server.URL}
+	if n, err := d.Cleanup("preview-a"); n != 3 || err != nil {
+		t.Errorf("Expected 3 objects to be deleted, got %d (%v)", n, err)
+	}
+	expected := []string{"DELETE /api/v1/monitor/1", "DELETE /api/v1/dashboard/abc", "POST /api/v1/synthetics/tests/delete xyz"}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Errorf("Expected only objects with exact name to be deleted with %v, got %v", expected, requests)
+	}
+
+	// failed deletion stops cleanup
+	requests, failing = []string{}, "DELETE /api/v1/monitor/1"
+	if n, err := d.Cleanup("preview-a"); n != 0 || err == nil {
+		t.Errorf("Expected error, got %d deleted", n)
+	}
+	if len(requests) != 0 {
+		t.Errorf("Expected nothing else to be deleted after failure, got %v", requests)
+	}
+}
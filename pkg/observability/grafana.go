@@ -0,0 +1,52 @@
+package observability
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Grafana deletes dashboards with matching title
+type Grafana struct {
+	// URL of Grafana, e.g. https://grafana.example.com
+	URL string
+	// Token is API key or service account token with Editor role
+	Token string
+}
+
+// Name implements Cleaner
+func (g *Grafana) Name() string {
+	return "grafana"
+}
+
+// Cleanup implements Cleaner
+func (g *Grafana) Cleanup(name string) (int, error) {
+	base := strings.TrimSuffix(g.URL, "/")
+	headers := map[string]string{"Authorization": "Bearer " + g.Token}
+
+	query := url.Values{}
+	query.Set("query", name)
+	query.Set("type", "dash-db")
+
+	dashboards := []struct {
+		UID   string `json:"uid"`
+		Title string `json:"title"`
+	}{}
+	if err := doJSON(http.MethodGet, fmt.Sprintf("%s/api/search?%s", base, query.Encode()), headers, nil, &dashboards); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, dashboard := range dashboards {
+		// search is a substring match, delete only exact ones
+		if dashboard.Title != name {
+			continue
+		}
+		if err := doJSON(http.MethodDelete, fmt.Sprintf("%s/api/dashboards/uid/%s", base, dashboard.UID), headers, nil, nil); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,56 @@
+package observability
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGrafana_Cleanup(t *testing.T) {
+	deleted := []string{}
+	failing := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/search":
+			if r.URL.Query().Get("query") != "preview-a" {
+				t.Errorf("Unexpected search %s", r.URL.RawQuery)
+			}
+			// search matches substrings
+			fmt.Fprint(w, `[{"uid": "a", "title": "preview-a"}, {"uid": "b", "title": "preview-a-2"}, {"uid": "c", "title": "preview-a"}]`)
+		case r.Method == http.MethodDelete:
+			uid := r.URL.Path[len("/api/dashboards/uid/"):]
+			if uid == failing {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			deleted = append(deleted, uid)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	g := &Grafana{URL: server.URL + "/", Token: "token"}
+	if n, err := g.Cleanup("preview-a"); n != 2 || err != nil {
+		t.Errorf("Expected 2 dashboards to be deleted, got %d (%v)", n, err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"a", "c"}) {
+		t.Errorf("Expected only dashboards with exact title to be deleted, got %v", deleted)
+	}
+
+	// failed deletion stops cleanup
+	deleted, failing = []string{}, "a"
+	if n, err := g.Cleanup("preview-a"); n != 0 || err == nil {
+		t.Errorf("Expected error, got %d deleted", n)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("Expected no more dashboards to be deleted after failure, got %v", deleted)
+	}
+}
@@ -0,0 +1,98 @@
+package observability
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const newRelicGraphQLURL = "https://api.newrelic.com/graphql"
+
+// NewRelic deletes dashboards and synthetic monitors with matching name using NerdGraph API
+type NewRelic struct {
+	// APIKey is User API key
+	APIKey string
+	// URL of NerdGraph endpoint, default is US region endpoint
+	URL string
+}
+
+// Name implements Cleaner
+func (n *NewRelic) Name() string {
+	return "newrelic"
+}
+
+type graphQLResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (n *NewRelic) query(query string, variables map[string]interface{}, out interface{}) error {
+	endpoint := n.URL
+	if endpoint == "" {
+		endpoint = newRelicGraphQLURL
+	}
+	payload := map[string]interface{}{"query": query, "variables": variables}
+	return doJSON(http.MethodPost, endpoint, map[string]string{"API-Key": n.APIKey}, payload, out)
+}
+
+// Cleanup implements Cleaner
+func (n *NewRelic) Cleanup(name string) (int, error) {
+	search := struct {
+		Data struct {
+			Actor struct {
+				EntitySearch struct {
+					Results struct {
+						Entities []struct {
+							GUID string `json:"guid"`
+							Name string `json:"name"`
+							Type string `json:"type"`
+						} `json:"entities"`
+					} `json:"results"`
+				} `json:"entitySearch"`
+			} `json:"actor"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+
+	// NRQL-like entity search query, quotes in name are escaped
+	entityQuery := fmt.Sprintf("name = '%s' AND type IN ('DASHBOARD', 'MONITOR')", strings.Replace(name, "'", "\\'", -1))
+	err := n.query(`query($q: String!) { actor { entitySearch(query: $q) { results { entities { guid name type } } } } }`,
+		map[string]interface{}{"q": entityQuery}, &search)
+	if err != nil {
+		return 0, err
+	}
+	if len(search.Errors) > 0 {
+		return 0, fmt.Errorf("NerdGraph error: %s", search.Errors[0].Message)
+	}
+
+	deleted := 0
+	for _, entity := range search.Data.Actor.EntitySearch.Results.Entities {
+		if entity.Name != name {
+			continue
+		}
+
+		var mutation string
+		switch entity.Type {
+		case "DASHBOARD":
+			mutation = `mutation($guid: EntityGuid!) { dashboardDelete(guid: $guid) { status } }`
+		case "MONITOR":
+			mutation = `mutation($guid: EntityGuid!) { syntheticsDeleteMonitor(guid: $guid) { deletedGuid } }`
+		default:
+			continue
+		}
+
+		resp := graphQLResponse{}
+		if err := n.query(mutation, map[string]interface{}{"guid": entity.GUID}, &resp); err != nil {
+			return deleted, err
+		}
+		if len(resp.Errors) > 0 {
+			return deleted, fmt.Errorf("NerdGraph error: %s", resp.Errors[0].Message)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,66 @@
+package observability
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewRelic_Cleanup(t *testing.T) {
+	deleted := []string{}
+	failing := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("API-Key") != "key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		payload := struct {
+			Query     string            `json:"query"`
+			Variables map[string]string `json:"variables"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&payload)
+
+		if strings.Contains(payload.Query, "entitySearch") {
+			if payload.Variables["q"] != "name = 'preview-a' AND type IN ('DASHBOARD', 'MONITOR')" {
+				t.Errorf("Unexpected entity query %s", payload.Variables["q"])
+			}
+			// search isn't exact for names
+			fmt.Fprint(w, `{"data": {"actor": {"entitySearch": {"results": {"entities": [
+				{"guid": "g1", "name": "preview-a", "type": "DASHBOARD"},
+				{"guid": "g2", "name": "preview-a-2", "type": "DASHBOARD"},
+				{"guid": "g3", "name": "preview-a", "type": "MONITOR"},
+				{"guid": "g4", "name": "preview-a", "type": "APPLICATION"}
+			]}}}}}`)
+			return
+		}
+		guid := payload.Variables["guid"]
+		if guid == failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		deleted = append(deleted, guid)
+		fmt.Fprint(w, `{"data": {}}`)
+	}))
+	defer server.Close()
+
+	n := &NewRelic{APIKey: "key", URL: server.URL}
+	if count, err := n.Cleanup("preview-a"); count != 2 || err != nil {
+		t.Errorf("Expected 2 entities to be deleted, got %d (%v)", count, err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"g1", "g3"}) {
+		t.Errorf("Expected only dashboards and monitors with exact name to be deleted, got %v", deleted)
+	}
+
+	// failed deletion stops cleanup
+	deleted, failing = []string{}, "g1"
+	if count, err := n.Cleanup("preview-a"); count != 0 || err == nil {
+		t.Errorf("Expected error, got %d deleted", count)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("Expected nothing else to be deleted after failure, got %v", deleted)
+	}
+}
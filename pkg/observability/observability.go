@@ -0,0 +1,60 @@
+// Package observability deletes branch-scoped objects (dashboards, monitors, synthetic checks)
+// from observability tools after environment is removed, so they don't generate false alerts.
+package observability
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Cleaner deletes objects named after environment from a single observability tool
+type Cleaner interface {
+	// Name of the tool for logging
+	Name() string
+	// Cleanup deletes objects whose name equals to name and returns number of deleted objects
+	Cleanup(name string) (int, error)
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// doJSON sends request with optional JSON payload and decodes JSON response into out (if it's not nil);
+// response statuses other than 2xx are returned as errors
+func doJSON(method, url string, headers map[string]string, payload, out interface{}) error {
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, val := range headers {
+		req.Header.Set(name, val)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s responded with status %d: %s", method, url, resp.StatusCode, msg)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
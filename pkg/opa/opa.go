@@ -0,0 +1,58 @@
+// Package opa evaluates deletion policies written in Rego with Open Policy Agent server through its REST API
+package opa
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client calls Data API of OPA server
+type Client struct {
+	httpClient *http.Client
+	url        string
+}
+
+// NewClient returns client of OPA server at URL, e.g. "http://localhost:8181"
+func NewClient(url string, timeout time.Duration) *Client {
+	return &Client{httpClient: &http.Client{Timeout: timeout}, url: strings.TrimSuffix(url, "/")}
+}
+
+// Decision is result of policy, policy is expected to evaluate to object like {"allow": true, "reason": "..."}
+type Decision struct {
+	Allow  bool   `json:"allow"`
+	Reason string `json:"reason"`
+}
+
+// Decide evaluates document at path (e.g. "buhtig_s8k/deletion") with input. Decision is nil if document is undefined,
+// e.g. policy isn't loaded or none of its rules matched input.
+func (c *Client) Decide(path string, input interface{}) (*Decision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": input})
+	if err != nil {
+		return nil, err
+	}
+	apiURL := c.url + "/v1/data/" + strings.Trim(strings.Replace(path, ".", "/", -1), "/")
+	resp, err := c.httpClient.Post(apiURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: 1024})
+		return nil, fmt.Errorf("OPA responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	result := struct {
+		Result *Decision `json:"result"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("Policy %s should evaluate to object with 'allow' and 'reason' fields: %v", path, err)
+	}
+	return result.Result, nil
+}
@@ -0,0 +1,57 @@
+package opa
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDecide(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := struct {
+			Input map[string]string `json:"input"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/data/buhtig_s8k/deletion":
+			if request.Input["team"] == "payments" {
+				fmt.Fprint(w, `{"result": {"allow": false, "reason": "payments environments are deleted manually"}}`)
+				return
+			}
+			fmt.Fprint(w, `{"result": {"allow": true}}`)
+		case "/v1/data/buhtig_s8k/undefined":
+			fmt.Fprint(w, `{}`)
+		case "/v1/data/buhtig_s8k/boolean":
+			fmt.Fprint(w, `{"result": true}`)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL+"/", time.Second)
+
+	decision, err := c.Decide("buhtig_s8k/deletion", map[string]string{"team": "payments"})
+	if err != nil || decision == nil || decision.Allow || decision.Reason != "payments environments are deleted manually" {
+		t.Errorf("Expected deletion to be denied, got %+v, %v", decision, err)
+	}
+	decision, err = c.Decide("buhtig_s8k.deletion", map[string]string{"team": "frontend"})
+	if err != nil || decision == nil || !decision.Allow {
+		t.Errorf("Expected deletion to be allowed, got %+v, %v", decision, err)
+	}
+	if decision, err := c.Decide("buhtig_s8k/undefined", nil); err != nil || decision != nil {
+		t.Errorf("Expected undefined decision, got %+v, %v", decision, err)
+	}
+	if _, err := c.Decide("buhtig_s8k/boolean", nil); err == nil {
+		t.Error("Expected error for policy evaluating to boolean")
+	}
+	if _, err := c.Decide("buhtig_s8k/failing", nil); err == nil {
+		t.Error("Expected error for failed request")
+	}
+}
@@ -0,0 +1,192 @@
+package otlp
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// aggregation temporality of sums and histograms, Prometheus counters are cumulative
+const temporalityCumulative = 2
+
+// Meter exports metrics collected by Prometheus registry, so that the same metrics can be scraped and pushed.
+// Counters become monotonic sums, gauges and untyped metrics become gauges, histograms and summaries are kept as is.
+type Meter struct {
+	exporter *Exporter
+	name     string
+	gatherer prometheus.Gatherer
+	// start is start time of cumulative sums, i.e. when counters were zero
+	start time.Time
+}
+
+// NewMeter returns meter exporting metrics of gatherer with exporter, name is instrumentation scope of metrics
+func NewMeter(exporter *Exporter, name string, gatherer prometheus.Gatherer) *Meter {
+	return &Meter{exporter: exporter, name: name, gatherer: gatherer, start: time.Now()}
+}
+
+// Export gathers metrics and exports their current values
+func (m *Meter) Export() error {
+	families, err := m.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	now, start := unixNano(time.Now()), unixNano(m.start)
+
+	metrics := make([]metric, 0, len(families))
+	for _, family := range families {
+		converted := metric{Name: family.GetName(), Description: family.GetHelp()}
+		// type is compared by name, so that client_model needn't be a direct dependency
+		switch family.GetType().String() {
+		case "COUNTER":
+			converted.Sum = &sum{AggregationTemporality: temporalityCumulative, IsMonotonic: true}
+		case "GAUGE", "UNTYPED":
+			converted.Gauge = &gauge{}
+		case "HISTOGRAM":
+			converted.Histogram = &histogram{AggregationTemporality: temporalityCumulative}
+		case "SUMMARY":
+			converted.Summary = &summary{}
+		default:
+			continue
+		}
+
+		for _, sample := range family.GetMetric() {
+			labels := map[string]interface{}{}
+			for _, label := range sample.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			attrs := attributes(labels)
+
+			switch {
+			case converted.Sum != nil:
+				converted.Sum.DataPoints = append(converted.Sum.DataPoints, numberDataPoint{
+					Attributes: attrs, StartTimeUnixNano: start, TimeUnixNano: now, AsDouble: sample.GetCounter().GetValue(),
+				})
+			case converted.Gauge != nil:
+				value := sample.GetGauge().GetValue()
+				if sample.Untyped != nil {
+					value = sample.GetUntyped().GetValue()
+				}
+				converted.Gauge.DataPoints = append(converted.Gauge.DataPoints, numberDataPoint{
+					Attributes: attrs, TimeUnixNano: now, AsDouble: value,
+				})
+			case converted.Histogram != nil:
+				h := sample.GetHistogram()
+				var bounds []float64
+				var cumulative []uint64
+				for _, bucket := range h.GetBucket() {
+					bounds = append(bounds, bucket.GetUpperBound())
+					cumulative = append(cumulative, bucket.GetCumulativeCount())
+				}
+				bounds, counts := histogramBuckets(bounds, cumulative, h.GetSampleCount())
+				converted.Histogram.DataPoints = append(converted.Histogram.DataPoints, histogramDataPoint{
+					Attributes: attrs, StartTimeUnixNano: start, TimeUnixNano: now,
+					Count: fmt.Sprint(h.GetSampleCount()), Sum: h.GetSampleSum(), BucketCounts: counts, ExplicitBounds: bounds,
+				})
+			case converted.Summary != nil:
+				s := sample.GetSummary()
+				quantiles := []quantileValue{}
+				for _, q := range s.GetQuantile() {
+					quantiles = append(quantiles, quantileValue{Quantile: q.GetQuantile(), Value: q.GetValue()})
+				}
+				converted.Summary.DataPoints = append(converted.Summary.DataPoints, summaryDataPoint{
+					Attributes: attrs, StartTimeUnixNano: start, TimeUnixNano: now,
+					Count: fmt.Sprint(s.GetSampleCount()), Sum: s.GetSampleSum(), QuantileValues: quantiles,
+				})
+			}
+		}
+		metrics = append(metrics, converted)
+	}
+
+	type scopeMetrics struct {
+		Scope   scope    `json:"scope"`
+		Metrics []metric `json:"metrics"`
+	}
+	type resourceMetrics struct {
+		Resource     resource       `json:"resource"`
+		ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+	}
+	return m.exporter.export("/v1/metrics", map[string]interface{}{
+		"resourceMetrics": []resourceMetrics{{
+			Resource:     m.exporter.resource,
+			ScopeMetrics: []scopeMetrics{{Scope: scope{Name: m.name}, Metrics: metrics}},
+		}},
+	})
+}
+
+// histogramBuckets converts cumulative counts of Prometheus buckets to OTLP buckets, which count samples between
+// adjacent bounds and end with implicit +Inf bucket
+func histogramBuckets(bounds []float64, cumulative []uint64, total uint64) ([]float64, []string) {
+	explicit := []float64{}
+	counts := []string{}
+	var previous uint64
+	for i, bound := range bounds {
+		if math.IsInf(bound, 1) {
+			break
+		}
+		explicit = append(explicit, bound)
+		counts = append(counts, fmt.Sprint(cumulative[i]-previous))
+		previous = cumulative[i]
+	}
+	return explicit, append(counts, fmt.Sprint(total-previous))
+}
+
+type numberDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsDouble          float64    `json:"asDouble"`
+}
+
+type histogramDataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	Count             string     `json:"count"`
+	Sum               float64    `json:"sum"`
+	BucketCounts      []string   `json:"bucketCounts"`
+	ExplicitBounds    []float64  `json:"explicitBounds"`
+}
+
+type quantileValue struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+type summaryDataPoint struct {
+	Attributes        []keyValue      `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               float64         `json:"sum"`
+	QuantileValues    []quantileValue `json:"quantileValues"`
+}
+
+type gauge struct {
+	DataPoints []numberDataPoint `json:"dataPoints"`
+}
+
+type sum struct {
+	DataPoints             []numberDataPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type histogram struct {
+	DataPoints             []histogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type summary struct {
+	DataPoints []summaryDataPoint `json:"dataPoints"`
+}
+
+type metric struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Gauge       *gauge     `json:"gauge,omitempty"`
+	Sum         *sum       `json:"sum,omitempty"`
+	Histogram   *histogram `json:"histogram,omitempty"`
+	Summary     *summary   `json:"summary,omitempty"`
+}
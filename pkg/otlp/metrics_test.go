@@ -0,0 +1,62 @@
+package otlp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMeter_Export(t *testing.T) {
+	var path string
+	var received struct {
+		ResourceMetrics []struct {
+			ScopeMetrics []struct {
+				Metrics []metric `json:"metrics"`
+			} `json:"scopeMetrics"`
+		} `json:"resourceMetrics"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "deletions_total", Help: "Deletions."}, []string{"status"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "namespaces", Help: "Namespaces."})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "duration_seconds", Help: "Duration.", Buckets: []float64{1, 10}})
+	registry.MustRegister(counter, gauge, histogram)
+	counter.WithLabelValues("deleted").Add(2)
+	gauge.Set(5)
+	for _, v := range []float64{0.5, 5, 7, 100} {
+		histogram.Observe(v)
+	}
+
+	if err := NewMeter(NewExporter(server.URL, "buhtig-s8k", nil), "buhtig-s8k", registry).Export(); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/metrics" {
+		t.Errorf("Expected POST to metrics endpoint, got %s", path)
+	}
+
+	metrics := map[string]metric{}
+	for _, m := range received.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+	if c := metrics["deletions_total"].Sum; c == nil || !c.IsMonotonic || c.DataPoints[0].AsDouble != 2 ||
+		*c.DataPoints[0].Attributes[0].Value.StringValue != "deleted" {
+		t.Errorf("Expected counter to be monotonic sum with attributes, got %+v", metrics["deletions_total"])
+	}
+	if g := metrics["namespaces"].Gauge; g == nil || g.DataPoints[0].AsDouble != 5 {
+		t.Errorf("Expected gauge, got %+v", metrics["namespaces"])
+	}
+	h := metrics["duration_seconds"].Histogram
+	if h == nil || h.DataPoints[0].Count != "4" || !reflect.DeepEqual(h.DataPoints[0].BucketCounts, []string{"1", "2", "1"}) ||
+		!reflect.DeepEqual(h.DataPoints[0].ExplicitBounds, []float64{1, 10}) {
+		t.Errorf("Expected histogram with non-cumulative buckets, got %+v", metrics["duration_seconds"])
+	}
+}
@@ -0,0 +1,137 @@
+// Package otlp exports telemetry to OpenTelemetry collector (or any other OTLP receiver) with OTLP/HTTP in its
+// JSON encoding, which needs neither gRPC nor generated protobuf code
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Exporter sends telemetry of a single service to OTLP/HTTP endpoint
+type Exporter struct {
+	httpClient *http.Client
+	endpoint   string
+	headers    map[string]string
+	resource   resource
+}
+
+// NewExporter returns exporter to endpoint like "http://otel-collector:4318", headers are added to every request
+// (e.g. authentication of SaaS backends)
+func NewExporter(endpoint, serviceName string, headers map[string]string) *Exporter {
+	return &Exporter{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		headers:    headers,
+		resource:   resource{Attributes: attributes(map[string]interface{}{"service.name": serviceName})},
+	}
+}
+
+// ParseHeaders parses headers in format of OTEL_EXPORTER_OTLP_HEADERS, e.g. "api-key=secret,tenant=dev"
+func ParseHeaders(value string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("header should be like KEY=VALUE, got '%s'", pair)
+		}
+		headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return headers, nil
+}
+
+// export posts payload to signal path of endpoint, e.g. "/v1/traces"
+func (e *Exporter) export(path string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: 1024})
+		return fmt.Errorf("OTLP receiver responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// JSON representation of OTLP messages, see https://github.com/open-telemetry/opentelemetry-proto
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// attributes converts map to OTLP attributes ordered by key, unsupported values are formatted as strings
+func attributes(attrs map[string]interface{}) []keyValue {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]keyValue, 0, len(keys))
+	for _, key := range keys {
+		kv := keyValue{Key: key}
+		switch v := attrs[key].(type) {
+		case string:
+			kv.Value.StringValue = &v
+		case bool:
+			kv.Value.BoolValue = &v
+		case int:
+			s := fmt.Sprint(v)
+			kv.Value.IntValue = &s
+		case int64:
+			s := fmt.Sprint(v)
+			kv.Value.IntValue = &s
+		case float64:
+			kv.Value.DoubleValue = &v
+		default:
+			s := fmt.Sprint(v)
+			kv.Value.StringValue = &s
+		}
+		result = append(result, kv)
+	}
+	return result
+}
+
+// unixNano formats time as OTLP fixed64 timestamp, 64-bit integers are strings in JSON encoding
+func unixNano(t time.Time) string {
+	return fmt.Sprint(t.UnixNano())
+}
@@ -0,0 +1,202 @@
+package otlp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// maxBufferedSpans limits memory used by ended spans while receiver is unreachable, newer spans are dropped
+const maxBufferedSpans = 10000
+
+// Tracer records spans and exports them on Flush. Nil tracer is valid and records nothing, so that callers
+// don't need to check if tracing is enabled. It's safe for concurrent use.
+type Tracer struct {
+	exporter *Exporter
+	name     string
+
+	mu      sync.Mutex
+	ended   []*Span
+	dropped int
+}
+
+// NewTracer returns tracer exporting spans with exporter, name is instrumentation scope of spans
+func NewTracer(exporter *Exporter, name string) *Tracer {
+	return &Tracer{exporter: exporter, name: name}
+}
+
+// Span is an operation of trace. Nil span is valid and records nothing.
+type Span struct {
+	tracer   *Tracer
+	parent   *Span
+	traceID  string
+	spanID   string
+	name     string
+	start    time.Time
+	kindCode int
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes map[string]interface{}
+	err        error
+}
+
+// kinds of spans
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+)
+
+// Start starts span, it's a child of parent or root of new trace if parent is nil
+func (t *Tracer) Start(parent *Span, name string) *Span {
+	if t == nil {
+		return nil
+	}
+	span := &Span{tracer: t, parent: parent, spanID: randomID(8), name: name, start: time.Now(), kindCode: spanKindInternal, attributes: map[string]interface{}{}}
+	if parent != nil {
+		span.traceID = parent.traceID
+	} else {
+		span.traceID = randomID(16)
+	}
+	return span
+}
+
+// StartClient starts span of call to remote service, e.g. Github API
+func (t *Tracer) StartClient(parent *Span, name string) *Span {
+	span := t.Start(parent, name)
+	if span != nil {
+		span.kindCode = spanKindClient
+	}
+	return span
+}
+
+// TraceID returns hex ID of trace of span, it's empty for nil span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.traceID
+}
+
+// Parent returns parent of span, it's nil for root span
+func (s *Span) Parent() *Span {
+	if s == nil {
+		return nil
+	}
+	return s.parent
+}
+
+// SetAttribute sets attribute of span, value should be string, bool, int, int64 or float64
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = value
+}
+
+// End ends span with error status if err isn't nil, span is exported on the next Flush; subsequent calls do nothing
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	s.mu.Unlock()
+
+	t := s.tracer
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.ended) >= maxBufferedSpans {
+		t.dropped++
+		return
+	}
+	t.ended = append(t.ended, s)
+}
+
+// Flush exports ended spans; spans are discarded even if export fails, so that failing receiver can't exhaust memory.
+// It returns number of spans dropped since the previous Flush because buffer was full.
+func (t *Tracer) Flush() (dropped int, err error) {
+	if t == nil {
+		return 0, nil
+	}
+	t.mu.Lock()
+	spans, dropped := t.ended, t.dropped
+	t.ended, t.dropped = nil, 0
+	t.mu.Unlock()
+
+	if len(spans) == 0 {
+		return dropped, nil
+	}
+	return dropped, t.exporter.export("/v1/traces", t.payload(spans))
+}
+
+func (t *Tracer) payload(spans []*Span) interface{} {
+	type status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	type span struct {
+		TraceID           string     `json:"traceId"`
+		SpanID            string     `json:"spanId"`
+		ParentSpanID      string     `json:"parentSpanId,omitempty"`
+		Name              string     `json:"name"`
+		Kind              int        `json:"kind"`
+		StartTimeUnixNano string     `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+		Attributes        []keyValue `json:"attributes,omitempty"`
+		Status            status     `json:"status"`
+	}
+	type scopeSpans struct {
+		Scope scope  `json:"scope"`
+		Spans []span `json:"spans"`
+	}
+	type resourceSpans struct {
+		Resource   resource     `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+
+	converted := make([]span, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		c := span{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			Name:              s.name,
+			Kind:              s.kindCode,
+			StartTimeUnixNano: unixNano(s.start),
+			EndTimeUnixNano:   unixNano(s.end),
+			Attributes:        attributes(s.attributes),
+			// OK status is reserved for explicit confirmation by user, successful spans are left unset
+			Status: status{Code: 0},
+		}
+		if s.err != nil {
+			c.Status = status{Code: 2, Message: s.err.Error()}
+		}
+		s.mu.Unlock()
+		if s.parent != nil {
+			c.ParentSpanID = s.parent.spanID
+		}
+		converted = append(converted, c)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []resourceSpans{{
+			Resource:   t.exporter.resource,
+			ScopeSpans: []scopeSpans{{Scope: scope{Name: t.name}, Spans: converted}},
+		}},
+	}
+}
+
+// randomID returns hex-encoded random ID of n bytes
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,83 @@
+package otlp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracer_Flush(t *testing.T) {
+	var received map[string]interface{}
+	var path, apiKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, apiKey = r.URL.Path, r.Header.Get("api-key")
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	tracer := NewTracer(NewExporter(server.URL+"/", "buhtig-s8k", map[string]string{"api-key": "secret"}), "buhtig-s8k")
+	root := tracer.Start(nil, "iteration")
+	child := tracer.StartClient(root, "github.check-branch")
+	child.SetAttribute("http.status_code", 404)
+	child.End(errors.New("rate limit"))
+	child.End(nil)
+	root.End(nil)
+
+	if dropped, err := tracer.Flush(); err != nil || dropped != 0 {
+		t.Fatalf("Expected spans to be exported, got %d dropped (%v)", dropped, err)
+	}
+	if path != "/v1/traces" || apiKey != "secret" {
+		t.Errorf("Expected POST to traces endpoint with headers, got %s %s", path, apiKey)
+	}
+
+	rs := received["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	serviceName := rs["resource"].(map[string]interface{})["attributes"].([]interface{})[0].(map[string]interface{})
+	if serviceName["key"] != "service.name" {
+		t.Errorf("Expected service name in resource, got %v", serviceName)
+	}
+	spans := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	if len(spans) != 2 {
+		t.Fatalf("Expected child span to be exported once, got %v", spans)
+	}
+	exportedChild, exportedRoot := spans[0].(map[string]interface{}), spans[1].(map[string]interface{})
+	if exportedChild["traceId"] != root.TraceID() || exportedChild["parentSpanId"] != exportedRoot["spanId"] || len(root.TraceID()) != 32 {
+		t.Errorf("Expected child of root in the same trace, got %v and %v", exportedChild, exportedRoot)
+	}
+	if exportedChild["kind"].(float64) != spanKindClient || exportedChild["status"].(map[string]interface{})["message"] != "rate limit" {
+		t.Errorf("Expected failed client span, got %v", exportedChild)
+	}
+	attr := exportedChild["attributes"].([]interface{})[0].(map[string]interface{})
+	if attr["value"].(map[string]interface{})["intValue"] != "404" {
+		t.Errorf("Expected int attribute encoded as string, got %v", attr)
+	}
+
+	path = ""
+	if _, err := tracer.Flush(); err != nil || path != "" {
+		t.Errorf("Expected nothing to be exported without spans, got %s (%v)", path, err)
+	}
+}
+
+func TestTracer_Nil(t *testing.T) {
+	var tracer *Tracer
+	span := tracer.Start(nil, "iteration")
+	span.SetAttribute("namespaces", 1)
+	span.End(nil)
+	if span != nil || span.TraceID() != "" {
+		t.Errorf("Expected nil tracer to record nothing, got %v", span)
+	}
+	if _, err := tracer.Flush(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders("api-key=secret, tenant = dev=1,")
+	if err != nil || len(headers) != 2 || headers["api-key"] != "secret" || headers["tenant"] != "dev=1" {
+		t.Errorf("Unexpected headers %v (%v)", headers, err)
+	}
+	if _, err := ParseHeaders("api-key"); err == nil {
+		t.Error("Expected error for header without value")
+	}
+}
@@ -0,0 +1,96 @@
+// Package prometheus runs instant queries against Prometheus HTTP API
+package prometheus
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls Prometheus HTTP API
+type Client struct {
+	httpClient *http.Client
+	url        string
+}
+
+// NewClient returns client of Prometheus at URL, e.g. "http://prometheus.monitoring:9090"
+func NewClient(url string, timeout time.Duration) *Client {
+	return &Client{httpClient: &http.Client{Timeout: timeout}, url: strings.TrimSuffix(url, "/")}
+}
+
+// Sample is a single value of query result
+type Sample struct {
+	Metric map[string]string
+	Value  float64
+}
+
+// Query evaluates PromQL expression at current time; scalar result is returned as a single sample without labels
+func (c *Client) Query(query string) ([]Sample, error) {
+	resp, err := c.httpClient.PostForm(c.url+"/api/v1/query", url.Values{"query": {query}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("Prometheus responded with status %d: %v", resp.StatusCode, err)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("Prometheus query failed: %s", result.Error)
+	}
+
+	switch result.Data.ResultType {
+	case "vector":
+		vector := []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []interface{}     `json:"value"`
+		}{}
+		if err := json.Unmarshal(result.Data.Result, &vector); err != nil {
+			return nil, err
+		}
+		samples := []Sample{}
+		for _, v := range vector {
+			value, err := sampleValue(v.Value)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, Sample{Metric: v.Metric, Value: value})
+		}
+		return samples, nil
+	case "scalar":
+		var scalar []interface{}
+		if err := json.Unmarshal(result.Data.Result, &scalar); err != nil {
+			return nil, err
+		}
+		value, err := sampleValue(scalar)
+		if err != nil {
+			return nil, err
+		}
+		return []Sample{{Metric: map[string]string{}, Value: value}}, nil
+	}
+	return nil, fmt.Errorf("Query should return vector or scalar, got %s", result.Data.ResultType)
+}
+
+// sampleValue parses value of [timestamp, "value"] pair
+func sampleValue(pair []interface{}) (float64, error) {
+	if len(pair) != 2 {
+		return 0, fmt.Errorf("Malformed sample %v", pair)
+	}
+	s, ok := pair[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("Malformed sample value %v", pair[1])
+	}
+	return strconv.ParseFloat(s, 64)
+}
@@ -0,0 +1,47 @@
+package prometheus
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.FormValue("query") {
+		case "vector":
+			fmt.Fprint(w, `{"status": "success", "data": {"resultType": "vector", "result": [{"metric": {"host": "a.example.com"}, "value": [1562079845.123, "42.5"]}]}}`)
+		case "scalar":
+			fmt.Fprint(w, `{"status": "success", "data": {"resultType": "scalar", "result": [1562079845.123, "7"]}}`)
+		case "matrix":
+			fmt.Fprint(w, `{"status": "success", "data": {"resultType": "matrix", "result": []}}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status": "error", "errorType": "bad_data", "error": "parse error"}`)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL+"/", time.Second)
+
+	samples, err := c.Query("vector")
+	if err != nil || len(samples) != 1 || samples[0].Value != 42.5 || samples[0].Metric["host"] != "a.example.com" {
+		t.Errorf("Unexpected vector result %+v, %v", samples, err)
+	}
+	samples, err = c.Query("scalar")
+	if err != nil || len(samples) != 1 || samples[0].Value != 7 {
+		t.Errorf("Unexpected scalar result %+v, %v", samples, err)
+	}
+	if _, err := c.Query("matrix"); err == nil {
+		t.Error("Expected error for range vector")
+	}
+	if _, err := c.Query("invalid"); err == nil || err.Error() != "Prometheus query failed: parse error" {
+		t.Errorf("Expected query error, got %v", err)
+	}
+}
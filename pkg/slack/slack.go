@@ -0,0 +1,166 @@
+// Package slack posts interactive messages to Slack and verifies interaction callbacks sent by it
+package slack
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// headers Slack puts signature of request and its timestamp into
+const (
+	SignatureHeader = "X-Slack-Signature"
+	TimestampHeader = "X-Slack-Request-Timestamp"
+)
+
+// max age of signed request, older ones are rejected as replayed
+const maxRequestAge = 5 * time.Minute
+
+// Client calls Slack Web API with bot token
+type Client struct {
+	httpClient *http.Client
+	url        string
+	token      string
+}
+
+// NewClient returns client of Slack Web API authenticated with bot token (xoxb-...)
+func NewClient(token string) *Client {
+	return &Client{httpClient: &http.Client{Timeout: 30 * time.Second}, url: "https://slack.com/api", token: token}
+}
+
+// Message is a message with optional Block Kit layout
+type Message struct {
+	Channel string        `json:"channel,omitempty"`
+	Text    string        `json:"text"`
+	Blocks  []interface{} `json:"blocks,omitempty"`
+	// ReplaceOriginal replaces message which interaction came from when sent to its response URL
+	ReplaceOriginal bool `json:"replace_original,omitempty"`
+}
+
+// PostMessage posts message to its channel and returns timestamp of posted message which identifies it in the channel
+func (c *Client) PostMessage(msg Message) (string, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.url+"/chat.postMessage", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Slack API responded with status %d", resp.StatusCode)
+	}
+	// Web API responds with 200 even to failed calls, outcome is in 'ok' field
+	result := struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+		TS    string `json:"ts"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if !result.OK {
+		return "", fmt.Errorf("Slack API call failed: %s", result.Error)
+	}
+	return result.TS, nil
+}
+
+// Respond sends message to response URL of interaction, e.g. to replace message with buttons by the outcome of action
+func (c *Client) Respond(responseURL string, msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("Slack responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// VerifyRequest checks that body of request was signed by Slack with signing secret (v0 signature) not earlier than
+// 5 minutes before now; timestamp and signature are values of X-Slack-Request-Timestamp and X-Slack-Signature headers
+func VerifyRequest(secret string, timestamp string, body []byte, signature string, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("Timestamp is missing or malformed")
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > maxRequestAge || age < -maxRequestAge {
+		return errors.New("Timestamp is too far from current time")
+	}
+
+	if !strings.HasPrefix(signature, "v0=") {
+		return errors.New("Signature is missing or has unsupported format")
+	}
+	actual, err := hex.DecodeString(strings.TrimPrefix(signature, "v0="))
+	if err != nil {
+		return errors.New("Signature is not a valid hex string")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	if !hmac.Equal(actual, mac.Sum(nil)) {
+		return errors.New("Signature doesn't match")
+	}
+	return nil
+}
+
+// Action is a button clicked by user
+type Action struct {
+	ActionID string `json:"action_id"`
+	Value    string `json:"value"`
+}
+
+// Interaction is 'block_actions' payload sent when user clicks a button in message (only fields we're interested in)
+type Interaction struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Actions     []Action `json:"actions"`
+	ResponseURL string   `json:"response_url"`
+}
+
+// ParseInteraction parses body of interaction request, it's a form with JSON in 'payload' field
+func ParseInteraction(body []byte) (*Interaction, error) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	payload := form.Get("payload")
+	if payload == "" {
+		return nil, errors.New("Payload is missing")
+	}
+	var interaction Interaction
+	if err := json.Unmarshal([]byte(payload), &interaction); err != nil {
+		return nil, err
+	}
+	return &interaction, nil
+}
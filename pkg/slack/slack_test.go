@@ -0,0 +1,111 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyRequest(t *testing.T) {
+	now := time.Unix(1531420618, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := []byte("payload=%7B%7D")
+
+	if err := VerifyRequest("secret", ts, body, sign("secret", ts, body), now); err != nil {
+		t.Errorf("Expected valid signature, got %v", err)
+	}
+	if err := VerifyRequest("other", ts, body, sign("secret", ts, body), now); err == nil {
+		t.Error("Expected error for signature made with another secret")
+	}
+	if err := VerifyRequest("secret", ts, []byte("payload=x"), sign("secret", ts, body), now); err == nil {
+		t.Error("Expected error for tampered body")
+	}
+	if err := VerifyRequest("secret", ts, body, sign("secret", ts, body), now.Add(10*time.Minute)); err == nil {
+		t.Error("Expected error for stale request")
+	}
+	if err := VerifyRequest("secret", "", body, sign("secret", ts, body), now); err == nil {
+		t.Error("Expected error for missing timestamp")
+	}
+	if err := VerifyRequest("secret", ts, body, "sha256=abc", now); err == nil {
+		t.Error("Expected error for unsupported signature format")
+	}
+}
+
+func TestParseInteraction(t *testing.T) {
+	payload := `{"type":"block_actions","user":{"id":"U1","username":"jdoe"},"actions":[{"action_id":"approve","value":"feature-a"}],"response_url":"https://hooks.slack.com/actions/1"}`
+	interaction, err := ParseInteraction([]byte("payload=" + url.QueryEscape(payload)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interaction.User.Username != "jdoe" || len(interaction.Actions) != 1 || interaction.Actions[0].ActionID != "approve" ||
+		interaction.Actions[0].Value != "feature-a" || interaction.ResponseURL != "https://hooks.slack.com/actions/1" {
+		t.Errorf("Unexpected interaction %+v", interaction)
+	}
+
+	if _, err := ParseInteraction([]byte("other=1")); err == nil {
+		t.Error("Expected error for missing payload")
+	}
+}
+
+func TestClient(t *testing.T) {
+	var responded Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chat.postMessage":
+			if r.Header.Get("Authorization") != "Bearer xoxb-token" {
+				fmt.Fprint(w, `{"ok": false, "error": "invalid_auth"}`)
+				return
+			}
+			var msg Message
+			json.NewDecoder(r.Body).Decode(&msg)
+			if msg.Channel != "#envs" || len(msg.Blocks) != 1 {
+				fmt.Fprint(w, `{"ok": false, "error": "invalid_blocks"}`)
+				return
+			}
+			fmt.Fprint(w, `{"ok": true, "ts": "1503435956.000247"}`)
+		case "/response":
+			json.NewDecoder(r.Body).Decode(&responded)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient("xoxb-token")
+	c.url = server.URL
+
+	ts, err := c.PostMessage(Message{Channel: "#envs", Text: "hello", Blocks: []interface{}{map[string]string{"type": "divider"}}})
+	if err != nil || ts != "1503435956.000247" {
+		t.Errorf("Expected message to be posted, got '%s', %v", ts, err)
+	}
+
+	c.token = "wrong"
+	if _, err := c.PostMessage(Message{Channel: "#envs", Text: "hello"}); err == nil {
+		t.Error("Expected error for failed API call")
+	}
+
+	if err := c.Respond(server.URL+"/response", Message{Text: "done", ReplaceOriginal: true}); err != nil {
+		t.Fatal(err)
+	}
+	if responded.Text != "done" || !responded.ReplaceOriginal {
+		t.Errorf("Unexpected response %+v", responded)
+	}
+	if err := c.Respond(server.URL+"/missing", Message{Text: "done"}); err == nil {
+		t.Error("Expected error for failed response")
+	}
+}
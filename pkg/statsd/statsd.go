@@ -0,0 +1,151 @@
+// Package statsd emits metrics collected by Prometheus registry to StatsD or DogStatsD agent, so that the same
+// metric set is available without Prometheus
+package statsd
+
+import (
+	"bytes"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxPacketSize keeps UDP packets below common MTU, so that metrics aren't lost to fragmentation
+const maxPacketSize = 1432
+
+// Emitter sends current values of metrics on Emit. Counters are sent as increments since the previous Emit,
+// gauges as values; histograms and summaries are sent as counters of their count and sum.
+type Emitter struct {
+	conn      net.Conn
+	prefix    string
+	dogstatsd bool
+	gatherer  prometheus.Gatherer
+
+	mu sync.Mutex
+	// previous holds values of counters sent by the previous Emit by line key
+	previous map[string]float64
+}
+
+// NewEmitter returns emitter to agent at UDP address like "localhost:8125". With dogstatsd labels are sent as
+// tags, otherwise (plain StatsD doesn't support tags) label values are appended to metric name.
+func NewEmitter(addr, prefix string, dogstatsd bool, gatherer prometheus.Gatherer) (*Emitter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Emitter{conn: conn, prefix: prefix, dogstatsd: dogstatsd, gatherer: gatherer, previous: map[string]float64{}}, nil
+}
+
+// Emit gathers metrics and sends them to agent
+func (e *Emitter) Emit() error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var lines []string
+	for _, family := range families {
+		name := e.prefix + family.GetName()
+		for _, sample := range family.GetMetric() {
+			var names, values []string
+			for _, label := range sample.GetLabel() {
+				names = append(names, label.GetName())
+				values = append(values, label.GetValue())
+			}
+			metric := e.metric(names, values)
+
+			// type is compared by name, so that client_model needn't be a direct dependency
+			switch family.GetType().String() {
+			case "COUNTER":
+				lines = append(lines, e.counter(name, metric, sample.GetCounter().GetValue()))
+			case "GAUGE":
+				lines = append(lines, e.line(name, metric, sample.GetGauge().GetValue(), "g"))
+			case "UNTYPED":
+				lines = append(lines, e.line(name, metric, sample.GetUntyped().GetValue(), "g"))
+			case "HISTOGRAM":
+				h := sample.GetHistogram()
+				lines = append(lines, e.counter(name+"_count", metric, float64(h.GetSampleCount())))
+				lines = append(lines, e.counter(name+"_sum", metric, h.GetSampleSum()))
+			case "SUMMARY":
+				s := sample.GetSummary()
+				lines = append(lines, e.counter(name+"_count", metric, float64(s.GetSampleCount())))
+				lines = append(lines, e.counter(name+"_sum", metric, s.GetSampleSum()))
+			}
+		}
+	}
+	return e.send(lines)
+}
+
+// metric is how labels are encoded: DogStatsD tags or suffix of metric name
+type metric struct {
+	suffix string
+	tags   string
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_\-.]`)
+
+func (e *Emitter) metric(names, values []string) metric {
+	if len(names) == 0 {
+		return metric{}
+	}
+	if !e.dogstatsd {
+		var suffix string
+		for _, value := range values {
+			suffix += "." + invalidNameChars.ReplaceAllString(value, "_")
+		}
+		return metric{suffix: suffix}
+	}
+	tags := make([]string, len(names))
+	for i := range names {
+		// characters of protocol can't be escaped
+		tags[i] = names[i] + ":" + strings.NewReplacer("|", "_", ",", "_", "#", "_").Replace(values[i])
+	}
+	return metric{tags: "|#" + strings.Join(tags, ",")}
+}
+
+func (e *Emitter) line(name string, m metric, value float64, kind string) string {
+	return name + m.suffix + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind + m.tags
+}
+
+// counter returns line with increment of counter since the previous Emit; counter which decreased (e.g. app
+// restarted with the same emitter) is sent as is
+func (e *Emitter) counter(name string, m metric, value float64) string {
+	key := name + m.suffix + m.tags
+	delta := value - e.previous[key]
+	if delta < 0 {
+		delta = value
+	}
+	e.previous[key] = value
+	return e.line(name, m, delta, "c")
+}
+
+// send packs lines into as few packets as possible
+func (e *Emitter) send(lines []string) error {
+	var packet bytes.Buffer
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := e.conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxPacketSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	return flush()
+}
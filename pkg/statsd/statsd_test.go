@@ -0,0 +1,79 @@
+package statsd
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestEmitter_Emit(t *testing.T) {
+	for _, tc := range []struct {
+		dogstatsd bool
+		expected  []string
+	}{
+		{true, []string{
+			"app_deletions_total:2|c|#status:deleted",
+			"app_duration_seconds_count:2|c",
+			"app_duration_seconds_sum:1.5|c",
+			"app_namespaces:5|g",
+		}},
+		{false, []string{
+			"app_deletions_total.deleted:2|c",
+			"app_duration_seconds_count:2|c",
+			"app_duration_seconds_sum:1.5|c",
+			"app_namespaces:5|g",
+		}},
+	} {
+		agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer agent.Close()
+
+		registry := prometheus.NewRegistry()
+		counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "deletions_total", Help: "Deletions."}, []string{"status"})
+		gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "namespaces", Help: "Namespaces."})
+		histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "duration_seconds", Help: "Duration."})
+		registry.MustRegister(counter, gauge, histogram)
+		counter.WithLabelValues("deleted").Add(2)
+		gauge.Set(5)
+		histogram.Observe(0.5)
+		histogram.Observe(1)
+
+		emitter, err := NewEmitter(agent.LocalAddr().String(), "app_", tc.dogstatsd, registry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := emitter.Emit(); err != nil {
+			t.Fatal(err)
+		}
+		if lines := receive(t, agent); strings.Join(lines, "\n") != strings.Join(tc.expected, "\n") {
+			t.Errorf("Expected %v, got %v", tc.expected, lines)
+		}
+
+		// counters are sent as increments
+		counter.WithLabelValues("deleted").Inc()
+		if err := emitter.Emit(); err != nil {
+			t.Fatal(err)
+		}
+		if lines := receive(t, agent); lines[0] != strings.Replace(tc.expected[0], ":2|", ":1|", 1) || lines[1] != "app_duration_seconds_count:0|c" {
+			t.Errorf("Expected increments since previous emit, got %v", lines)
+		}
+	}
+}
+
+func receive(t *testing.T, agent net.PacketConn) []string {
+	buf := make([]byte, maxPacketSize)
+	agent.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := agent.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(buf[:n]), "\n")
+	sort.Strings(lines)
+	return lines
+}
@@ -0,0 +1,172 @@
+// Package terraform queues destroy runs in Terraform Cloud/Enterprise workspaces
+package terraform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const contentType = "application/vnd.api+json"
+
+// statuses of run which are final
+const (
+	StatusApplied            = "applied"
+	StatusPlannedAndFinished = "planned_and_finished"
+	StatusErrored            = "errored"
+	StatusCanceled           = "canceled"
+	StatusForceCanceled      = "force_canceled"
+	StatusDiscarded          = "discarded"
+)
+
+// Client calls Terraform Cloud (or Enterprise) API v2
+type Client struct {
+	httpClient *http.Client
+	url        string
+	token      string
+}
+
+// NewClient returns client of Terraform Cloud at URL (e.g. https://app.terraform.io) authorized with team or user token
+func NewClient(url, token string) *Client {
+	return &Client{httpClient: &http.Client{Timeout: 30 * time.Second}, url: strings.TrimSuffix(url, "/"), token: token}
+}
+
+// Run is state of run
+type Run struct {
+	ID     string
+	Status string
+	// Confirmable is true if run waits for confirmation to apply
+	Confirmable bool
+}
+
+// IsFinished checks if run reached final status
+func (r *Run) IsFinished() bool {
+	switch r.Status {
+	case StatusApplied, StatusPlannedAndFinished, StatusErrored, StatusCanceled, StatusForceCanceled, StatusDiscarded:
+		return true
+	}
+	return false
+}
+
+// IsSucceeded checks if run finished successfully, i.e. resources are destroyed or there was nothing to destroy
+func (r *Run) IsSucceeded() bool {
+	return r.Status == StatusApplied || r.Status == StatusPlannedAndFinished
+}
+
+// Workspace is workspace of organization
+type Workspace struct {
+	ID   string
+	Name string
+	Tags []string
+}
+
+// HasTag checks if workspace is tagged with tag
+func (w *Workspace) HasTag(tag string) bool {
+	for _, t := range w.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// GetWorkspace returns workspace of organization, it's nil if workspace doesn't exist
+func (c *Client) GetWorkspace(organization, workspace string) (*Workspace, error) {
+	resp := struct {
+		Data struct {
+			ID         string `json:"id"`
+			Attributes struct {
+				Name     string   `json:"name"`
+				TagNames []string `json:"tag-names"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}{}
+	status, err := c.do(http.MethodGet, fmt.Sprintf("/api/v2/organizations/%s/workspaces/%s", url.PathEscape(organization), url.PathEscape(workspace)), nil, &resp)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Workspace{ID: resp.Data.ID, Name: resp.Data.Attributes.Name, Tags: resp.Data.Attributes.TagNames}, nil
+}
+
+// CreateDestroyRun queues destroy run in workspace which is applied automatically and returns its ID
+func (c *Client) CreateDestroyRun(workspaceID, message string) (string, error) {
+	payload := map[string]interface{}{
+		"data": map[string]interface{}{
+			"type":       "runs",
+			"attributes": map[string]interface{}{"is-destroy": true, "auto-apply": true, "message": message},
+			"relationships": map[string]interface{}{
+				"workspace": map[string]interface{}{"data": map[string]string{"type": "workspaces", "id": workspaceID}},
+			},
+		},
+	}
+	resp := struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}{}
+	_, err := c.do(http.MethodPost, "/api/v2/runs", payload, &resp)
+	return resp.Data.ID, err
+}
+
+// GetRun returns state of run
+func (c *Client) GetRun(id string) (*Run, error) {
+	resp := struct {
+		Data struct {
+			ID         string `json:"id"`
+			Attributes struct {
+				Status  string `json:"status"`
+				Actions struct {
+					IsConfirmable bool `json:"is-confirmable"`
+				} `json:"actions"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}{}
+	if _, err := c.do(http.MethodGet, "/api/v2/runs/"+url.PathEscape(id), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &Run{ID: resp.Data.ID, Status: resp.Data.Attributes.Status, Confirmable: resp.Data.Attributes.Actions.IsConfirmable}, nil
+}
+
+// ApplyRun confirms run which waits for confirmation (e.g. when workspace or older Terraform Enterprise ignores auto-apply)
+func (c *Client) ApplyRun(id, comment string) error {
+	_, err := c.do(http.MethodPost, "/api/v2/runs/"+url.PathEscape(id)+"/actions/apply", map[string]string{"comment": comment}, nil)
+	return err
+}
+
+// do sends request and decodes response into out; status is returned even if it's an error
+func (c *Client) do(method, path string, payload, out interface{}) (int, error) {
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return 0, err
+		}
+	}
+	req, err := http.NewRequest(method, c.url+path, &body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, fmt.Errorf("Terraform Cloud %s %s responded with status %d: %s", method, path, resp.StatusCode, msg)
+	}
+	if out == nil {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,71 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	var created map[string]interface{}
+	applied := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v2/organizations/org/workspaces/preview-a":
+			fmt.Fprint(w, `{"data": {"id": "ws-1", "type": "workspaces", "attributes": {"name": "preview-a", "tag-names": ["preview"]}}}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v2/organizations/org/workspaces/gone":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v2/runs":
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"data": {"id": "run-1", "type": "runs"}}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v2/runs/run-1":
+			fmt.Fprint(w, `{"data": {"id": "run-1", "attributes": {"status": "planned", "actions": {"is-confirmable": true}}}}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v2/runs/run-1/actions/apply":
+			applied = true
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL+"/", "token")
+	if workspace, err := c.GetWorkspace("org", "gone"); workspace != nil || err != nil {
+		t.Errorf("Expected no workspace, got %+v (%v)", workspace, err)
+	}
+	workspace, err := c.GetWorkspace("org", "preview-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workspace.ID != "ws-1" || workspace.Name != "preview-a" || !workspace.HasTag("preview") || workspace.HasTag("prod") {
+		t.Fatalf("Unexpected workspace %+v", workspace)
+	}
+
+	runID, err := c.CreateDestroyRun(workspace.ID, "destroy")
+	if runID != "run-1" || err != nil {
+		t.Fatalf("Expected run run-1, got %s (%v)", runID, err)
+	}
+	attributes := created["data"].(map[string]interface{})["attributes"].(map[string]interface{})
+	if attributes["is-destroy"] != true {
+		t.Errorf("Expected destroy run, got %v", attributes)
+	}
+
+	run, err := c.GetRun(runID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.IsFinished() || !run.Confirmable {
+		t.Errorf("Unexpected run %+v", run)
+	}
+	if err := c.ApplyRun(runID, "apply"); err != nil || !applied {
+		t.Errorf("Expected run to be applied, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package vcs
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// pull request states providers report, provider-specific states are mapped to them
+const (
+	StateOpen   = "open"
+	StateClosed = "closed"
+	StateMerged = "merged"
+)
+
+// ErrNotSupported is returned by providers for operations their VCS doesn't offer
+var ErrNotSupported = errors.New("operation is not supported by VCS provider")
+
+// PullRequest describes pull (merge) request created from branch
+type PullRequest struct {
+	Number int
+	// State is one of State* constants
+	State string
+	URL   string
+}
+
+// Provider checks branches referenced by source URLs of single VCS (e.g. Github, GitLab);
+// statuses are in terms of HTTP, so that 404 means branch (repository) doesn't exist
+type Provider interface {
+	// Name is short name of provider used in logs, e.g. "github"
+	Name() string
+	// Match checks if URL points to branch of this provider, it's usually decided by host of URL
+	Match(sourceURL *url.URL) bool
+	// CheckBranch returns status of branch referenced by source URL
+	CheckBranch(sourceURL string) (int, error)
+	// CheckRepo returns status of repository of branch referenced by source URL
+	CheckRepo(sourceURL string) (int, error)
+	// CheckPR returns the most recently updated pull request created from branch, nil if there's none
+	CheckPR(sourceURL string) (*PullRequest, error)
+}
+
+// RateLimiter is implemented by providers which know when their API budget is exhausted
+type RateLimiter interface {
+	// RateLimitedUntil returns time when exhausted rate limit resets, zero time means requests can be sent
+	RateLimitedUntil() time.Time
+}
+
+// Registry selects provider by source URL or by name. It's safe for concurrent use.
+type Registry struct {
+	mu        sync.RWMutex
+	providers []Provider
+	named     map[string]Provider
+}
+
+// NewRegistry returns empty registry
+func NewRegistry() *Registry {
+	return &Registry{named: map[string]Provider{}}
+}
+
+// Register adds provider available both for auto-detection and by its name; providers are matched
+// in order of registration, so more specific ones (e.g. configured self-hosted instances) should go first
+func (r *Registry) Register(p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers = append(r.providers, p)
+	if _, ok := r.named[p.Name()]; !ok {
+		r.named[p.Name()] = p
+	}
+}
+
+// RegisterNamed adds provider which is available only by name (it's excluded from auto-detection),
+// e.g. instance with its own credentials selected explicitly for some namespaces
+func (r *Registry) RegisterNamed(name string, p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.named[name] = p
+}
+
+// Named returns provider registered under name
+func (r *Registry) Named(name string) (Provider, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.named[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown VCS provider '%s'", name)
+	}
+	return p, nil
+}
+
+// Lookup returns the first provider matching source URL
+func (r *Registry) Lookup(sourceURL string) (Provider, error) {
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, p := range r.providers {
+		if p.Match(u) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("No VCS provider matches URL %s", sourceURL)
+}
@@ -0,0 +1,59 @@
+package vcs
+
+import (
+	"net/url"
+	"testing"
+)
+
+type fakeProvider struct {
+	name string
+	host string
+}
+
+func (p fakeProvider) Name() string                         { return p.name }
+func (p fakeProvider) Match(u *url.URL) bool                { return p.host == "" || u.Host == p.host }
+func (p fakeProvider) CheckBranch(string) (int, error)      { return 200, nil }
+func (p fakeProvider) CheckRepo(string) (int, error)        { return 200, nil }
+func (p fakeProvider) CheckPR(string) (*PullRequest, error) { return nil, ErrNotSupported }
+
+func TestRegistry_Lookup(t *testing.T) {
+	r := NewRegistry()
+	r.Register(fakeProvider{name: "self-hosted", host: "git.example.com"})
+	r.Register(fakeProvider{name: "fallback"})
+
+	for sourceURL, expected := range map[string]string{
+		"https://git.example.com/owner/repo/tree/branch": "self-hosted",
+		"https://github.com/owner/repo/tree/branch":      "fallback",
+	} {
+		p, err := r.Lookup(sourceURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Name() != expected {
+			t.Errorf("Expected provider '%s' for %s, but got '%s'", expected, sourceURL, p.Name())
+		}
+	}
+
+	if _, err := NewRegistry().Lookup("https://github.com/owner/repo/tree/branch"); err == nil {
+		t.Errorf("Expected error when no provider matches")
+	}
+}
+
+func TestRegistry_Named(t *testing.T) {
+	r := NewRegistry()
+	r.Register(fakeProvider{name: "github", host: "github.com"})
+	r.RegisterNamed("ghe-internal", fakeProvider{name: "github", host: "ghe.example.com"})
+
+	if p, err := r.Named("github"); err != nil || p.(fakeProvider).host != "github.com" {
+		t.Errorf("Expected auto-detected provider to be available by its name, but got %+v (%v)", p, err)
+	}
+	if p, err := r.Named("ghe-internal"); err != nil || p.(fakeProvider).host != "ghe.example.com" {
+		t.Errorf("Expected named provider, but got %+v (%v)", p, err)
+	}
+	if _, err := r.Lookup("https://ghe.example.com/owner/repo/tree/branch"); err == nil {
+		t.Errorf("Named provider shouldn't take part in auto-detection")
+	}
+	if _, err := r.Named("unknown"); err == nil {
+		t.Errorf("Expected error for unknown provider")
+	}
+}
@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SignatureHeader is the header Github puts HMAC-SHA256 signature of payload into
+const SignatureHeader = "X-Hub-Signature-256"
+
+// DeliveryHeader is the header with unique ID of webhook delivery
+const DeliveryHeader = "X-GitHub-Delivery"
+
+// Sign returns HMAC-SHA256 signature of body for secret in the format of X-Hub-Signature-256 header,
+// it's used to sign webhooks sent by the app
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks that signature (value of X-Hub-Signature-256 header, like "sha256=HEX")
+// is a valid HMAC-SHA256 of body for secret
+func VerifySignature(secret, body []byte, signature string) error {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return errors.New("Signature is missing or has unsupported format")
+	}
+	actual, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return errors.New("Signature is not a valid hex string")
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if !hmac.Equal(actual, mac.Sum(nil)) {
+		return errors.New("Signature doesn't match")
+	}
+	return nil
+}
+
+// Digest returns SHA-256 of payload, it identifies signed content of delivery since delivery ID header isn't signed
+func Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// DeliveryCache remembers IDs (or digests) of processed deliveries for some time in order to reject replayed ones.
+// It's safe for concurrent use.
+type DeliveryCache struct {
+	ttl     time.Duration
+	maxSize int
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewDeliveryCache returns cache which remembers up to maxSize deliveries for ttl
+func NewDeliveryCache(ttl time.Duration, maxSize int) *DeliveryCache {
+	return &DeliveryCache{ttl: ttl, maxSize: maxSize, seen: map[string]time.Time{}}
+}
+
+// Seen records delivery ID and returns true if it was already recorded before
+func (c *DeliveryCache) Seen(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if at, ok := c.seen[id]; ok && now.Sub(at) < c.ttl {
+		return true
+	}
+
+	if len(c.seen) >= c.maxSize {
+		c.evict(now)
+	}
+	c.seen[id] = now
+	return false
+}
+
+// evict removes expired entries; if cache is still full then the oldest entry is removed
+func (c *DeliveryCache) evict(now time.Time) {
+	oldestID, oldestAt := "", now
+	for id, at := range c.seen {
+		if now.Sub(at) >= c.ttl {
+			delete(c.seen, id)
+			continue
+		}
+		if at.Before(oldestAt) {
+			oldestID, oldestAt = id, at
+		}
+	}
+	if len(c.seen) >= c.maxSize {
+		delete(c.seen, oldestID)
+	}
+}
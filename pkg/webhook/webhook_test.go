@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	secret := []byte("It's a Secret to Everybody")
+	body := []byte("Hello, World!")
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if err := VerifySignature(secret, body, signature); err != nil {
+		t.Errorf("Expected valid signature, but got %v", err)
+	}
+	if err := VerifySignature(secret, []byte("Hello, World?"), signature); err == nil {
+		t.Errorf("Expected error for tampered body")
+	}
+	if err := VerifySignature([]byte("wrong"), body, signature); err == nil {
+		t.Errorf("Expected error for wrong secret")
+	}
+	if err := VerifySignature(secret, body, ""); err == nil {
+		t.Errorf("Expected error for missing signature")
+	}
+	if err := VerifySignature(secret, body, Sign(secret, body)); err != nil {
+		t.Errorf("Expected valid signature of Sign, but got %v", err)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	if Digest([]byte("one")) == Digest([]byte("two")) || Digest([]byte("one")) != Digest([]byte("one")) {
+		t.Error("Expected digest to identify payload")
+	}
+}
+
+func TestDeliveryCache(t *testing.T) {
+	c := NewDeliveryCache(time.Hour, 2)
+
+	if c.Seen("one") {
+		t.Errorf("Expected 'one' to be new")
+	}
+	if !c.Seen("one") {
+		t.Errorf("Expected 'one' to be replayed")
+	}
+
+	c.Seen("two")
+	c.Seen("three") // evicts 'one' as the oldest entry
+
+	if len(c.seen) != 2 {
+		t.Errorf("Expected cache size 2, but got %d", len(c.seen))
+	}
+	if !c.Seen("three") {
+		t.Errorf("Expected 'three' to be replayed")
+	}
+}